@@ -0,0 +1,89 @@
+// Command coins-audit verifies the hash chain of the audit log of the coins service.
+//
+// Usage:
+//
+//	coins-audit verify
+//
+// It connects to Postgres with the POSTGRES_* variables of the service and exits with status 1
+// if the chain is broken, i.e. a record was changed, inserted or removed.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/donmikel/coins/pkg/audit"
+	"github.com/donmikel/coins/pkg/storage"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/kelseyhightower/envconfig"
+)
+
+type configuration struct {
+	BatchSize int `envconfig:"AUDIT_VERIFY_BATCH_SIZE" default:"1000"`
+
+	PostgresAddress  string `envconfig:"POSTGRES_ADDRESS" required:"true"`
+	PostgresDatabase string `envconfig:"POSTGRES_DATABASE" required:"true"`
+	PostgresUser     string `envconfig:"POSTGRES_USER" required:"true"`
+	PostgresPassword string `envconfig:"POSTGRES_PASSWORD" required:"true"`
+}
+
+func main() {
+	logger := log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr))
+	logger = log.With(logger, "ts", log.DefaultTimestampUTC)
+
+	if len(os.Args) != 2 || os.Args[1] != "verify" {
+		fmt.Fprintln(os.Stderr, "usage: coins-audit verify")
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-c
+		cancel()
+	}()
+
+	if err := verify(ctx, logger); err != nil {
+		level.Error(logger).Log("msg", "audit log verification failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func verify(ctx context.Context, logger log.Logger) error {
+	var cfg configuration
+	if err := envconfig.Process("", &cfg); err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if cfg.BatchSize <= 0 || cfg.BatchSize > audit.MaxLimit {
+		return fmt.Errorf("batch size must be between 1 and %d", audit.MaxLimit)
+	}
+
+	s, err := storage.New(storage.Config{
+		PostgresAddress:  cfg.PostgresAddress,
+		PostgresDatabase: cfg.PostgresDatabase,
+		PostgresPassword: cfg.PostgresPassword,
+		PostgresUser:     cfg.PostgresUser,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage: %w", err)
+	}
+	defer func() {
+		if err := s.Close(); err != nil {
+			level.Error(logger).Log("msg", "failed to close storage", "err", err)
+		}
+	}()
+
+	n, err := audit.VerifyStore(ctx, s, cfg.BatchSize)
+	if err != nil {
+		return fmt.Errorf("verified %d records: %w", n, err)
+	}
+	level.Info(logger).Log("msg", "audit log verified", "records", n)
+
+	return nil
+}
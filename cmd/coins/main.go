@@ -2,29 +2,90 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/donmikel/coins/pkg/auth"
 	"github.com/donmikel/coins/pkg/coinssvc"
+	"github.com/donmikel/coins/pkg/event"
+	"github.com/donmikel/coins/pkg/feed"
+	"github.com/donmikel/coins/pkg/fx"
+	"github.com/donmikel/coins/pkg/hold"
+	"github.com/donmikel/coins/pkg/pending"
+	"github.com/donmikel/coins/pkg/risk"
+	"github.com/donmikel/coins/pkg/schedule"
 	"github.com/donmikel/coins/pkg/storage"
+	"github.com/donmikel/coins/pkg/webhook"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/shopspring/decimal"
 	"golang.org/x/sync/errgroup"
 )
 
 const metricPrefix = "coins_payments"
 
+// memoryPublisherSize is the number of the last events kept by the in-memory publisher.
+const memoryPublisherSize = 1000
+
 type configuration struct {
 	Port            string        `envconfig:"PORT" required:"true"`
+	GRPCPort        string        `envconfig:"GRPC_PORT" default:"9090"`
+	AdminPort       string        `envconfig:"ADMIN_PORT" default:"8081"`
 	ReadTimeout     time.Duration `envconfig:"READ_TIMEOUT" default:"1s"`
 	WriteTimeout    time.Duration `envconfig:"WRITE_TIMEOUT" default:"1s"`
 	ShutdownTimeout time.Duration `envconfig:"SHUTDOWN_TIMEOUT" default:"1s"`
 	AllowedOrigins  []string      `envconfig:"ALLOWED_ORIGINS"`
 
+	TrustProxyHeaders bool `envconfig:"TRUST_PROXY_HEADERS" default:"false"`
+
+	AuthDisabled bool   `envconfig:"AUTH_DISABLED" default:"false"`
+	JWKSFile     string `envconfig:"JWKS_FILE"`
+	JWTIssuer    string `envconfig:"JWT_ISSUER"`
+	JWTAudience  string `envconfig:"JWT_AUDIENCE"`
+
+	FXRates     map[string]string `envconfig:"FX_RATES"`
+	FXRatesFile string            `envconfig:"FX_RATES_FILE"`
+	FXQuoteTTL  time.Duration     `envconfig:"FX_QUOTE_TTL" default:"30s"`
+
+	SchedulePollInterval time.Duration `envconfig:"SCHEDULE_POLL_INTERVAL" default:"10s"`
+	ScheduleMaxAttempts  int           `envconfig:"SCHEDULE_MAX_ATTEMPTS" default:"3"`
+	ScheduleRetryDelay   time.Duration `envconfig:"SCHEDULE_RETRY_DELAY" default:"1m"`
+
+	StreamBuffer int `envconfig:"STREAM_BUFFER" default:"100"`
+
+	HoldTTL           time.Duration `envconfig:"HOLD_TTL" default:"168h"`
+	HoldMaxTTL        time.Duration `envconfig:"HOLD_MAX_TTL" default:"720h"`
+	HoldSweepInterval time.Duration `envconfig:"HOLD_SWEEP_INTERVAL" default:"1m"`
+
+	EventsPublisher      string        `envconfig:"EVENTS_PUBLISHER" default:"memory"`
+	EventsWebhookURL     string        `envconfig:"EVENTS_WEBHOOK_URL"`
+	EventsPollInterval   time.Duration `envconfig:"EVENTS_POLL_INTERVAL" default:"1s"`
+	EventsBatchSize      int           `envconfig:"EVENTS_BATCH_SIZE" default:"100"`
+	EventsWebhookTimeout time.Duration `envconfig:"EVENTS_WEBHOOK_TIMEOUT" default:"5s"`
+
+	WebhookPollInterval  time.Duration `envconfig:"WEBHOOK_POLL_INTERVAL" default:"1s"`
+	WebhookTimeout       time.Duration `envconfig:"WEBHOOK_TIMEOUT" default:"10s"`
+	WebhookMaxAttempts   int           `envconfig:"WEBHOOK_MAX_ATTEMPTS" default:"8"`
+	WebhookRetryDelay    time.Duration `envconfig:"WEBHOOK_RETRY_DELAY" default:"30s"`
+	WebhookMaxRetryDelay time.Duration `envconfig:"WEBHOOK_MAX_RETRY_DELAY" default:"1h"`
+
+	RiskDisabled              bool            `envconfig:"RISK_DISABLED" default:"false"`
+	RiskNewCounterpartyAmount decimal.Decimal `envconfig:"RISK_NEW_COUNTERPARTY_AMOUNT" default:"1000"`
+	RiskRoundTripWindow       time.Duration   `envconfig:"RISK_ROUND_TRIP_WINDOW" default:"1h"`
+	RiskUnusualHours          string          `envconfig:"RISK_UNUSUAL_HOURS"`
+	RiskLocation              string          `envconfig:"RISK_LOCATION" default:"UTC"`
+	RiskDenyRules             []string        `envconfig:"RISK_DENY_RULES"`
+
+	ApprovalThresholds   map[string]string `envconfig:"APPROVAL_THRESHOLDS"`
+	PendingTTL           time.Duration     `envconfig:"PENDING_PAYMENT_TTL" default:"72h"`
+	PendingSweepInterval time.Duration     `envconfig:"PENDING_SWEEP_INTERVAL" default:"1m"`
+
 	PostgresAddress  string `envconfig:"POSTGRES_ADDRESS" required:"true"`
 	PostgresDatabase string `envconfig:"POSTGRES_DATABASE" required:"true"`
 	PostgresUser     string `envconfig:"POSTGRES_USER" required:"true"`
@@ -68,15 +129,68 @@ func run(ctx context.Context, logger log.Logger) error {
 		}
 	}()
 
+	mismatches, err := storage.VerifyLedger(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to verify ledger: %w", err)
+	}
+	for _, m := range mismatches {
+		level.Warn(logger).Log("msg", "account balance does not match ledger",
+			"account", m.AccountID, "balance", m.Balance, "ledger_balance", m.LedgerBalance)
+	}
+
+	publisher, err := newPublisher(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize event publisher: %w", err)
+	}
+
+	rates, err := newRateProvider(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize exchange rates: %w", err)
+	}
+
+	authenticator, err := newAuthenticator(cfg, storage)
+	if err != nil {
+		return fmt.Errorf("failed to initialize authentication: %w", err)
+	}
+	if authenticator == nil {
+		level.Warn(logger).Log("msg", "API authentication is disabled")
+	}
+
+	rules, err := newRiskRules(cfg, storage)
+	if err != nil {
+		return fmt.Errorf("failed to initialize risk rules: %w", err)
+	}
+	if cfg.RiskDisabled {
+		level.Warn(logger).Log("msg", "payment risk assessment is disabled")
+	}
+
+	hub := &feed.Hub{
+		Listener: storage,
+		Buffer:   cfg.StreamBuffer,
+		Logger:   log.With(logger, "component", "payment_feed"),
+	}
+
 	srv, err := coinssvc.NewServer(coinssvc.ServerConfig{
 		AllowedOrigins:  cfg.AllowedOrigins,
 		Storage:         storage,
 		Logger:          logger,
 		Port:            cfg.Port,
+		GRPCPort:        cfg.GRPCPort,
+		AdminPort:       cfg.AdminPort,
 		ReadTimeout:     cfg.ReadTimeout,
 		WriteTimeout:    cfg.WriteTimeout,
 		ShutdownTimeout: cfg.ShutdownTimeout,
 		MetricPrefix:    metricPrefix,
+		RateProvider:    rates,
+		QuoteTTL:        cfg.FXQuoteTTL,
+		HoldTTL:         cfg.HoldTTL,
+		HoldMaxTTL:      cfg.HoldMaxTTL,
+		Feed:            hub,
+		Authenticator:   authenticator,
+		RiskRules:       rules,
+		PendingTTL:      cfg.PendingTTL,
+
+		TrustProxyHeaders: cfg.TrustProxyHeaders,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to initialize server: %w", err)
@@ -93,9 +207,205 @@ func run(ctx context.Context, logger log.Logger) error {
 		return nil
 	})
 
+	g.Go(func() error {
+		level.Info(logger).Log("msg", "starting admin server", "port", cfg.AdminPort)
+		if err := srv.ServeAdmin(ctx); err != nil {
+			return fmt.Errorf("failed to serve admin http: %w", err)
+		}
+
+		return nil
+	})
+
+	g.Go(func() error {
+		level.Info(logger).Log("msg", "starting grpc server", "port", cfg.GRPCPort)
+		if err := srv.ServeGRPC(ctx); err != nil {
+			return fmt.Errorf("failed to serve grpc: %w", err)
+		}
+
+		return nil
+	})
+
+	g.Go(func() error {
+		level.Info(logger).Log("msg", "starting payment feed")
+		return hub.Run(ctx)
+	})
+
+	worker := &schedule.Worker{
+		Runner:   storage,
+		Interval: cfg.SchedulePollInterval,
+		Retry: schedule.Retry{
+			MaxAttempts: cfg.ScheduleMaxAttempts,
+			Delay:       cfg.ScheduleRetryDelay,
+		},
+		Logger: log.With(logger, "component", "scheduler"),
+	}
+	if len(rules) > 0 {
+		// Scheduled payments can not be parked, a run of a payment the rules do not allow is skipped.
+		worker.Check = (&risk.Engine{Rules: rules, History: storage}).Allowed
+	}
+	g.Go(func() error {
+		level.Info(logger).Log("msg", "starting payment scheduler", "interval", cfg.SchedulePollInterval)
+		return worker.Run(ctx)
+	})
+
+	sweeper := &hold.Sweeper{
+		Expirer:  storage,
+		Interval: cfg.HoldSweepInterval,
+		Logger:   log.With(logger, "component", "hold_sweeper"),
+	}
+	g.Go(func() error {
+		level.Info(logger).Log("msg", "starting hold sweeper", "interval", cfg.HoldSweepInterval)
+		return sweeper.Run(ctx)
+	})
+
+	pendingSweeper := &pending.Sweeper{
+		Expirer:  storage,
+		Interval: cfg.PendingSweepInterval,
+		Logger:   log.With(logger, "component", "pending_sweeper"),
+	}
+	g.Go(func() error {
+		level.Info(logger).Log("msg", "starting pending payment sweeper", "interval", cfg.PendingSweepInterval)
+		return pendingSweeper.Run(ctx)
+	})
+
+	relay := &event.Relay{
+		Outbox:    storage,
+		Publisher: event.Multi(&webhook.Fanout{Enqueuer: storage}, publisher),
+		Interval:  cfg.EventsPollInterval,
+		BatchSize: cfg.EventsBatchSize,
+		Logger:    log.With(logger, "component", "event_relay"),
+	}
+	g.Go(func() error {
+		level.Info(logger).Log("msg", "starting event relay", "publisher", cfg.EventsPublisher)
+		return relay.Run(ctx)
+	})
+
+	webhooks := &webhook.Worker{
+		Store:  storage,
+		Client: &http.Client{Timeout: cfg.WebhookTimeout},
+		Retry: webhook.Retry{
+			MaxAttempts: cfg.WebhookMaxAttempts,
+			Delay:       cfg.WebhookRetryDelay,
+			MaxDelay:    cfg.WebhookMaxRetryDelay,
+		},
+		Interval: cfg.WebhookPollInterval,
+		// A claimed delivery is attempted again after the lease
+		// if the worker stops before storing the result.
+		Lease:  2 * cfg.WebhookTimeout,
+		Logger: log.With(logger, "component", "webhooks"),
+	}
+	g.Go(func() error {
+		level.Info(logger).Log("msg", "starting webhook deliveries", "interval", cfg.WebhookPollInterval)
+		return webhooks.Run(ctx)
+	})
+
 	return g.Wait()
 }
 
+// newRateProvider returns a rate provider with rates loaded from FX_RATES_FILE if it is set,
+// otherwise with rates given in FX_RATES, e.g. "EUR/USD:1.21,GBP/USD:1.35".
+func newRateProvider(cfg configuration) (fx.RateProvider, error) {
+	if cfg.FXRatesFile != "" {
+		return fx.NewFileProvider(cfg.FXRatesFile)
+	}
+	rates, err := fx.ParseRates(cfg.FXRates)
+	if err != nil {
+		return nil, err
+	}
+
+	return fx.NewStaticProvider(rates)
+}
+
+// newAuthenticator returns an authenticator of API keys stored in Postgres and, if JWKS_FILE is set,
+// of JWTs signed with its keys. It returns nil if AUTH_DISABLED is set.
+func newAuthenticator(cfg configuration, keys auth.KeyStore) (auth.Authenticator, error) {
+	if cfg.AuthDisabled {
+		return nil, nil
+	}
+	a := &auth.Bearer{APIKeys: &auth.APIKeys{Store: keys}}
+	if cfg.JWKSFile != "" {
+		jwt, err := auth.NewJWTFromFile(cfg.JWKSFile, cfg.JWTIssuer, cfg.JWTAudience)
+		if err != nil {
+			return nil, err
+		}
+		a.JWT = jwt
+	}
+
+	return a, nil
+}
+
+// newRiskRules returns the payment risk rules, only the approval threshold one if RISK_DISABLED is set.
+// The approval threshold rule applies only if APPROVAL_THRESHOLDS is set and the unusual hour rule only
+// if RISK_UNUSUAL_HOURS is, rules named in RISK_DENY_RULES deny payments instead of parking them for a review.
+// Approval thresholds need authentication, approvals by a second principal are not enforced without it.
+func newRiskRules(cfg configuration, accounts risk.Accounts) ([]risk.Rule, error) {
+	var rules []risk.Rule
+	if len(cfg.ApprovalThresholds) > 0 {
+		if cfg.AuthDisabled {
+			return nil, errors.New("APPROVAL_THRESHOLDS requires authentication, AUTH_DISABLED must not be set")
+		}
+		amounts, err := risk.ParseThresholds(cfg.ApprovalThresholds)
+		if err != nil {
+			return nil, fmt.Errorf("invalid APPROVAL_THRESHOLDS: %w", err)
+		}
+		rules = append(rules, &risk.ApprovalThreshold{Amounts: amounts, Accounts: accounts})
+	}
+	if cfg.RiskDisabled {
+		return rules, nil
+	}
+
+	outcomes := make(map[string]risk.Outcome, len(cfg.RiskDenyRules))
+	for _, name := range cfg.RiskDenyRules {
+		outcomes[name] = risk.Deny
+	}
+
+	assessed := []risk.Rule{
+		&risk.NewCounterparty{Amount: cfg.RiskNewCounterpartyAmount, Outcome: outcomes["new_counterparty"]},
+		&risk.RoundTrip{Window: cfg.RiskRoundTripWindow, Outcome: outcomes["round_trip"]},
+	}
+	if cfg.RiskUnusualHours != "" {
+		from, to, err := risk.ParseHours(cfg.RiskUnusualHours)
+		if err != nil {
+			return nil, err
+		}
+		loc, err := time.LoadLocation(cfg.RiskLocation)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RISK_LOCATION: %w", err)
+		}
+		assessed = append(assessed, &risk.UnusualHour{From: from, To: to, Location: loc, Outcome: outcomes["unusual_hour"]})
+	}
+	for name := range outcomes {
+		known := false
+		for _, r := range assessed {
+			known = known || r.Name() == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown rule %q in RISK_DENY_RULES", name)
+		}
+	}
+
+	return append(rules, assessed...), nil
+}
+
+// newPublisher returns the event publisher selected by EVENTS_PUBLISHER, either "memory"
+// or "webhook" posting events to EVENTS_WEBHOOK_URL.
+func newPublisher(cfg configuration) (event.Publisher, error) {
+	switch cfg.EventsPublisher {
+	case "memory":
+		return &event.MemoryPublisher{Size: memoryPublisherSize}, nil
+	case "webhook":
+		if cfg.EventsWebhookURL == "" {
+			return nil, errors.New("EVENTS_WEBHOOK_URL is required by the webhook publisher")
+		}
+		return &event.WebhookPublisher{
+			URL:    cfg.EventsWebhookURL,
+			Client: &http.Client{Timeout: cfg.EventsWebhookTimeout},
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown EVENTS_PUBLISHER %q", cfg.EventsPublisher)
+	}
+}
+
 // signalContext returns a context that is canceled if either SIGTERM or SIGINT signal is received.
 func signalContext(logger log.Logger) (context.Context, context.CancelFunc) {
 	ctx, cancel := context.WithCancel(context.Background())
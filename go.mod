@@ -5,6 +5,7 @@ go 1.14
 require (
 	github.com/RoaringBitmap/roaring v0.4.23 // indirect
 	github.com/go-kit/kit v0.10.0
+	github.com/golang/protobuf v1.4.0
 	github.com/gorilla/handlers v1.5.1
 	github.com/gorilla/mux v1.7.4
 	github.com/jmoiron/sqlx v1.2.0
@@ -18,4 +19,6 @@ require (
 	github.com/stretchr/testify v1.4.0
 	go.mongodb.org/mongo-driver v1.3.5 // indirect
 	golang.org/x/sync v0.0.0-20200625203802-6e8e738ad208
+	google.golang.org/grpc v1.27.0
+	google.golang.org/protobuf v1.22.0
 )
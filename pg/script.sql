@@ -19,58 +19,341 @@ CREATE TABLE IF NOT EXISTS payments
     dt           timestamp DEFAULT now()
 );
 
-CREATE OR REPLACE PROCEDURE send_payment_proc(from_account text, to_account text, amount decimal,
-                                              direction smallint)
-as
+-- Accounts have a status, funds held by holds and the principal owning them. Existing accounts are
+-- active and owned by nobody, only an operator or an unauthenticated API debits them.
+ALTER TABLE accounts
+    ADD COLUMN IF NOT EXISTS status varchar(16) NOT NULL DEFAULT 'active',
+    ADD COLUMN IF NOT EXISTS held   decimal     NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS owner  text        NOT NULL DEFAULT '';
+
+-- The closed and frozen flags of earlier versions are replaced by the status.
+DO
 $$
-DECLARE
-    from_currency varchar(3);
-    to_currency   varchar(3);
-    u_count       int;
-BEGIN
-    SELECT a.currency
-    INTO from_currency
-    FROM accounts AS a
-    WHERE a.id = from_account
-        FOR UPDATE;
+    BEGIN
+        IF NOT EXISTS(SELECT FROM pg_constraint WHERE conname = 'accounts_status_check') THEN
+            ALTER TABLE accounts
+                ADD CONSTRAINT accounts_status_check CHECK (status IN ('active', 'frozen-debit', 'frozen-all', 'closed'));
+        END IF;
+        IF EXISTS(SELECT FROM information_schema.columns WHERE table_name = 'accounts' AND column_name = 'closed') THEN
+            UPDATE accounts SET status = 'closed' WHERE closed;
+            ALTER TABLE accounts DROP COLUMN closed;
+        END IF;
+        IF EXISTS(SELECT FROM information_schema.columns WHERE table_name = 'accounts' AND column_name = 'frozen') THEN
+            UPDATE accounts SET status = 'frozen-debit' WHERE frozen AND status = 'active';
+            ALTER TABLE accounts DROP COLUMN frozen;
+        END IF;
+    END
+$$;
 
-    SELECT a.currency
-    INTO to_currency
-    FROM accounts AS a
-    WHERE a.id = to_currency
-        FOR UPDATE;
-
-    IF from_account <> to_currency THEN
-        RETURN;
-    end if;
-
-    UPDATE accounts as a
-    SET balance = balance - amount
-    where a.id = from_account
-      and a.balance - amount >= 0;
-    get diagnostics u_count = row_count;
-    IF u_count = 0 THEN
-        ROLLBACK;
-        RETURN;
-    end if;
-
-    UPDATE accounts as a
-    SET balance = balance + amount
-    where a.id = to_account;
-    get diagnostics u_count = row_count;
-    IF u_count = 0 THEN
-        ROLLBACK;
-        RETURN;
-    end if;
-
-    INSERT INTO payments (from_account, to_account, amount, direction)
-    VALUES (from_account, to_account, amount, direction);
-
-    COMMIT;
-END;
+-- A payment debits amount in currency and credits credit_amount in credit_currency at rate,
+-- payments made before currency conversions debit and credit the currency of the source account.
+ALTER TABLE payments
+    ADD COLUMN IF NOT EXISTS currency        varchar(3),
+    ADD COLUMN IF NOT EXISTS credit_amount   numeric,
+    ADD COLUMN IF NOT EXISTS credit_currency varchar(3),
+    ADD COLUMN IF NOT EXISTS rate            numeric     NOT NULL DEFAULT 1,
+    ADD COLUMN IF NOT EXISTS quote_id        varchar(32) NOT NULL DEFAULT '';
+
+UPDATE payments AS p
+SET currency = coalesce((SELECT a.currency FROM accounts AS a WHERE a.id = p.from_account),
+                        (SELECT a.currency FROM accounts AS a WHERE a.id = p.to_account))
+WHERE p.currency IS NULL;
+UPDATE payments SET credit_amount = amount WHERE credit_amount IS NULL;
+UPDATE payments SET credit_currency = currency WHERE credit_currency IS NULL;
+
+ALTER TABLE payments
+    ALTER COLUMN currency SET NOT NULL,
+    ALTER COLUMN credit_amount SET NOT NULL,
+    ALTER COLUMN credit_currency SET NOT NULL;
+
+-- A refund is a compensating payment of the payment refund_of.
+ALTER TABLE payments
+    ADD COLUMN IF NOT EXISTS refund_of bigint REFERENCES payments (id);
+
+-- Exchange rate quotes, a quote locks the rate of a single payment until expires_at.
+CREATE TABLE IF NOT EXISTS fx_quotes
+(
+    id            varchar(32) primary key,
+    from_currency varchar(3)  NOT NULL,
+    to_currency   varchar(3)  NOT NULL,
+    rate          numeric     NOT NULL,
+    expires_at    timestamptz NOT NULL,
+    used          boolean     NOT NULL DEFAULT false
+);
+
+CREATE INDEX IF NOT EXISTS payments_from_account_idx ON payments (from_account, id);
+CREATE INDEX IF NOT EXISTS payments_to_account_idx ON payments (to_account, id);
+CREATE INDEX IF NOT EXISTS payments_dt_idx ON payments (dt, id);
+CREATE INDEX IF NOT EXISTS payments_refund_of_idx ON payments (refund_of);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys
+(
+    key          varchar(255) primary key,
+    request_hash varchar(64) NOT NULL,
+    payment_id   bigint REFERENCES payments (id),
+    created_at   timestamp    NOT NULL DEFAULT now()
+);
+
+-- Double-entry ledger: every balance change is a journal transaction made of postings
+-- that sum up to zero, so an account balance equals the sum of its postings.
+CREATE TABLE IF NOT EXISTS journal
+(
+    id          bigserial primary key,
+    payment_id  bigint REFERENCES payments (id),
+    description text      NOT NULL DEFAULT '',
+    dt          timestamp NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS postings
+(
+    id         bigserial primary key,
+    journal_id bigint       NOT NULL REFERENCES journal (id),
+    account_id varchar(250) NOT NULL,
+    amount     numeric      NOT NULL,
+    currency   varchar(3)   NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS postings_account_id_idx ON postings (account_id, id);
+
+-- Scheduled payments, a due schedule runs at coalesce(retry_at, next_run).
+CREATE TABLE IF NOT EXISTS schedules
+(
+    id              bigserial primary key,
+    from_account    text        NOT NULL,
+    to_account      text        NOT NULL,
+    amount          numeric     NOT NULL,
+    direction       smallint    NOT NULL,
+    spec            text        NOT NULL,
+    status          varchar(16) NOT NULL DEFAULT 'active',
+    next_run        timestamptz NOT NULL,
+    retry_at        timestamptz,
+    attempts        integer     NOT NULL DEFAULT 0,
+    last_run        timestamptz,
+    last_payment_id bigint REFERENCES payments (id),
+    last_error      text        NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS schedules_due_idx ON schedules ((coalesce(retry_at, next_run))) WHERE status = 'active';
+
+-- Authorized payments, an authorized hold reserves its amount in accounts.held until captured, voided or expired.
+CREATE TABLE IF NOT EXISTS holds
+(
+    id           bigserial primary key,
+    from_account text        NOT NULL,
+    to_account   text        NOT NULL,
+    amount       numeric     NOT NULL,
+    direction    smallint    NOT NULL,
+    status       varchar(16) NOT NULL,
+    created_at   timestamptz NOT NULL DEFAULT now(),
+    expires_at   timestamptz NOT NULL,
+    payment_id   bigint REFERENCES payments (id)
+);
+
+CREATE INDEX IF NOT EXISTS holds_expires_at_idx ON holds (expires_at) WHERE status = 'authorized';
+
+-- Outbox of payment lifecycle events written in the transaction of the change,
+-- the relay publishes unpublished events in ID order.
+CREATE TABLE IF NOT EXISTS outbox
+(
+    id           bigserial primary key,
+    type         varchar(64) NOT NULL,
+    payload      jsonb       NOT NULL,
+    created_at   timestamptz NOT NULL DEFAULT now(),
+    published_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS outbox_unpublished_idx ON outbox (id) WHERE published_at IS NULL;
+
+-- Webhook subscriptions of accounts, deliveries are signed with the secret.
+CREATE TABLE IF NOT EXISTS webhook_subscriptions
+(
+    id         bigserial primary key,
+    account_id varchar(250) NOT NULL REFERENCES accounts (id),
+    url        text         NOT NULL,
+    secret     text         NOT NULL,
+    created_at timestamptz  NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_subscriptions_account_id_idx ON webhook_subscriptions (account_id);
+
+-- Webhook deliveries of outbox events, a pending delivery is attempted at next_attempt
+-- until it is delivered or becomes dead.
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id              bigserial primary key,
+    subscription_id bigint      NOT NULL REFERENCES webhook_subscriptions (id) ON DELETE CASCADE,
+    event_id        bigint      NOT NULL REFERENCES outbox (id),
+    status          varchar(16) NOT NULL,
+    attempts        integer     NOT NULL DEFAULT 0,
+    next_attempt    timestamptz,
+    last_attempt    timestamptz,
+    response_status integer     NOT NULL DEFAULT 0,
+    last_error      text        NOT NULL DEFAULT '',
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt) WHERE status = 'pending';
+
+-- Changes of accounts made by operators with the admin API.
+CREATE TABLE IF NOT EXISTS account_changes
+(
+    id         bigserial primary key,
+    account_id varchar(250) NOT NULL REFERENCES accounts (id),
+    type       varchar(16)  NOT NULL,
+    amount     numeric,
+    reason     text         NOT NULL,
+    actor      text         NOT NULL,
+    created_at timestamptz  NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS account_changes_account_id_idx ON account_changes (account_id, id);
+
+-- A status change records the new status, other changes have none.
+ALTER TABLE account_changes
+    ADD COLUMN IF NOT EXISTS status varchar(16) NOT NULL DEFAULT '';
+
+-- API keys of principals, only SHA-256 hashes of keys are stored.
+CREATE TABLE IF NOT EXISTS api_keys
+(
+    key_hash   varchar(64) primary key,
+    principal  text        NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    revoked_at timestamptz
+);
+
+-- Principals of keys created before roles are customers.
+ALTER TABLE api_keys
+    ADD COLUMN IF NOT EXISTS role varchar(16) NOT NULL DEFAULT 'customer';
+
+-- Audit log of mutating API calls. Every record holds the hash of the previous one,
+-- input is json rather than jsonb to keep the hashed text as is.
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id         bigserial primary key,
+    principal  text        NOT NULL,
+    request_id text        NOT NULL,
+    client_ip  text        NOT NULL,
+    method     text        NOT NULL,
+    input      json        NOT NULL,
+    outcome    varchar(16) NOT NULL,
+    error      text        NOT NULL,
+    created_at timestamptz NOT NULL,
+    prev_hash  varchar(64) NOT NULL,
+    hash       varchar(64) NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_principal_idx ON audit_log (principal, id);
+CREATE INDEX IF NOT EXISTS audit_log_request_id_idx ON audit_log (request_id);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS
 $$
-    LANGUAGE plpgsql;
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE
+    ON audit_log
+    FOR EACH STATEMENT
+EXECUTE PROCEDURE audit_log_append_only();
+
+-- Transfer limits of accounts and default limits of currencies, account_id is empty
+-- for the limits of a currency. A null limit is not enforced.
+CREATE TABLE IF NOT EXISTS transfer_limits
+(
+    account_id    varchar(250) NOT NULL DEFAULT '',
+    currency      varchar(3)   NOT NULL,
+    max_payment   numeric CHECK (max_payment >= 0),
+    daily_total   numeric CHECK (daily_total >= 0),
+    monthly_total numeric CHECK (monthly_total >= 0),
+    hourly_count  integer CHECK (hourly_count >= 0),
+    updated_by    text         NOT NULL DEFAULT '',
+    updated_at    timestamptz  NOT NULL DEFAULT now(),
+    primary key (currency, account_id)
+);
+
+CREATE INDEX IF NOT EXISTS transfer_limits_account_id_idx ON transfer_limits (account_id);
+CREATE INDEX IF NOT EXISTS payments_from_account_dt_idx ON payments (from_account, dt);
+
+-- Payment requests parked for a review by operators, decisions are the reasons to park them.
+CREATE TABLE IF NOT EXISTS pending_payments
+(
+    id            bigserial primary key,
+    from_account  text        NOT NULL,
+    to_account    text        NOT NULL,
+    amount        numeric     NOT NULL,
+    currency      varchar(3)  NOT NULL,
+    direction     smallint    NOT NULL,
+    quote_id      varchar(32) NOT NULL DEFAULT '',
+    status        varchar(16) NOT NULL,
+    decisions     jsonb       NOT NULL,
+    created_by    text        NOT NULL DEFAULT '',
+    created_at    timestamptz NOT NULL DEFAULT now(),
+    reviewed_by   text        NOT NULL DEFAULT '',
+    reviewed_at   timestamptz,
+    review_reason text        NOT NULL DEFAULT '',
+    payment_id    bigint REFERENCES payments (id)
+);
 
-INSERT INTO accounts
-VALUES ('bob123', 100, 'USD'),
-       ('alice456', 0.01, 'USD');
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS pending_payments_status_idx ON pending_payments (status, id);
+
+-- A payment request parked with an idempotency key is replayed as the pending payment until it is approved.
+ALTER TABLE idempotency_keys
+    ADD COLUMN IF NOT EXISTS pending_id bigint REFERENCES pending_payments (id);
+
+-- A pending payment not reviewed until expires_at expires, a payment without expires_at never does.
+ALTER TABLE pending_payments
+    ADD COLUMN IF NOT EXISTS expires_at timestamptz;
+
+-- A payment sent on an approval records the principal that requested it and the one that approved it.
+ALTER TABLE payments
+    ADD COLUMN IF NOT EXISTS initiated_by text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS approved_by  text NOT NULL DEFAULT '';
+
+-- A pending refund refunds amount in the currency of the refunded payment when it is approved.
+ALTER TABLE pending_payments
+    ADD COLUMN IF NOT EXISTS refund_of bigint REFERENCES payments (id);
+
+-- Payments are executed by the storage layer in a single transaction,
+-- the former send_payment_proc procedure is no longer used.
+DROP PROCEDURE IF EXISTS send_payment_proc(text, text, decimal, smallint);
+
+-- The example accounts of earlier versions get their owners.
+INSERT INTO accounts (id, balance, currency, owner)
+VALUES ('bob123', 100, 'USD', 'bob'),
+       ('alice456', 0.01, 'USD', 'alice')
+ON CONFLICT (id) DO UPDATE SET owner = excluded.owner
+WHERE accounts.owner = '';
+
+-- Development API keys of the example accounts owners and staff, do not use them in production.
+INSERT INTO api_keys (key_hash, principal, role)
+VALUES (encode(sha256('dev-bob-key'), 'hex'), 'bob', 'customer'),
+       (encode(sha256('dev-alice-key'), 'hex'), 'alice', 'customer'),
+       (encode(sha256('dev-operator-key'), 'hex'), 'operator', 'operator'),
+       (encode(sha256('dev-auditor-key'), 'hex'), 'auditor', 'auditor')
+ON CONFLICT (key_hash) DO NOTHING;
+
+-- Balances of accounts without postings, such as the example accounts and accounts of versions
+-- before the ledger, are posted as opening balances.
+WITH opening AS (
+    SELECT a.id, a.balance, a.currency
+    FROM accounts AS a
+    WHERE a.balance <> 0
+      AND NOT EXISTS(SELECT FROM postings AS p WHERE p.account_id = a.id)
+),
+     j AS (
+         INSERT INTO journal (description) SELECT 'opening balance' WHERE EXISTS(SELECT FROM opening) RETURNING id
+     )
+INSERT
+INTO postings (journal_id, account_id, amount, currency)
+SELECT j.id, o.id, o.balance, o.currency
+FROM j,
+     opening AS o
+UNION ALL
+SELECT j.id, '@opening', -sum(o.balance), o.currency
+FROM j,
+     opening AS o
+GROUP BY j.id, o.currency;
@@ -2,15 +2,39 @@ package account
 
 import (
 	"errors"
+	"regexp"
+	"time"
 
+	"github.com/donmikel/coins/pkg/currency"
+	"github.com/donmikel/coins/pkg/payment"
 	"github.com/shopspring/decimal"
 )
 
+// idPattern matches valid account IDs, they are used in URL paths as they are.
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
 // Account is single account
 type Account struct {
 	ID       string          `json:"id" db:"id"`
 	Balance  decimal.Decimal `json:"balance" db:"balance"`
 	Currency string          `json:"currency" db:"currency"`
+	Status   Status          `json:"status" db:"status"`
+
+	// Owner is the ID of the principal allowed to debit the account.
+	Owner string `json:"owner,omitempty" db:"owner"`
+
+	// Held is the part of the balance reserved by authorized holds.
+	Held decimal.Decimal `json:"held" db:"held"`
+}
+
+// Available returns the balance that is not reserved by holds.
+func (p Account) Available() decimal.Decimal {
+	return p.Balance.Sub(p.Held)
+}
+
+// Empty reports whether the account has neither a balance nor held funds.
+func (p Account) Empty() bool {
+	return p.Balance.IsZero() && p.Held.IsZero()
 }
 
 // Account validates the given Account structure
@@ -18,9 +42,76 @@ func (p Account) Validate() error {
 	if p.ID == "" {
 		return errors.New("empty ID")
 	}
+	if !idPattern.MatchString(p.ID) {
+		return errors.New("invalid ID, use up to 64 letters, digits, '_' and '-'")
+	}
 	if p.Currency == "" {
 		return errors.New("empty Currency")
 	}
+	c, err := currency.Lookup(p.Currency)
+	if err != nil {
+		return err
+	}
+	if p.Balance.IsNegative() {
+		return errors.New("negative Balance")
+	}
+	if !c.Fits(p.Balance) {
+		return errors.New("Balance exceeds the currency precision")
+	}
+
+	return nil
+}
+
+// AccountUpdate is an input structure used to partially update an account.
+// Nil fields are left unchanged.
+type AccountUpdate struct {
+	Balance  *decimal.Decimal `json:"balance,omitempty"`
+	Currency *string          `json:"currency,omitempty"`
+}
+
+// Validate validates the given AccountUpdate structure
+func (u AccountUpdate) Validate() error {
+	if u.Balance == nil && u.Currency == nil {
+		return errors.New("nothing to update")
+	}
+	if u.Balance != nil && u.Balance.IsNegative() {
+		return errors.New("negative Balance")
+	}
+	if u.Currency != nil && *u.Currency == "" {
+		return errors.New("empty Currency")
+	}
+	if u.Currency == nil {
+		return nil
+	}
+	c, err := currency.Lookup(*u.Currency)
+	if err != nil {
+		return errors.New("unknown Currency")
+	}
+	if u.Balance != nil && !c.Fits(*u.Balance) {
+		return errors.New("Balance exceeds the currency precision")
+	}
 
 	return nil
 }
+
+// Statement is the account activity for a period, from inclusive to exclusive.
+// Balances are the sums of the ledger postings of the account.
+type Statement struct {
+	AccountID      string          `json:"account_id"`
+	Currency       string          `json:"currency"`
+	From           *time.Time      `json:"from,omitempty"`
+	To             *time.Time      `json:"to,omitempty"`
+	OpeningBalance decimal.Decimal `json:"opening_balance"`
+	ClosingBalance decimal.Decimal `json:"closing_balance"`
+	Lines          []StatementLine `json:"lines"`
+}
+
+// StatementLine is a single ledger posting of the statement, Payment is nil for postings of opening
+// balances and adjustments. Amount is negative for money leaving the account, Balance is the account
+// balance after the posting.
+type StatementLine struct {
+	Payment     *payment.Payment `json:"payment,omitempty"`
+	Description string           `json:"description"`
+	Amount      decimal.Decimal  `json:"amount"`
+	Balance     decimal.Decimal  `json:"balance"`
+}
@@ -0,0 +1,38 @@
+package account
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountValidate(t *testing.T) {
+	testCases := []struct {
+		id    string
+		valid bool
+	}{
+		{id: "bob123", valid: true},
+		{id: "Bob_123-usd", valid: true},
+		{id: "", valid: false},
+		{id: "bob 123", valid: false},
+		{id: "bob/123", valid: false},
+		{id: "bob%2F123", valid: false},
+		{id: "bob123?x=1", valid: false},
+		{id: "bob✓", valid: false},
+		{id: strings.Repeat("a", 64), valid: true},
+		{id: strings.Repeat("a", 65), valid: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.id, func(t *testing.T) {
+			err := Account{ID: tc.id, Balance: decimal.Zero, Currency: "USD"}.Validate()
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package account
+
+import (
+	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// ChangeType is a type of account change made by an operator.
+type ChangeType string
+
+// Possible account change types.
+const (
+	StatusChange ChangeType = "status"
+	Adjustment   ChangeType = "adjustment"
+)
+
+// Change is an account change made by an operator, the history of an account is made of its changes.
+type Change struct {
+	ID        uint64     `json:"id" db:"id"`
+	AccountID string     `json:"account_id" db:"account_id"`
+	Type      ChangeType `json:"type" db:"type"`
+	// Status is the new status of a status change.
+	Status Status `json:"status,omitempty" db:"status"`
+	// Amount is the balance change of an adjustment, negative if the balance is decreased.
+	Amount    *decimal.Decimal `json:"amount,omitempty" db:"amount"`
+	Reason    string           `json:"reason" db:"reason"`
+	Actor     string           `json:"actor" db:"actor"`
+	CreatedAt time.Time        `json:"created_at" db:"created_at"`
+}
+
+// AdjustmentInput is an input structure used to manually change an account balance.
+type AdjustmentInput struct {
+	// Amount is added to the balance, a negative amount decreases it.
+	Amount decimal.Decimal `json:"amount"`
+	Reason string          `json:"reason"`
+}
+
+// Validate validates the given AdjustmentInput structure
+func (in AdjustmentInput) Validate() error {
+	if in.Amount.IsZero() {
+		return errors.New("zero Amount")
+	}
+	if in.Reason == "" {
+		return errors.New("empty Reason")
+	}
+
+	return nil
+}
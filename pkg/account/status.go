@@ -0,0 +1,65 @@
+package account
+
+import (
+	"errors"
+)
+
+// Status is a status of an account.
+type Status string
+
+// Possible account statuses.
+const (
+	// Active accounts send and receive payments.
+	Active Status = "active"
+	// FrozenDebit accounts receive payments but do not send them.
+	FrozenDebit Status = "frozen-debit"
+	// FrozenAll accounts neither send nor receive payments.
+	FrozenAll Status = "frozen-all"
+	// Closed accounts are final, they are not available for payments and changes.
+	Closed Status = "closed"
+)
+
+// Valid reports whether the status is known.
+func (s Status) Valid() bool {
+	switch s {
+	case Active, FrozenDebit, FrozenAll, Closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// CanDebit reports whether an account with the status may send payments.
+func (s Status) CanDebit() bool {
+	return s == Active
+}
+
+// CanCredit reports whether an account with the status may receive payments.
+func (s Status) CanCredit() bool {
+	return s == Active || s == FrozenDebit
+}
+
+// CanTransition reports whether an account with the status may change it to the given status.
+// Any status but closed changes to any other one, an account is only closed if it is Empty
+// and has no active schedules, authorized holds or pending payments.
+func (s Status) CanTransition(to Status) bool {
+	return s != Closed && s != to && to.Valid()
+}
+
+// StatusInput is an input structure used to change the status of an account.
+type StatusInput struct {
+	Status Status `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// Validate validates the given StatusInput structure
+func (in StatusInput) Validate() error {
+	if !in.Status.Valid() {
+		return errors.New("unknown Status")
+	}
+	if in.Reason == "" {
+		return errors.New("empty Reason")
+	}
+
+	return nil
+}
@@ -0,0 +1,39 @@
+package account
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatus(t *testing.T) {
+	testCases := []struct {
+		status    Status
+		canDebit  bool
+		canCredit bool
+	}{
+		{status: Active, canDebit: true, canCredit: true},
+		{status: FrozenDebit, canCredit: true},
+		{status: FrozenAll},
+		{status: Closed},
+	}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.status), func(t *testing.T) {
+			assert.True(t, tc.status.Valid())
+			assert.Equal(t, tc.canDebit, tc.status.CanDebit())
+			assert.Equal(t, tc.canCredit, tc.status.CanCredit())
+		})
+	}
+	assert.False(t, Status("suspended").Valid())
+}
+
+func TestStatusCanTransition(t *testing.T) {
+	assert.True(t, Active.CanTransition(FrozenDebit))
+	assert.True(t, FrozenDebit.CanTransition(FrozenAll))
+	assert.True(t, FrozenAll.CanTransition(Active))
+	assert.True(t, FrozenAll.CanTransition(Closed))
+	assert.False(t, Active.CanTransition(Active))
+	assert.False(t, Active.CanTransition("suspended"))
+	assert.False(t, Closed.CanTransition(Active))
+}
@@ -0,0 +1,167 @@
+// Package audit records mutating API calls in an append-only log chained by hashes,
+// so that a changed, inserted or removed record breaks the chain.
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrBrokenChain is returned when the hash chain of the audit log does not verify.
+var ErrBrokenChain = errors.New("audit log hash chain is broken")
+
+// Outcome is an outcome of an audited call.
+type Outcome string
+
+// Possible outcomes of audited calls.
+const (
+	Success Outcome = "success"
+	Failure Outcome = "failure"
+)
+
+// Record is an audited call. Hash is the hash of the record fields and PrevHash,
+// the hash of the previous record or an empty string for the first record.
+type Record struct {
+	ID        uint64          `json:"id" db:"id"`
+	Principal string          `json:"principal" db:"principal"`
+	RequestID string          `json:"request_id" db:"request_id"`
+	ClientIP  string          `json:"client_ip" db:"client_ip"`
+	Method    string          `json:"method" db:"method"`
+	Input     json.RawMessage `json:"input" db:"input"`
+	Outcome   Outcome         `json:"outcome" db:"outcome"`
+	Error     string          `json:"error,omitempty" db:"error"`
+	CreatedAt time.Time       `json:"created_at" db:"created_at"`
+	PrevHash  string          `json:"prev_hash" db:"prev_hash"`
+	Hash      string          `json:"hash" db:"hash"`
+}
+
+// ComputeHash returns the hex SHA-256 hash of the record fields and PrevHash.
+// Every field is prefixed with its length, so that the boundaries of fields are hashed too.
+func (r Record) ComputeHash() string {
+	h := sha256.New()
+	for _, f := range []string{
+		r.PrevHash,
+		strconv.FormatUint(r.ID, 10),
+		r.Principal,
+		r.RequestID,
+		r.ClientIP,
+		r.Method,
+		string(r.Input),
+		string(r.Outcome),
+		r.Error,
+		r.CreatedAt.UTC().Format(time.RFC3339Nano),
+	} {
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(f)))
+		h.Write(size[:])
+		h.Write([]byte(f))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify checks that records follow the record with the prevHash hash in the chain
+// and returns the hash of the last record, or prevHash if there are no records.
+func Verify(prevHash string, records []Record) (string, error) {
+	for _, r := range records {
+		if r.PrevHash != prevHash {
+			return prevHash, fmt.Errorf("record %d does not follow the previous record: %w", r.ID, ErrBrokenChain)
+		}
+		if r.ComputeHash() != r.Hash {
+			return prevHash, fmt.Errorf("record %d does not match its hash: %w", r.ID, ErrBrokenChain)
+		}
+		prevHash = r.Hash
+	}
+
+	return prevHash, nil
+}
+
+// Store is an append-only audit log.
+type Store interface {
+	// AppendAuditRecord sets the ID, creation time and hashes of the record and appends it to the chain.
+	AppendAuditRecord(ctx context.Context, r Record) (appended Record, err error)
+	// GetAuditRecords returns a page of records matching the filter.
+	GetAuditRecords(ctx context.Context, f Filter) (page Page, err error)
+}
+
+// VerifyStore walks the whole chain of the store in pages of limit records
+// and returns the number of verified records.
+func VerifyStore(ctx context.Context, s Store, limit int) (n int, err error) {
+	var prevHash string
+	f := Filter{Limit: limit}
+	for {
+		page, err := s.GetAuditRecords(ctx, f)
+		if err != nil {
+			return n, err
+		}
+		if prevHash, err = Verify(prevHash, page.Records); err != nil {
+			return n, err
+		}
+		n += len(page.Records)
+		if page.NextCursor == 0 {
+			return n, nil
+		}
+		f.Cursor = page.NextCursor
+	}
+}
+
+// Audit log page size limits.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Filter describes a page of the audit log. Records are ordered by ID,
+// the page starts after the record with ID equal to Cursor.
+type Filter struct {
+	Principal string
+	Method    string
+	RequestID string
+	From      *time.Time
+	To        *time.Time
+	Cursor    uint64
+	Limit     int
+}
+
+// Validate validates the given Filter structure
+func (f Filter) Validate() error {
+	if f.From != nil && f.To != nil && f.From.After(*f.To) {
+		return errors.New("From is after To")
+	}
+	if f.Limit < 0 || f.Limit > MaxLimit {
+		return errors.New("invalid Limit")
+	}
+
+	return nil
+}
+
+// Page is a page of the audit log. NextCursor is zero on the last page.
+type Page struct {
+	Records    []Record `json:"records"`
+	NextCursor uint64   `json:"next_cursor,omitempty"`
+}
+
+// Request is the origin of a call.
+type Request struct {
+	ID       string
+	ClientIP string
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of the context carrying the request.
+func NewContext(ctx context.Context, r Request) context.Context {
+	return context.WithValue(ctx, contextKey{}, r)
+}
+
+// FromContext returns the request of the context, if any.
+func FromContext(ctx context.Context) (Request, bool) {
+	r, ok := ctx.Value(contextKey{}).(Request)
+	return r, ok
+}
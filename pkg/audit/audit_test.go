@@ -0,0 +1,139 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryStore is an audit log kept in memory.
+type memoryStore struct {
+	records []Record
+}
+
+func (s *memoryStore) AppendAuditRecord(ctx context.Context, r Record) (Record, error) {
+	r.ID = uint64(len(s.records) + 1)
+	if len(s.records) > 0 {
+		r.PrevHash = s.records[len(s.records)-1].Hash
+	}
+	r.CreatedAt = time.Date(2020, 12, 25, 10, 0, len(s.records), 0, time.UTC)
+	r.Hash = r.ComputeHash()
+	s.records = append(s.records, r)
+	return r, nil
+}
+
+func (s *memoryStore) GetAuditRecords(ctx context.Context, f Filter) (page Page, err error) {
+	for _, r := range s.records {
+		if r.ID <= f.Cursor {
+			continue
+		}
+		if len(page.Records) == f.Limit {
+			page.NextCursor = page.Records[len(page.Records)-1].ID
+			break
+		}
+		page.Records = append(page.Records, r)
+	}
+	return page, nil
+}
+
+func newTestStore(t *testing.T, n int) *memoryStore {
+	s := &memoryStore{}
+	for i := 0; i < n; i++ {
+		_, err := s.AppendAuditRecord(context.Background(), Record{
+			Principal: "bob",
+			RequestID: "req",
+			ClientIP:  "10.0.0.1",
+			Method:    "SendPayment",
+			Input:     []byte(`{"from_account":"bob123","amount":"10"}`),
+			Outcome:   Success,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestVerify(t *testing.T) {
+	s := newTestStore(t, 3)
+
+	last, err := Verify("", s.records)
+	assert.NoError(t, err)
+	assert.Equal(t, s.records[2].Hash, last)
+
+	last, err = Verify(s.records[0].Hash, s.records[1:])
+	assert.NoError(t, err)
+	assert.Equal(t, s.records[2].Hash, last)
+
+	last, err = Verify("", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "", last)
+}
+
+func TestVerifyTampered(t *testing.T) {
+	testCases := []struct {
+		name   string
+		tamper func(records []Record) []Record
+	}{
+		{
+			name: "changed input",
+			tamper: func(records []Record) []Record {
+				records[1].Input = []byte(`{"from_account":"bob123","amount":"1000"}`)
+				return records
+			},
+		},
+		{
+			name: "changed outcome and rehashed",
+			tamper: func(records []Record) []Record {
+				records[1].Outcome = Failure
+				records[1].Hash = records[1].ComputeHash()
+				return records
+			},
+		},
+		{
+			name: "removed record",
+			tamper: func(records []Record) []Record {
+				return append(records[:1], records[2:]...)
+			},
+		},
+		{
+			name: "fields shifted",
+			tamper: func(records []Record) []Record {
+				records[1].Principal, records[1].RequestID = "bobre", "q"
+				return records
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestStore(t, 3)
+			_, err := Verify("", tc.tamper(s.records))
+			assert.True(t, errors.Is(err, ErrBrokenChain), err)
+		})
+	}
+}
+
+func TestVerifyStore(t *testing.T) {
+	s := newTestStore(t, 5)
+
+	n, err := VerifyStore(context.Background(), s, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	s.records[3].Error = "insufficient funds"
+	n, err = VerifyStore(context.Background(), s, 2)
+	assert.True(t, errors.Is(err, ErrBrokenChain))
+	assert.Equal(t, 2, n)
+}
+
+func TestFilterValidate(t *testing.T) {
+	from := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(-time.Hour)
+	assert.NoError(t, Filter{From: &from}.Validate())
+	assert.Error(t, Filter{From: &from, To: &to}.Validate())
+	assert.Error(t, Filter{Limit: MaxLimit + 1}.Validate())
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/donmikel/coins/pkg/coins"
+)
+
+// KeyStore finds principals by API key hashes.
+type KeyStore interface {
+	// GetAPIKey returns the principal of an active API key with the given hash
+	// or coins.ErrNotFoundInStorage.
+	GetAPIKey(ctx context.Context, hash string) (p Principal, err error)
+}
+
+// APIKeys authenticates principals by API keys. Keys are stored as hashes,
+// so a leaked key store does not reveal usable keys.
+type APIKeys struct {
+	Store KeyStore
+}
+
+// Authenticate authenticates the principal of the API key.
+func (a *APIKeys) Authenticate(ctx context.Context, key string) (Principal, error) {
+	if key == "" {
+		return Principal{}, fmt.Errorf("%w: empty API key", ErrInvalidCredentials)
+	}
+	p, err := a.Store.GetAPIKey(ctx, HashKey(key))
+	if errors.Is(err, coins.ErrNotFoundInStorage) {
+		return Principal{}, fmt.Errorf("%w: unknown API key", ErrInvalidCredentials)
+	}
+	if err != nil {
+		return Principal{}, fmt.Errorf("failed to get API key: %w", err)
+	}
+	if !p.Role.Valid() {
+		return Principal{}, fmt.Errorf("%w: unknown role %q", ErrInvalidCredentials, p.Role)
+	}
+
+	return p, nil
+}
+
+// HashKey returns the hex SHA-256 hash of an API key as it is stored.
+// Keys are random, so an unsalted fast hash is enough.
+func HashKey(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
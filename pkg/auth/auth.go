@@ -0,0 +1,99 @@
+// Package auth authenticates API clients and carries the authenticated principal in the request context.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidCredentials is returned for missing, unknown, expired or malformed credentials.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Role is a set of permissions of a principal.
+type Role string
+
+// Possible roles of principals.
+const (
+	// Customer owns accounts and moves money between them.
+	Customer Role = "customer"
+	// Operator manages accounts of customers with the admin API.
+	Operator Role = "operator"
+	// Auditor views account histories of the admin API.
+	Auditor Role = "auditor"
+)
+
+// Valid reports whether the role is known.
+func (r Role) Valid() bool {
+	switch r {
+	case Customer, Operator, Auditor:
+		return true
+	default:
+		return false
+	}
+}
+
+// Principal is an authenticated API client, the owner of accounts it created.
+type Principal struct {
+	ID   string
+	Role Role
+}
+
+// HasRole reports whether the principal has one of the roles.
+func (p Principal) HasRole(roles ...Role) bool {
+	for _, r := range roles {
+		if p.Role == r {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of the context carrying the principal.
+func NewContext(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal of the context, if any.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok
+}
+
+// Authenticator authenticates a principal by a bearer token.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (Principal, error)
+}
+
+// Bearer authenticates JWTs with JWT and other tokens with APIKeys, either of them may be nil.
+type Bearer struct {
+	APIKeys Authenticator
+	JWT     Authenticator
+}
+
+// Authenticate authenticates a principal by an API key or a JWT.
+func (b *Bearer) Authenticate(ctx context.Context, token string) (Principal, error) {
+	// A JWT is made of three dot-separated parts, API keys have no dots.
+	a := b.APIKeys
+	if strings.Count(token, ".") == 2 {
+		a = b.JWT
+	}
+	if a == nil {
+		return Principal{}, fmt.Errorf("%w: unsupported token", ErrInvalidCredentials)
+	}
+
+	return a.Authenticate(ctx, token)
+}
+
+// ParseAuthorization returns the token of a bearer Authorization header value.
+func ParseAuthorization(header string) (string, error) {
+	const prefix = "bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", fmt.Errorf("%w: missing bearer token", ErrInvalidCredentials)
+	}
+
+	return strings.TrimSpace(header[len(prefix):]), nil
+}
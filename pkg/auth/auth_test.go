@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/stretchr/testify/assert"
+)
+
+type keyStore map[string]Principal
+
+func (s keyStore) GetAPIKey(ctx context.Context, hash string) (Principal, error) {
+	p, ok := s[hash]
+	if !ok {
+		return p, coins.ErrNotFoundInStorage
+	}
+	return p, nil
+}
+
+type authenticatorFunc func(ctx context.Context, token string) (Principal, error)
+
+func (f authenticatorFunc) Authenticate(ctx context.Context, token string) (Principal, error) {
+	return f(ctx, token)
+}
+
+func TestAPIKeys(t *testing.T) {
+	a := &APIKeys{Store: keyStore{
+		HashKey("secret-key"):   {ID: "bob", Role: Customer},
+		HashKey("operator-key"): {ID: "ops", Role: Operator},
+		HashKey("unknown-role"): {ID: "eve", Role: "root"},
+	}}
+
+	p, err := a.Authenticate(context.Background(), "secret-key")
+	assert.NoError(t, err)
+	assert.Equal(t, Principal{ID: "bob", Role: Customer}, p)
+
+	p, err = a.Authenticate(context.Background(), "operator-key")
+	assert.NoError(t, err)
+	assert.Equal(t, Principal{ID: "ops", Role: Operator}, p)
+
+	_, err = a.Authenticate(context.Background(), "unknown-role")
+	assert.True(t, errors.Is(err, ErrInvalidCredentials))
+
+	_, err = a.Authenticate(context.Background(), "other-key")
+	assert.True(t, errors.Is(err, ErrInvalidCredentials))
+
+	_, err = a.Authenticate(context.Background(), "")
+	assert.True(t, errors.Is(err, ErrInvalidCredentials))
+}
+
+func TestBearer(t *testing.T) {
+	named := func(id string) Authenticator {
+		return authenticatorFunc(func(ctx context.Context, token string) (Principal, error) {
+			return Principal{ID: id}, nil
+		})
+	}
+	b := &Bearer{APIKeys: named("key"), JWT: named("jwt")}
+
+	p, err := b.Authenticate(context.Background(), "secret-key")
+	assert.NoError(t, err)
+	assert.Equal(t, "key", p.ID)
+
+	p, err = b.Authenticate(context.Background(), "a.b.c")
+	assert.NoError(t, err)
+	assert.Equal(t, "jwt", p.ID)
+
+	b.JWT = nil
+	_, err = b.Authenticate(context.Background(), "a.b.c")
+	assert.True(t, errors.Is(err, ErrInvalidCredentials))
+}
+
+func TestParseAuthorization(t *testing.T) {
+	token, err := ParseAuthorization("Bearer secret-key")
+	assert.NoError(t, err)
+	assert.Equal(t, "secret-key", token)
+
+	token, err = ParseAuthorization("bearer secret-key")
+	assert.NoError(t, err)
+	assert.Equal(t, "secret-key", token)
+
+	for _, header := range []string{"", "Bearer ", "Basic Ym9iOnBhc3M="} {
+		_, err = ParseAuthorization(header)
+		assert.True(t, errors.Is(err, ErrInvalidCredentials), header)
+	}
+}
+
+func TestContext(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	p, ok := FromContext(NewContext(context.Background(), Principal{ID: "bob"}))
+	assert.True(t, ok)
+	assert.Equal(t, Principal{ID: "bob"}, p)
+}
+
+func TestPrincipalHasRole(t *testing.T) {
+	p := Principal{ID: "ops", Role: Operator}
+	assert.True(t, p.HasRole(Operator))
+	assert.True(t, p.HasRole(Auditor, Operator))
+	assert.False(t, p.HasRole(Customer))
+	assert.False(t, p.HasRole())
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testNow = time.Date(2020, 12, 25, 10, 0, 0, 0, time.UTC)
+
+func signJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	hash := crypto.SHA256
+	h := hash.New()
+	h.Write([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, hash, h.Sum(nil))
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, h.Sum(nil))
+		sig = append(padBytes(r, 32), padBytes(s, 32)...)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func padBytes(i *big.Int, size int) []byte {
+	b := i.Bytes()
+	return append(make([]byte, size-len(b)), b...)
+}
+
+func encodeBigInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func TestJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwks, err := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encodeBigInt(rsaKey.N), "e": encodeBigInt(big.NewInt(int64(rsaKey.E)))},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encodeBigInt(ecKey.X), "y": encodeBigInt(ecKey.Y)},
+		{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := ParseJWKS(jwks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, keys, 2)
+
+	j := &JWT{
+		Keys:     keys,
+		Issuer:   "https://auth.example.com",
+		Audience: "coins",
+		Leeway:   DefaultLeeway,
+		now:      func() time.Time { return testNow },
+	}
+	validClaims := func(modify func(c map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"sub": "bob",
+			"iss": "https://auth.example.com",
+			"aud": []string{"coins", "other"},
+			"exp": testNow.Add(time.Hour).Unix(),
+		}
+		if modify != nil {
+			modify(c)
+		}
+		return c
+	}
+
+	testCases := []struct {
+		name     string
+		token    string
+		wantRole Role
+		wantErr  bool
+	}{
+		{
+			name:  "RS256",
+			token: signJWT(t, "RS256", "rsa", rsaKey, validClaims(nil)),
+		},
+		{
+			name:  "ES256",
+			token: signJWT(t, "ES256", "ec", ecKey, validClaims(nil)),
+		},
+		{
+			name:     "auditor",
+			token:    signJWT(t, "RS256", "rsa", rsaKey, validClaims(func(c map[string]interface{}) { c["role"] = "auditor" })),
+			wantRole: Auditor,
+		},
+		{
+			name:    "unknown role",
+			token:   signJWT(t, "RS256", "rsa", rsaKey, validClaims(func(c map[string]interface{}) { c["role"] = "root" })),
+			wantErr: true,
+		},
+		{
+			name:  "audience string",
+			token: signJWT(t, "RS256", "rsa", rsaKey, validClaims(func(c map[string]interface{}) { c["aud"] = "coins" })),
+		},
+		{
+			name:  "expired within leeway",
+			token: signJWT(t, "RS256", "rsa", rsaKey, validClaims(func(c map[string]interface{}) { c["exp"] = testNow.Add(-time.Second).Unix() })),
+		},
+		{
+			name:    "expired",
+			token:   signJWT(t, "RS256", "rsa", rsaKey, validClaims(func(c map[string]interface{}) { c["exp"] = testNow.Add(-time.Hour).Unix() })),
+			wantErr: true,
+		},
+		{
+			name:    "no exp",
+			token:   signJWT(t, "RS256", "rsa", rsaKey, validClaims(func(c map[string]interface{}) { delete(c, "exp") })),
+			wantErr: true,
+		},
+		{
+			name:    "not valid yet",
+			token:   signJWT(t, "RS256", "rsa", rsaKey, validClaims(func(c map[string]interface{}) { c["nbf"] = testNow.Add(time.Hour).Unix() })),
+			wantErr: true,
+		},
+		{
+			name:    "wrong issuer",
+			token:   signJWT(t, "RS256", "rsa", rsaKey, validClaims(func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" })),
+			wantErr: true,
+		},
+		{
+			name:    "wrong audience",
+			token:   signJWT(t, "RS256", "rsa", rsaKey, validClaims(func(c map[string]interface{}) { c["aud"] = "other" })),
+			wantErr: true,
+		},
+		{
+			name:    "no subject",
+			token:   signJWT(t, "RS256", "rsa", rsaKey, validClaims(func(c map[string]interface{}) { delete(c, "sub") })),
+			wantErr: true,
+		},
+		{
+			name:    "unknown key",
+			token:   signJWT(t, "RS256", "other", otherKey, validClaims(nil)),
+			wantErr: true,
+		},
+		{
+			name:    "signed by other key",
+			token:   signJWT(t, "RS256", "rsa", otherKey, validClaims(nil)),
+			wantErr: true,
+		},
+		{
+			name:    "alg does not match key",
+			token:   signJWT(t, "ES256", "rsa", ecKey, validClaims(nil)),
+			wantErr: true,
+		},
+		{
+			name: "alg none",
+			token: func() string {
+				header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"rsa"}`))
+				payload, _ := json.Marshal(validClaims(nil))
+				return header + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+			}(),
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			token:   "a.b.c",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := j.Authenticate(context.Background(), tc.token)
+			if tc.wantErr {
+				assert.True(t, errors.Is(err, ErrInvalidCredentials), err)
+				return
+			}
+			assert.NoError(t, err)
+			wantRole := tc.wantRole
+			if wantRole == "" {
+				wantRole = Customer
+			}
+			assert.Equal(t, Principal{ID: "bob", Role: wantRole}, p)
+		})
+	}
+}
+
+func TestParseJWKSErrors(t *testing.T) {
+	for _, data := range []string{
+		`{`,
+		`{"keys": []}`,
+		`{"keys": [{"kty": "oct", "k": "c2VjcmV0"}]}`,
+		`{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`,
+		`{"keys": [{"kty": "RSA", "kid": "a", "n": "AQAB", "e": "AQAB"}, {"kty": "RSA", "kid": "a", "n": "AQAB", "e": "AQAB"}]}`,
+	} {
+		_, err := ParseJWKS([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
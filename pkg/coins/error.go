@@ -5,27 +5,70 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+
+	"github.com/shopspring/decimal"
 )
 
 // Storage-related errors.
 var (
-	ErrNotFoundInStorage = errors.New("not found in storage")
+	ErrNotFoundInStorage      = errors.New("not found in storage")
+	ErrAlreadyExistsInStorage = errors.New("already exists in storage")
+)
+
+// Payment-related errors.
+var (
+	ErrUnknownAccount    = errors.New("unknown account")
+	ErrCurrencyMismatch  = errors.New("currency mismatch")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrSameAccount       = errors.New("same source and destination account")
+	ErrIdempotencyKey    = errors.New("idempotency key reused with a different request")
+	ErrInvalidQuote      = errors.New("invalid exchange rate quote")
+	ErrQuoteExpired      = errors.New("exchange rate quote expired")
+	ErrInvalidAmount     = errors.New("amount exceeds the currency precision")
+	ErrNotRefundable     = errors.New("payment is not refundable")
+	ErrRefundExceeded    = errors.New("refund exceeds the payment amount")
+	ErrHoldFinalized     = errors.New("hold is captured, voided or expired")
+	ErrCaptureExceeded   = errors.New("capture exceeds the hold amount")
+	ErrHoldExpiration    = errors.New("hold expiration is not in the future")
+	ErrAccountFrozen     = errors.New("account is frozen")
+	ErrPaymentReviewed   = errors.New("pending payment is already reviewed")
+	ErrPaymentExpired    = errors.New("pending payment is expired")
+	ErrSelfApproval      = errors.New("pending payment can not be approved by its creator")
+	ErrAnonymousApproval = errors.New("pending payment above an approval threshold can not be approved anonymously")
+)
+
+// Account-related errors.
+var (
+	ErrInvalidTransition = errors.New("invalid account status transition")
+	ErrCurrencyInUse     = errors.New("currency of a used account can not be changed")
+	ErrAccountInUse      = errors.New("account with funds or obligations can not be closed")
 )
 
 // ServiceError describes a web-service error.
 type ServiceError struct {
 	Code    int
 	Message string
+
+	// Limit is the kind of the transfer limit exceeded by a payment and Remaining
+	// is the allowance left under the limit, both are set by ErrLimitExceeded.
+	Limit     string
+	Remaining *decimal.Decimal
+}
+
+// serviceErrorBody is the JSON body of a service error response.
+type serviceErrorBody struct {
+	Error     string           `json:"error"`
+	Limit     string           `json:"limit,omitempty"`
+	Remaining *decimal.Decimal `json:"remaining,omitempty"`
 }
 
 // Decode decodes the error from the given HTTP response.
 func (e *ServiceError) Decode(r *http.Response) {
 	e.Code = r.StatusCode
-	var res struct {
-		Error string `json:"error"`
-	}
+	var res serviceErrorBody
 	if err := json.NewDecoder(r.Body).Decode(&res); err == nil && res.Error != "" {
 		e.Message = res.Error
+		e.Limit, e.Remaining = res.Limit, res.Remaining
 	} else {
 		e.Message = http.StatusText(r.StatusCode)
 	}
@@ -39,7 +82,7 @@ func (e *ServiceError) Encode(w http.ResponseWriter) {
 	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(e.Code)
-	json.NewEncoder(w).Encode(map[string]string{"error": message})
+	json.NewEncoder(w).Encode(serviceErrorBody{Error: message, Limit: e.Limit, Remaining: e.Remaining})
 }
 
 // Error returns a string representation of the error.
@@ -55,6 +98,57 @@ func ErrBadRequest(format string, v ...interface{}) error {
 	}
 }
 
+// ErrUnauthorized creates an Unauthorized service error.
+func ErrUnauthorized(format string, v ...interface{}) error {
+	return &ServiceError{
+		Code:    http.StatusUnauthorized,
+		Message: fmt.Sprintf(format, v...),
+	}
+}
+
+// ErrForbidden creates a Forbidden service error.
+func ErrForbidden(format string, v ...interface{}) error {
+	return &ServiceError{
+		Code:    http.StatusForbidden,
+		Message: fmt.Sprintf(format, v...),
+	}
+}
+
+// ErrNotFound creates a NotFound service error.
+func ErrNotFound(format string, v ...interface{}) error {
+	return &ServiceError{
+		Code:    http.StatusNotFound,
+		Message: fmt.Sprintf(format, v...),
+	}
+}
+
+// ErrConflict creates a Conflict service error.
+func ErrConflict(format string, v ...interface{}) error {
+	return &ServiceError{
+		Code:    http.StatusConflict,
+		Message: fmt.Sprintf(format, v...),
+	}
+}
+
+// ErrUnprocessable creates an UnprocessableEntity service error.
+func ErrUnprocessable(format string, v ...interface{}) error {
+	return &ServiceError{
+		Code:    http.StatusUnprocessableEntity,
+		Message: fmt.Sprintf(format, v...),
+	}
+}
+
+// ErrLimitExceeded creates an UnprocessableEntity service error of a payment exceeding
+// the transfer limit, remaining is the allowance left under the limit.
+func ErrLimitExceeded(limit string, remaining decimal.Decimal, format string, v ...interface{}) error {
+	return &ServiceError{
+		Code:      http.StatusUnprocessableEntity,
+		Message:   fmt.Sprintf(format, v...),
+		Limit:     limit,
+		Remaining: &remaining,
+	}
+}
+
 // ErrInternal creates an Internal service error.
 func ErrInternal(format string, v ...interface{}) error {
 	return &ServiceError{
@@ -0,0 +1,252 @@
+package coinssvc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/audit"
+	"github.com/donmikel/coins/pkg/auth"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/currency"
+	"github.com/donmikel/coins/pkg/limit"
+	"github.com/donmikel/coins/pkg/pending"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// AdminService provides account management functionality for operators and auditors.
+type AdminService interface {
+	SetAccountStatus(ctx context.Context, id string, input account.StatusInput) (acc account.Account, err error)
+	AdjustBalance(ctx context.Context, id string, input account.AdjustmentInput) (acc account.Account, err error)
+	GetAccountHistory(ctx context.Context, id string) (changes []account.Change, err error)
+	GetAuditLog(ctx context.Context, filter audit.Filter) (page audit.Page, err error)
+	GetLimits(ctx context.Context, scope limit.Scope) (l limit.Limits, err error)
+	SetLimits(ctx context.Context, scope limit.Scope, input limit.Input) (l limit.Limits, err error)
+	DeleteLimits(ctx context.Context, scope limit.Scope) (err error)
+	GetPendingPayments(ctx context.Context, filter pending.Filter) (page pending.Page, err error)
+	GetPendingPayment(ctx context.Context, id uint64) (pp pending.Payment, err error)
+	ApprovePendingPayment(ctx context.Context, id uint64, input pending.ReviewInput) (pp pending.Payment, err error)
+	RejectPendingPayment(ctx context.Context, id uint64, input pending.ReviewInput) (pp pending.Payment, err error)
+}
+
+type adminService struct {
+	logger  log.Logger
+	storage Storage
+}
+
+func newAdminService(logger log.Logger, storage Storage) *adminService {
+	return &adminService{
+		logger:  logger,
+		storage: storage,
+	}
+}
+
+// actor returns the ID of the principal making the change, empty if authentication is disabled.
+func actor(ctx context.Context) string {
+	p, _ := auth.FromContext(ctx)
+	return p.ID
+}
+
+func (s *adminService) SetAccountStatus(ctx context.Context, id string, input account.StatusInput) (acc account.Account, err error) {
+	if err = input.Validate(); err != nil {
+		return acc, coins.ErrBadRequest("invalid status change: %s", err)
+	}
+	change := account.Change{
+		AccountID: id,
+		Type:      account.StatusChange,
+		Status:    input.Status,
+		Reason:    input.Reason,
+		Actor:     actor(ctx),
+	}
+
+	acc, err = s.storage.SetAccountStatus(ctx, change)
+	switch {
+	case errors.Is(err, coins.ErrNotFoundInStorage):
+		return acc, coins.ErrNotFound("account %s not found", id)
+	case errors.Is(err, coins.ErrInvalidTransition), errors.Is(err, coins.ErrAccountInUse):
+		return acc, coins.ErrConflict("failed to change account status: %s", err)
+	case err != nil:
+		return acc, coins.ErrInternal("failed to change account status: %s", err)
+	}
+	level.Info(s.logger).Log("msg", "account changed", "account", id, "change", change.Type,
+		"status", change.Status, "actor", change.Actor, "reason", change.Reason)
+	return
+}
+
+func (s *adminService) AdjustBalance(ctx context.Context, id string, input account.AdjustmentInput) (acc account.Account, err error) {
+	if err = input.Validate(); err != nil {
+		return acc, coins.ErrBadRequest("invalid adjustment: %s", err)
+	}
+	change := account.Change{
+		AccountID: id,
+		Type:      account.Adjustment,
+		Amount:    &input.Amount,
+		Reason:    input.Reason,
+		Actor:     actor(ctx),
+	}
+
+	acc, err = s.storage.AdjustBalance(ctx, change)
+	switch {
+	case errors.Is(err, coins.ErrNotFoundInStorage):
+		return acc, coins.ErrNotFound("account %s not found", id)
+	case errors.Is(err, coins.ErrInsufficientFunds), errors.Is(err, coins.ErrInvalidAmount):
+		return acc, coins.ErrUnprocessable("failed to adjust balance: %s", err)
+	case err != nil:
+		return acc, coins.ErrInternal("failed to adjust balance: %s", err)
+	}
+	level.Info(s.logger).Log("msg", "account changed", "account", id, "change", change.Type,
+		"amount", input.Amount, "actor", change.Actor, "reason", change.Reason)
+	return
+}
+
+func (s *adminService) GetAccountHistory(ctx context.Context, id string) (changes []account.Change, err error) {
+	if _, err = s.storage.GetAccount(ctx, id); errors.Is(err, coins.ErrNotFoundInStorage) {
+		return nil, coins.ErrNotFound("account %s not found", id)
+	}
+	if err != nil {
+		return nil, coins.ErrInternal("failed to get account: %s", err)
+	}
+	changes, err = s.storage.GetAccountChanges(ctx, id)
+	if err != nil {
+		return nil, coins.ErrInternal("failed to get account history: %s", err)
+	}
+	return
+}
+
+func (s *adminService) GetAuditLog(ctx context.Context, filter audit.Filter) (page audit.Page, err error) {
+	if err = filter.Validate(); err != nil {
+		return page, coins.ErrBadRequest("invalid filter: %s", err)
+	}
+	page, err = s.storage.GetAuditRecords(ctx, filter)
+	if err != nil {
+		return page, coins.ErrInternal("failed to get audit log: %s", err)
+	}
+	return
+}
+
+// validateScope checks the limits scope, the currency of a currency scope must be known.
+func validateScope(scope limit.Scope) error {
+	if err := scope.Validate(); err != nil {
+		return coins.ErrBadRequest("invalid limits scope: %s", err)
+	}
+	if scope.Currency != "" && !currency.Valid(scope.Currency) {
+		return coins.ErrBadRequest("unknown currency %q", scope.Currency)
+	}
+	return nil
+}
+
+func (s *adminService) GetLimits(ctx context.Context, scope limit.Scope) (l limit.Limits, err error) {
+	if err = validateScope(scope); err != nil {
+		return l, err
+	}
+	l, err = s.storage.GetLimits(ctx, scope)
+	if errors.Is(err, coins.ErrNotFoundInStorage) {
+		return l, coins.ErrNotFound("account %s not found", scope.AccountID)
+	}
+	if err != nil {
+		return l, coins.ErrInternal("failed to get limits: %s", err)
+	}
+	return
+}
+
+func (s *adminService) SetLimits(ctx context.Context, scope limit.Scope, input limit.Input) (l limit.Limits, err error) {
+	if err = validateScope(scope); err != nil {
+		return l, err
+	}
+	if err = input.Validate(); err != nil {
+		return l, coins.ErrBadRequest("invalid limits: %s", err)
+	}
+	l = input.Limits(scope)
+	l.UpdatedBy = actor(ctx)
+
+	l, err = s.storage.SetLimits(ctx, l)
+	switch {
+	case errors.Is(err, coins.ErrNotFoundInStorage):
+		return l, coins.ErrNotFound("account %s not found", scope.AccountID)
+	case errors.Is(err, coins.ErrInvalidAmount):
+		return l, coins.ErrBadRequest("invalid limits: %s", err)
+	case err != nil:
+		return l, coins.ErrInternal("failed to set limits: %s", err)
+	}
+	level.Info(s.logger).Log("msg", "limits changed", "account", scope.AccountID, "currency", l.Currency, "actor", l.UpdatedBy)
+	return
+}
+
+func (s *adminService) DeleteLimits(ctx context.Context, scope limit.Scope) (err error) {
+	if err = validateScope(scope); err != nil {
+		return err
+	}
+	err = s.storage.DeleteLimits(ctx, scope)
+	if errors.Is(err, coins.ErrNotFoundInStorage) {
+		return coins.ErrNotFound("no limits of %s%s", scope.AccountID, scope.Currency)
+	}
+	if err != nil {
+		return coins.ErrInternal("failed to delete limits: %s", err)
+	}
+	level.Info(s.logger).Log("msg", "limits deleted", "account", scope.AccountID, "currency", scope.Currency, "actor", actor(ctx))
+	return
+}
+
+func (s *adminService) GetPendingPayments(ctx context.Context, filter pending.Filter) (page pending.Page, err error) {
+	if err = filter.Validate(); err != nil {
+		return page, coins.ErrBadRequest("invalid filter: %s", err)
+	}
+	page, err = s.storage.GetPendingPayments(ctx, filter)
+	if err != nil {
+		return page, coins.ErrInternal("failed to get pending payments: %s", err)
+	}
+	return
+}
+
+func (s *adminService) GetPendingPayment(ctx context.Context, id uint64) (pp pending.Payment, err error) {
+	pp, err = s.storage.GetPendingPayment(ctx, id)
+	if errors.Is(err, coins.ErrNotFoundInStorage) {
+		return pp, coins.ErrNotFound("pending payment %d not found", id)
+	}
+	if err != nil {
+		return pp, coins.ErrInternal("failed to get pending payment: %s", err)
+	}
+	return
+}
+
+func (s *adminService) ApprovePendingPayment(ctx context.Context, id uint64, input pending.ReviewInput) (pp pending.Payment, err error) {
+	if err = input.Validate(); err != nil {
+		return pp, coins.ErrBadRequest("invalid review: %s", err)
+	}
+	review := pending.Review{By: actor(ctx), Reason: input.Reason}
+
+	pp, err = s.storage.ApprovePendingPayment(ctx, id, review)
+	switch {
+	case errors.Is(err, coins.ErrNotFoundInStorage):
+		return pp, coins.ErrNotFound("pending payment %d not found", id)
+	case errors.Is(err, coins.ErrSelfApproval), errors.Is(err, coins.ErrAnonymousApproval):
+		return pp, coins.ErrForbidden("failed to approve payment: %s", err)
+	case errors.Is(err, coins.ErrPaymentReviewed), errors.Is(err, coins.ErrPaymentExpired):
+		return pp, coins.ErrConflict("failed to approve payment: %s", err)
+	case err != nil:
+		return pp, paymentError(err)
+	}
+	level.Info(s.logger).Log("msg", "pending payment approved", "pending_id", id, "payment_id", *pp.PaymentID,
+		"initiated_by", pp.CreatedBy, "actor", review.By, "reason", review.Reason)
+	return
+}
+
+func (s *adminService) RejectPendingPayment(ctx context.Context, id uint64, input pending.ReviewInput) (pp pending.Payment, err error) {
+	if err = input.Validate(); err != nil {
+		return pp, coins.ErrBadRequest("invalid review: %s", err)
+	}
+	review := pending.Review{By: actor(ctx), Reason: input.Reason}
+
+	pp, err = s.storage.RejectPendingPayment(ctx, id, review)
+	switch {
+	case errors.Is(err, coins.ErrNotFoundInStorage):
+		return pp, coins.ErrNotFound("pending payment %d not found", id)
+	case errors.Is(err, coins.ErrPaymentReviewed), errors.Is(err, coins.ErrPaymentExpired):
+		return pp, coins.ErrConflict("failed to reject payment: %s", err)
+	case err != nil:
+		return pp, coins.ErrInternal("failed to reject payment: %s", err)
+	}
+	level.Info(s.logger).Log("msg", "pending payment rejected", "pending_id", id, "actor", review.By, "reason", review.Reason)
+	return
+}
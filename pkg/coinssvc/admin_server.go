@@ -0,0 +1,203 @@
+package coinssvc
+
+import (
+	"context"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/donmikel/coins/pkg/auth"
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// makeAdminHandler returns the handler of the admin listener. Operators change accounts and limits,
+// review pending payments and profile the service, auditors and operators view account histories,
+// limits, pending payments and the audit log, metrics are not authenticated.
+func makeAdminHandler(svc AdminService, a auth.Authenticator) http.Handler {
+	opts := []kithttp.ServerOption{
+		kithttp.ServerErrorEncoder(encodeError),
+	}
+
+	router := mux.NewRouter()
+
+	router.Path("/admin/v1/accounts/{id}/status").Methods(http.MethodPost).Handler(withRoles(a, kithttp.NewServer(
+		makeSetAccountStatusEndpoint(svc),
+		decodeSetAccountStatusRequest,
+		encodeAdminAccountResponse,
+		opts...,
+	), auth.Operator))
+
+	router.Path("/admin/v1/accounts/{id}/adjustments").Methods(http.MethodPost).Handler(withRoles(a, kithttp.NewServer(
+		makeAdjustBalanceEndpoint(svc),
+		decodeAdjustBalanceRequest,
+		encodeAdminAccountResponse,
+		opts...,
+	), auth.Operator))
+
+	router.Path("/admin/v1/accounts/{id}/history").Methods(http.MethodGet).Handler(withRoles(a, kithttp.NewServer(
+		makeGetAccountHistoryEndpoint(svc),
+		decodeGetAccountHistoryRequest,
+		encodeGetAccountHistoryResponse,
+		opts...,
+	), auth.Operator, auth.Auditor))
+
+	router.Path("/admin/v1/audit").Methods(http.MethodGet).Handler(withRoles(a, kithttp.NewServer(
+		makeGetAuditLogEndpoint(svc),
+		decodeGetAuditLogRequest,
+		encodeGetAuditLogResponse,
+		opts...,
+	), auth.Operator, auth.Auditor))
+
+	for _, path := range []string{"/admin/v1/accounts/{id}/limits", "/admin/v1/currencies/{currency}/limits"} {
+		router.Path(path).Methods(http.MethodGet).Handler(withRoles(a, kithttp.NewServer(
+			makeGetLimitsEndpoint(svc),
+			decodeLimitsRequest,
+			encodeLimitsResponse,
+			opts...,
+		), auth.Operator, auth.Auditor))
+
+		router.Path(path).Methods(http.MethodPut).Handler(withRoles(a, kithttp.NewServer(
+			makeSetLimitsEndpoint(svc),
+			decodeSetLimitsRequest,
+			encodeLimitsResponse,
+			opts...,
+		), auth.Operator))
+
+		router.Path(path).Methods(http.MethodDelete).Handler(withRoles(a, kithttp.NewServer(
+			makeDeleteLimitsEndpoint(svc),
+			decodeLimitsRequest,
+			encodeDeleteLimitsResponse,
+			opts...,
+		), auth.Operator))
+	}
+
+	router.Path("/admin/v1/pending-payments").Methods(http.MethodGet).Handler(withRoles(a, kithttp.NewServer(
+		makeGetPendingPaymentsEndpoint(svc),
+		decodeGetPendingPaymentsRequest,
+		encodeGetPendingPaymentsResponse,
+		opts...,
+	), auth.Operator, auth.Auditor))
+
+	router.Path("/admin/v1/pending-payments/{id}").Methods(http.MethodGet).Handler(withRoles(a, kithttp.NewServer(
+		makeGetPendingPaymentEndpoint(svc),
+		decodePendingPaymentRequest,
+		encodePendingPaymentResponse,
+		opts...,
+	), auth.Operator, auth.Auditor))
+
+	router.Path("/admin/v1/pending-payments/{id}/approve").Methods(http.MethodPost).Handler(withRoles(a, kithttp.NewServer(
+		makeApprovePendingPaymentEndpoint(svc),
+		decodeReviewPendingPaymentRequest,
+		encodePendingPaymentResponse,
+		opts...,
+	), auth.Operator))
+
+	router.Path("/admin/v1/pending-payments/{id}/reject").Methods(http.MethodPost).Handler(withRoles(a, kithttp.NewServer(
+		makeRejectPendingPaymentEndpoint(svc),
+		decodeReviewPendingPaymentRequest,
+		encodePendingPaymentResponse,
+		opts...,
+	), auth.Operator))
+
+	profiler := http.NewServeMux()
+	profiler.HandleFunc("/debug/pprof/", pprof.Index)
+	profiler.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	profiler.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	profiler.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	profiler.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	router.PathPrefix("/debug/pprof/").Handler(withRoles(a, profiler, auth.Operator))
+
+	router.Path("/metrics").Handler(promhttp.Handler())
+
+	return router
+}
+
+func makeSetAccountStatusEndpoint(svc AdminService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(setAccountStatusRequest)
+		acc, err := svc.SetAccountStatus(ctx, req.id, req.input)
+		return adminAccountResponse{account: acc}, err
+	}
+}
+
+func makeAdjustBalanceEndpoint(svc AdminService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(adjustBalanceRequest)
+		acc, err := svc.AdjustBalance(ctx, req.id, req.input)
+		return adminAccountResponse{account: acc}, err
+	}
+}
+
+func makeGetAccountHistoryEndpoint(svc AdminService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getAccountHistoryRequest)
+		changes, err := svc.GetAccountHistory(ctx, req.id)
+		return getAccountHistoryResponse{changes: changes}, err
+	}
+}
+
+func makeGetAuditLogEndpoint(svc AdminService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getAuditLogRequest)
+		page, err := svc.GetAuditLog(ctx, req.filter)
+		return getAuditLogResponse{page: page}, err
+	}
+}
+
+func makeGetLimitsEndpoint(svc AdminService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(limitsRequest)
+		l, err := svc.GetLimits(ctx, req.scope)
+		return limitsResponse{limits: l}, err
+	}
+}
+
+func makeSetLimitsEndpoint(svc AdminService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(setLimitsRequest)
+		l, err := svc.SetLimits(ctx, req.scope, req.input)
+		return limitsResponse{limits: l}, err
+	}
+}
+
+func makeDeleteLimitsEndpoint(svc AdminService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(limitsRequest)
+		err := svc.DeleteLimits(ctx, req.scope)
+		return deleteLimitsResponse{}, err
+	}
+}
+
+func makeGetPendingPaymentsEndpoint(svc AdminService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getPendingPaymentsRequest)
+		page, err := svc.GetPendingPayments(ctx, req.filter)
+		return getPendingPaymentsResponse{page: page}, err
+	}
+}
+
+func makeGetPendingPaymentEndpoint(svc AdminService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(pendingPaymentRequest)
+		pp, err := svc.GetPendingPayment(ctx, req.id)
+		return pendingPaymentResponse{payment: pp}, err
+	}
+}
+
+func makeApprovePendingPaymentEndpoint(svc AdminService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(reviewPendingPaymentRequest)
+		pp, err := svc.ApprovePendingPayment(ctx, req.id, req.input)
+		return pendingPaymentResponse{payment: pp}, err
+	}
+}
+
+func makeRejectPendingPaymentEndpoint(svc AdminService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(reviewPendingPaymentRequest)
+		pp, err := svc.RejectPendingPayment(ctx, req.id, req.input)
+		return pendingPaymentResponse{payment: pp}, err
+	}
+}
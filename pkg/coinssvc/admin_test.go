@@ -0,0 +1,608 @@
+package coinssvc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/audit"
+	"github.com/donmikel/coins/pkg/auth"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/limit"
+	"github.com/donmikel/coins/pkg/pending"
+	"github.com/donmikel/coins/pkg/risk"
+	"github.com/go-kit/kit/log"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockAdminService struct {
+	onSetAccountStatus  func(ctx context.Context, id string, input account.StatusInput) (acc account.Account, err error)
+	onAdjustBalance     func(ctx context.Context, id string, input account.AdjustmentInput) (acc account.Account, err error)
+	onGetAccountHistory func(ctx context.Context, id string) (changes []account.Change, err error)
+	onGetAuditLog       func(ctx context.Context, filter audit.Filter) (page audit.Page, err error)
+	onGetLimits         func(ctx context.Context, scope limit.Scope) (l limit.Limits, err error)
+	onSetLimits         func(ctx context.Context, scope limit.Scope, input limit.Input) (l limit.Limits, err error)
+	onDeleteLimits      func(ctx context.Context, scope limit.Scope) (err error)
+	onGetPendings       func(ctx context.Context, filter pending.Filter) (page pending.Page, err error)
+	onGetPending        func(ctx context.Context, id uint64) (pp pending.Payment, err error)
+	onApprovePending    func(ctx context.Context, id uint64, input pending.ReviewInput) (pp pending.Payment, err error)
+	onRejectPending     func(ctx context.Context, id uint64, input pending.ReviewInput) (pp pending.Payment, err error)
+}
+
+func (m *mockAdminService) SetAccountStatus(ctx context.Context, id string, input account.StatusInput) (acc account.Account, err error) {
+	return m.onSetAccountStatus(ctx, id, input)
+}
+
+func (m *mockAdminService) AdjustBalance(ctx context.Context, id string, input account.AdjustmentInput) (acc account.Account, err error) {
+	return m.onAdjustBalance(ctx, id, input)
+}
+
+func (m *mockAdminService) GetAccountHistory(ctx context.Context, id string) (changes []account.Change, err error) {
+	return m.onGetAccountHistory(ctx, id)
+}
+
+func (m *mockAdminService) GetAuditLog(ctx context.Context, filter audit.Filter) (page audit.Page, err error) {
+	return m.onGetAuditLog(ctx, filter)
+}
+
+func (m *mockAdminService) GetLimits(ctx context.Context, scope limit.Scope) (l limit.Limits, err error) {
+	return m.onGetLimits(ctx, scope)
+}
+
+func (m *mockAdminService) SetLimits(ctx context.Context, scope limit.Scope, input limit.Input) (l limit.Limits, err error) {
+	return m.onSetLimits(ctx, scope, input)
+}
+
+func (m *mockAdminService) DeleteLimits(ctx context.Context, scope limit.Scope) (err error) {
+	return m.onDeleteLimits(ctx, scope)
+}
+
+func (m *mockAdminService) GetPendingPayments(ctx context.Context, filter pending.Filter) (page pending.Page, err error) {
+	return m.onGetPendings(ctx, filter)
+}
+
+func (m *mockAdminService) GetPendingPayment(ctx context.Context, id uint64) (pp pending.Payment, err error) {
+	return m.onGetPending(ctx, id)
+}
+
+func (m *mockAdminService) ApprovePendingPayment(ctx context.Context, id uint64, input pending.ReviewInput) (pp pending.Payment, err error) {
+	return m.onApprovePending(ctx, id, input)
+}
+
+func (m *mockAdminService) RejectPendingPayment(ctx context.Context, id uint64, input pending.ReviewInput) (pp pending.Payment, err error) {
+	return m.onRejectPending(ctx, id, input)
+}
+
+func doAdminRequest(t *testing.T, server *httptest.Server, method, path, token, body string) *http.Response {
+	req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set(authorizationHeader, "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		resp.Body.Close()
+	})
+	return resp
+}
+
+func TestAdminRoles(t *testing.T) {
+	svc := &mockAdminService{
+		onSetAccountStatus: func(ctx context.Context, id string, input account.StatusInput) (account.Account, error) {
+			return mustNewAccount(func(a *account.Account) { a.Status = input.Status }), nil
+		},
+		onGetAccountHistory: func(ctx context.Context, id string) ([]account.Change, error) {
+			return nil, nil
+		},
+		onGetLimits: func(ctx context.Context, scope limit.Scope) (limit.Limits, error) {
+			return limit.Limits{}, nil
+		},
+		onSetLimits: func(ctx context.Context, scope limit.Scope, input limit.Input) (limit.Limits, error) {
+			return limit.Limits{}, nil
+		},
+		onGetPendings: func(ctx context.Context, filter pending.Filter) (pending.Page, error) {
+			return pending.Page{}, nil
+		},
+		onApprovePending: func(ctx context.Context, id uint64, input pending.ReviewInput) (pending.Payment, error) {
+			return pending.Payment{ID: id, Status: pending.Approved}, nil
+		},
+	}
+	server := httptest.NewServer(makeAdminHandler(svc, testAuthenticator{}))
+	defer server.Close()
+
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{
+			name:       "operator freezes account",
+			method:     http.MethodPost,
+			path:       "/admin/v1/accounts/bob123/status",
+			token:      "operator-key",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "auditor can not freeze account",
+			method:     http.MethodPost,
+			path:       "/admin/v1/accounts/bob123/status",
+			token:      "auditor-key",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "customer can not freeze account",
+			method:     http.MethodPost,
+			path:       "/admin/v1/accounts/bob123/status",
+			token:      "bob-key",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "no credentials",
+			method:     http.MethodPost,
+			path:       "/admin/v1/accounts/bob123/status",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "auditor views history",
+			method:     http.MethodGet,
+			path:       "/admin/v1/accounts/bob123/history",
+			token:      "auditor-key",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "customer can not view history",
+			method:     http.MethodGet,
+			path:       "/admin/v1/accounts/bob123/history",
+			token:      "bob-key",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "auditor views limits",
+			method:     http.MethodGet,
+			path:       "/admin/v1/currencies/USD/limits",
+			token:      "auditor-key",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "operator sets limits",
+			method:     http.MethodPut,
+			path:       "/admin/v1/accounts/bob123/limits",
+			token:      "operator-key",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "auditor can not set limits",
+			method:     http.MethodPut,
+			path:       "/admin/v1/accounts/bob123/limits",
+			token:      "auditor-key",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "customer can not view limits",
+			method:     http.MethodGet,
+			path:       "/admin/v1/accounts/bob123/limits",
+			token:      "bob-key",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "auditor views pending payments",
+			method:     http.MethodGet,
+			path:       "/admin/v1/pending-payments",
+			token:      "auditor-key",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "operator approves pending payment",
+			method:     http.MethodPost,
+			path:       "/admin/v1/pending-payments/7/approve",
+			token:      "operator-key",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "auditor can not approve pending payment",
+			method:     http.MethodPost,
+			path:       "/admin/v1/pending-payments/7/approve",
+			token:      "auditor-key",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "customer can not view pending payments",
+			method:     http.MethodGet,
+			path:       "/admin/v1/pending-payments",
+			token:      "bob-key",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "operator profiles",
+			method:     http.MethodGet,
+			path:       "/debug/pprof/cmdline",
+			token:      "operator-key",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "auditor can not profile",
+			method:     http.MethodGet,
+			path:       "/debug/pprof/cmdline",
+			token:      "auditor-key",
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "metrics are not authenticated",
+			method:     http.MethodGet,
+			path:       "/metrics",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := doAdminRequest(t, server, tc.method, tc.path, tc.token, `{"status":"frozen-all","reason":"fraud investigation"}`)
+			assert.Equal(t, tc.wantStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestAdminAdjustBalance(t *testing.T) {
+	svc := &mockAdminService{}
+	server := httptest.NewServer(makeAdminHandler(svc, nil))
+	defer server.Close()
+
+	var gotID string
+	var gotInput account.AdjustmentInput
+	svc.onAdjustBalance = func(ctx context.Context, id string, input account.AdjustmentInput) (account.Account, error) {
+		gotID, gotInput = id, input
+		return mustNewAccount(func(a *account.Account) { a.Balance = decimal.New(875, -1) }), nil
+	}
+
+	resp := doAdminRequest(t, server, http.MethodPost, "/admin/v1/accounts/bob123/adjustments", "",
+		`{"amount":"-12.5","reason":"chargeback"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "bob123", gotID)
+	assert.True(t, decimal.New(-125, -1).Equal(gotInput.Amount))
+	assert.Equal(t, "chargeback", gotInput.Reason)
+
+	var got account.Account
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, decimal.New(875, -1).Equal(got.Balance))
+
+	resp = doAdminRequest(t, server, http.MethodPost, "/admin/v1/accounts/bob123/adjustments", "", `{`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAdminGetAccountHistory(t *testing.T) {
+	amount := decimal.NewFromInt(10)
+	changes := []account.Change{
+		{
+			ID:        1,
+			AccountID: "bob123",
+			Type:      account.StatusChange,
+			Status:    account.FrozenAll,
+			Reason:    "fraud investigation",
+			Actor:     "ops",
+			CreatedAt: time.Date(2020, 12, 25, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			ID:        2,
+			AccountID: "bob123",
+			Type:      account.Adjustment,
+			Amount:    &amount,
+			Reason:    "goodwill credit",
+			Actor:     "ops",
+			CreatedAt: time.Date(2020, 12, 25, 11, 0, 0, 0, time.UTC),
+		},
+	}
+	svc := &mockAdminService{
+		onGetAccountHistory: func(ctx context.Context, id string) ([]account.Change, error) {
+			return changes, nil
+		},
+	}
+	server := httptest.NewServer(makeAdminHandler(svc, nil))
+	defer server.Close()
+
+	resp := doAdminRequest(t, server, http.MethodGet, "/admin/v1/accounts/bob123/history", "", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var got []account.Change
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, changes, got)
+}
+
+func TestAdminLimits(t *testing.T) {
+	svc := &mockAdminService{}
+	server := httptest.NewServer(makeAdminHandler(svc, nil))
+	defer server.Close()
+
+	var gotScope limit.Scope
+	var gotInput limit.Input
+	svc.onSetLimits = func(ctx context.Context, scope limit.Scope, input limit.Input) (limit.Limits, error) {
+		gotScope, gotInput = scope, input
+		return input.Limits(limit.Scope{AccountID: scope.AccountID, Currency: "USD"}), nil
+	}
+	svc.onGetLimits = func(ctx context.Context, scope limit.Scope) (limit.Limits, error) {
+		gotScope = scope
+		return limit.Limits{Currency: scope.Currency}, nil
+	}
+	svc.onDeleteLimits = func(ctx context.Context, scope limit.Scope) error {
+		gotScope = scope
+		return coins.ErrNotFound("no limits of %s", scope.AccountID)
+	}
+
+	resp := doAdminRequest(t, server, http.MethodPut, "/admin/v1/accounts/bob123/limits", "",
+		`{"max_payment":"100","daily_total":"300","hourly_count":5}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, limit.Scope{AccountID: "bob123"}, gotScope)
+	assert.True(t, decimal.NewFromInt(100).Equal(*gotInput.MaxPayment))
+	assert.True(t, decimal.NewFromInt(300).Equal(*gotInput.DailyTotal))
+	assert.Nil(t, gotInput.MonthlyTotal)
+	assert.Equal(t, 5, *gotInput.HourlyCount)
+
+	var got limit.Limits
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "bob123", got.AccountID)
+	assert.Equal(t, "USD", got.Currency)
+
+	resp = doAdminRequest(t, server, http.MethodGet, "/admin/v1/currencies/EUR/limits", "", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, limit.Scope{Currency: "EUR"}, gotScope)
+
+	resp = doAdminRequest(t, server, http.MethodDelete, "/admin/v1/accounts/alice456/limits", "", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	assert.Equal(t, limit.Scope{AccountID: "alice456"}, gotScope)
+
+	resp = doAdminRequest(t, server, http.MethodPut, "/admin/v1/currencies/USD/limits", "", `{`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestAdminPendingPayments(t *testing.T) {
+	svc := &mockAdminService{}
+	server := httptest.NewServer(makeAdminHandler(svc, nil))
+	defer server.Close()
+
+	var gotFilter pending.Filter
+	svc.onGetPendings = func(ctx context.Context, filter pending.Filter) (pending.Page, error) {
+		gotFilter = filter
+		return pending.Page{}, nil
+	}
+	resp := doAdminRequest(t, server, http.MethodGet, "/admin/v1/pending-payments?status=pending&account=bob123&cursor=3&limit=10", "", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, pending.Filter{Status: pending.Pending, Account: "bob123", Cursor: 3, Limit: 10}, gotFilter)
+
+	var page pending.Page
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []pending.Payment{}, page.Payments)
+
+	resp = doAdminRequest(t, server, http.MethodGet, "/admin/v1/pending-payments?limit=ten", "", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	paymentID := uint64(42)
+	var gotID uint64
+	var gotInput pending.ReviewInput
+	svc.onApprovePending = func(ctx context.Context, id uint64, input pending.ReviewInput) (pending.Payment, error) {
+		gotID, gotInput = id, input
+		return pending.Payment{
+			ID:         id,
+			Amount:     decimal.NewFromInt(1500),
+			Status:     pending.Approved,
+			Decisions:  []risk.Decision{{Rule: "new_counterparty", Outcome: risk.Review, Reason: "first payment"}},
+			ReviewedBy: "ops",
+			PaymentID:  &paymentID,
+		}, nil
+	}
+	resp = doAdminRequest(t, server, http.MethodPost, "/admin/v1/pending-payments/7/approve", "", `{"reason":"known supplier"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, uint64(7), gotID)
+	assert.Equal(t, pending.ReviewInput{Reason: "known supplier"}, gotInput)
+
+	var got pending.Payment
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, pending.Approved, got.Status)
+	assert.Equal(t, &paymentID, got.PaymentID)
+	assert.Equal(t, "new_counterparty", got.Decisions[0].Rule)
+
+	svc.onRejectPending = func(ctx context.Context, id uint64, input pending.ReviewInput) (pending.Payment, error) {
+		return pending.Payment{}, coins.ErrConflict("pending payment %d is approved", id)
+	}
+	resp = doAdminRequest(t, server, http.MethodPost, "/admin/v1/pending-payments/7/reject", "", `{"reason":"fraud"}`)
+	assert.Equal(t, http.StatusConflict, resp.StatusCode)
+
+	resp = doAdminRequest(t, server, http.MethodGet, "/admin/v1/pending-payments/seven", "", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func (m *mockStorage) SetAccountStatus(ctx context.Context, change account.Change, from ...account.Status) (acc account.Account, err error) {
+	return m.onSetAccountStatus(ctx, change, from...)
+}
+
+func (m *mockStorage) AdjustBalance(ctx context.Context, change account.Change) (acc account.Account, err error) {
+	return m.onAdjustBalance(ctx, change)
+}
+
+func (m *mockStorage) GetLimits(ctx context.Context, scope limit.Scope) (l limit.Limits, err error) {
+	return m.onGetLimits(ctx, scope)
+}
+
+func (m *mockStorage) SetLimits(ctx context.Context, l limit.Limits) (set limit.Limits, err error) {
+	return m.onSetLimits(ctx, l)
+}
+
+func (m *mockStorage) DeleteLimits(ctx context.Context, scope limit.Scope) (err error) {
+	return m.onDeleteLimits(ctx, scope)
+}
+
+func (m *mockStorage) ApprovePendingPayment(ctx context.Context, id uint64, review pending.Review) (pp pending.Payment, err error) {
+	return m.onApprovePending(ctx, id, review)
+}
+
+func (m *mockStorage) RejectPendingPayment(ctx context.Context, id uint64, review pending.Review) (pp pending.Payment, err error) {
+	return m.onRejectPending(ctx, id, review)
+}
+
+func TestAdminServiceErrors(t *testing.T) {
+	storage := &mockStorage{}
+	svc := newAdminService(log.NewNopLogger(), storage)
+	ctx := context.Background()
+
+	var gotChange account.Change
+	storage.onSetAccountStatus = func(ctx context.Context, change account.Change, from ...account.Status) (account.Account, error) {
+		gotChange = change
+		if change.Status == account.Active {
+			return account.Account{}, fmt.Errorf("account bob123 is active: %w", coins.ErrInvalidTransition)
+		}
+		return mustNewAccount(nil), nil
+	}
+	_, err := svc.SetAccountStatus(ctx, "bob123", account.StatusInput{Status: account.FrozenDebit, Reason: "fraud investigation"})
+	assert.NoError(t, err)
+	assert.Equal(t, account.Change{
+		AccountID: "bob123",
+		Type:      account.StatusChange,
+		Status:    account.FrozenDebit,
+		Reason:    "fraud investigation",
+	}, gotChange)
+
+	_, err = svc.SetAccountStatus(ctx, "bob123", account.StatusInput{Status: account.Active, Reason: "cleared"})
+	assert.Equal(t, http.StatusConflict, err.(*coins.ServiceError).Code)
+
+	_, err = svc.SetAccountStatus(ctx, "bob123", account.StatusInput{Status: account.FrozenAll})
+	assert.Equal(t, http.StatusBadRequest, err.(*coins.ServiceError).Code)
+
+	_, err = svc.SetAccountStatus(ctx, "bob123", account.StatusInput{Status: "suspended", Reason: "typo"})
+	assert.Equal(t, http.StatusBadRequest, err.(*coins.ServiceError).Code)
+
+	storage.onAdjustBalance = func(ctx context.Context, change account.Change) (account.Account, error) {
+		return account.Account{}, fmt.Errorf("account bob123: %w", coins.ErrInsufficientFunds)
+	}
+	_, err = svc.AdjustBalance(ctx, "bob123", account.AdjustmentInput{Amount: decimal.NewFromInt(-1000), Reason: "chargeback"})
+	assert.Equal(t, http.StatusUnprocessableEntity, err.(*coins.ServiceError).Code)
+
+	_, err = svc.AdjustBalance(ctx, "bob123", account.AdjustmentInput{Reason: "nothing"})
+	assert.Equal(t, http.StatusBadRequest, err.(*coins.ServiceError).Code)
+}
+
+func TestAdminServiceLimits(t *testing.T) {
+	storage := &mockStorage{}
+	svc := newAdminService(log.NewNopLogger(), storage)
+	ctx := auth.NewContext(context.Background(), auth.Principal{ID: "ops", Role: auth.Operator})
+
+	var gotLimits limit.Limits
+	storage.onSetLimits = func(ctx context.Context, l limit.Limits) (limit.Limits, error) {
+		gotLimits = l
+		if l.AccountID == "carol789" {
+			return limit.Limits{}, fmt.Errorf("account carol789: %w", coins.ErrNotFoundInStorage)
+		}
+		if l.MaxPayment != nil && l.MaxPayment.Exponent() < -2 {
+			return limit.Limits{}, fmt.Errorf("%s USD: %w", l.MaxPayment, coins.ErrInvalidAmount)
+		}
+		return l, nil
+	}
+	daily := decimal.NewFromInt(300)
+	_, err := svc.SetLimits(ctx, limit.Scope{Currency: "USD"}, limit.Input{DailyTotal: &daily})
+	assert.NoError(t, err)
+	assert.Equal(t, limit.Limits{Currency: "USD", DailyTotal: &daily, UpdatedBy: "ops"}, gotLimits)
+
+	_, err = svc.SetLimits(ctx, limit.Scope{AccountID: "carol789"}, limit.Input{DailyTotal: &daily})
+	assert.Equal(t, http.StatusNotFound, err.(*coins.ServiceError).Code)
+
+	precise := decimal.New(1, -3)
+	_, err = svc.SetLimits(ctx, limit.Scope{Currency: "USD"}, limit.Input{MaxPayment: &precise})
+	assert.Equal(t, http.StatusBadRequest, err.(*coins.ServiceError).Code)
+
+	negative := decimal.NewFromInt(-1)
+	_, err = svc.SetLimits(ctx, limit.Scope{Currency: "USD"}, limit.Input{MaxPayment: &negative})
+	assert.Equal(t, http.StatusBadRequest, err.(*coins.ServiceError).Code)
+
+	_, err = svc.GetLimits(ctx, limit.Scope{Currency: "XXY"})
+	assert.Equal(t, http.StatusBadRequest, err.(*coins.ServiceError).Code)
+
+	storage.onDeleteLimits = func(ctx context.Context, scope limit.Scope) error {
+		return fmt.Errorf("limits of %s: %w", scope.Currency, coins.ErrNotFoundInStorage)
+	}
+	err = svc.DeleteLimits(ctx, limit.Scope{Currency: "EUR"})
+	assert.Equal(t, http.StatusNotFound, err.(*coins.ServiceError).Code)
+}
+
+func TestAdminServicePendingPayments(t *testing.T) {
+	storage := &mockStorage{}
+	svc := newAdminService(log.NewNopLogger(), storage)
+	ctx := auth.NewContext(context.Background(), auth.Principal{ID: "ops", Role: auth.Operator})
+
+	paymentID := uint64(42)
+	var gotReview pending.Review
+	storage.onApprovePending = func(ctx context.Context, id uint64, review pending.Review) (pending.Payment, error) {
+		gotReview = review
+		switch id {
+		case 1:
+			return pending.Payment{ID: id, Status: pending.Approved, PaymentID: &paymentID}, nil
+		case 2:
+			return pending.Payment{}, fmt.Errorf("pending payment 2 is rejected: %w", coins.ErrPaymentReviewed)
+		case 3:
+			return pending.Payment{}, fmt.Errorf("account bob123: %w", coins.ErrInsufficientFunds)
+		case 5:
+			return pending.Payment{}, fmt.Errorf("pending payment 5 created by ops: %w", coins.ErrSelfApproval)
+		case 6:
+			return pending.Payment{}, fmt.Errorf("pending payment 6: %w", coins.ErrPaymentExpired)
+		case 7:
+			return pending.Payment{}, fmt.Errorf("pending payment 7: %w", coins.ErrAnonymousApproval)
+		default:
+			return pending.Payment{}, fmt.Errorf("pending payment %d: %w", id, coins.ErrNotFoundInStorage)
+		}
+	}
+
+	pp, err := svc.ApprovePendingPayment(ctx, 1, pending.ReviewInput{Reason: "known supplier"})
+	assert.NoError(t, err)
+	assert.Equal(t, &paymentID, pp.PaymentID)
+	assert.Equal(t, pending.Review{By: "ops", Reason: "known supplier"}, gotReview)
+
+	_, err = svc.ApprovePendingPayment(ctx, 2, pending.ReviewInput{Reason: "known supplier"})
+	assert.Equal(t, http.StatusConflict, err.(*coins.ServiceError).Code)
+
+	_, err = svc.ApprovePendingPayment(ctx, 3, pending.ReviewInput{Reason: "known supplier"})
+	assert.Equal(t, http.StatusUnprocessableEntity, err.(*coins.ServiceError).Code)
+
+	_, err = svc.ApprovePendingPayment(ctx, 4, pending.ReviewInput{Reason: "known supplier"})
+	assert.Equal(t, http.StatusNotFound, err.(*coins.ServiceError).Code)
+
+	_, err = svc.ApprovePendingPayment(ctx, 5, pending.ReviewInput{Reason: "known supplier"})
+	assert.Equal(t, http.StatusForbidden, err.(*coins.ServiceError).Code)
+
+	_, err = svc.ApprovePendingPayment(ctx, 6, pending.ReviewInput{Reason: "known supplier"})
+	assert.Equal(t, http.StatusConflict, err.(*coins.ServiceError).Code)
+
+	_, err = svc.ApprovePendingPayment(ctx, 7, pending.ReviewInput{Reason: "known supplier"})
+	assert.Equal(t, http.StatusForbidden, err.(*coins.ServiceError).Code)
+
+	_, err = svc.ApprovePendingPayment(ctx, 1, pending.ReviewInput{})
+	assert.Equal(t, http.StatusBadRequest, err.(*coins.ServiceError).Code)
+
+	storage.onRejectPending = func(ctx context.Context, id uint64, review pending.Review) (pending.Payment, error) {
+		return pending.Payment{}, fmt.Errorf("pending payment %d is approved: %w", id, coins.ErrPaymentReviewed)
+	}
+	_, err = svc.RejectPendingPayment(ctx, 1, pending.ReviewInput{Reason: "fraud"})
+	assert.Equal(t, http.StatusConflict, err.(*coins.ServiceError).Code)
+
+	_, err = svc.GetPendingPayments(ctx, pending.Filter{Status: "parked"})
+	assert.Equal(t, http.StatusBadRequest, err.(*coins.ServiceError).Code)
+}
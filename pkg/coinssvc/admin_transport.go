@@ -0,0 +1,304 @@
+package coinssvc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/audit"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/limit"
+	"github.com/donmikel/coins/pkg/pending"
+	"github.com/gorilla/mux"
+)
+
+type setAccountStatusRequest struct {
+	id    string
+	input account.StatusInput
+}
+
+type adminAccountResponse struct {
+	account account.Account
+}
+
+func decodeSetAccountStatusRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeAccountID(r)
+	if err != nil {
+		return nil, err
+	}
+	var input account.StatusInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, coins.ErrBadRequest("failed to decode JSON request: %v", err)
+	}
+
+	return setAccountStatusRequest{id: id, input: input}, nil
+}
+
+func encodeAdminAccountResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(adminAccountResponse)
+	return encodeAccountResponse(w, http.StatusOK, res.account)
+}
+
+type adjustBalanceRequest struct {
+	id    string
+	input account.AdjustmentInput
+}
+
+func decodeAdjustBalanceRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeAccountID(r)
+	if err != nil {
+		return nil, err
+	}
+	var input account.AdjustmentInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, coins.ErrBadRequest("failed to decode JSON request: %v", err)
+	}
+
+	return adjustBalanceRequest{id: id, input: input}, nil
+}
+
+type getAccountHistoryRequest struct {
+	id string
+}
+
+type getAccountHistoryResponse struct {
+	changes []account.Change
+}
+
+func decodeGetAccountHistoryRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeAccountID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return getAccountHistoryRequest{id: id}, nil
+}
+
+func encodeGetAccountHistoryResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(getAccountHistoryResponse)
+	changes := res.changes
+	if changes == nil {
+		changes = []account.Change{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(changes); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+type getAuditLogRequest struct {
+	filter audit.Filter
+}
+
+type getAuditLogResponse struct {
+	page audit.Page
+}
+
+func decodeGetAuditLogRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	f := audit.Filter{
+		Principal: q.Get("principal"),
+		Method:    q.Get("method"),
+		RequestID: q.Get("request_id"),
+	}
+	var err error
+	if f.From, err = decodeTimeParam(q, "from"); err != nil {
+		return nil, err
+	}
+	if f.To, err = decodeTimeParam(q, "to"); err != nil {
+		return nil, err
+	}
+	if v := q.Get("cursor"); v != "" {
+		if f.Cursor, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return nil, coins.ErrBadRequest("invalid cursor: %v", err)
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil {
+			return nil, coins.ErrBadRequest("invalid limit: %v", err)
+		}
+	}
+
+	return getAuditLogRequest{filter: f}, nil
+}
+
+func encodeGetAuditLogResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(getAuditLogResponse)
+	page := res.page
+	if page.Records == nil {
+		page.Records = []audit.Record{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+type limitsRequest struct {
+	scope limit.Scope
+}
+
+type setLimitsRequest struct {
+	scope limit.Scope
+	input limit.Input
+}
+
+type limitsResponse struct {
+	limits limit.Limits
+}
+
+type deleteLimitsResponse struct{}
+
+// decodeLimitsScope returns the scope of limits of the account or the currency in the request path.
+func decodeLimitsScope(r *http.Request) (limit.Scope, error) {
+	vars := mux.Vars(r)
+	if c, ok := vars["currency"]; ok {
+		return limit.Scope{Currency: c}, nil
+	}
+	id, err := decodeAccountID(r)
+	if err != nil {
+		return limit.Scope{}, err
+	}
+
+	return limit.Scope{AccountID: id}, nil
+}
+
+func decodeLimitsRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	scope, err := decodeLimitsScope(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return limitsRequest{scope: scope}, nil
+}
+
+func decodeSetLimitsRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	scope, err := decodeLimitsScope(r)
+	if err != nil {
+		return nil, err
+	}
+	var input limit.Input
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, coins.ErrBadRequest("failed to decode JSON request: %v", err)
+	}
+
+	return setLimitsRequest{scope: scope, input: input}, nil
+}
+
+func encodeLimitsResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(limitsResponse)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res.limits); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+func encodeDeleteLimitsResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type getPendingPaymentsRequest struct {
+	filter pending.Filter
+}
+
+type getPendingPaymentsResponse struct {
+	page pending.Page
+}
+
+type pendingPaymentRequest struct {
+	id uint64
+}
+
+type reviewPendingPaymentRequest struct {
+	id    uint64
+	input pending.ReviewInput
+}
+
+type pendingPaymentResponse struct {
+	payment pending.Payment
+}
+
+func decodeGetPendingPaymentsRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	f := pending.Filter{
+		Status:  pending.Status(q.Get("status")),
+		Account: q.Get("account"),
+	}
+	var err error
+	if v := q.Get("cursor"); v != "" {
+		if f.Cursor, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return nil, coins.ErrBadRequest("invalid cursor: %v", err)
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil {
+			return nil, coins.ErrBadRequest("invalid limit: %v", err)
+		}
+	}
+
+	return getPendingPaymentsRequest{filter: f}, nil
+}
+
+func encodeGetPendingPaymentsResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(getPendingPaymentsResponse)
+	page := res.page
+	if page.Payments == nil {
+		page.Payments = []pending.Payment{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+func decodePendingPaymentID(r *http.Request) (uint64, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return 0, coins.ErrBadRequest("invalid pending payment id: %v", err)
+	}
+
+	return id, nil
+}
+
+func decodePendingPaymentRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodePendingPaymentID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return pendingPaymentRequest{id: id}, nil
+}
+
+func decodeReviewPendingPaymentRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodePendingPaymentID(r)
+	if err != nil {
+		return nil, err
+	}
+	var input pending.ReviewInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, coins.ErrBadRequest("failed to decode JSON request: %v", err)
+	}
+
+	return reviewPendingPaymentRequest{id: id, input: input}, nil
+}
+
+func encodePendingPaymentResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(pendingPaymentResponse)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res.payment); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,368 @@
+package coinssvc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/audit"
+	"github.com/donmikel/coins/pkg/auth"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/fx"
+	"github.com/donmikel/coins/pkg/hold"
+	"github.com/donmikel/coins/pkg/limit"
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/pending"
+	"github.com/donmikel/coins/pkg/schedule"
+	"github.com/donmikel/coins/pkg/webhook"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// requestIDHeader is a request header with the ID of the request, generated if it is missing.
+// The ID is returned in the response header of the same name.
+const requestIDHeader = "X-Request-ID"
+
+// requestIDMetadata is a gRPC metadata key with the ID of the request.
+const requestIDMetadata = "x-request-id"
+
+// forwardedForHeader is a request header with the client IP address added by proxies.
+const forwardedForHeader = "X-Forwarded-For"
+
+// maxRequestIDLen is the maximum length of a request ID given by the client.
+const maxRequestIDLen = 128
+
+// auditTimeout is the timeout of appending a record to the audit log.
+const auditTimeout = 5 * time.Second
+
+// newRequestID returns a random request ID.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestID returns the request ID given by the client if it is valid, otherwise a new request ID.
+func requestID(id string) string {
+	if id == "" || len(id) > maxRequestIDLen || strings.IndexFunc(id, func(r rune) bool { return r < '!' || r > '~' }) >= 0 {
+		return newRequestID()
+	}
+	return id
+}
+
+// clientIP returns the client IP address, the first address of forwardedFor if the proxy is trusted.
+func clientIP(remoteAddr, forwardedFor string, trustProxy bool) string {
+	if trustProxy && forwardedFor != "" {
+		return strings.TrimSpace(strings.Split(forwardedFor, ",")[0])
+	}
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// withRequest returns a handler that passes requests to next with the request ID and the client IP
+// in the request context.
+func withRequest(trustProxy bool, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := audit.Request{
+			ID:       requestID(r.Header.Get(requestIDHeader)),
+			ClientIP: clientIP(r.RemoteAddr, r.Header.Get(forwardedForHeader), trustProxy),
+		}
+		w.Header().Set(requestIDHeader, req.ID)
+		next.ServeHTTP(w, r.WithContext(audit.NewContext(r.Context(), req)))
+	})
+}
+
+// grpcRequestInterceptor puts the request ID and the client IP of gRPC calls in the call context.
+func grpcRequestInterceptor(trustProxy bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var id, forwardedFor, remoteAddr string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if v := md.Get(requestIDMetadata); len(v) > 0 {
+				id = v[0]
+			}
+			if v := md.Get(strings.ToLower(forwardedForHeader)); len(v) > 0 {
+				forwardedFor = v[0]
+			}
+		}
+		if p, ok := peer.FromContext(ctx); ok {
+			remoteAddr = p.Addr.String()
+		}
+		r := audit.Request{
+			ID:       requestID(id),
+			ClientIP: clientIP(remoteAddr, forwardedFor, trustProxy),
+		}
+		grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, r.ID))
+
+		return handler(audit.NewContext(ctx, r), req)
+	}
+}
+
+// chainUnaryInterceptors returns an interceptor calling the interceptors in the given order.
+func chainUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		for i := len(interceptors) - 1; i >= 0; i-- {
+			interceptor, next := interceptors[i], handler
+			handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+				return interceptor(ctx, req, info, next)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// valuesContext carries the values of a context without its cancellation,
+// so that calls of canceled requests are audited too.
+type valuesContext struct {
+	context.Context
+}
+
+func (valuesContext) Deadline() (deadline time.Time, ok bool) { return }
+func (valuesContext) Done() <-chan struct{}                   { return nil }
+func (valuesContext) Err() error                              { return nil }
+
+// auditor appends records of calls to the audit log.
+type auditor struct {
+	store  audit.Store
+	logger log.Logger
+}
+
+// record appends the record of the method call with the input and the error to the audit log.
+// A call that is not recorded fails with an internal error, even though it is already made,
+// so the client never takes an unaudited change for a successful one.
+func (a *auditor) record(ctx context.Context, method string, input interface{}, err *error) {
+	p, _ := auth.FromContext(ctx)
+	req, _ := audit.FromContext(ctx)
+	r := audit.Record{
+		Principal: p.ID,
+		RequestID: req.ID,
+		ClientIP:  req.ClientIP,
+		Method:    method,
+		Outcome:   audit.Success,
+	}
+	if *err != nil {
+		r.Outcome = audit.Failure
+		r.Error = (*err).Error()
+	}
+	var merr error
+	if r.Input, merr = json.Marshal(input); merr != nil {
+		level.Error(a.logger).Log("msg", "failed to encode audited input", "method", method, "err", merr)
+		r.Input = nil
+	}
+
+	ctx, cancel := context.WithTimeout(valuesContext{ctx}, auditTimeout)
+	defer cancel()
+	if _, aerr := a.store.AppendAuditRecord(ctx, r); aerr != nil {
+		level.Error(a.logger).Log("msg", "failed to audit call", "method", method, "principal", r.Principal,
+			"request_id", r.RequestID, "outcome", r.Outcome, "err", aerr)
+		if *err == nil {
+			*err = coins.ErrInternal("failed to audit call: %s", aerr)
+		}
+	}
+}
+
+// AuditMiddleware wraps Service and records mutating calls in the audit log.
+type AuditMiddleware struct {
+	svc Service
+	auditor
+}
+
+func NewAuditMiddleware(svc Service, store audit.Store, logger log.Logger) *AuditMiddleware {
+	return &AuditMiddleware{
+		svc:     svc,
+		auditor: auditor{store: store, logger: logger},
+	}
+}
+
+// idInput is the audited input of calls with an ID.
+type idInput struct {
+	ID    interface{} `json:"id"`
+	Input interface{} `json:"input,omitempty"`
+}
+
+func (mw *AuditMiddleware) GetAllPayments(ctx context.Context, filter payment.Filter) (page payment.Page, err error) {
+	return mw.svc.GetAllPayments(ctx, filter)
+}
+
+func (mw *AuditMiddleware) SendPayment(ctx context.Context, input payment.PaymentInput) (p payment.Payment, err error) {
+	defer mw.record(ctx, "SendPayment", input, &err)
+	return mw.svc.SendPayment(ctx, input)
+}
+
+func (mw *AuditMiddleware) SendPayments(ctx context.Context, input payment.BatchInput) (res payment.BatchResult, err error) {
+	defer mw.record(ctx, "SendPayments", input, &err)
+	return mw.svc.SendPayments(ctx, input)
+}
+
+func (mw *AuditMiddleware) GetPayment(ctx context.Context, id uint64) (p payment.Payment, err error) {
+	return mw.svc.GetPayment(ctx, id)
+}
+
+func (mw *AuditMiddleware) RefundPayment(ctx context.Context, id uint64, input payment.RefundInput) (p payment.Payment, err error) {
+	defer mw.record(ctx, "RefundPayment", idInput{ID: id, Input: input}, &err)
+	return mw.svc.RefundPayment(ctx, id, input)
+}
+
+func (mw *AuditMiddleware) GetAvailableAccounts(ctx context.Context) (accounts []account.Account, err error) {
+	return mw.svc.GetAvailableAccounts(ctx)
+}
+
+func (mw *AuditMiddleware) CreateAccount(ctx context.Context, input account.Account) (acc account.Account, err error) {
+	defer mw.record(ctx, "CreateAccount", input, &err)
+	return mw.svc.CreateAccount(ctx, input)
+}
+
+func (mw *AuditMiddleware) GetAccount(ctx context.Context, id string) (acc account.Account, err error) {
+	return mw.svc.GetAccount(ctx, id)
+}
+
+func (mw *AuditMiddleware) UpdateAccount(ctx context.Context, id string, input account.AccountUpdate) (acc account.Account, err error) {
+	defer mw.record(ctx, "UpdateAccount", idInput{ID: id, Input: input}, &err)
+	return mw.svc.UpdateAccount(ctx, id, input)
+}
+
+func (mw *AuditMiddleware) CloseAccount(ctx context.Context, id string) (err error) {
+	defer mw.record(ctx, "CloseAccount", idInput{ID: id}, &err)
+	return mw.svc.CloseAccount(ctx, id)
+}
+
+func (mw *AuditMiddleware) GetStatement(ctx context.Context, id string, from, to *time.Time) (st account.Statement, err error) {
+	return mw.svc.GetStatement(ctx, id, from, to)
+}
+
+func (mw *AuditMiddleware) CreateQuote(ctx context.Context, input fx.QuoteInput) (q fx.Quote, err error) {
+	defer mw.record(ctx, "CreateQuote", input, &err)
+	return mw.svc.CreateQuote(ctx, input)
+}
+
+func (mw *AuditMiddleware) CreateSchedule(ctx context.Context, input schedule.ScheduleInput) (sch schedule.Schedule, err error) {
+	defer mw.record(ctx, "CreateSchedule", input, &err)
+	return mw.svc.CreateSchedule(ctx, input)
+}
+
+func (mw *AuditMiddleware) GetSchedules(ctx context.Context, accountID string) (schedules []schedule.Schedule, err error) {
+	return mw.svc.GetSchedules(ctx, accountID)
+}
+
+func (mw *AuditMiddleware) GetSchedule(ctx context.Context, id uint64) (sch schedule.Schedule, err error) {
+	return mw.svc.GetSchedule(ctx, id)
+}
+
+func (mw *AuditMiddleware) CancelSchedule(ctx context.Context, id uint64) (err error) {
+	defer mw.record(ctx, "CancelSchedule", idInput{ID: id}, &err)
+	return mw.svc.CancelSchedule(ctx, id)
+}
+
+func (mw *AuditMiddleware) AuthorizePayment(ctx context.Context, input hold.AuthorizeInput) (h hold.Hold, err error) {
+	defer mw.record(ctx, "AuthorizePayment", input, &err)
+	return mw.svc.AuthorizePayment(ctx, input)
+}
+
+func (mw *AuditMiddleware) GetHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	return mw.svc.GetHold(ctx, id)
+}
+
+func (mw *AuditMiddleware) CaptureHold(ctx context.Context, id uint64, input hold.CaptureInput) (h hold.Hold, err error) {
+	defer mw.record(ctx, "CaptureHold", idInput{ID: id, Input: input}, &err)
+	return mw.svc.CaptureHold(ctx, id, input)
+}
+
+func (mw *AuditMiddleware) VoidHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	defer mw.record(ctx, "VoidHold", idInput{ID: id}, &err)
+	return mw.svc.VoidHold(ctx, id)
+}
+
+// CreateSubscription is audited without the signing secret of the subscription.
+func (mw *AuditMiddleware) CreateSubscription(ctx context.Context, accountID string, input webhook.SubscriptionInput) (sub webhook.Subscription, err error) {
+	audited := input
+	if audited.Secret != "" {
+		audited.Secret = "redacted"
+	}
+	defer mw.record(ctx, "CreateSubscription", idInput{ID: accountID, Input: audited}, &err)
+	return mw.svc.CreateSubscription(ctx, accountID, input)
+}
+
+func (mw *AuditMiddleware) GetSubscriptions(ctx context.Context, accountID string) (subs []webhook.Subscription, err error) {
+	return mw.svc.GetSubscriptions(ctx, accountID)
+}
+
+func (mw *AuditMiddleware) GetSubscription(ctx context.Context, id uint64) (sub webhook.Subscription, err error) {
+	return mw.svc.GetSubscription(ctx, id)
+}
+
+func (mw *AuditMiddleware) DeleteSubscription(ctx context.Context, id uint64) (err error) {
+	defer mw.record(ctx, "DeleteSubscription", idInput{ID: id}, &err)
+	return mw.svc.DeleteSubscription(ctx, id)
+}
+
+func (mw *AuditMiddleware) GetDeliveries(ctx context.Context, subscriptionID uint64) (deliveries []webhook.Delivery, err error) {
+	return mw.svc.GetDeliveries(ctx, subscriptionID)
+}
+
+// adminAuditMiddleware wraps AdminService and records account changes in the audit log.
+type adminAuditMiddleware struct {
+	svc AdminService
+	auditor
+}
+
+func (mw *adminAuditMiddleware) SetAccountStatus(ctx context.Context, id string, input account.StatusInput) (acc account.Account, err error) {
+	defer mw.record(ctx, "SetAccountStatus", idInput{ID: id, Input: input}, &err)
+	return mw.svc.SetAccountStatus(ctx, id, input)
+}
+
+func (mw *adminAuditMiddleware) AdjustBalance(ctx context.Context, id string, input account.AdjustmentInput) (acc account.Account, err error) {
+	defer mw.record(ctx, "AdjustBalance", idInput{ID: id, Input: input}, &err)
+	return mw.svc.AdjustBalance(ctx, id, input)
+}
+
+func (mw *adminAuditMiddleware) GetAccountHistory(ctx context.Context, id string) (changes []account.Change, err error) {
+	return mw.svc.GetAccountHistory(ctx, id)
+}
+
+func (mw *adminAuditMiddleware) GetAuditLog(ctx context.Context, filter audit.Filter) (page audit.Page, err error) {
+	return mw.svc.GetAuditLog(ctx, filter)
+}
+
+func (mw *adminAuditMiddleware) GetLimits(ctx context.Context, scope limit.Scope) (l limit.Limits, err error) {
+	return mw.svc.GetLimits(ctx, scope)
+}
+
+func (mw *adminAuditMiddleware) SetLimits(ctx context.Context, scope limit.Scope, input limit.Input) (l limit.Limits, err error) {
+	defer mw.record(ctx, "SetLimits", idInput{ID: scope, Input: input}, &err)
+	return mw.svc.SetLimits(ctx, scope, input)
+}
+
+func (mw *adminAuditMiddleware) DeleteLimits(ctx context.Context, scope limit.Scope) (err error) {
+	defer mw.record(ctx, "DeleteLimits", idInput{ID: scope}, &err)
+	return mw.svc.DeleteLimits(ctx, scope)
+}
+
+func (mw *adminAuditMiddleware) GetPendingPayments(ctx context.Context, filter pending.Filter) (page pending.Page, err error) {
+	return mw.svc.GetPendingPayments(ctx, filter)
+}
+
+func (mw *adminAuditMiddleware) GetPendingPayment(ctx context.Context, id uint64) (pp pending.Payment, err error) {
+	return mw.svc.GetPendingPayment(ctx, id)
+}
+
+func (mw *adminAuditMiddleware) ApprovePendingPayment(ctx context.Context, id uint64, input pending.ReviewInput) (pp pending.Payment, err error) {
+	defer mw.record(ctx, "ApprovePendingPayment", idInput{ID: id, Input: input}, &err)
+	return mw.svc.ApprovePendingPayment(ctx, id, input)
+}
+
+func (mw *adminAuditMiddleware) RejectPendingPayment(ctx context.Context, id uint64, input pending.ReviewInput) (pp pending.Payment, err error) {
+	defer mw.record(ctx, "RejectPendingPayment", idInput{ID: id, Input: input}, &err)
+	return mw.svc.RejectPendingPayment(ctx, id, input)
+}
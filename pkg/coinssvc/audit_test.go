@@ -0,0 +1,265 @@
+package coinssvc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/audit"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/webhook"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryAuditStore keeps appended audit records in memory.
+type memoryAuditStore struct {
+	mu      sync.Mutex
+	records []audit.Record
+}
+
+func (s *memoryAuditStore) AppendAuditRecord(ctx context.Context, r audit.Record) (audit.Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r.ID = uint64(len(s.records) + 1)
+	s.records = append(s.records, r)
+	return r, nil
+}
+
+func (s *memoryAuditStore) GetAuditRecords(ctx context.Context, f audit.Filter) (page audit.Page, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	page.Records = append(page.Records, s.records...)
+	return page, nil
+}
+
+func initAuditTest(t *testing.T) (*httptest.Server, *mockService, *memoryAuditStore) {
+	svc := initAuthTest()
+	store := &memoryAuditStore{}
+	handler := makeHandler(NewAuditMiddleware(NewAuthorizingMiddleware(svc), store, log.NewNopLogger()))
+	server := httptest.NewServer(withRequest(true, authenticate(testAuthenticator{}, handler)))
+	t.Cleanup(server.Close)
+	return server, svc, store
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	server, svc, store := initAuditTest(t)
+	client := &http.Client{Timeout: time.Second}
+
+	post := func(path, token, body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(authorizationHeader, "Bearer "+token)
+		req.Header.Set(requestIDHeader, "req-1")
+		req.Header.Set(forwardedForHeader, "203.0.113.7, 10.0.0.1")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := post("/api/v1/payments", "bob-key", `{"from_account":"bob123","to_account":"alice456","amount":"10"}`)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "req-1", resp.Header.Get(requestIDHeader))
+
+	// Rejected calls are audited too.
+	resp = post("/api/v1/payments", "bob-key", `{"from_account":"alice456","to_account":"bob123","amount":"10"}`)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	svc.onCreateSubscription = func(ctx context.Context, accountID string, input webhook.SubscriptionInput) (webhook.Subscription, error) {
+		assert.Equal(t, "whsec", input.Secret)
+		return webhook.Subscription{ID: 1, AccountID: accountID, URL: input.URL}, nil
+	}
+	post("/api/v1/accounts/bob123/webhooks", "bob-key", `{"url":"https://example.com/hook","secret":"whsec"}`)
+
+	// Reads are not audited.
+	svc.onGetAllPayments = func(ctx context.Context, filter payment.Filter) (payment.Page, error) {
+		return payment.Page{}, nil
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/v1/payments", nil)
+	req.Header.Set(authorizationHeader, "Bearer bob-key")
+	if resp, err := client.Do(req); assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+
+	if !assert.Len(t, store.records, 3) {
+		return
+	}
+	r := store.records[0]
+	assert.Equal(t, "bob", r.Principal)
+	assert.Equal(t, "req-1", r.RequestID)
+	assert.Equal(t, "203.0.113.7", r.ClientIP)
+	assert.Equal(t, "SendPayment", r.Method)
+	assert.Equal(t, audit.Success, r.Outcome)
+	assert.Contains(t, string(r.Input), `"from_account":"bob123"`)
+
+	r = store.records[1]
+	assert.Equal(t, audit.Failure, r.Outcome)
+	assert.Equal(t, coins.ErrForbidden("account alice456 is not owned by bob").Error(), r.Error)
+
+	r = store.records[2]
+	assert.Equal(t, "CreateSubscription", r.Method)
+	assert.Contains(t, string(r.Input), `"id":"bob123"`)
+	assert.NotContains(t, string(r.Input), "whsec")
+}
+
+func TestAuditCanceledRequest(t *testing.T) {
+	store := &memoryAuditStore{}
+	svc := &mockService{
+		onCloseAccount: func(ctx context.Context, id string) error {
+			return nil
+		},
+	}
+	mw := NewAuditMiddleware(svc, store, log.NewNopLogger())
+
+	ctx, cancel := context.WithCancel(audit.NewContext(context.Background(), audit.Request{ID: "req-2"}))
+	cancel()
+	assert.NoError(t, mw.CloseAccount(ctx, "bob123"))
+	if assert.Len(t, store.records, 1) {
+		assert.Equal(t, "req-2", store.records[0].RequestID)
+		assert.Equal(t, `{"id":"bob123"}`, string(store.records[0].Input))
+	}
+}
+
+// failingAuditStore fails to append audit records.
+type failingAuditStore struct {
+	memoryAuditStore
+}
+
+func (s *failingAuditStore) AppendAuditRecord(ctx context.Context, r audit.Record) (audit.Record, error) {
+	return r, errors.New("connection refused")
+}
+
+func TestAuditAppendFailure(t *testing.T) {
+	var closed bool
+	svc := &mockService{
+		onCloseAccount: func(ctx context.Context, id string) error {
+			closed = true
+			return nil
+		},
+	}
+	mw := NewAuditMiddleware(svc, &failingAuditStore{}, log.NewNopLogger())
+
+	// An unaudited call is never reported as successful.
+	err := mw.CloseAccount(context.Background(), "bob123")
+	assert.True(t, closed)
+	assertServiceErrorCode(t, http.StatusInternalServerError, err)
+
+	svc.onCloseAccount = func(ctx context.Context, id string) error {
+		return coins.ErrNotFound("account %s not found", id)
+	}
+	err = mw.CloseAccount(context.Background(), "bob123")
+	assertServiceErrorCode(t, http.StatusNotFound, err)
+}
+
+func TestWithRequest(t *testing.T) {
+	var got audit.Request
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = audit.FromContext(r.Context())
+	})
+
+	testCases := []struct {
+		name       string
+		trustProxy bool
+		requestID  string
+		wantIP     string
+		wantNewID  bool
+	}{
+		{
+			name:      "proxy is not trusted",
+			requestID: "req-1",
+			wantIP:    "192.0.2.1",
+		},
+		{
+			name:       "proxy is trusted",
+			trustProxy: true,
+			requestID:  "req-1",
+			wantIP:     "203.0.113.7",
+		},
+		{
+			name:      "missing request id",
+			wantIP:    "192.0.2.1",
+			wantNewID: true,
+		},
+		{
+			name:      "invalid request id",
+			requestID: "req 1",
+			wantIP:    "192.0.2.1",
+			wantNewID: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/payments", nil)
+			r.RemoteAddr = "192.0.2.1:5000"
+			r.Header.Set(forwardedForHeader, "203.0.113.7")
+			if tc.requestID != "" {
+				r.Header.Set(requestIDHeader, tc.requestID)
+			}
+			w := httptest.NewRecorder()
+			withRequest(tc.trustProxy, handler).ServeHTTP(w, r)
+
+			assert.Equal(t, tc.wantIP, got.ClientIP)
+			assert.Equal(t, got.ID, w.Header().Get(requestIDHeader))
+			if tc.wantNewID {
+				assert.Len(t, got.ID, 32)
+			} else {
+				assert.Equal(t, tc.requestID, got.ID)
+			}
+		})
+	}
+}
+
+func TestAdminAuditLog(t *testing.T) {
+	var gotFilter audit.Filter
+	store := &memoryAuditStore{}
+	svc := &adminAuditMiddleware{
+		svc: &mockAdminService{
+			onSetAccountStatus: func(ctx context.Context, id string, input account.StatusInput) (account.Account, error) {
+				return mustNewAccount(nil), nil
+			},
+			onGetAuditLog: func(ctx context.Context, filter audit.Filter) (audit.Page, error) {
+				gotFilter = filter
+				return store.GetAuditRecords(ctx, filter)
+			},
+		},
+		auditor: auditor{store: store, logger: log.NewNopLogger()},
+	}
+	server := httptest.NewServer(withRequest(false, makeAdminHandler(svc, testAuthenticator{})))
+	defer server.Close()
+
+	resp := doAdminRequest(t, server, http.MethodPost, "/admin/v1/accounts/bob123/status", "operator-key", `{"status":"frozen-all","reason":"fraud"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = doAdminRequest(t, server, http.MethodGet, "/admin/v1/audit?principal=ops&limit=10", "bob-key", "")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = doAdminRequest(t, server, http.MethodGet, "/admin/v1/audit?principal=ops&limit=10", "auditor-key", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, audit.Filter{Principal: "ops", Limit: 10}, gotFilter)
+
+	var page audit.Page
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, page.Records, 1) {
+		assert.Equal(t, "SetAccountStatus", page.Records[0].Method)
+		assert.Equal(t, "ops", page.Records[0].Principal)
+	}
+
+	resp = doAdminRequest(t, server, http.MethodGet, "/admin/v1/audit?from=yesterday", "auditor-key", "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
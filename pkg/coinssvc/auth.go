@@ -0,0 +1,436 @@
+package coinssvc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/auth"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/fx"
+	"github.com/donmikel/coins/pkg/hold"
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/schedule"
+	"github.com/donmikel/coins/pkg/webhook"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// authorizationHeader is a request header with the bearer token of the principal.
+const authorizationHeader = "Authorization"
+
+// authorizationMetadata is a gRPC metadata key with the bearer token of the principal, keys are lowercase.
+const authorizationMetadata = "authorization"
+
+// authenticationError converts an authentication error into a service error.
+func authenticationError(err error) error {
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		return coins.ErrUnauthorized("%s", err)
+	}
+	return coins.ErrInternal("failed to authenticate: %s", err)
+}
+
+// authenticate returns a handler that passes requests with valid credentials to next
+// with the principal in the request context.
+func authenticate(a auth.Authenticator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		token, err := auth.ParseAuthorization(r.Header.Get(authorizationHeader))
+		if err == nil {
+			var p auth.Principal
+			if p, err = a.Authenticate(ctx, token); err == nil {
+				next.ServeHTTP(w, r.WithContext(auth.NewContext(ctx, p)))
+				return
+			}
+		}
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		encodeError(ctx, authenticationError(err), w)
+	})
+}
+
+// withAuthentication returns next authenticated with a, or next itself if a is nil.
+func withAuthentication(a auth.Authenticator, next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+	return authenticate(a, next)
+}
+
+// withRoles returns next authenticated with a and available only to principals with one of the roles,
+// or next itself if a is nil.
+func withRoles(a auth.Authenticator, next http.Handler, roles ...auth.Role) http.Handler {
+	return withAuthentication(a, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a != nil {
+			p, _ := auth.FromContext(r.Context())
+			if !p.HasRole(roles...) {
+				encodeError(r.Context(), coins.ErrForbidden("%s is not allowed to %s %s", p.ID, r.Method, r.URL.Path), w)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
+
+// grpcAuthInterceptor authenticates gRPC calls by the authorization metadata.
+func grpcAuthInterceptor(a auth.Authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var header string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if v := md.Get(authorizationMetadata); len(v) > 0 {
+				header = v[0]
+			}
+		}
+		token, err := auth.ParseAuthorization(header)
+		if err != nil {
+			return nil, encodeGRPCError(authenticationError(err))
+		}
+		p, err := a.Authenticate(ctx, token)
+		if err != nil {
+			return nil, encodeGRPCError(authenticationError(err))
+		}
+
+		return handler(auth.NewContext(ctx, p), req)
+	}
+}
+
+// AuthorizingMiddleware wraps Service and allows principals to debit, change, subscribe to and read
+// only accounts they own. Accounts are owned by principals that created them.
+// Requests without a principal are rejected.
+type AuthorizingMiddleware struct {
+	svc Service
+}
+
+func NewAuthorizingMiddleware(svc Service) *AuthorizingMiddleware {
+	return &AuthorizingMiddleware{svc: svc}
+}
+
+// principal returns the principal of the request.
+func principal(ctx context.Context) (auth.Principal, error) {
+	p, ok := auth.FromContext(ctx)
+	if !ok {
+		return p, coins.ErrUnauthorized("unauthenticated request")
+	}
+	return p, nil
+}
+
+// checkOwner checks that the principal of the request owns the accounts.
+func (mw *AuthorizingMiddleware) checkOwner(ctx context.Context, ids ...string) error {
+	p, err := principal(ctx)
+	if err != nil {
+		return err
+	}
+	checked := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if checked[id] {
+			continue
+		}
+		checked[id] = true
+		acc, err := mw.svc.GetAccount(ctx, id)
+		if err != nil {
+			return err
+		}
+		if acc.Owner != p.ID {
+			return coins.ErrForbidden("account %s is not owned by %s", id, p.ID)
+		}
+	}
+
+	return nil
+}
+
+// checkAnyOwner checks that the principal of the request owns at least one of the accounts.
+func (mw *AuthorizingMiddleware) checkAnyOwner(ctx context.Context, ids ...string) (err error) {
+	for _, id := range ids {
+		if err = mw.checkOwner(ctx, id); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// owns reports whether the principal of the request owns the account, unknown accounts are not owned.
+func (mw *AuthorizingMiddleware) owns(ctx context.Context, id string) (bool, error) {
+	err := mw.checkOwner(ctx, id)
+	var e *coins.ServiceError
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.As(err, &e) && (e.Code == http.StatusForbidden || e.Code == http.StatusNotFound):
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// GetAllPayments lists payments of an account owned by the principal only.
+func (mw *AuthorizingMiddleware) GetAllPayments(ctx context.Context, filter payment.Filter) (page payment.Page, err error) {
+	if filter.Account == "" {
+		return page, coins.ErrForbidden("payments are listed by account")
+	}
+	if err = mw.checkOwner(ctx, filter.Account); err != nil {
+		return page, err
+	}
+	return mw.svc.GetAllPayments(ctx, filter)
+}
+
+func (mw *AuthorizingMiddleware) SendPayment(ctx context.Context, input payment.PaymentInput) (p payment.Payment, err error) {
+	if err = mw.checkOwner(ctx, input.FromAccount); err != nil {
+		return p, err
+	}
+	return mw.svc.SendPayment(ctx, input)
+}
+
+// SendPayments rejects the whole batch if any of the payments debits an account the principal does not own.
+func (mw *AuthorizingMiddleware) SendPayments(ctx context.Context, input payment.BatchInput) (res payment.BatchResult, err error) {
+	ids := make([]string, len(input.Payments))
+	for i, in := range input.Payments {
+		ids[i] = in.FromAccount
+	}
+	if err = mw.checkOwner(ctx, ids...); err != nil {
+		return res, err
+	}
+	return mw.svc.SendPayments(ctx, input)
+}
+
+// GetPayment allows the owners of both payment accounts to read it.
+func (mw *AuthorizingMiddleware) GetPayment(ctx context.Context, id uint64) (p payment.Payment, err error) {
+	if p, err = mw.svc.GetPayment(ctx, id); err != nil {
+		return p, err
+	}
+	if err = mw.checkAnyOwner(ctx, p.FromAccount, p.ToAccount); err != nil {
+		return payment.Payment{}, err
+	}
+	return p, nil
+}
+
+// RefundPayment allows the owner of the payment destination account to refund it, since the refund debits it.
+func (mw *AuthorizingMiddleware) RefundPayment(ctx context.Context, id uint64, input payment.RefundInput) (p payment.Payment, err error) {
+	orig, err := mw.svc.GetPayment(ctx, id)
+	if err != nil {
+		return p, err
+	}
+	if err = mw.checkOwner(ctx, orig.ToAccount); err != nil {
+		return p, err
+	}
+	return mw.svc.RefundPayment(ctx, id, input)
+}
+
+// GetAvailableAccounts returns the accounts of the principal only.
+func (mw *AuthorizingMiddleware) GetAvailableAccounts(ctx context.Context) (accounts []account.Account, err error) {
+	p, err := principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	all, err := mw.svc.GetAvailableAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	accounts = make([]account.Account, 0, len(all))
+	for _, acc := range all {
+		if acc.Owner == p.ID {
+			accounts = append(accounts, acc)
+		}
+	}
+	return accounts, nil
+}
+
+// CreateAccount makes the principal the owner of the created account, only customers own accounts.
+// Customers open empty accounts, operators fund them with the admin API.
+func (mw *AuthorizingMiddleware) CreateAccount(ctx context.Context, input account.Account) (acc account.Account, err error) {
+	p, err := principal(ctx)
+	if err != nil {
+		return acc, err
+	}
+	if p.Role != auth.Customer {
+		return acc, coins.ErrForbidden("%s is not allowed to own accounts", p.Role)
+	}
+	if !input.Balance.IsZero() {
+		return acc, coins.ErrForbidden("balance is adjusted by operators")
+	}
+	input.Owner = p.ID
+	return mw.svc.CreateAccount(ctx, input)
+}
+
+func (mw *AuthorizingMiddleware) GetAccount(ctx context.Context, id string) (acc account.Account, err error) {
+	p, err := principal(ctx)
+	if err != nil {
+		return acc, err
+	}
+	if acc, err = mw.svc.GetAccount(ctx, id); err != nil {
+		return acc, err
+	}
+	if acc.Owner != p.ID {
+		return account.Account{}, coins.ErrForbidden("account %s is not owned by %s", id, p.ID)
+	}
+	return acc, nil
+}
+
+// UpdateAccount does not allow to change the balance, operators adjust it with the admin API.
+// The currency is changed by owners, the storage rejects the change for accounts already in use.
+func (mw *AuthorizingMiddleware) UpdateAccount(ctx context.Context, id string, input account.AccountUpdate) (acc account.Account, err error) {
+	if err = mw.checkOwner(ctx, id); err != nil {
+		return acc, err
+	}
+	if input.Balance != nil {
+		return acc, coins.ErrForbidden("balance is adjusted by operators")
+	}
+	return mw.svc.UpdateAccount(ctx, id, input)
+}
+
+func (mw *AuthorizingMiddleware) CloseAccount(ctx context.Context, id string) (err error) {
+	if err = mw.checkOwner(ctx, id); err != nil {
+		return err
+	}
+	return mw.svc.CloseAccount(ctx, id)
+}
+
+func (mw *AuthorizingMiddleware) GetStatement(ctx context.Context, id string, from, to *time.Time) (st account.Statement, err error) {
+	if err = mw.checkOwner(ctx, id); err != nil {
+		return st, err
+	}
+	return mw.svc.GetStatement(ctx, id, from, to)
+}
+
+func (mw *AuthorizingMiddleware) CreateQuote(ctx context.Context, input fx.QuoteInput) (q fx.Quote, err error) {
+	return mw.svc.CreateQuote(ctx, input)
+}
+
+func (mw *AuthorizingMiddleware) CreateSchedule(ctx context.Context, input schedule.ScheduleInput) (sch schedule.Schedule, err error) {
+	if err = mw.checkOwner(ctx, input.FromAccount); err != nil {
+		return sch, err
+	}
+	return mw.svc.CreateSchedule(ctx, input)
+}
+
+// GetSchedules returns schedules of the principal's accounts only, of all of them if accountID is empty.
+func (mw *AuthorizingMiddleware) GetSchedules(ctx context.Context, accountID string) (schedules []schedule.Schedule, err error) {
+	if accountID != "" {
+		if err = mw.checkOwner(ctx, accountID); err != nil {
+			return nil, err
+		}
+		return mw.svc.GetSchedules(ctx, accountID)
+	}
+
+	all, err := mw.svc.GetSchedules(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	owned := make(map[string]bool)
+	schedules = make([]schedule.Schedule, 0, len(all))
+	for _, sch := range all {
+		ok, checked := owned[sch.FromAccount]
+		if !checked {
+			if ok, err = mw.owns(ctx, sch.FromAccount); err != nil {
+				return nil, err
+			}
+			owned[sch.FromAccount] = ok
+		}
+		if ok {
+			schedules = append(schedules, sch)
+		}
+	}
+	return schedules, nil
+}
+
+func (mw *AuthorizingMiddleware) GetSchedule(ctx context.Context, id uint64) (sch schedule.Schedule, err error) {
+	if sch, err = mw.svc.GetSchedule(ctx, id); err != nil {
+		return sch, err
+	}
+	if err = mw.checkOwner(ctx, sch.FromAccount); err != nil {
+		return schedule.Schedule{}, err
+	}
+	return sch, nil
+}
+
+func (mw *AuthorizingMiddleware) CancelSchedule(ctx context.Context, id uint64) (err error) {
+	sch, err := mw.svc.GetSchedule(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err = mw.checkOwner(ctx, sch.FromAccount); err != nil {
+		return err
+	}
+	return mw.svc.CancelSchedule(ctx, id)
+}
+
+func (mw *AuthorizingMiddleware) AuthorizePayment(ctx context.Context, input hold.AuthorizeInput) (h hold.Hold, err error) {
+	if err = mw.checkOwner(ctx, input.FromAccount); err != nil {
+		return h, err
+	}
+	return mw.svc.AuthorizePayment(ctx, input)
+}
+
+// GetHold allows the owners of both hold accounts to read it.
+func (mw *AuthorizingMiddleware) GetHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	if h, err = mw.svc.GetHold(ctx, id); err != nil {
+		return h, err
+	}
+	if err = mw.checkAnyOwner(ctx, h.FromAccount, h.ToAccount); err != nil {
+		return hold.Hold{}, err
+	}
+	return h, nil
+}
+
+// CaptureHold allows the owners of both hold accounts to capture it, the debit is authorized by the hold.
+func (mw *AuthorizingMiddleware) CaptureHold(ctx context.Context, id uint64, input hold.CaptureInput) (h hold.Hold, err error) {
+	if h, err = mw.svc.GetHold(ctx, id); err != nil {
+		return h, err
+	}
+	if err = mw.checkAnyOwner(ctx, h.FromAccount, h.ToAccount); err != nil {
+		return hold.Hold{}, err
+	}
+	return mw.svc.CaptureHold(ctx, id, input)
+}
+
+func (mw *AuthorizingMiddleware) VoidHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	if h, err = mw.svc.GetHold(ctx, id); err != nil {
+		return h, err
+	}
+	if err = mw.checkAnyOwner(ctx, h.FromAccount, h.ToAccount); err != nil {
+		return hold.Hold{}, err
+	}
+	return mw.svc.VoidHold(ctx, id)
+}
+
+func (mw *AuthorizingMiddleware) CreateSubscription(ctx context.Context, accountID string, input webhook.SubscriptionInput) (sub webhook.Subscription, err error) {
+	if err = mw.checkOwner(ctx, accountID); err != nil {
+		return sub, err
+	}
+	return mw.svc.CreateSubscription(ctx, accountID, input)
+}
+
+func (mw *AuthorizingMiddleware) GetSubscriptions(ctx context.Context, accountID string) (subs []webhook.Subscription, err error) {
+	if err = mw.checkOwner(ctx, accountID); err != nil {
+		return nil, err
+	}
+	return mw.svc.GetSubscriptions(ctx, accountID)
+}
+
+func (mw *AuthorizingMiddleware) GetSubscription(ctx context.Context, id uint64) (sub webhook.Subscription, err error) {
+	if sub, err = mw.svc.GetSubscription(ctx, id); err != nil {
+		return sub, err
+	}
+	if err = mw.checkOwner(ctx, sub.AccountID); err != nil {
+		return webhook.Subscription{}, err
+	}
+	return sub, nil
+}
+
+func (mw *AuthorizingMiddleware) DeleteSubscription(ctx context.Context, id uint64) (err error) {
+	sub, err := mw.svc.GetSubscription(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err = mw.checkOwner(ctx, sub.AccountID); err != nil {
+		return err
+	}
+	return mw.svc.DeleteSubscription(ctx, id)
+}
+
+func (mw *AuthorizingMiddleware) GetDeliveries(ctx context.Context, subscriptionID uint64) (deliveries []webhook.Delivery, err error) {
+	if _, err = mw.GetSubscription(ctx, subscriptionID); err != nil {
+		return nil, err
+	}
+	return mw.svc.GetDeliveries(ctx, subscriptionID)
+}
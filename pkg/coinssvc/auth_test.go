@@ -0,0 +1,374 @@
+package coinssvc
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/auth"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/coinssvc/pb"
+	"github.com/donmikel/coins/pkg/feed"
+	"github.com/donmikel/coins/pkg/hold"
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/schedule"
+	"github.com/donmikel/coins/pkg/webhook"
+	"github.com/go-kit/kit/log"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+// testAuthenticator authenticates customers bob and alice, an operator and an auditor by their tokens.
+type testAuthenticator struct{}
+
+func (testAuthenticator) Authenticate(ctx context.Context, token string) (auth.Principal, error) {
+	switch token {
+	case "bob-key":
+		return auth.Principal{ID: "bob", Role: auth.Customer}, nil
+	case "alice-key":
+		return auth.Principal{ID: "alice", Role: auth.Customer}, nil
+	case "operator-key":
+		return auth.Principal{ID: "ops", Role: auth.Operator}, nil
+	case "auditor-key":
+		return auth.Principal{ID: "audit", Role: auth.Auditor}, nil
+	default:
+		return auth.Principal{}, auth.ErrInvalidCredentials
+	}
+}
+
+// initAuthTest returns a mock service with accounts bob123 owned by bob and alice456 owned by alice.
+func initAuthTest() *mockService {
+	owners := map[string]string{"bob123": "bob", "alice456": "alice"}
+	return &mockService{
+		onGetAccount: func(ctx context.Context, id string) (acc account.Account, err error) {
+			owner, ok := owners[id]
+			if !ok {
+				return acc, coins.ErrNotFound("account %s not found", id)
+			}
+			return mustNewAccount(func(a *account.Account) {
+				a.ID = id
+				a.Owner = owner
+			}), nil
+		},
+		onSendPayments: func(ctx context.Context, input payment.PaymentInput) (payment.Payment, error) {
+			return mustNewPayment(nil), nil
+		},
+	}
+}
+
+func initAuthTransportTest(t *testing.T, token string) (*httptest.Server, *Client, *mockService) {
+	svc := initAuthTest()
+	server := httptest.NewServer(authenticate(testAuthenticator{}, makeHandler(NewAuthorizingMiddleware(svc))))
+	client, err := NewClient(ClientConfig{
+		ServiceURL: server.URL,
+		Timeout:    time.Second,
+		Token:      token,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, client, svc
+}
+
+func TestAuthentication(t *testing.T) {
+	server, client, _ := initAuthTransportTest(t, "bob-key")
+	defer server.Close()
+
+	testCases := []struct {
+		name       string
+		header     string
+		wantStatus int
+	}{
+		{
+			name:       "no credentials",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unknown key",
+			header:     "Bearer unknown",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "not bearer",
+			header:     "Basic Ym9iOnBhc3M=",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "valid key",
+			header:     "Bearer bob-key",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, server.URL+"/api/v1/accounts/bob123", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.header != "" {
+				req.Header.Set(authorizationHeader, tc.header)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			assert.Equal(t, tc.wantStatus, resp.StatusCode)
+			if tc.wantStatus == http.StatusUnauthorized {
+				assert.Equal(t, "Bearer", resp.Header.Get("WWW-Authenticate"))
+			}
+		})
+	}
+
+	_, err := client.GetAccount(context.Background(), "bob123")
+	assert.NoError(t, err)
+}
+
+func TestAuthorization(t *testing.T) {
+	server, client, svc := initAuthTransportTest(t, "bob-key")
+	defer server.Close()
+
+	_, err := client.SendPayment(context.Background(), mustNewPaymentInput(nil))
+	assert.NoError(t, err)
+
+	_, err = client.SendPayment(context.Background(), mustNewPaymentInput(func(pi *payment.PaymentInput) {
+		pi.FromAccount, pi.ToAccount = "alice456", "bob123"
+	}))
+	assert.Equal(t, coins.ErrForbidden("account alice456 is not owned by bob"), err)
+
+	_, err = client.SendPayment(context.Background(), mustNewPaymentInput(func(pi *payment.PaymentInput) {
+		pi.FromAccount = "unknown"
+	}))
+	assert.Equal(t, coins.ErrNotFound("account unknown not found"), err)
+
+	_, err = client.SendPayments(context.Background(), payment.BatchInput{
+		Mode: payment.BestEffort,
+		Payments: []payment.PaymentInput{
+			mustNewPaymentInput(nil),
+			mustNewPaymentInput(func(pi *payment.PaymentInput) { pi.FromAccount, pi.ToAccount = "alice456", "bob123" }),
+		},
+	})
+	assert.Equal(t, coins.ErrForbidden("account alice456 is not owned by bob"), err)
+
+	// A refund debits the destination account of the payment.
+	svc.onGetPayment = func(ctx context.Context, id uint64) (payment.Payment, error) {
+		return mustNewPayment(nil), nil
+	}
+	_, err = client.RefundPayment(context.Background(), 1, payment.RefundInput{})
+	assert.Equal(t, coins.ErrForbidden("account alice456 is not owned by bob"), err)
+
+	// A hold may be captured by the owner of either account.
+	svc.onGetHold = func(ctx context.Context, id uint64) (hold.Hold, error) {
+		return mustNewHold(nil), nil
+	}
+	svc.onCaptureHold = func(ctx context.Context, id uint64, input hold.CaptureInput) (hold.Hold, error) {
+		return mustNewHold(nil), nil
+	}
+	_, err = client.CaptureHold(context.Background(), 1, hold.CaptureInput{})
+	assert.NoError(t, err)
+
+	var gotOwner string
+	svc.onCreateAccount = func(ctx context.Context, input account.Account) (account.Account, error) {
+		gotOwner = input.Owner
+		return input, nil
+	}
+	acc, err := client.CreateAccount(context.Background(), mustNewAccount(func(a *account.Account) {
+		a.ID = "carol789"
+		a.Owner = "alice"
+		a.Balance = decimal.Zero
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "bob", gotOwner)
+	assert.Equal(t, "bob", acc.Owner)
+
+	_, err = client.CreateAccount(context.Background(), mustNewAccount(func(a *account.Account) {
+		a.ID = "carol789"
+	}))
+	assert.Equal(t, coins.ErrForbidden("balance is adjusted by operators"), err)
+
+	balance := decimal.NewFromInt(1000)
+	_, err = client.UpdateAccount(context.Background(), "bob123", account.AccountUpdate{Balance: &balance})
+	assert.Equal(t, coins.ErrForbidden("balance is adjusted by operators"), err)
+
+	// Owners change the currency of unused accounts only, the service rejects the change for funded ones.
+	currency := "JPY"
+	_, err = client.UpdateAccount(context.Background(), "alice456", account.AccountUpdate{Currency: &currency})
+	assert.Equal(t, coins.ErrForbidden("account alice456 is not owned by bob"), err)
+
+	svc.onUpdateAccount = func(ctx context.Context, id string, input account.AccountUpdate) (account.Account, error) {
+		return account.Account{}, coins.ErrConflict("failed to update account: account %s: %s", id, coins.ErrCurrencyInUse)
+	}
+	_, err = client.UpdateAccount(context.Background(), "bob123", account.AccountUpdate{Currency: &currency})
+	assert.Equal(t, coins.ErrConflict("failed to update account: account bob123: %s", coins.ErrCurrencyInUse), err)
+}
+
+func TestAuthorizedReads(t *testing.T) {
+	server, client, svc := initAuthTransportTest(t, "bob-key")
+	defer server.Close()
+	ctx := context.Background()
+	forbidden := coins.ErrForbidden("account alice456 is not owned by bob")
+
+	_, err := client.GetAccount(ctx, "alice456")
+	assert.Equal(t, forbidden, err)
+
+	svc.onGetAvailableAccounts = func(ctx context.Context) ([]account.Account, error) {
+		return []account.Account{
+			mustNewAccount(func(a *account.Account) { a.Owner = "bob" }),
+			mustNewAccount(func(a *account.Account) { a.ID, a.Owner = "alice456", "alice" }),
+		}, nil
+	}
+	accounts, err := client.GetAvailableAccounts(ctx)
+	assert.NoError(t, err)
+	if assert.Len(t, accounts, 1) {
+		assert.Equal(t, "bob123", accounts[0].ID)
+	}
+
+	svc.onGetAllPayments = func(ctx context.Context, filter payment.Filter) (payment.Page, error) {
+		return payment.Page{}, nil
+	}
+	_, err = client.GetAllPayments(ctx, payment.Filter{})
+	assert.Equal(t, coins.ErrForbidden("payments are listed by account"), err)
+	_, err = client.GetAllPayments(ctx, payment.Filter{Account: "alice456"})
+	assert.Equal(t, forbidden, err)
+	_, err = client.GetAllPayments(ctx, payment.Filter{Account: "bob123"})
+	assert.NoError(t, err)
+
+	// Payments and holds are read by the owners of either account.
+	svc.onGetPayment = func(ctx context.Context, id uint64) (payment.Payment, error) {
+		return mustNewPayment(func(p *payment.Payment) { p.FromAccount, p.ToAccount = "alice456", "alice456" }), nil
+	}
+	_, err = client.GetPayment(ctx, 1)
+	assert.Equal(t, forbidden, err)
+	svc.onGetHold = func(ctx context.Context, id uint64) (hold.Hold, error) {
+		return mustNewHold(func(h *hold.Hold) { h.FromAccount, h.ToAccount = "alice456", "bob123" }), nil
+	}
+	_, err = client.GetHold(ctx, 1)
+	assert.NoError(t, err)
+
+	svc.onGetStatement = func(ctx context.Context, id string, from, to *time.Time) (account.Statement, error) {
+		return account.Statement{AccountID: id}, nil
+	}
+	_, err = client.GetStatement(ctx, "alice456", nil, nil)
+	assert.Equal(t, forbidden, err)
+	_, err = client.GetStatement(ctx, "bob123", nil, nil)
+	assert.NoError(t, err)
+
+	// Schedules of all accounts are listed for own accounts only.
+	svc.onGetSchedules = func(ctx context.Context, accountID string) ([]schedule.Schedule, error) {
+		return []schedule.Schedule{
+			mustNewSchedule(nil),
+			mustNewSchedule(func(s *schedule.Schedule) { s.ID, s.FromAccount, s.ToAccount = 2, "alice456", "bob123" }),
+			mustNewSchedule(func(s *schedule.Schedule) { s.ID, s.FromAccount = 3, "closed" }),
+		}, nil
+	}
+	schedules, err := client.GetSchedules(ctx, "")
+	assert.NoError(t, err)
+	if assert.Len(t, schedules, 1) {
+		assert.Equal(t, uint64(1), schedules[0].ID)
+	}
+	_, err = client.GetSchedules(ctx, "alice456")
+	assert.Equal(t, forbidden, err)
+	svc.onGetSchedule = func(ctx context.Context, id uint64) (schedule.Schedule, error) {
+		return mustNewSchedule(func(s *schedule.Schedule) { s.FromAccount = "alice456" }), nil
+	}
+	_, err = client.GetSchedule(ctx, 1)
+	assert.Equal(t, forbidden, err)
+
+	svc.onGetSubscriptions = func(ctx context.Context, accountID string) ([]webhook.Subscription, error) {
+		return []webhook.Subscription{mustNewSubscription(nil)}, nil
+	}
+	_, err = client.GetSubscriptions(ctx, "alice456")
+	assert.Equal(t, forbidden, err)
+	_, err = client.GetSubscriptions(ctx, "bob123")
+	assert.NoError(t, err)
+	svc.onGetSubscription = func(ctx context.Context, id uint64) (webhook.Subscription, error) {
+		return mustNewSubscription(func(s *webhook.Subscription) { s.AccountID = "alice456" }), nil
+	}
+	svc.onGetDeliveries = func(ctx context.Context, subscriptionID uint64) ([]webhook.Delivery, error) {
+		return []webhook.Delivery{}, nil
+	}
+	_, err = client.GetSubscription(ctx, 1)
+	assert.Equal(t, forbidden, err)
+	_, err = client.GetDeliveries(ctx, 1)
+	assert.Equal(t, forbidden, err)
+}
+
+func TestAuthorizedStream(t *testing.T) {
+	server := httptest.NewServer(authenticate(testAuthenticator{}, &streamHandler{
+		svc:    NewAuthorizingMiddleware(initAuthTest()),
+		hub:    &feed.Hub{},
+		logger: log.NewNopLogger(),
+	}))
+	defer server.Close()
+
+	for _, query := range []string{"", "?account=alice456"} {
+		req, err := http.NewRequest(http.MethodGet, server.URL+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(authorizationHeader, "Bearer bob-key")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode, query)
+	}
+}
+
+func TestStaffCanNotOwnAccounts(t *testing.T) {
+	server, client, _ := initAuthTransportTest(t, "operator-key")
+	defer server.Close()
+
+	_, err := client.CreateAccount(context.Background(), mustNewAccount(func(a *account.Account) {
+		a.ID = "ops1"
+	}))
+	assert.Equal(t, coins.ErrForbidden("operator is not allowed to own accounts"), err)
+}
+
+func TestGRPCAuthentication(t *testing.T) {
+	svc := initAuthTest()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.UnaryInterceptor(grpcAuthInterceptor(testAuthenticator{})))
+	pb.RegisterCoinsServer(server, makeGRPCServer(NewAuthorizingMiddleware(svc)))
+	go server.Serve(lis)
+	defer server.Stop()
+
+	newClient := func(token string) *GRPCClient {
+		client, err := NewGRPCClient(GRPCClientConfig{
+			ServiceAddress: lis.Addr().String(),
+			Timeout:        time.Second,
+			Token:          token,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			client.Close()
+		})
+		return client
+	}
+
+	_, err = newClient("").SendPayment(context.Background(), mustNewPaymentInput(nil))
+	assert.Equal(t, coins.ErrUnauthorized("invalid credentials: missing bearer token"), err)
+
+	_, err = newClient("unknown").SendPayment(context.Background(), mustNewPaymentInput(nil))
+	assert.Equal(t, coins.ErrUnauthorized("invalid credentials"), err)
+
+	_, err = newClient("alice-key").SendPayment(context.Background(), mustNewPaymentInput(nil))
+	assert.Equal(t, coins.ErrForbidden("account bob123 is not owned by alice"), err)
+
+	_, err = newClient("bob-key").SendPayment(context.Background(), mustNewPaymentInput(nil))
+	assert.NoError(t, err)
+}
@@ -2,12 +2,20 @@ package coinssvc
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"time"
 
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/fx"
+	"github.com/donmikel/coins/pkg/hold"
 	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/schedule"
+	"github.com/donmikel/coins/pkg/webhook"
 	"github.com/go-kit/kit/endpoint"
 	kithttp "github.com/go-kit/kit/transport/http"
 )
@@ -16,6 +24,9 @@ import (
 type ClientConfig struct {
 	ServiceURL string
 	Timeout    time.Duration
+
+	// Token is an API key or a JWT sent as the bearer token of requests, if set.
+	Token string
 }
 
 func (cfg ClientConfig) validate() error {
@@ -35,7 +46,29 @@ var _ Service = (*Client)(nil)
 type Client struct {
 	getAllPaymentsEndpoint       endpoint.Endpoint
 	sendPaymentEndpoint          endpoint.Endpoint
+	sendPaymentsEndpoint         endpoint.Endpoint
+	getPaymentEndpoint           endpoint.Endpoint
+	refundPaymentEndpoint        endpoint.Endpoint
 	getAvailableAccountsEndpoint endpoint.Endpoint
+	createAccountEndpoint        endpoint.Endpoint
+	getAccountEndpoint           endpoint.Endpoint
+	updateAccountEndpoint        endpoint.Endpoint
+	closeAccountEndpoint         endpoint.Endpoint
+	getStatementEndpoint         endpoint.Endpoint
+	createQuoteEndpoint          endpoint.Endpoint
+	createScheduleEndpoint       endpoint.Endpoint
+	getSchedulesEndpoint         endpoint.Endpoint
+	getScheduleEndpoint          endpoint.Endpoint
+	cancelScheduleEndpoint       endpoint.Endpoint
+	authorizePaymentEndpoint     endpoint.Endpoint
+	getHoldEndpoint              endpoint.Endpoint
+	captureHoldEndpoint          endpoint.Endpoint
+	voidHoldEndpoint             endpoint.Endpoint
+	createSubscriptionEndpoint   endpoint.Endpoint
+	getSubscriptionsEndpoint     endpoint.Endpoint
+	getSubscriptionEndpoint      endpoint.Endpoint
+	deleteSubscriptionEndpoint   endpoint.Endpoint
+	getDeliveriesEndpoint        endpoint.Endpoint
 }
 
 // NewClient creates a new client.
@@ -55,6 +88,12 @@ func NewClient(cfg ClientConfig) (*Client, error) {
 			Timeout: cfg.Timeout,
 		}),
 	}
+	if cfg.Token != "" {
+		options = append(options, kithttp.ClientBefore(func(ctx context.Context, r *http.Request) context.Context {
+			r.Header.Set(authorizationHeader, "Bearer "+cfg.Token)
+			return ctx
+		}))
+	}
 
 	c := &Client{
 		getAllPaymentsEndpoint: kithttp.NewClient(
@@ -71,6 +110,27 @@ func NewClient(cfg ClientConfig) (*Client, error) {
 			decodeSendPaymentResponse,
 			options...,
 		).Endpoint(),
+		sendPaymentsEndpoint: kithttp.NewClient(
+			http.MethodPost,
+			baseURL,
+			encodeSendPaymentsRequest,
+			decodeSendPaymentsResponse,
+			options...,
+		).Endpoint(),
+		getPaymentEndpoint: kithttp.NewClient(
+			http.MethodGet,
+			baseURL,
+			encodeGetPaymentRequest,
+			decodeGetPaymentResponse,
+			options...,
+		).Endpoint(),
+		refundPaymentEndpoint: kithttp.NewClient(
+			http.MethodPost,
+			baseURL,
+			encodeRefundPaymentRequest,
+			decodeRefundPaymentResponse,
+			options...,
+		).Endpoint(),
 		getAvailableAccountsEndpoint: kithttp.NewClient(
 			http.MethodGet,
 			baseURL,
@@ -78,33 +138,205 @@ func NewClient(cfg ClientConfig) (*Client, error) {
 			decodeGetAvailableAccountsResponse,
 			options...,
 		).Endpoint(),
+		createAccountEndpoint: kithttp.NewClient(
+			http.MethodPost,
+			baseURL,
+			encodeCreateAccountRequest,
+			decodeCreateAccountResponse,
+			options...,
+		).Endpoint(),
+		getAccountEndpoint: kithttp.NewClient(
+			http.MethodGet,
+			baseURL,
+			encodeGetAccountRequest,
+			decodeGetAccountResponse,
+			options...,
+		).Endpoint(),
+		updateAccountEndpoint: kithttp.NewClient(
+			http.MethodPatch,
+			baseURL,
+			encodeUpdateAccountRequest,
+			decodeUpdateAccountResponse,
+			options...,
+		).Endpoint(),
+		closeAccountEndpoint: kithttp.NewClient(
+			http.MethodDelete,
+			baseURL,
+			encodeCloseAccountRequest,
+			decodeCloseAccountResponse,
+			options...,
+		).Endpoint(),
+		getStatementEndpoint: kithttp.NewClient(
+			http.MethodGet,
+			baseURL,
+			encodeGetStatementRequest,
+			decodeGetStatementResponse,
+			options...,
+		).Endpoint(),
+		createQuoteEndpoint: kithttp.NewClient(
+			http.MethodPost,
+			baseURL,
+			encodeCreateQuoteRequest,
+			decodeCreateQuoteResponse,
+			options...,
+		).Endpoint(),
+		createScheduleEndpoint: kithttp.NewClient(
+			http.MethodPost,
+			baseURL,
+			encodeCreateScheduleRequest,
+			decodeCreateScheduleResponse,
+			options...,
+		).Endpoint(),
+		getSchedulesEndpoint: kithttp.NewClient(
+			http.MethodGet,
+			baseURL,
+			encodeGetSchedulesRequest,
+			decodeGetSchedulesResponse,
+			options...,
+		).Endpoint(),
+		getScheduleEndpoint: kithttp.NewClient(
+			http.MethodGet,
+			baseURL,
+			encodeGetScheduleRequest,
+			decodeGetScheduleResponse,
+			options...,
+		).Endpoint(),
+		cancelScheduleEndpoint: kithttp.NewClient(
+			http.MethodDelete,
+			baseURL,
+			encodeCancelScheduleRequest,
+			decodeCancelScheduleResponse,
+			options...,
+		).Endpoint(),
+		authorizePaymentEndpoint: kithttp.NewClient(
+			http.MethodPost,
+			baseURL,
+			encodeAuthorizePaymentRequest,
+			decodeHoldResponse,
+			options...,
+		).Endpoint(),
+		getHoldEndpoint: kithttp.NewClient(
+			http.MethodGet,
+			baseURL,
+			encodeGetHoldRequest,
+			decodeHoldResponse,
+			options...,
+		).Endpoint(),
+		captureHoldEndpoint: kithttp.NewClient(
+			http.MethodPost,
+			baseURL,
+			encodeCaptureHoldRequest,
+			decodeHoldResponse,
+			options...,
+		).Endpoint(),
+		voidHoldEndpoint: kithttp.NewClient(
+			http.MethodPost,
+			baseURL,
+			encodeVoidHoldRequest,
+			decodeHoldResponse,
+			options...,
+		).Endpoint(),
+		createSubscriptionEndpoint: kithttp.NewClient(
+			http.MethodPost,
+			baseURL,
+			encodeCreateSubscriptionRequest,
+			decodeCreateSubscriptionResponse,
+			options...,
+		).Endpoint(),
+		getSubscriptionsEndpoint: kithttp.NewClient(
+			http.MethodGet,
+			baseURL,
+			encodeGetSubscriptionsRequest,
+			decodeGetSubscriptionsResponse,
+			options...,
+		).Endpoint(),
+		getSubscriptionEndpoint: kithttp.NewClient(
+			http.MethodGet,
+			baseURL,
+			encodeGetSubscriptionRequest,
+			decodeGetSubscriptionResponse,
+			options...,
+		).Endpoint(),
+		deleteSubscriptionEndpoint: kithttp.NewClient(
+			http.MethodDelete,
+			baseURL,
+			encodeDeleteSubscriptionRequest,
+			decodeDeleteSubscriptionResponse,
+			options...,
+		).Endpoint(),
+		getDeliveriesEndpoint: kithttp.NewClient(
+			http.MethodGet,
+			baseURL,
+			encodeGetDeliveriesRequest,
+			decodeGetDeliveriesResponse,
+			options...,
+		).Endpoint(),
 	}
 
 	return c, nil
 }
 
-// GetAllPayments get list of all payments.
-func (c *Client) GetAllPayments(ctx context.Context) (payments []payment.Payment, err error) {
-	response, err := c.getAllPaymentsEndpoint(ctx, getAllPaymentsRequest{})
+// GetAllPayments get a page of payments matching the filter.
+func (c *Client) GetAllPayments(ctx context.Context, filter payment.Filter) (page payment.Page, err error) {
+	response, err := c.getAllPaymentsEndpoint(ctx, getAllPaymentsRequest{filter: filter})
 	if err != nil {
-		return nil, err
+		return page, err
 	}
 
-	return response.(getAllPaymentsResponse).payments, nil
+	return response.(getAllPaymentsResponse).page, nil
 }
 
-// SendPayment send payment to user.
-func (c *Client) SendPayment(ctx context.Context, payment payment.PaymentInput) (err error) {
-	_, err = c.sendPaymentEndpoint(ctx, sendPaymentRequest{input: payment})
+// SendPayment send payment to user and returns the created payment.
+// An idempotency key is generated unless the input already has one,
+// set it explicitly to retry the same payment safely.
+func (c *Client) SendPayment(ctx context.Context, input payment.PaymentInput) (p payment.Payment, err error) {
+	if input.IdempotencyKey == "" {
+		input.IdempotencyKey, err = newIdempotencyKey()
+		if err != nil {
+			return p, err
+		}
+	}
+	response, err := c.sendPaymentEndpoint(ctx, sendPaymentRequest{input: input})
 	if err != nil {
-		return err
+		return p, err
 	}
 
-	return nil
+	return response.(sendPaymentResponse).payment, nil
+}
+
+// SendPayments sends a batch of payments and returns the result of every payment of the batch.
+// An atomic batch fails as a whole, a best effort batch reports failed payments in the result.
+func (c *Client) SendPayments(ctx context.Context, input payment.BatchInput) (res payment.BatchResult, err error) {
+	response, err := c.sendPaymentsEndpoint(ctx, sendPaymentsRequest{input: input})
+	if err != nil {
+		return res, err
+	}
+
+	return response.(sendPaymentsResponse).result, nil
+}
+
+// GetPayment get payment by ID.
+func (c *Client) GetPayment(ctx context.Context, id uint64) (p payment.Payment, err error) {
+	response, err := c.getPaymentEndpoint(ctx, getPaymentRequest{id: id})
+	if err != nil {
+		return p, err
+	}
+
+	return response.(getPaymentResponse).payment, nil
+}
+
+// RefundPayment refunds the payment with the given ID and returns the refund payment.
+func (c *Client) RefundPayment(ctx context.Context, id uint64, input payment.RefundInput) (p payment.Payment, err error) {
+	response, err := c.refundPaymentEndpoint(ctx, refundPaymentRequest{id: id, input: input})
+	if err != nil {
+		return p, err
+	}
+
+	return response.(refundPaymentResponse).payment, nil
 }
 
 // GetAvailableAccounts get available account to send money.
-func (c *Client) GetAvailableAccounts(ctx context.Context) (accounts []string, err error) {
+func (c *Client) GetAvailableAccounts(ctx context.Context) (accounts []account.Account, err error) {
 	response, err := c.getAvailableAccountsEndpoint(ctx, getAvailableAccountsRequest{})
 	if err != nil {
 		return nil, err
@@ -112,3 +344,202 @@ func (c *Client) GetAvailableAccounts(ctx context.Context) (accounts []string, e
 
 	return response.(getAvailableAccountsResponse).accounts, nil
 }
+
+// CreateAccount creates a new account.
+func (c *Client) CreateAccount(ctx context.Context, input account.Account) (acc account.Account, err error) {
+	response, err := c.createAccountEndpoint(ctx, createAccountRequest{input: input})
+	if err != nil {
+		return acc, err
+	}
+
+	return response.(createAccountResponse).account, nil
+}
+
+// GetAccount get account by ID.
+func (c *Client) GetAccount(ctx context.Context, id string) (acc account.Account, err error) {
+	response, err := c.getAccountEndpoint(ctx, getAccountRequest{id: id})
+	if err != nil {
+		return acc, err
+	}
+
+	return response.(getAccountResponse).account, nil
+}
+
+// UpdateAccount partially updates an account.
+func (c *Client) UpdateAccount(ctx context.Context, id string, input account.AccountUpdate) (acc account.Account, err error) {
+	response, err := c.updateAccountEndpoint(ctx, updateAccountRequest{id: id, input: input})
+	if err != nil {
+		return acc, err
+	}
+
+	return response.(updateAccountResponse).account, nil
+}
+
+// CloseAccount closes an account.
+func (c *Client) CloseAccount(ctx context.Context, id string) (err error) {
+	_, err = c.closeAccountEndpoint(ctx, closeAccountRequest{id: id})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetStatement get account statement for the period.
+func (c *Client) GetStatement(ctx context.Context, id string, from, to *time.Time) (st account.Statement, err error) {
+	response, err := c.getStatementEndpoint(ctx, getStatementRequest{id: id, from: from, to: to})
+	if err != nil {
+		return st, err
+	}
+
+	return response.(getStatementResponse).statement, nil
+}
+
+// CreateQuote locks an exchange rate for a payment between accounts with different currencies.
+func (c *Client) CreateQuote(ctx context.Context, input fx.QuoteInput) (q fx.Quote, err error) {
+	response, err := c.createQuoteEndpoint(ctx, createQuoteRequest{input: input})
+	if err != nil {
+		return q, err
+	}
+
+	return response.(createQuoteResponse).quote, nil
+}
+
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate idempotency key: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// CreateSchedule creates a scheduled payment.
+func (c *Client) CreateSchedule(ctx context.Context, input schedule.ScheduleInput) (sch schedule.Schedule, err error) {
+	response, err := c.createScheduleEndpoint(ctx, createScheduleRequest{input: input})
+	if err != nil {
+		return sch, err
+	}
+
+	return response.(createScheduleResponse).schedule, nil
+}
+
+// GetSchedules get schedules sending money from the account, or all schedules if the account is empty.
+func (c *Client) GetSchedules(ctx context.Context, accountID string) (schedules []schedule.Schedule, err error) {
+	response, err := c.getSchedulesEndpoint(ctx, getSchedulesRequest{accountID: accountID})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.(getSchedulesResponse).schedules, nil
+}
+
+// GetSchedule get schedule by ID.
+func (c *Client) GetSchedule(ctx context.Context, id uint64) (sch schedule.Schedule, err error) {
+	response, err := c.getScheduleEndpoint(ctx, getScheduleRequest{id: id})
+	if err != nil {
+		return sch, err
+	}
+
+	return response.(getScheduleResponse).schedule, nil
+}
+
+// CancelSchedule cancels an active schedule.
+func (c *Client) CancelSchedule(ctx context.Context, id uint64) (err error) {
+	_, err = c.cancelScheduleEndpoint(ctx, cancelScheduleRequest{id: id})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AuthorizePayment places a hold on the source account funds for a payment captured later.
+func (c *Client) AuthorizePayment(ctx context.Context, input hold.AuthorizeInput) (h hold.Hold, err error) {
+	response, err := c.authorizePaymentEndpoint(ctx, authorizePaymentRequest{input: input})
+	if err != nil {
+		return h, err
+	}
+
+	return response.(holdResponse).hold, nil
+}
+
+// GetHold get hold by ID.
+func (c *Client) GetHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	response, err := c.getHoldEndpoint(ctx, getHoldRequest{id: id})
+	if err != nil {
+		return h, err
+	}
+
+	return response.(holdResponse).hold, nil
+}
+
+// CaptureHold sends the payment of the hold, fully or partially.
+func (c *Client) CaptureHold(ctx context.Context, id uint64, input hold.CaptureInput) (h hold.Hold, err error) {
+	response, err := c.captureHoldEndpoint(ctx, captureHoldRequest{id: id, input: input})
+	if err != nil {
+		return h, err
+	}
+
+	return response.(holdResponse).hold, nil
+}
+
+// VoidHold releases the hold without payment.
+func (c *Client) VoidHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	response, err := c.voidHoldEndpoint(ctx, voidHoldRequest{id: id})
+	if err != nil {
+		return h, err
+	}
+
+	return response.(holdResponse).hold, nil
+}
+
+// CreateSubscription registers a webhook receiving events of the account payments and holds.
+func (c *Client) CreateSubscription(ctx context.Context, accountID string, input webhook.SubscriptionInput) (sub webhook.Subscription, err error) {
+	response, err := c.createSubscriptionEndpoint(ctx, createSubscriptionRequest{accountID: accountID, input: input})
+	if err != nil {
+		return sub, err
+	}
+
+	return response.(createSubscriptionResponse).subscription, nil
+}
+
+// GetSubscriptions get webhook subscriptions of the account.
+func (c *Client) GetSubscriptions(ctx context.Context, accountID string) (subs []webhook.Subscription, err error) {
+	response, err := c.getSubscriptionsEndpoint(ctx, getSubscriptionsRequest{accountID: accountID})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.(getSubscriptionsResponse).subscriptions, nil
+}
+
+// GetSubscription get webhook subscription by ID.
+func (c *Client) GetSubscription(ctx context.Context, id uint64) (sub webhook.Subscription, err error) {
+	response, err := c.getSubscriptionEndpoint(ctx, getSubscriptionRequest{id: id})
+	if err != nil {
+		return sub, err
+	}
+
+	return response.(getSubscriptionResponse).subscription, nil
+}
+
+// DeleteSubscription deletes the webhook subscription, its pending deliveries are not sent.
+func (c *Client) DeleteSubscription(ctx context.Context, id uint64) (err error) {
+	_, err = c.deleteSubscriptionEndpoint(ctx, deleteSubscriptionRequest{id: id})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetDeliveries get the latest deliveries of the webhook subscription.
+func (c *Client) GetDeliveries(ctx context.Context, subscriptionID uint64) (deliveries []webhook.Delivery, err error) {
+	response, err := c.getDeliveriesEndpoint(ctx, getDeliveriesRequest{id: subscriptionID})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.(getDeliveriesResponse).deliveries, nil
+}
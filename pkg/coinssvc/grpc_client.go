@@ -0,0 +1,604 @@
+package coinssvc
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/coinssvc/pb"
+	"github.com/donmikel/coins/pkg/fx"
+	"github.com/donmikel/coins/pkg/hold"
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/schedule"
+	"github.com/donmikel/coins/pkg/webhook"
+	"github.com/go-kit/kit/endpoint"
+	kitgrpc "github.com/go-kit/kit/transport/grpc"
+	"google.golang.org/grpc"
+)
+
+// grpcServiceName is the full name of the Coins gRPC service.
+const grpcServiceName = "coins.v1.Coins"
+
+// GRPCClientConfig is a GRPCClient configuration.
+type GRPCClientConfig struct {
+	ServiceAddress string
+	Timeout        time.Duration
+
+	// Token is an API key or a JWT sent as the bearer token of calls, if set.
+	Token string
+}
+
+func (cfg GRPCClientConfig) validate() error {
+	if cfg.ServiceAddress == "" {
+		return errors.New("must provide ServiceAddress")
+	}
+	if cfg.Timeout <= 0 {
+		return errors.New("invalid Timeout")
+	}
+
+	return nil
+}
+
+var _ Service = (*GRPCClient)(nil)
+
+// GRPCClient is a payments service gRPC client.
+type GRPCClient struct {
+	conn *grpc.ClientConn
+
+	getAvailableAccountsEndpoint endpoint.Endpoint
+	getAllPaymentsEndpoint       endpoint.Endpoint
+	sendPaymentEndpoint          endpoint.Endpoint
+	sendPaymentsEndpoint         endpoint.Endpoint
+	getPaymentEndpoint           endpoint.Endpoint
+	refundPaymentEndpoint        endpoint.Endpoint
+	createAccountEndpoint        endpoint.Endpoint
+	getAccountEndpoint           endpoint.Endpoint
+	updateAccountEndpoint        endpoint.Endpoint
+	closeAccountEndpoint         endpoint.Endpoint
+	getStatementEndpoint         endpoint.Endpoint
+	createQuoteEndpoint          endpoint.Endpoint
+	createScheduleEndpoint       endpoint.Endpoint
+	getSchedulesEndpoint         endpoint.Endpoint
+	getScheduleEndpoint          endpoint.Endpoint
+	cancelScheduleEndpoint       endpoint.Endpoint
+	authorizePaymentEndpoint     endpoint.Endpoint
+	getHoldEndpoint              endpoint.Endpoint
+	captureHoldEndpoint          endpoint.Endpoint
+	voidHoldEndpoint             endpoint.Endpoint
+	createSubscriptionEndpoint   endpoint.Endpoint
+	getSubscriptionsEndpoint     endpoint.Endpoint
+	getSubscriptionEndpoint      endpoint.Endpoint
+	deleteSubscriptionEndpoint   endpoint.Endpoint
+	getDeliveriesEndpoint        endpoint.Endpoint
+}
+
+// NewGRPCClient creates a new gRPC client, the connection is established lazily.
+func NewGRPCClient(cfg GRPCClientConfig) (*GRPCClient, error) {
+	err := cfg.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.Dial(cfg.ServiceAddress, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+
+	var opts []kitgrpc.ClientOption
+	if cfg.Token != "" {
+		opts = append(opts, kitgrpc.ClientBefore(kitgrpc.SetRequestHeader(authorizationMetadata, "Bearer "+cfg.Token)))
+	}
+	mw := grpcClientMiddleware(cfg.Timeout)
+	c := &GRPCClient{
+		conn: conn,
+		getAvailableAccountsEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"GetAvailableAccounts",
+			encodeGRPCGetAvailableAccountsRequest,
+			decodeGRPCGetAvailableAccountsResponse,
+			&pb.Accounts{},
+			opts...,
+		).Endpoint()),
+		getAllPaymentsEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"GetAllPayments",
+			encodeGRPCGetAllPaymentsRequest,
+			decodeGRPCGetAllPaymentsResponse,
+			&pb.PaymentPage{},
+			opts...,
+		).Endpoint()),
+		sendPaymentEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"SendPayment",
+			encodeGRPCSendPaymentRequest,
+			decodeGRPCSendPaymentResponse,
+			&pb.Payment{},
+			opts...,
+		).Endpoint()),
+		sendPaymentsEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"SendPayments",
+			encodeGRPCSendPaymentsRequest,
+			decodeGRPCSendPaymentsResponse,
+			&pb.BatchResult{},
+			opts...,
+		).Endpoint()),
+		getPaymentEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"GetPayment",
+			encodeGRPCGetPaymentRequest,
+			decodeGRPCGetPaymentResponse,
+			&pb.Payment{},
+			opts...,
+		).Endpoint()),
+		refundPaymentEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"RefundPayment",
+			encodeGRPCRefundPaymentRequest,
+			decodeGRPCRefundPaymentResponse,
+			&pb.Payment{},
+			opts...,
+		).Endpoint()),
+		createAccountEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"CreateAccount",
+			encodeGRPCCreateAccountRequest,
+			decodeGRPCCreateAccountResponse,
+			&pb.Account{},
+			opts...,
+		).Endpoint()),
+		getAccountEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"GetAccount",
+			encodeGRPCGetAccountRequest,
+			decodeGRPCGetAccountResponse,
+			&pb.Account{},
+			opts...,
+		).Endpoint()),
+		updateAccountEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"UpdateAccount",
+			encodeGRPCUpdateAccountRequest,
+			decodeGRPCUpdateAccountResponse,
+			&pb.Account{},
+			opts...,
+		).Endpoint()),
+		closeAccountEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"CloseAccount",
+			encodeGRPCCloseAccountRequest,
+			decodeGRPCCloseAccountResponse,
+			&pb.Empty{},
+			opts...,
+		).Endpoint()),
+		getStatementEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"GetStatement",
+			encodeGRPCGetStatementRequest,
+			decodeGRPCGetStatementResponse,
+			&pb.Statement{},
+			opts...,
+		).Endpoint()),
+		createQuoteEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"CreateQuote",
+			encodeGRPCCreateQuoteRequest,
+			decodeGRPCCreateQuoteResponse,
+			&pb.Quote{},
+			opts...,
+		).Endpoint()),
+		createScheduleEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"CreateSchedule",
+			encodeGRPCCreateScheduleRequest,
+			decodeGRPCCreateScheduleResponse,
+			&pb.Schedule{},
+			opts...,
+		).Endpoint()),
+		getSchedulesEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"GetSchedules",
+			encodeGRPCGetSchedulesRequest,
+			decodeGRPCGetSchedulesResponse,
+			&pb.Schedules{},
+			opts...,
+		).Endpoint()),
+		getScheduleEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"GetSchedule",
+			encodeGRPCGetScheduleRequest,
+			decodeGRPCGetScheduleResponse,
+			&pb.Schedule{},
+			opts...,
+		).Endpoint()),
+		cancelScheduleEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"CancelSchedule",
+			encodeGRPCCancelScheduleRequest,
+			decodeGRPCCancelScheduleResponse,
+			&pb.Empty{},
+			opts...,
+		).Endpoint()),
+		authorizePaymentEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"AuthorizePayment",
+			encodeGRPCAuthorizePaymentRequest,
+			decodeGRPCHoldResponse,
+			&pb.Hold{},
+			opts...,
+		).Endpoint()),
+		getHoldEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"GetHold",
+			encodeGRPCGetHoldRequest,
+			decodeGRPCHoldResponse,
+			&pb.Hold{},
+			opts...,
+		).Endpoint()),
+		captureHoldEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"CaptureHold",
+			encodeGRPCCaptureHoldRequest,
+			decodeGRPCHoldResponse,
+			&pb.Hold{},
+			opts...,
+		).Endpoint()),
+		voidHoldEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"VoidHold",
+			encodeGRPCVoidHoldRequest,
+			decodeGRPCHoldResponse,
+			&pb.Hold{},
+			opts...,
+		).Endpoint()),
+		createSubscriptionEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"CreateSubscription",
+			encodeGRPCCreateSubscriptionRequest,
+			decodeGRPCCreateSubscriptionResponse,
+			&pb.Subscription{},
+			opts...,
+		).Endpoint()),
+		getSubscriptionsEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"GetSubscriptions",
+			encodeGRPCGetSubscriptionsRequest,
+			decodeGRPCGetSubscriptionsResponse,
+			&pb.Subscriptions{},
+			opts...,
+		).Endpoint()),
+		getSubscriptionEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"GetSubscription",
+			encodeGRPCGetSubscriptionRequest,
+			decodeGRPCGetSubscriptionResponse,
+			&pb.Subscription{},
+			opts...,
+		).Endpoint()),
+		deleteSubscriptionEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"DeleteSubscription",
+			encodeGRPCDeleteSubscriptionRequest,
+			decodeGRPCDeleteSubscriptionResponse,
+			&pb.Empty{},
+			opts...,
+		).Endpoint()),
+		getDeliveriesEndpoint: mw(kitgrpc.NewClient(
+			conn,
+			grpcServiceName,
+			"GetDeliveries",
+			encodeGRPCGetDeliveriesRequest,
+			decodeGRPCGetDeliveriesResponse,
+			&pb.Deliveries{},
+			opts...,
+		).Endpoint()),
+	}
+
+	return c, nil
+}
+
+// grpcClientMiddleware limits every call by the timeout and converts gRPC statuses back to service errors.
+func grpcClientMiddleware(timeout time.Duration) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			response, err := next(ctx, request)
+			if err != nil {
+				return nil, decodeGRPCError(err)
+			}
+
+			return response, nil
+		}
+	}
+}
+
+// Close closes the client connection.
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
+
+// GetAllPayments get a page of payments matching the filter.
+func (c *GRPCClient) GetAllPayments(ctx context.Context, filter payment.Filter) (page payment.Page, err error) {
+	response, err := c.getAllPaymentsEndpoint(ctx, getAllPaymentsRequest{filter: filter})
+	if err != nil {
+		return page, err
+	}
+
+	return response.(getAllPaymentsResponse).page, nil
+}
+
+// SendPayment send payment to user and returns the created payment.
+// An idempotency key is generated unless the input already has one,
+// set it explicitly to retry the same payment safely.
+func (c *GRPCClient) SendPayment(ctx context.Context, input payment.PaymentInput) (p payment.Payment, err error) {
+	if input.IdempotencyKey == "" {
+		input.IdempotencyKey, err = newIdempotencyKey()
+		if err != nil {
+			return p, err
+		}
+	}
+	response, err := c.sendPaymentEndpoint(ctx, sendPaymentRequest{input: input})
+	if err != nil {
+		return p, err
+	}
+
+	return response.(sendPaymentResponse).payment, nil
+}
+
+// SendPayments sends a batch of payments and returns the result of every payment of the batch.
+// An atomic batch fails as a whole, a best effort batch reports failed payments in the result.
+func (c *GRPCClient) SendPayments(ctx context.Context, input payment.BatchInput) (res payment.BatchResult, err error) {
+	response, err := c.sendPaymentsEndpoint(ctx, sendPaymentsRequest{input: input})
+	if err != nil {
+		return res, err
+	}
+
+	return response.(sendPaymentsResponse).result, nil
+}
+
+// GetPayment get payment by ID.
+func (c *GRPCClient) GetPayment(ctx context.Context, id uint64) (p payment.Payment, err error) {
+	response, err := c.getPaymentEndpoint(ctx, getPaymentRequest{id: id})
+	if err != nil {
+		return p, err
+	}
+
+	return response.(getPaymentResponse).payment, nil
+}
+
+// RefundPayment refunds the payment with the given ID and returns the refund payment.
+func (c *GRPCClient) RefundPayment(ctx context.Context, id uint64, input payment.RefundInput) (p payment.Payment, err error) {
+	response, err := c.refundPaymentEndpoint(ctx, refundPaymentRequest{id: id, input: input})
+	if err != nil {
+		return p, err
+	}
+
+	return response.(refundPaymentResponse).payment, nil
+}
+
+// GetAvailableAccounts get available account to send money.
+func (c *GRPCClient) GetAvailableAccounts(ctx context.Context) (accounts []account.Account, err error) {
+	response, err := c.getAvailableAccountsEndpoint(ctx, getAvailableAccountsRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.(getAvailableAccountsResponse).accounts, nil
+}
+
+// CreateAccount creates a new account.
+func (c *GRPCClient) CreateAccount(ctx context.Context, input account.Account) (acc account.Account, err error) {
+	response, err := c.createAccountEndpoint(ctx, createAccountRequest{input: input})
+	if err != nil {
+		return acc, err
+	}
+
+	return response.(createAccountResponse).account, nil
+}
+
+// GetAccount get account by ID.
+func (c *GRPCClient) GetAccount(ctx context.Context, id string) (acc account.Account, err error) {
+	response, err := c.getAccountEndpoint(ctx, getAccountRequest{id: id})
+	if err != nil {
+		return acc, err
+	}
+
+	return response.(getAccountResponse).account, nil
+}
+
+// UpdateAccount partially updates an account.
+func (c *GRPCClient) UpdateAccount(ctx context.Context, id string, input account.AccountUpdate) (acc account.Account, err error) {
+	response, err := c.updateAccountEndpoint(ctx, updateAccountRequest{id: id, input: input})
+	if err != nil {
+		return acc, err
+	}
+
+	return response.(updateAccountResponse).account, nil
+}
+
+// CloseAccount closes an account.
+func (c *GRPCClient) CloseAccount(ctx context.Context, id string) (err error) {
+	_, err = c.closeAccountEndpoint(ctx, closeAccountRequest{id: id})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetStatement get account statement for the period.
+func (c *GRPCClient) GetStatement(ctx context.Context, id string, from, to *time.Time) (st account.Statement, err error) {
+	response, err := c.getStatementEndpoint(ctx, getStatementRequest{id: id, from: from, to: to})
+	if err != nil {
+		return st, err
+	}
+
+	return response.(getStatementResponse).statement, nil
+}
+
+// CreateQuote locks an exchange rate for a payment between accounts with different currencies.
+func (c *GRPCClient) CreateQuote(ctx context.Context, input fx.QuoteInput) (q fx.Quote, err error) {
+	response, err := c.createQuoteEndpoint(ctx, createQuoteRequest{input: input})
+	if err != nil {
+		return q, err
+	}
+
+	return response.(createQuoteResponse).quote, nil
+}
+
+// CreateSchedule creates a scheduled payment.
+func (c *GRPCClient) CreateSchedule(ctx context.Context, input schedule.ScheduleInput) (sch schedule.Schedule, err error) {
+	response, err := c.createScheduleEndpoint(ctx, createScheduleRequest{input: input})
+	if err != nil {
+		return sch, err
+	}
+
+	return response.(createScheduleResponse).schedule, nil
+}
+
+// GetSchedules get schedules sending money from the account, or all schedules if the account is empty.
+func (c *GRPCClient) GetSchedules(ctx context.Context, accountID string) (schedules []schedule.Schedule, err error) {
+	response, err := c.getSchedulesEndpoint(ctx, getSchedulesRequest{accountID: accountID})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.(getSchedulesResponse).schedules, nil
+}
+
+// GetSchedule get schedule by ID.
+func (c *GRPCClient) GetSchedule(ctx context.Context, id uint64) (sch schedule.Schedule, err error) {
+	response, err := c.getScheduleEndpoint(ctx, getScheduleRequest{id: id})
+	if err != nil {
+		return sch, err
+	}
+
+	return response.(getScheduleResponse).schedule, nil
+}
+
+// CancelSchedule cancels an active schedule.
+func (c *GRPCClient) CancelSchedule(ctx context.Context, id uint64) (err error) {
+	_, err = c.cancelScheduleEndpoint(ctx, cancelScheduleRequest{id: id})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AuthorizePayment places a hold on the source account funds for a payment captured later.
+func (c *GRPCClient) AuthorizePayment(ctx context.Context, input hold.AuthorizeInput) (h hold.Hold, err error) {
+	response, err := c.authorizePaymentEndpoint(ctx, authorizePaymentRequest{input: input})
+	if err != nil {
+		return h, err
+	}
+
+	return response.(holdResponse).hold, nil
+}
+
+// GetHold get hold by ID.
+func (c *GRPCClient) GetHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	response, err := c.getHoldEndpoint(ctx, getHoldRequest{id: id})
+	if err != nil {
+		return h, err
+	}
+
+	return response.(holdResponse).hold, nil
+}
+
+// CaptureHold sends the payment of the hold, fully or partially.
+func (c *GRPCClient) CaptureHold(ctx context.Context, id uint64, input hold.CaptureInput) (h hold.Hold, err error) {
+	response, err := c.captureHoldEndpoint(ctx, captureHoldRequest{id: id, input: input})
+	if err != nil {
+		return h, err
+	}
+
+	return response.(holdResponse).hold, nil
+}
+
+// VoidHold releases the hold without payment.
+func (c *GRPCClient) VoidHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	response, err := c.voidHoldEndpoint(ctx, voidHoldRequest{id: id})
+	if err != nil {
+		return h, err
+	}
+
+	return response.(holdResponse).hold, nil
+}
+
+// CreateSubscription registers a webhook receiving events of the account payments and holds.
+func (c *GRPCClient) CreateSubscription(ctx context.Context, accountID string, input webhook.SubscriptionInput) (sub webhook.Subscription, err error) {
+	response, err := c.createSubscriptionEndpoint(ctx, createSubscriptionRequest{accountID: accountID, input: input})
+	if err != nil {
+		return sub, err
+	}
+
+	return response.(createSubscriptionResponse).subscription, nil
+}
+
+// GetSubscriptions get webhook subscriptions of the account.
+func (c *GRPCClient) GetSubscriptions(ctx context.Context, accountID string) (subs []webhook.Subscription, err error) {
+	response, err := c.getSubscriptionsEndpoint(ctx, getSubscriptionsRequest{accountID: accountID})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.(getSubscriptionsResponse).subscriptions, nil
+}
+
+// GetSubscription get webhook subscription by ID.
+func (c *GRPCClient) GetSubscription(ctx context.Context, id uint64) (sub webhook.Subscription, err error) {
+	response, err := c.getSubscriptionEndpoint(ctx, getSubscriptionRequest{id: id})
+	if err != nil {
+		return sub, err
+	}
+
+	return response.(getSubscriptionResponse).subscription, nil
+}
+
+// DeleteSubscription deletes the webhook subscription, its pending deliveries are not sent.
+func (c *GRPCClient) DeleteSubscription(ctx context.Context, id uint64) (err error) {
+	_, err = c.deleteSubscriptionEndpoint(ctx, deleteSubscriptionRequest{id: id})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetDeliveries get the latest deliveries of the webhook subscription.
+func (c *GRPCClient) GetDeliveries(ctx context.Context, subscriptionID uint64) (deliveries []webhook.Delivery, err error) {
+	response, err := c.getDeliveriesEndpoint(ctx, getDeliveriesRequest{id: subscriptionID})
+	if err != nil {
+		return nil, err
+	}
+
+	return response.(getDeliveriesResponse).deliveries, nil
+}
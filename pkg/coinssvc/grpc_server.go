@@ -0,0 +1,437 @@
+package coinssvc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/donmikel/coins/pkg/coinssvc/pb"
+	kitgrpc "github.com/go-kit/kit/transport/grpc"
+)
+
+// ServeGRPC starts gRPC server and stops it when the provided context is canceled.
+// The server is stopped forcibly if it is not gracefully stopped in ShutdownTimeout.
+func (s *Server) ServeGRPC(ctx context.Context) error {
+	lis, err := net.Listen("tcp", ":"+s.cfg.GRPCPort)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.grpcSrv.Serve(lis)
+	}()
+
+	select {
+	case err := <-errChan:
+		return err
+
+	case <-ctx.Done():
+		stopped := make(chan struct{})
+		go func() {
+			s.grpcSrv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(s.cfg.ShutdownTimeout):
+			s.grpcSrv.Stop()
+		}
+		return nil
+	}
+}
+
+// grpcServer implements the Coins gRPC service with go-kit handlers sharing endpoints with the HTTP API.
+type grpcServer struct {
+	getAvailableAccounts kitgrpc.Handler
+	getAllPayments       kitgrpc.Handler
+	sendPayment          kitgrpc.Handler
+	sendPayments         kitgrpc.Handler
+	getPayment           kitgrpc.Handler
+	refundPayment        kitgrpc.Handler
+	createAccount        kitgrpc.Handler
+	getAccount           kitgrpc.Handler
+	updateAccount        kitgrpc.Handler
+	closeAccount         kitgrpc.Handler
+	getStatement         kitgrpc.Handler
+	createQuote          kitgrpc.Handler
+	createSchedule       kitgrpc.Handler
+	getSchedules         kitgrpc.Handler
+	getSchedule          kitgrpc.Handler
+	cancelSchedule       kitgrpc.Handler
+	authorizePayment     kitgrpc.Handler
+	getHold              kitgrpc.Handler
+	captureHold          kitgrpc.Handler
+	voidHold             kitgrpc.Handler
+	createSubscription   kitgrpc.Handler
+	getSubscriptions     kitgrpc.Handler
+	getSubscription      kitgrpc.Handler
+	deleteSubscription   kitgrpc.Handler
+	getDeliveries        kitgrpc.Handler
+}
+
+func makeGRPCServer(svc Service) pb.CoinsServer {
+	return &grpcServer{
+		getAvailableAccounts: kitgrpc.NewServer(
+			makeGetAvailableAccountsEndpoint(svc),
+			decodeGRPCGetAvailableAccountsRequest,
+			encodeGRPCGetAvailableAccountsResponse,
+		),
+		getAllPayments: kitgrpc.NewServer(
+			makeGetAllPaymentsEndpoint(svc),
+			decodeGRPCGetAllPaymentsRequest,
+			encodeGRPCGetAllPaymentsResponse,
+		),
+		sendPayment: kitgrpc.NewServer(
+			makeSendPaymentEndpoint(svc),
+			decodeGRPCSendPaymentRequest,
+			encodeGRPCSendPaymentResponse,
+		),
+		sendPayments: kitgrpc.NewServer(
+			makeSendPaymentsEndpoint(svc),
+			decodeGRPCSendPaymentsRequest,
+			encodeGRPCSendPaymentsResponse,
+		),
+		getPayment: kitgrpc.NewServer(
+			makeGetPaymentEndpoint(svc),
+			decodeGRPCGetPaymentRequest,
+			encodeGRPCGetPaymentResponse,
+		),
+		refundPayment: kitgrpc.NewServer(
+			makeRefundPaymentEndpoint(svc),
+			decodeGRPCRefundPaymentRequest,
+			encodeGRPCRefundPaymentResponse,
+		),
+		createAccount: kitgrpc.NewServer(
+			makeCreateAccountEndpoint(svc),
+			decodeGRPCCreateAccountRequest,
+			encodeGRPCCreateAccountResponse,
+		),
+		getAccount: kitgrpc.NewServer(
+			makeGetAccountEndpoint(svc),
+			decodeGRPCGetAccountRequest,
+			encodeGRPCGetAccountResponse,
+		),
+		updateAccount: kitgrpc.NewServer(
+			makeUpdateAccountEndpoint(svc),
+			decodeGRPCUpdateAccountRequest,
+			encodeGRPCUpdateAccountResponse,
+		),
+		closeAccount: kitgrpc.NewServer(
+			makeCloseAccountEndpoint(svc),
+			decodeGRPCCloseAccountRequest,
+			encodeGRPCEmptyResponse,
+		),
+		getStatement: kitgrpc.NewServer(
+			makeGetStatementEndpoint(svc),
+			decodeGRPCGetStatementRequest,
+			encodeGRPCGetStatementResponse,
+		),
+		createQuote: kitgrpc.NewServer(
+			makeCreateQuoteEndpoint(svc),
+			decodeGRPCCreateQuoteRequest,
+			encodeGRPCCreateQuoteResponse,
+		),
+		createSchedule: kitgrpc.NewServer(
+			makeCreateScheduleEndpoint(svc),
+			decodeGRPCCreateScheduleRequest,
+			encodeGRPCCreateScheduleResponse,
+		),
+		getSchedules: kitgrpc.NewServer(
+			makeGetSchedulesEndpoint(svc),
+			decodeGRPCGetSchedulesRequest,
+			encodeGRPCGetSchedulesResponse,
+		),
+		getSchedule: kitgrpc.NewServer(
+			makeGetScheduleEndpoint(svc),
+			decodeGRPCGetScheduleRequest,
+			encodeGRPCGetScheduleResponse,
+		),
+		cancelSchedule: kitgrpc.NewServer(
+			makeCancelScheduleEndpoint(svc),
+			decodeGRPCCancelScheduleRequest,
+			encodeGRPCEmptyResponse,
+		),
+		authorizePayment: kitgrpc.NewServer(
+			makeAuthorizePaymentEndpoint(svc),
+			decodeGRPCAuthorizePaymentRequest,
+			encodeGRPCHoldResponse,
+		),
+		getHold: kitgrpc.NewServer(
+			makeGetHoldEndpoint(svc),
+			decodeGRPCGetHoldRequest,
+			encodeGRPCHoldResponse,
+		),
+		captureHold: kitgrpc.NewServer(
+			makeCaptureHoldEndpoint(svc),
+			decodeGRPCCaptureHoldRequest,
+			encodeGRPCHoldResponse,
+		),
+		voidHold: kitgrpc.NewServer(
+			makeVoidHoldEndpoint(svc),
+			decodeGRPCVoidHoldRequest,
+			encodeGRPCHoldResponse,
+		),
+		createSubscription: kitgrpc.NewServer(
+			makeCreateSubscriptionEndpoint(svc),
+			decodeGRPCCreateSubscriptionRequest,
+			encodeGRPCCreateSubscriptionResponse,
+		),
+		getSubscriptions: kitgrpc.NewServer(
+			makeGetSubscriptionsEndpoint(svc),
+			decodeGRPCGetSubscriptionsRequest,
+			encodeGRPCGetSubscriptionsResponse,
+		),
+		getSubscription: kitgrpc.NewServer(
+			makeGetSubscriptionEndpoint(svc),
+			decodeGRPCGetSubscriptionRequest,
+			encodeGRPCGetSubscriptionResponse,
+		),
+		deleteSubscription: kitgrpc.NewServer(
+			makeDeleteSubscriptionEndpoint(svc),
+			decodeGRPCDeleteSubscriptionRequest,
+			encodeGRPCEmptyResponse,
+		),
+		getDeliveries: kitgrpc.NewServer(
+			makeGetDeliveriesEndpoint(svc),
+			decodeGRPCGetDeliveriesRequest,
+			encodeGRPCGetDeliveriesResponse,
+		),
+	}
+}
+
+// serveGRPC serves the request with the handler and converts service errors to gRPC statuses.
+func serveGRPC(ctx context.Context, h kitgrpc.Handler, req interface{}) (interface{}, error) {
+	_, res, err := h.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, encodeGRPCError(err)
+	}
+
+	return res, nil
+}
+
+func (s *grpcServer) GetAvailableAccounts(ctx context.Context, req *pb.Empty) (*pb.Accounts, error) {
+	res, err := serveGRPC(ctx, s.getAvailableAccounts, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Accounts), nil
+}
+
+func (s *grpcServer) GetAllPayments(ctx context.Context, req *pb.PaymentFilter) (*pb.PaymentPage, error) {
+	res, err := serveGRPC(ctx, s.getAllPayments, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.PaymentPage), nil
+}
+
+func (s *grpcServer) SendPayment(ctx context.Context, req *pb.PaymentInput) (*pb.Payment, error) {
+	res, err := serveGRPC(ctx, s.sendPayment, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Payment), nil
+}
+
+func (s *grpcServer) SendPayments(ctx context.Context, req *pb.BatchInput) (*pb.BatchResult, error) {
+	res, err := serveGRPC(ctx, s.sendPayments, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.BatchResult), nil
+}
+
+func (s *grpcServer) GetPayment(ctx context.Context, req *pb.IDRequest) (*pb.Payment, error) {
+	res, err := serveGRPC(ctx, s.getPayment, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Payment), nil
+}
+
+func (s *grpcServer) RefundPayment(ctx context.Context, req *pb.RefundRequest) (*pb.Payment, error) {
+	res, err := serveGRPC(ctx, s.refundPayment, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Payment), nil
+}
+
+func (s *grpcServer) CreateAccount(ctx context.Context, req *pb.Account) (*pb.Account, error) {
+	res, err := serveGRPC(ctx, s.createAccount, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Account), nil
+}
+
+func (s *grpcServer) GetAccount(ctx context.Context, req *pb.AccountIDRequest) (*pb.Account, error) {
+	res, err := serveGRPC(ctx, s.getAccount, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Account), nil
+}
+
+func (s *grpcServer) UpdateAccount(ctx context.Context, req *pb.UpdateAccountRequest) (*pb.Account, error) {
+	res, err := serveGRPC(ctx, s.updateAccount, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Account), nil
+}
+
+func (s *grpcServer) CloseAccount(ctx context.Context, req *pb.AccountIDRequest) (*pb.Empty, error) {
+	res, err := serveGRPC(ctx, s.closeAccount, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Empty), nil
+}
+
+func (s *grpcServer) GetStatement(ctx context.Context, req *pb.StatementRequest) (*pb.Statement, error) {
+	res, err := serveGRPC(ctx, s.getStatement, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Statement), nil
+}
+
+func (s *grpcServer) CreateQuote(ctx context.Context, req *pb.QuoteInput) (*pb.Quote, error) {
+	res, err := serveGRPC(ctx, s.createQuote, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Quote), nil
+}
+
+func (s *grpcServer) CreateSchedule(ctx context.Context, req *pb.ScheduleInput) (*pb.Schedule, error) {
+	res, err := serveGRPC(ctx, s.createSchedule, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Schedule), nil
+}
+
+func (s *grpcServer) GetSchedules(ctx context.Context, req *pb.AccountIDRequest) (*pb.Schedules, error) {
+	res, err := serveGRPC(ctx, s.getSchedules, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Schedules), nil
+}
+
+func (s *grpcServer) GetSchedule(ctx context.Context, req *pb.IDRequest) (*pb.Schedule, error) {
+	res, err := serveGRPC(ctx, s.getSchedule, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Schedule), nil
+}
+
+func (s *grpcServer) CancelSchedule(ctx context.Context, req *pb.IDRequest) (*pb.Empty, error) {
+	res, err := serveGRPC(ctx, s.cancelSchedule, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Empty), nil
+}
+
+func (s *grpcServer) AuthorizePayment(ctx context.Context, req *pb.AuthorizeInput) (*pb.Hold, error) {
+	res, err := serveGRPC(ctx, s.authorizePayment, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Hold), nil
+}
+
+func (s *grpcServer) GetHold(ctx context.Context, req *pb.IDRequest) (*pb.Hold, error) {
+	res, err := serveGRPC(ctx, s.getHold, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Hold), nil
+}
+
+func (s *grpcServer) CaptureHold(ctx context.Context, req *pb.CaptureRequest) (*pb.Hold, error) {
+	res, err := serveGRPC(ctx, s.captureHold, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Hold), nil
+}
+
+func (s *grpcServer) VoidHold(ctx context.Context, req *pb.IDRequest) (*pb.Hold, error) {
+	res, err := serveGRPC(ctx, s.voidHold, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Hold), nil
+}
+
+func (s *grpcServer) CreateSubscription(ctx context.Context, req *pb.CreateSubscriptionRequest) (*pb.Subscription, error) {
+	res, err := serveGRPC(ctx, s.createSubscription, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Subscription), nil
+}
+
+func (s *grpcServer) GetSubscriptions(ctx context.Context, req *pb.AccountIDRequest) (*pb.Subscriptions, error) {
+	res, err := serveGRPC(ctx, s.getSubscriptions, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Subscriptions), nil
+}
+
+func (s *grpcServer) GetSubscription(ctx context.Context, req *pb.IDRequest) (*pb.Subscription, error) {
+	res, err := serveGRPC(ctx, s.getSubscription, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Subscription), nil
+}
+
+func (s *grpcServer) DeleteSubscription(ctx context.Context, req *pb.IDRequest) (*pb.Empty, error) {
+	res, err := serveGRPC(ctx, s.deleteSubscription, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Empty), nil
+}
+
+func (s *grpcServer) GetDeliveries(ctx context.Context, req *pb.IDRequest) (*pb.Deliveries, error) {
+	res, err := serveGRPC(ctx, s.getDeliveries, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*pb.Deliveries), nil
+}
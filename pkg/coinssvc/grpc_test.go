@@ -0,0 +1,358 @@
+package coinssvc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/coinssvc/pb"
+	"github.com/donmikel/coins/pkg/hold"
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/webhook"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+)
+
+func initGRPCTransportTest(t *testing.T) (*grpc.Server, *GRPCClient, *mockService) {
+	svc := &mockService{}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	pb.RegisterCoinsServer(server, makeGRPCServer(svc))
+	go server.Serve(lis)
+
+	client, err := NewGRPCClient(GRPCClientConfig{
+		ServiceAddress: lis.Addr().String(),
+		Timeout:        time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+	})
+	return server, client, svc
+}
+
+func TestGRPCTransportErrors(t *testing.T) {
+	server, client, svc := initGRPCTransportTest(t)
+	defer server.Stop()
+
+	testCases := []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{
+			name:    "bad request",
+			err:     coins.ErrBadRequest("invalid payment: empty FromAccount"),
+			wantErr: coins.ErrBadRequest("invalid payment: empty FromAccount"),
+		},
+		{
+			name:    "not found",
+			err:     coins.ErrNotFound("payment 1 not found"),
+			wantErr: coins.ErrNotFound("payment 1 not found"),
+		},
+		{
+			name:    "conflict",
+			err:     coins.ErrConflict("idempotency key reused with a different request"),
+			wantErr: coins.ErrConflict("idempotency key reused with a different request"),
+		},
+		{
+			name:    "unprocessable",
+			err:     coins.ErrUnprocessable("insufficient funds"),
+			wantErr: coins.ErrUnprocessable("insufficient funds"),
+		},
+		{
+			name:    "limit exceeded",
+			err:     coins.ErrLimitExceeded("daily_total", decimal.NewFromInt(40), "daily_total limit of 300 USD exceeded, 40 USD remaining"),
+			wantErr: coins.ErrLimitExceeded("daily_total", decimal.NewFromInt(40), "daily_total limit of 300 USD exceeded, 40 USD remaining"),
+		},
+		{
+			name:    "internal error is not exposed",
+			err:     coins.ErrInternal("connection refused"),
+			wantErr: coins.ErrInternal("internal error"),
+		},
+		{
+			name:    "plain error is internal",
+			err:     errors.New("connection refused"),
+			wantErr: coins.ErrInternal("internal error"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc.onGetPayment = func(ctx context.Context, id uint64) (p payment.Payment, err error) {
+				return p, tc.err
+			}
+
+			_, gotErr := client.GetPayment(context.Background(), 1)
+
+			assert.Equal(t, tc.wantErr, gotErr)
+		})
+	}
+}
+
+func TestGRPCTransportGetAllPayments(t *testing.T) {
+	server, client, svc := initGRPCTransportTest(t)
+	defer server.Stop()
+
+	direction := payment.Outgoing
+	minAmount := decimal.NewFromInt(10)
+	maxAmount := decimal.New(2505, -1)
+	from := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC)
+	dt := time.Date(2020, 12, 25, 22, 41, 58, 401358000, time.UTC)
+	refundOf := uint64(1)
+
+	filter := payment.Filter{
+		Account:      "bob123",
+		Counterparty: "alice456",
+		Direction:    &direction,
+		MinAmount:    &minAmount,
+		MaxAmount:    &maxAmount,
+		From:         &from,
+		To:           &to,
+		Cursor:       42,
+		Limit:        10,
+	}
+	page := payment.Page{
+		Payments: []payment.Payment{
+			mustNewPayment(func(p *payment.Payment) {
+				p.ID = 2
+				p.Dt = &dt
+				p.RefundOf = &refundOf
+			}),
+			mustNewPayment(func(p *payment.Payment) {
+				p.ID = 3
+				p.Dt = &dt
+				p.InitiatedBy = "bob"
+				p.ApprovedBy = "ops"
+			}),
+		},
+		NextCursor: 2,
+	}
+
+	var gotFilter payment.Filter
+	svc.onGetAllPayments = func(ctx context.Context, filter payment.Filter) (payment.Page, error) {
+		gotFilter = filter
+		return page, nil
+	}
+
+	got, err := client.GetAllPayments(context.Background(), filter)
+	assert.NoError(t, err)
+	assert.Equal(t, filter, gotFilter)
+	assert.Equal(t, page, got)
+
+	_, err = client.GetAllPayments(context.Background(), payment.Filter{})
+	assert.NoError(t, err)
+	assert.Equal(t, payment.Filter{}, gotFilter)
+}
+
+func TestGRPCTransportSendPayment(t *testing.T) {
+	server, client, svc := initGRPCTransportTest(t)
+	defer server.Stop()
+
+	var gotInput payment.PaymentInput
+	svc.onSendPayments = func(ctx context.Context, input payment.PaymentInput) (payment.Payment, error) {
+		gotInput = input
+		return mustNewPayment(nil), nil
+	}
+
+	input := mustNewPaymentInput(func(pi *payment.PaymentInput) {
+		pi.QuoteID = "q-1"
+	})
+	got, err := client.SendPayment(context.Background(), input)
+	assert.NoError(t, err)
+	assert.Equal(t, mustNewPayment(nil), got)
+
+	assert.NotEmpty(t, gotInput.IdempotencyKey)
+	gotInput.IdempotencyKey = ""
+	assert.Equal(t, input, gotInput)
+
+	parked := mustNewPayment(func(p *payment.Payment) {
+		pendingID := uint64(7)
+		p.ID = 0
+		p.PendingID = &pendingID
+	})
+	svc.onSendPayments = func(ctx context.Context, input payment.PaymentInput) (payment.Payment, error) {
+		return parked, nil
+	}
+	got, err = client.SendPayment(context.Background(), input)
+	assert.NoError(t, err)
+	assert.Equal(t, parked, got)
+}
+
+func TestGRPCTransportSendPayments(t *testing.T) {
+	server, client, svc := initGRPCTransportTest(t)
+	defer server.Stop()
+
+	p := mustNewPayment(nil)
+	input := payment.BatchInput{
+		Mode:     payment.BestEffort,
+		Payments: []payment.PaymentInput{mustNewPaymentInput(nil), mustNewPaymentInput(nil)},
+	}
+	result := payment.BatchResult{
+		Mode: payment.BestEffort,
+		Results: []payment.BatchItem{
+			{Status: http.StatusCreated, Payment: &p},
+			{Status: http.StatusUnprocessableEntity, Error: "insufficient funds"},
+		},
+	}
+
+	var gotInput payment.BatchInput
+	svc.onSendPaymentsBatch = func(ctx context.Context, input payment.BatchInput) (payment.BatchResult, error) {
+		gotInput = input
+		return result, nil
+	}
+
+	got, err := client.SendPayments(context.Background(), input)
+	assert.NoError(t, err)
+	assert.Equal(t, input, gotInput)
+	assert.Equal(t, result, got)
+}
+
+func TestGRPCTransportUpdateAccount(t *testing.T) {
+	server, client, svc := initGRPCTransportTest(t)
+	defer server.Stop()
+
+	balance := decimal.New(105, -1)
+	currency := "EUR"
+	testCases := []struct {
+		name  string
+		input account.AccountUpdate
+	}{
+		{
+			name:  "balance",
+			input: account.AccountUpdate{Balance: &balance},
+		},
+		{
+			name:  "currency",
+			input: account.AccountUpdate{Currency: &currency},
+		},
+		{
+			name:  "nothing",
+			input: account.AccountUpdate{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotInput account.AccountUpdate
+			svc.onUpdateAccount = func(ctx context.Context, id string, input account.AccountUpdate) (account.Account, error) {
+				gotInput = input
+				return mustNewAccount(nil), nil
+			}
+
+			got, err := client.UpdateAccount(context.Background(), "bob123", tc.input)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.input, gotInput)
+			assert.Equal(t, "bob123", got.ID)
+			assert.True(t, decimal.NewFromInt(100).Equal(got.Balance))
+		})
+	}
+}
+
+func TestGRPCTransportGetStatement(t *testing.T) {
+	server, client, svc := initGRPCTransportTest(t)
+	defer server.Stop()
+
+	from := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	pay := mustNewPayment(nil)
+	st := account.Statement{
+		AccountID:      "bob123",
+		Currency:       "USD",
+		From:           &from,
+		OpeningBalance: decimal.NewFromInt(200),
+		ClosingBalance: decimal.NewFromInt(100),
+		Lines: []account.StatementLine{
+			{
+				Payment:     &pay,
+				Description: "payment",
+				Amount:      decimal.NewFromInt(-100),
+				Balance:     decimal.NewFromInt(100),
+			},
+			{
+				Description: "manual adjustment: chargeback",
+				Amount:      decimal.NewFromInt(-20),
+				Balance:     decimal.NewFromInt(80),
+			},
+		},
+	}
+
+	var gotFrom, gotTo *time.Time
+	svc.onGetStatement = func(ctx context.Context, id string, from, to *time.Time) (account.Statement, error) {
+		gotFrom, gotTo = from, to
+		return st, nil
+	}
+
+	got, err := client.GetStatement(context.Background(), "bob123", &from, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, &from, gotFrom)
+	assert.Nil(t, gotTo)
+	assert.Equal(t, st, got)
+}
+
+func TestGRPCTransportCaptureHold(t *testing.T) {
+	server, client, svc := initGRPCTransportTest(t)
+	defer server.Stop()
+
+	partial := decimal.NewFromInt(4)
+	paymentID := uint64(7)
+	captured := mustNewHold(func(h *hold.Hold) {
+		h.Status = hold.Captured
+		h.PaymentID = &paymentID
+	})
+
+	var gotID uint64
+	var gotInput hold.CaptureInput
+	svc.onCaptureHold = func(ctx context.Context, id uint64, input hold.CaptureInput) (hold.Hold, error) {
+		gotID, gotInput = id, input
+		return captured, nil
+	}
+
+	got, err := client.CaptureHold(context.Background(), 1, hold.CaptureInput{Amount: &partial, QuoteID: "q-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), gotID)
+	assert.Equal(t, hold.CaptureInput{Amount: &partial, QuoteID: "q-1"}, gotInput)
+	assert.Equal(t, captured, got)
+
+	_, err = client.CaptureHold(context.Background(), 1, hold.CaptureInput{})
+	assert.NoError(t, err)
+	assert.Nil(t, gotInput.Amount)
+}
+
+func TestGRPCTransportGetDeliveries(t *testing.T) {
+	server, client, svc := initGRPCTransportTest(t)
+	defer server.Stop()
+
+	lastAttempt := time.Date(2020, 12, 25, 10, 0, 0, 0, time.UTC)
+	deliveries := []webhook.Delivery{{
+		ID:             2,
+		SubscriptionID: 1,
+		EventID:        7,
+		EventType:      "payment.created",
+		Status:         webhook.Dead,
+		Attempts:       8,
+		LastAttempt:    &lastAttempt,
+		ResponseStatus: http.StatusInternalServerError,
+		LastError:      "webhook returned status 500",
+		CreatedAt:      lastAttempt.Add(-time.Hour),
+	}}
+	svc.onGetDeliveries = func(ctx context.Context, subscriptionID uint64) ([]webhook.Delivery, error) {
+		return deliveries, nil
+	}
+
+	got, err := client.GetDeliveries(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, deliveries, got)
+}
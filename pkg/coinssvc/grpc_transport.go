@@ -0,0 +1,1305 @@
+package coinssvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/coinssvc/pb"
+	"github.com/donmikel/coins/pkg/event"
+	"github.com/donmikel/coins/pkg/fx"
+	"github.com/donmikel/coins/pkg/hold"
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/schedule"
+	"github.com/donmikel/coins/pkg/webhook"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/shopspring/decimal"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcCodes maps HTTP status codes of service errors to gRPC status codes and back.
+var grpcCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.Aborted,
+	http.StatusUnprocessableEntity: codes.FailedPrecondition,
+	http.StatusInternalServerError: codes.Internal,
+}
+
+func encodeGRPCError(err error) error {
+	var e *coins.ServiceError
+	if !errors.As(err, &e) || e.Code == http.StatusInternalServerError {
+		return status.Error(codes.Internal, "internal error")
+	}
+	code, ok := grpcCodes[e.Code]
+	if !ok {
+		code = codes.Unknown
+	}
+
+	st := status.New(code, e.Message)
+	if e.Limit != "" && e.Remaining != nil {
+		if detailed, err := st.WithDetails(&pb.LimitExceeded{Limit: e.Limit, Remaining: e.Remaining.String()}); err == nil {
+			st = detailed
+		}
+	}
+
+	return st.Err()
+}
+
+func decodeGRPCError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	for httpCode, code := range grpcCodes {
+		if st.Code() == code {
+			e := &coins.ServiceError{Code: httpCode, Message: st.Message()}
+			for _, d := range st.Details() {
+				if m, ok := d.(*pb.LimitExceeded); ok {
+					e.Limit, e.Remaining = limitExceededFromPB(m)
+				}
+			}
+			return e
+		}
+	}
+
+	return err
+}
+
+func limitExceededFromPB(m *pb.LimitExceeded) (limit string, remaining *decimal.Decimal) {
+	if m == nil || m.GetLimit() == "" {
+		return "", nil
+	}
+	remaining, err := parseOptionalDecimal(m.GetRemaining(), "remaining")
+	if err != nil {
+		return "", nil
+	}
+
+	return m.GetLimit(), remaining
+}
+
+func parseDecimal(v, name string) (decimal.Decimal, error) {
+	if v == "" {
+		return decimal.Zero, nil
+	}
+	d, err := decimal.NewFromString(v)
+	if err != nil {
+		return d, fmt.Errorf("invalid %s: %v", name, err)
+	}
+
+	return d, nil
+}
+
+func parseOptionalDecimal(v, name string) (*decimal.Decimal, error) {
+	if v == "" {
+		return nil, nil
+	}
+	d, err := parseDecimal(v, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &d, nil
+}
+
+func formatOptionalDecimal(d *decimal.Decimal) string {
+	if d == nil {
+		return ""
+	}
+
+	return d.String()
+}
+
+func parseDirection(v uint32) (payment.Direction, error) {
+	if v > math.MaxUint16 {
+		return 0, fmt.Errorf("invalid direction %d", v)
+	}
+
+	return payment.Direction(v), nil
+}
+
+func toPBTime(t time.Time) *timestamp.Timestamp {
+	return &timestamp.Timestamp{Seconds: t.Unix(), Nanos: int32(t.Nanosecond())}
+}
+
+func toPBOptionalTime(t *time.Time) *timestamp.Timestamp {
+	if t == nil {
+		return nil
+	}
+
+	return toPBTime(*t)
+}
+
+func parseTime(ts *timestamp.Timestamp, name string) (time.Time, error) {
+	if ts == nil {
+		return time.Time{}, nil
+	}
+	t, err := ptypes.Timestamp(ts)
+	if err != nil {
+		return t, fmt.Errorf("invalid %s: %v", name, err)
+	}
+
+	return t, nil
+}
+
+func parseOptionalTime(ts *timestamp.Timestamp, name string) (*time.Time, error) {
+	if ts == nil {
+		return nil, nil
+	}
+	t, err := parseTime(ts, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func optionalID(id uint64) *uint64 {
+	if id == 0 {
+		return nil
+	}
+
+	return &id
+}
+
+func idValue(id *uint64) uint64 {
+	if id == nil {
+		return 0
+	}
+
+	return *id
+}
+
+func toPBAccount(acc account.Account) *pb.Account {
+	return &pb.Account{
+		Id:       acc.ID,
+		Balance:  acc.Balance.String(),
+		Currency: acc.Currency,
+		Status:   string(acc.Status),
+		Held:     acc.Held.String(),
+		Owner:    acc.Owner,
+	}
+}
+
+func accountFromPB(m *pb.Account) (acc account.Account, err error) {
+	acc = account.Account{
+		ID:       m.GetId(),
+		Currency: m.GetCurrency(),
+		Status:   account.Status(m.GetStatus()),
+		Owner:    m.GetOwner(),
+	}
+	if acc.Balance, err = parseDecimal(m.GetBalance(), "balance"); err != nil {
+		return acc, err
+	}
+	if acc.Held, err = parseDecimal(m.GetHeld(), "held"); err != nil {
+		return acc, err
+	}
+
+	return acc, nil
+}
+
+func toPBPayment(p payment.Payment) *pb.Payment {
+	return &pb.Payment{
+		Id:             p.ID,
+		FromAccount:    p.FromAccount,
+		Amount:         p.Amount.String(),
+		ToAccount:      p.ToAccount,
+		Direction:      uint32(p.Direction),
+		Dt:             toPBOptionalTime(p.Dt),
+		Currency:       p.Currency,
+		CreditAmount:   p.CreditAmount.String(),
+		CreditCurrency: p.CreditCurrency,
+		Rate:           p.Rate.String(),
+		QuoteId:        p.QuoteID,
+		RefundOf:       idValue(p.RefundOf),
+		PendingId:      idValue(p.PendingID),
+		InitiatedBy:    p.InitiatedBy,
+		ApprovedBy:     p.ApprovedBy,
+	}
+}
+
+func paymentFromPB(m *pb.Payment) (p payment.Payment, err error) {
+	p = payment.Payment{
+		ID:             m.GetId(),
+		FromAccount:    m.GetFromAccount(),
+		ToAccount:      m.GetToAccount(),
+		Currency:       m.GetCurrency(),
+		CreditCurrency: m.GetCreditCurrency(),
+		QuoteID:        m.GetQuoteId(),
+		RefundOf:       optionalID(m.GetRefundOf()),
+		PendingID:      optionalID(m.GetPendingId()),
+		InitiatedBy:    m.GetInitiatedBy(),
+		ApprovedBy:     m.GetApprovedBy(),
+	}
+	if p.Direction, err = parseDirection(m.GetDirection()); err != nil {
+		return p, err
+	}
+	if p.Amount, err = parseDecimal(m.GetAmount(), "amount"); err != nil {
+		return p, err
+	}
+	if p.CreditAmount, err = parseDecimal(m.GetCreditAmount(), "credit_amount"); err != nil {
+		return p, err
+	}
+	if p.Rate, err = parseDecimal(m.GetRate(), "rate"); err != nil {
+		return p, err
+	}
+	if p.Dt, err = parseOptionalTime(m.GetDt(), "dt"); err != nil {
+		return p, err
+	}
+
+	return p, nil
+}
+
+func toPBPaymentInput(input payment.PaymentInput) *pb.PaymentInput {
+	return &pb.PaymentInput{
+		FromAccount:    input.FromAccount,
+		Amount:         input.Amount.String(),
+		ToAccount:      input.ToAccount,
+		Direction:      uint32(input.Direction),
+		QuoteId:        input.QuoteID,
+		IdempotencyKey: input.IdempotencyKey,
+	}
+}
+
+func paymentInputFromPB(m *pb.PaymentInput) (input payment.PaymentInput, err error) {
+	input = payment.PaymentInput{
+		FromAccount:    m.GetFromAccount(),
+		ToAccount:      m.GetToAccount(),
+		QuoteID:        m.GetQuoteId(),
+		IdempotencyKey: m.GetIdempotencyKey(),
+	}
+	if input.Direction, err = parseDirection(m.GetDirection()); err != nil {
+		return input, err
+	}
+	if input.Amount, err = parseDecimal(m.GetAmount(), "amount"); err != nil {
+		return input, err
+	}
+	if len(input.IdempotencyKey) > maxIdempotencyKeyLen {
+		return input, fmt.Errorf("idempotency_key is longer than %d characters", maxIdempotencyKeyLen)
+	}
+
+	return input, nil
+}
+
+func toPBPaymentFilter(f payment.Filter) *pb.PaymentFilter {
+	m := &pb.PaymentFilter{
+		Account:      f.Account,
+		Counterparty: f.Counterparty,
+		MinAmount:    formatOptionalDecimal(f.MinAmount),
+		MaxAmount:    formatOptionalDecimal(f.MaxAmount),
+		From:         toPBOptionalTime(f.From),
+		To:           toPBOptionalTime(f.To),
+		Cursor:       f.Cursor,
+		Limit:        uint32(f.Limit),
+	}
+	if f.Direction != nil {
+		m.Direction = &wrappers.UInt32Value{Value: uint32(*f.Direction)}
+	}
+
+	return m
+}
+
+func paymentFilterFromPB(m *pb.PaymentFilter) (f payment.Filter, err error) {
+	f = payment.Filter{
+		Account:      m.GetAccount(),
+		Counterparty: m.GetCounterparty(),
+		Cursor:       m.GetCursor(),
+	}
+	if m.GetDirection() != nil {
+		direction, err := parseDirection(m.GetDirection().GetValue())
+		if err != nil {
+			return f, err
+		}
+		f.Direction = &direction
+	}
+	if f.MinAmount, err = parseOptionalDecimal(m.GetMinAmount(), "min_amount"); err != nil {
+		return f, err
+	}
+	if f.MaxAmount, err = parseOptionalDecimal(m.GetMaxAmount(), "max_amount"); err != nil {
+		return f, err
+	}
+	if f.From, err = parseOptionalTime(m.GetFrom(), "from"); err != nil {
+		return f, err
+	}
+	if f.To, err = parseOptionalTime(m.GetTo(), "to"); err != nil {
+		return f, err
+	}
+	if m.GetLimit() > payment.MaxLimit {
+		return f, errors.New("invalid limit")
+	}
+	f.Limit = int(m.GetLimit())
+
+	return f, nil
+}
+
+func toPBStatement(st account.Statement) *pb.Statement {
+	m := &pb.Statement{
+		AccountId:      st.AccountID,
+		Currency:       st.Currency,
+		From:           toPBOptionalTime(st.From),
+		To:             toPBOptionalTime(st.To),
+		OpeningBalance: st.OpeningBalance.String(),
+		ClosingBalance: st.ClosingBalance.String(),
+		Lines:          make([]*pb.StatementLine, 0, len(st.Lines)),
+	}
+	for _, line := range st.Lines {
+		ml := &pb.StatementLine{
+			Amount:      line.Amount.String(),
+			Balance:     line.Balance.String(),
+			Description: line.Description,
+		}
+		if line.Payment != nil {
+			ml.Payment = toPBPayment(*line.Payment)
+		}
+		m.Lines = append(m.Lines, ml)
+	}
+
+	return m
+}
+
+func statementFromPB(m *pb.Statement) (st account.Statement, err error) {
+	st = account.Statement{
+		AccountID: m.GetAccountId(),
+		Currency:  m.GetCurrency(),
+		Lines:     make([]account.StatementLine, 0, len(m.GetLines())),
+	}
+	if st.From, err = parseOptionalTime(m.GetFrom(), "from"); err != nil {
+		return st, err
+	}
+	if st.To, err = parseOptionalTime(m.GetTo(), "to"); err != nil {
+		return st, err
+	}
+	if st.OpeningBalance, err = parseDecimal(m.GetOpeningBalance(), "opening_balance"); err != nil {
+		return st, err
+	}
+	if st.ClosingBalance, err = parseDecimal(m.GetClosingBalance(), "closing_balance"); err != nil {
+		return st, err
+	}
+	for _, l := range m.GetLines() {
+		line := account.StatementLine{Description: l.GetDescription()}
+		if l.GetPayment() != nil {
+			p, err := paymentFromPB(l.GetPayment())
+			if err != nil {
+				return st, err
+			}
+			line.Payment = &p
+		}
+		if line.Amount, err = parseDecimal(l.GetAmount(), "amount"); err != nil {
+			return st, err
+		}
+		if line.Balance, err = parseDecimal(l.GetBalance(), "balance"); err != nil {
+			return st, err
+		}
+		st.Lines = append(st.Lines, line)
+	}
+
+	return st, nil
+}
+
+func toPBQuote(q fx.Quote) *pb.Quote {
+	return &pb.Quote{
+		Id:           q.ID,
+		FromCurrency: q.FromCurrency,
+		ToCurrency:   q.ToCurrency,
+		Rate:         q.Rate.String(),
+		ExpiresAt:    toPBTime(q.ExpiresAt),
+	}
+}
+
+func quoteFromPB(m *pb.Quote) (q fx.Quote, err error) {
+	q = fx.Quote{
+		ID:           m.GetId(),
+		FromCurrency: m.GetFromCurrency(),
+		ToCurrency:   m.GetToCurrency(),
+	}
+	if q.Rate, err = parseDecimal(m.GetRate(), "rate"); err != nil {
+		return q, err
+	}
+	if q.ExpiresAt, err = parseTime(m.GetExpiresAt(), "expires_at"); err != nil {
+		return q, err
+	}
+
+	return q, nil
+}
+
+func toPBSchedule(sch schedule.Schedule) *pb.Schedule {
+	return &pb.Schedule{
+		Id:            sch.ID,
+		FromAccount:   sch.FromAccount,
+		ToAccount:     sch.ToAccount,
+		Amount:        sch.Amount.String(),
+		Direction:     uint32(sch.Direction),
+		Schedule:      sch.Spec,
+		Status:        string(sch.Status),
+		NextRun:       toPBTime(sch.NextRun),
+		RetryAt:       toPBOptionalTime(sch.RetryAt),
+		Attempts:      int32(sch.Attempts),
+		LastRun:       toPBOptionalTime(sch.LastRun),
+		LastPaymentId: idValue(sch.LastPaymentID),
+		LastError:     sch.LastError,
+	}
+}
+
+func scheduleFromPB(m *pb.Schedule) (sch schedule.Schedule, err error) {
+	sch = schedule.Schedule{
+		ID:            m.GetId(),
+		FromAccount:   m.GetFromAccount(),
+		ToAccount:     m.GetToAccount(),
+		Spec:          m.GetSchedule(),
+		Status:        schedule.Status(m.GetStatus()),
+		Attempts:      int(m.GetAttempts()),
+		LastPaymentID: optionalID(m.GetLastPaymentId()),
+		LastError:     m.GetLastError(),
+	}
+	if sch.Direction, err = parseDirection(m.GetDirection()); err != nil {
+		return sch, err
+	}
+	if sch.Amount, err = parseDecimal(m.GetAmount(), "amount"); err != nil {
+		return sch, err
+	}
+	if sch.NextRun, err = parseTime(m.GetNextRun(), "next_run"); err != nil {
+		return sch, err
+	}
+	if sch.RetryAt, err = parseOptionalTime(m.GetRetryAt(), "retry_at"); err != nil {
+		return sch, err
+	}
+	if sch.LastRun, err = parseOptionalTime(m.GetLastRun(), "last_run"); err != nil {
+		return sch, err
+	}
+
+	return sch, nil
+}
+
+func toPBSchedules(schedules []schedule.Schedule) *pb.Schedules {
+	m := &pb.Schedules{Schedules: make([]*pb.Schedule, 0, len(schedules))}
+	for _, sch := range schedules {
+		m.Schedules = append(m.Schedules, toPBSchedule(sch))
+	}
+
+	return m
+}
+
+func toPBHold(h hold.Hold) *pb.Hold {
+	return &pb.Hold{
+		Id:          h.ID,
+		FromAccount: h.FromAccount,
+		ToAccount:   h.ToAccount,
+		Amount:      h.Amount.String(),
+		Direction:   uint32(h.Direction),
+		Status:      string(h.Status),
+		CreatedAt:   toPBTime(h.CreatedAt),
+		ExpiresAt:   toPBTime(h.ExpiresAt),
+		PaymentId:   idValue(h.PaymentID),
+	}
+}
+
+func holdFromPB(m *pb.Hold) (h hold.Hold, err error) {
+	h = hold.Hold{
+		ID:          m.GetId(),
+		FromAccount: m.GetFromAccount(),
+		ToAccount:   m.GetToAccount(),
+		Status:      hold.Status(m.GetStatus()),
+		PaymentID:   optionalID(m.GetPaymentId()),
+	}
+	if h.Direction, err = parseDirection(m.GetDirection()); err != nil {
+		return h, err
+	}
+	if h.Amount, err = parseDecimal(m.GetAmount(), "amount"); err != nil {
+		return h, err
+	}
+	if h.CreatedAt, err = parseTime(m.GetCreatedAt(), "created_at"); err != nil {
+		return h, err
+	}
+	if h.ExpiresAt, err = parseTime(m.GetExpiresAt(), "expires_at"); err != nil {
+		return h, err
+	}
+
+	return h, nil
+}
+
+func toPBSubscription(sub webhook.Subscription) *pb.Subscription {
+	return &pb.Subscription{
+		Id:        sub.ID,
+		AccountId: sub.AccountID,
+		Url:       sub.URL,
+		CreatedAt: toPBTime(sub.CreatedAt),
+	}
+}
+
+func subscriptionFromPB(m *pb.Subscription) (sub webhook.Subscription, err error) {
+	sub = webhook.Subscription{
+		ID:        m.GetId(),
+		AccountID: m.GetAccountId(),
+		URL:       m.GetUrl(),
+	}
+	if sub.CreatedAt, err = parseTime(m.GetCreatedAt(), "created_at"); err != nil {
+		return sub, err
+	}
+
+	return sub, nil
+}
+
+func toPBDelivery(d webhook.Delivery) *pb.Delivery {
+	return &pb.Delivery{
+		Id:             d.ID,
+		SubscriptionId: d.SubscriptionID,
+		EventId:        d.EventID,
+		EventType:      string(d.EventType),
+		Status:         string(d.Status),
+		Attempts:       int32(d.Attempts),
+		NextAttempt:    toPBOptionalTime(d.NextAttempt),
+		LastAttempt:    toPBOptionalTime(d.LastAttempt),
+		ResponseStatus: int32(d.ResponseStatus),
+		LastError:      d.LastError,
+		CreatedAt:      toPBTime(d.CreatedAt),
+	}
+}
+
+func deliveryFromPB(m *pb.Delivery) (d webhook.Delivery, err error) {
+	d = webhook.Delivery{
+		ID:             m.GetId(),
+		SubscriptionID: m.GetSubscriptionId(),
+		EventID:        m.GetEventId(),
+		EventType:      event.Type(m.GetEventType()),
+		Status:         webhook.DeliveryStatus(m.GetStatus()),
+		Attempts:       int(m.GetAttempts()),
+		ResponseStatus: int(m.GetResponseStatus()),
+		LastError:      m.GetLastError(),
+	}
+	if d.NextAttempt, err = parseOptionalTime(m.GetNextAttempt(), "next_attempt"); err != nil {
+		return d, err
+	}
+	if d.LastAttempt, err = parseOptionalTime(m.GetLastAttempt(), "last_attempt"); err != nil {
+		return d, err
+	}
+	if d.CreatedAt, err = parseTime(m.GetCreatedAt(), "created_at"); err != nil {
+		return d, err
+	}
+
+	return d, nil
+}
+
+// Server side request decoders and response encoders.
+
+func decodeGRPCGetAvailableAccountsRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return getAvailableAccountsRequest{}, nil
+}
+
+func encodeGRPCGetAvailableAccountsResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	res := response.(getAvailableAccountsResponse)
+	m := &pb.Accounts{Accounts: make([]*pb.Account, 0, len(res.accounts))}
+	for _, acc := range res.accounts {
+		m.Accounts = append(m.Accounts, toPBAccount(acc))
+	}
+
+	return m, nil
+}
+
+func decodeGRPCGetAllPaymentsRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	filter, err := paymentFilterFromPB(request.(*pb.PaymentFilter))
+	if err != nil {
+		return nil, coins.ErrBadRequest("%v", err)
+	}
+
+	return getAllPaymentsRequest{filter: filter}, nil
+}
+
+func encodeGRPCGetAllPaymentsResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	res := response.(getAllPaymentsResponse)
+	m := &pb.PaymentPage{
+		Payments:   make([]*pb.Payment, 0, len(res.page.Payments)),
+		NextCursor: res.page.NextCursor,
+	}
+	for _, p := range res.page.Payments {
+		m.Payments = append(m.Payments, toPBPayment(p))
+	}
+
+	return m, nil
+}
+
+func decodeGRPCSendPaymentRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	input, err := paymentInputFromPB(request.(*pb.PaymentInput))
+	if err != nil {
+		return nil, coins.ErrBadRequest("%v", err)
+	}
+
+	return sendPaymentRequest{input: input}, nil
+}
+
+func encodeGRPCSendPaymentResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return toPBPayment(response.(sendPaymentResponse).payment), nil
+}
+
+func decodeGRPCSendPaymentsRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.BatchInput)
+	input := payment.BatchInput{
+		Mode:     payment.BatchMode(req.GetMode()),
+		Payments: make([]payment.PaymentInput, 0, len(req.GetPayments())),
+	}
+	for i, m := range req.GetPayments() {
+		p, err := paymentInputFromPB(m)
+		if err != nil {
+			return nil, coins.ErrBadRequest("payment %d: %v", i, err)
+		}
+		input.Payments = append(input.Payments, p)
+	}
+
+	return sendPaymentsRequest{input: input}, nil
+}
+
+func encodeGRPCSendPaymentsResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	res := response.(sendPaymentsResponse).result
+	m := &pb.BatchResult{
+		Mode:    string(res.Mode),
+		Results: make([]*pb.BatchItem, 0, len(res.Results)),
+	}
+	for _, item := range res.Results {
+		mi := &pb.BatchItem{Status: int32(item.Status), Error: item.Error}
+		if item.Limit != "" && item.Remaining != nil {
+			mi.LimitExceeded = &pb.LimitExceeded{Limit: item.Limit, Remaining: item.Remaining.String()}
+		}
+		if item.Payment != nil {
+			mi.Payment = toPBPayment(*item.Payment)
+		}
+		m.Results = append(m.Results, mi)
+	}
+
+	return m, nil
+}
+
+func decodeGRPCGetPaymentRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return getPaymentRequest{id: request.(*pb.IDRequest).GetId()}, nil
+}
+
+func encodeGRPCGetPaymentResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return toPBPayment(response.(getPaymentResponse).payment), nil
+}
+
+func decodeGRPCRefundPaymentRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.RefundRequest)
+	amount, err := parseOptionalDecimal(req.GetAmount(), "amount")
+	if err != nil {
+		return nil, coins.ErrBadRequest("%v", err)
+	}
+
+	return refundPaymentRequest{id: req.GetId(), input: payment.RefundInput{Amount: amount}}, nil
+}
+
+func encodeGRPCRefundPaymentResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return toPBPayment(response.(refundPaymentResponse).payment), nil
+}
+
+func decodeGRPCCreateAccountRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	input, err := accountFromPB(request.(*pb.Account))
+	if err != nil {
+		return nil, coins.ErrBadRequest("%v", err)
+	}
+
+	return createAccountRequest{input: input}, nil
+}
+
+func encodeGRPCCreateAccountResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return toPBAccount(response.(createAccountResponse).account), nil
+}
+
+func decodeGRPCGetAccountRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return getAccountRequest{id: request.(*pb.AccountIDRequest).GetAccountId()}, nil
+}
+
+func encodeGRPCGetAccountResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return toPBAccount(response.(getAccountResponse).account), nil
+}
+
+func decodeGRPCUpdateAccountRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.UpdateAccountRequest)
+	var input account.AccountUpdate
+	if req.GetBalance() != nil {
+		balance, err := decimal.NewFromString(req.GetBalance().GetValue())
+		if err != nil {
+			return nil, coins.ErrBadRequest("invalid balance: %v", err)
+		}
+		input.Balance = &balance
+	}
+	if req.GetCurrency() != nil {
+		currency := req.GetCurrency().GetValue()
+		input.Currency = &currency
+	}
+
+	return updateAccountRequest{id: req.GetId(), input: input}, nil
+}
+
+func encodeGRPCUpdateAccountResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return toPBAccount(response.(updateAccountResponse).account), nil
+}
+
+func decodeGRPCCloseAccountRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return closeAccountRequest{id: request.(*pb.AccountIDRequest).GetAccountId()}, nil
+}
+
+func encodeGRPCEmptyResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return &pb.Empty{}, nil
+}
+
+func decodeGRPCGetStatementRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.StatementRequest)
+	from, err := parseOptionalTime(req.GetFrom(), "from")
+	if err != nil {
+		return nil, coins.ErrBadRequest("%v", err)
+	}
+	to, err := parseOptionalTime(req.GetTo(), "to")
+	if err != nil {
+		return nil, coins.ErrBadRequest("%v", err)
+	}
+
+	return getStatementRequest{id: req.GetId(), from: from, to: to}, nil
+}
+
+func encodeGRPCGetStatementResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return toPBStatement(response.(getStatementResponse).statement), nil
+}
+
+func decodeGRPCCreateQuoteRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.QuoteInput)
+
+	return createQuoteRequest{input: fx.QuoteInput{
+		FromCurrency: req.GetFromCurrency(),
+		ToCurrency:   req.GetToCurrency(),
+	}}, nil
+}
+
+func encodeGRPCCreateQuoteResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return toPBQuote(response.(createQuoteResponse).quote), nil
+}
+
+func decodeGRPCCreateScheduleRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.ScheduleInput)
+	input := schedule.ScheduleInput{
+		FromAccount: req.GetFromAccount(),
+		ToAccount:   req.GetToAccount(),
+		Spec:        req.GetSchedule(),
+	}
+	var err error
+	if input.Direction, err = parseDirection(req.GetDirection()); err != nil {
+		return nil, coins.ErrBadRequest("%v", err)
+	}
+	if input.Amount, err = parseDecimal(req.GetAmount(), "amount"); err != nil {
+		return nil, coins.ErrBadRequest("%v", err)
+	}
+	if input.StartAt, err = parseOptionalTime(req.GetStartAt(), "start_at"); err != nil {
+		return nil, coins.ErrBadRequest("%v", err)
+	}
+
+	return createScheduleRequest{input: input}, nil
+}
+
+func encodeGRPCCreateScheduleResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return toPBSchedule(response.(createScheduleResponse).schedule), nil
+}
+
+func decodeGRPCGetSchedulesRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return getSchedulesRequest{accountID: request.(*pb.AccountIDRequest).GetAccountId()}, nil
+}
+
+func encodeGRPCGetSchedulesResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return toPBSchedules(response.(getSchedulesResponse).schedules), nil
+}
+
+func decodeGRPCGetScheduleRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return getScheduleRequest{id: request.(*pb.IDRequest).GetId()}, nil
+}
+
+func encodeGRPCGetScheduleResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return toPBSchedule(response.(getScheduleResponse).schedule), nil
+}
+
+func decodeGRPCCancelScheduleRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return cancelScheduleRequest{id: request.(*pb.IDRequest).GetId()}, nil
+}
+
+func decodeGRPCAuthorizePaymentRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.AuthorizeInput)
+	input := hold.AuthorizeInput{
+		FromAccount: req.GetFromAccount(),
+		ToAccount:   req.GetToAccount(),
+	}
+	var err error
+	if input.Direction, err = parseDirection(req.GetDirection()); err != nil {
+		return nil, coins.ErrBadRequest("%v", err)
+	}
+	if input.Amount, err = parseDecimal(req.GetAmount(), "amount"); err != nil {
+		return nil, coins.ErrBadRequest("%v", err)
+	}
+	if input.ExpiresAt, err = parseOptionalTime(req.GetExpiresAt(), "expires_at"); err != nil {
+		return nil, coins.ErrBadRequest("%v", err)
+	}
+
+	return authorizePaymentRequest{input: input}, nil
+}
+
+func encodeGRPCHoldResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return toPBHold(response.(holdResponse).hold), nil
+}
+
+func decodeGRPCGetHoldRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return getHoldRequest{id: request.(*pb.IDRequest).GetId()}, nil
+}
+
+func decodeGRPCCaptureHoldRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.CaptureRequest)
+	amount, err := parseOptionalDecimal(req.GetAmount(), "amount")
+	if err != nil {
+		return nil, coins.ErrBadRequest("%v", err)
+	}
+
+	return captureHoldRequest{id: req.GetId(), input: hold.CaptureInput{Amount: amount, QuoteID: req.GetQuoteId()}}, nil
+}
+
+func decodeGRPCVoidHoldRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return voidHoldRequest{id: request.(*pb.IDRequest).GetId()}, nil
+}
+
+func decodeGRPCCreateSubscriptionRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.CreateSubscriptionRequest)
+
+	return createSubscriptionRequest{
+		accountID: req.GetAccountId(),
+		input:     webhook.SubscriptionInput{URL: req.GetUrl(), Secret: req.GetSecret()},
+	}, nil
+}
+
+func encodeGRPCCreateSubscriptionResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return toPBSubscription(response.(createSubscriptionResponse).subscription), nil
+}
+
+func decodeGRPCGetSubscriptionsRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return getSubscriptionsRequest{accountID: request.(*pb.AccountIDRequest).GetAccountId()}, nil
+}
+
+func encodeGRPCGetSubscriptionsResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	subs := response.(getSubscriptionsResponse).subscriptions
+	m := &pb.Subscriptions{Subscriptions: make([]*pb.Subscription, 0, len(subs))}
+	for _, sub := range subs {
+		m.Subscriptions = append(m.Subscriptions, toPBSubscription(sub))
+	}
+
+	return m, nil
+}
+
+func decodeGRPCGetSubscriptionRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return getSubscriptionRequest{id: request.(*pb.IDRequest).GetId()}, nil
+}
+
+func encodeGRPCGetSubscriptionResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return toPBSubscription(response.(getSubscriptionResponse).subscription), nil
+}
+
+func decodeGRPCDeleteSubscriptionRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return deleteSubscriptionRequest{id: request.(*pb.IDRequest).GetId()}, nil
+}
+
+func decodeGRPCGetDeliveriesRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return getDeliveriesRequest{id: request.(*pb.IDRequest).GetId()}, nil
+}
+
+func encodeGRPCGetDeliveriesResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	deliveries := response.(getDeliveriesResponse).deliveries
+	m := &pb.Deliveries{Deliveries: make([]*pb.Delivery, 0, len(deliveries))}
+	for _, d := range deliveries {
+		m.Deliveries = append(m.Deliveries, toPBDelivery(d))
+	}
+
+	return m, nil
+}
+
+// Client side request encoders and response decoders.
+
+func encodeGRPCGetAvailableAccountsRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return &pb.Empty{}, nil
+}
+
+func decodeGRPCGetAvailableAccountsResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	reply := response.(*pb.Accounts)
+	res := getAvailableAccountsResponse{accounts: make([]account.Account, 0, len(reply.GetAccounts()))}
+	for _, m := range reply.GetAccounts() {
+		acc, err := accountFromPB(m)
+		if err != nil {
+			return nil, err
+		}
+		res.accounts = append(res.accounts, acc)
+	}
+
+	return res, nil
+}
+
+func encodeGRPCGetAllPaymentsRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return toPBPaymentFilter(request.(getAllPaymentsRequest).filter), nil
+}
+
+func decodeGRPCGetAllPaymentsResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	reply := response.(*pb.PaymentPage)
+	res := getAllPaymentsResponse{page: payment.Page{
+		Payments:   make([]payment.Payment, 0, len(reply.GetPayments())),
+		NextCursor: reply.GetNextCursor(),
+	}}
+	for _, m := range reply.GetPayments() {
+		p, err := paymentFromPB(m)
+		if err != nil {
+			return nil, err
+		}
+		res.page.Payments = append(res.page.Payments, p)
+	}
+
+	return res, nil
+}
+
+func encodeGRPCSendPaymentRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return toPBPaymentInput(request.(sendPaymentRequest).input), nil
+}
+
+func decodeGRPCSendPaymentResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	p, err := paymentFromPB(response.(*pb.Payment))
+	if err != nil {
+		return nil, err
+	}
+
+	return sendPaymentResponse{payment: p}, nil
+}
+
+func encodeGRPCSendPaymentsRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	input := request.(sendPaymentsRequest).input
+	m := &pb.BatchInput{
+		Mode:     string(input.Mode),
+		Payments: make([]*pb.PaymentInput, 0, len(input.Payments)),
+	}
+	for _, p := range input.Payments {
+		m.Payments = append(m.Payments, toPBPaymentInput(p))
+	}
+
+	return m, nil
+}
+
+func decodeGRPCSendPaymentsResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	reply := response.(*pb.BatchResult)
+	res := sendPaymentsResponse{result: payment.BatchResult{
+		Mode:    payment.BatchMode(reply.GetMode()),
+		Results: make([]payment.BatchItem, 0, len(reply.GetResults())),
+	}}
+	for _, m := range reply.GetResults() {
+		item := payment.BatchItem{Status: int(m.GetStatus()), Error: m.GetError()}
+		item.Limit, item.Remaining = limitExceededFromPB(m.GetLimitExceeded())
+		if m.GetPayment() != nil {
+			p, err := paymentFromPB(m.GetPayment())
+			if err != nil {
+				return nil, err
+			}
+			item.Payment = &p
+		}
+		res.result.Results = append(res.result.Results, item)
+	}
+
+	return res, nil
+}
+
+func encodeGRPCGetPaymentRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return &pb.IDRequest{Id: request.(getPaymentRequest).id}, nil
+}
+
+func decodeGRPCGetPaymentResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	p, err := paymentFromPB(response.(*pb.Payment))
+	if err != nil {
+		return nil, err
+	}
+
+	return getPaymentResponse{payment: p}, nil
+}
+
+func encodeGRPCRefundPaymentRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(refundPaymentRequest)
+
+	return &pb.RefundRequest{Id: req.id, Amount: formatOptionalDecimal(req.input.Amount)}, nil
+}
+
+func decodeGRPCRefundPaymentResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	p, err := paymentFromPB(response.(*pb.Payment))
+	if err != nil {
+		return nil, err
+	}
+
+	return refundPaymentResponse{payment: p}, nil
+}
+
+func encodeGRPCCreateAccountRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return toPBAccount(request.(createAccountRequest).input), nil
+}
+
+func decodeGRPCCreateAccountResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	acc, err := accountFromPB(response.(*pb.Account))
+	if err != nil {
+		return nil, err
+	}
+
+	return createAccountResponse{account: acc}, nil
+}
+
+func encodeGRPCGetAccountRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return &pb.AccountIDRequest{AccountId: request.(getAccountRequest).id}, nil
+}
+
+func decodeGRPCGetAccountResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	acc, err := accountFromPB(response.(*pb.Account))
+	if err != nil {
+		return nil, err
+	}
+
+	return getAccountResponse{account: acc}, nil
+}
+
+func encodeGRPCUpdateAccountRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(updateAccountRequest)
+	m := &pb.UpdateAccountRequest{Id: req.id}
+	if req.input.Balance != nil {
+		m.Balance = &wrappers.StringValue{Value: req.input.Balance.String()}
+	}
+	if req.input.Currency != nil {
+		m.Currency = &wrappers.StringValue{Value: *req.input.Currency}
+	}
+
+	return m, nil
+}
+
+func decodeGRPCUpdateAccountResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	acc, err := accountFromPB(response.(*pb.Account))
+	if err != nil {
+		return nil, err
+	}
+
+	return updateAccountResponse{account: acc}, nil
+}
+
+func encodeGRPCCloseAccountRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return &pb.AccountIDRequest{AccountId: request.(closeAccountRequest).id}, nil
+}
+
+func decodeGRPCCloseAccountResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return closeAccountResponse{}, nil
+}
+
+func encodeGRPCGetStatementRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(getStatementRequest)
+
+	return &pb.StatementRequest{
+		Id:   req.id,
+		From: toPBOptionalTime(req.from),
+		To:   toPBOptionalTime(req.to),
+	}, nil
+}
+
+func decodeGRPCGetStatementResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	st, err := statementFromPB(response.(*pb.Statement))
+	if err != nil {
+		return nil, err
+	}
+
+	return getStatementResponse{statement: st}, nil
+}
+
+func encodeGRPCCreateQuoteRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	input := request.(createQuoteRequest).input
+
+	return &pb.QuoteInput{FromCurrency: input.FromCurrency, ToCurrency: input.ToCurrency}, nil
+}
+
+func decodeGRPCCreateQuoteResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	q, err := quoteFromPB(response.(*pb.Quote))
+	if err != nil {
+		return nil, err
+	}
+
+	return createQuoteResponse{quote: q}, nil
+}
+
+func encodeGRPCCreateScheduleRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	input := request.(createScheduleRequest).input
+
+	return &pb.ScheduleInput{
+		FromAccount: input.FromAccount,
+		ToAccount:   input.ToAccount,
+		Amount:      input.Amount.String(),
+		Direction:   uint32(input.Direction),
+		Schedule:    input.Spec,
+		StartAt:     toPBOptionalTime(input.StartAt),
+	}, nil
+}
+
+func decodeGRPCCreateScheduleResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	sch, err := scheduleFromPB(response.(*pb.Schedule))
+	if err != nil {
+		return nil, err
+	}
+
+	return createScheduleResponse{schedule: sch}, nil
+}
+
+func encodeGRPCGetSchedulesRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return &pb.AccountIDRequest{AccountId: request.(getSchedulesRequest).accountID}, nil
+}
+
+func decodeGRPCGetSchedulesResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	reply := response.(*pb.Schedules)
+	res := getSchedulesResponse{schedules: make([]schedule.Schedule, 0, len(reply.GetSchedules()))}
+	for _, m := range reply.GetSchedules() {
+		sch, err := scheduleFromPB(m)
+		if err != nil {
+			return nil, err
+		}
+		res.schedules = append(res.schedules, sch)
+	}
+
+	return res, nil
+}
+
+func encodeGRPCGetScheduleRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return &pb.IDRequest{Id: request.(getScheduleRequest).id}, nil
+}
+
+func decodeGRPCGetScheduleResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	sch, err := scheduleFromPB(response.(*pb.Schedule))
+	if err != nil {
+		return nil, err
+	}
+
+	return getScheduleResponse{schedule: sch}, nil
+}
+
+func encodeGRPCCancelScheduleRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return &pb.IDRequest{Id: request.(cancelScheduleRequest).id}, nil
+}
+
+func decodeGRPCCancelScheduleResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return cancelScheduleResponse{}, nil
+}
+
+func encodeGRPCAuthorizePaymentRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	input := request.(authorizePaymentRequest).input
+
+	return &pb.AuthorizeInput{
+		FromAccount: input.FromAccount,
+		ToAccount:   input.ToAccount,
+		Amount:      input.Amount.String(),
+		Direction:   uint32(input.Direction),
+		ExpiresAt:   toPBOptionalTime(input.ExpiresAt),
+	}, nil
+}
+
+func decodeGRPCHoldResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	h, err := holdFromPB(response.(*pb.Hold))
+	if err != nil {
+		return nil, err
+	}
+
+	return holdResponse{hold: h}, nil
+}
+
+func encodeGRPCGetHoldRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return &pb.IDRequest{Id: request.(getHoldRequest).id}, nil
+}
+
+func encodeGRPCCaptureHoldRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(captureHoldRequest)
+
+	return &pb.CaptureRequest{
+		Id:      req.id,
+		Amount:  formatOptionalDecimal(req.input.Amount),
+		QuoteId: req.input.QuoteID,
+	}, nil
+}
+
+func encodeGRPCVoidHoldRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return &pb.IDRequest{Id: request.(voidHoldRequest).id}, nil
+}
+
+func encodeGRPCCreateSubscriptionRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	req := request.(createSubscriptionRequest)
+
+	return &pb.CreateSubscriptionRequest{
+		AccountId: req.accountID,
+		Url:       req.input.URL,
+		Secret:    req.input.Secret,
+	}, nil
+}
+
+func decodeGRPCCreateSubscriptionResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	sub, err := subscriptionFromPB(response.(*pb.Subscription))
+	if err != nil {
+		return nil, err
+	}
+
+	return createSubscriptionResponse{subscription: sub}, nil
+}
+
+func encodeGRPCGetSubscriptionsRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return &pb.AccountIDRequest{AccountId: request.(getSubscriptionsRequest).accountID}, nil
+}
+
+func decodeGRPCGetSubscriptionsResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	reply := response.(*pb.Subscriptions)
+	res := getSubscriptionsResponse{subscriptions: make([]webhook.Subscription, 0, len(reply.GetSubscriptions()))}
+	for _, m := range reply.GetSubscriptions() {
+		sub, err := subscriptionFromPB(m)
+		if err != nil {
+			return nil, err
+		}
+		res.subscriptions = append(res.subscriptions, sub)
+	}
+
+	return res, nil
+}
+
+func encodeGRPCGetSubscriptionRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return &pb.IDRequest{Id: request.(getSubscriptionRequest).id}, nil
+}
+
+func decodeGRPCGetSubscriptionResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	sub, err := subscriptionFromPB(response.(*pb.Subscription))
+	if err != nil {
+		return nil, err
+	}
+
+	return getSubscriptionResponse{subscription: sub}, nil
+}
+
+func encodeGRPCDeleteSubscriptionRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return &pb.IDRequest{Id: request.(deleteSubscriptionRequest).id}, nil
+}
+
+func decodeGRPCDeleteSubscriptionResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	return deleteSubscriptionResponse{}, nil
+}
+
+func encodeGRPCGetDeliveriesRequest(ctx context.Context, request interface{}) (interface{}, error) {
+	return &pb.IDRequest{Id: request.(getDeliveriesRequest).id}, nil
+}
+
+func decodeGRPCGetDeliveriesResponse(ctx context.Context, response interface{}) (interface{}, error) {
+	reply := response.(*pb.Deliveries)
+	res := getDeliveriesResponse{deliveries: make([]webhook.Delivery, 0, len(reply.GetDeliveries()))}
+	for _, m := range reply.GetDeliveries() {
+		d, err := deliveryFromPB(m)
+		if err != nil {
+			return nil, err
+		}
+		res.deliveries = append(res.deliveries, d)
+	}
+
+	return res, nil
+}
@@ -5,7 +5,12 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/fx"
+	"github.com/donmikel/coins/pkg/hold"
 	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/schedule"
+	"github.com/donmikel/coins/pkg/webhook"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/go-kit/kit/metrics"
@@ -32,21 +37,131 @@ func NewInstrumentingMiddleware(svc Service, prefix string) *InstrumentingMiddle
 	}
 }
 
-func (mw *InstrumentingMiddleware) GetAllPayments(ctx context.Context) (payments []payment.Payment, err error) {
+func (mw *InstrumentingMiddleware) GetAllPayments(ctx context.Context, filter payment.Filter) (page payment.Page, err error) {
 	defer mw.record(time.Now(), "GetAllPayments", &err)
-	return mw.svc.GetAllPayments(ctx)
+	return mw.svc.GetAllPayments(ctx, filter)
 }
 
-func (mw *InstrumentingMiddleware) SendPayment(ctx context.Context, payment payment.PaymentInput) (err error) {
+func (mw *InstrumentingMiddleware) SendPayment(ctx context.Context, input payment.PaymentInput) (p payment.Payment, err error) {
 	defer mw.record(time.Now(), "SendPayment", &err)
-	return mw.svc.SendPayment(ctx, payment)
+	return mw.svc.SendPayment(ctx, input)
 }
 
-func (mw *InstrumentingMiddleware) GetAvailableAccounts(ctx context.Context) (accounts []string, err error) {
+func (mw *InstrumentingMiddleware) SendPayments(ctx context.Context, input payment.BatchInput) (res payment.BatchResult, err error) {
+	defer mw.record(time.Now(), "SendPayments", &err)
+	return mw.svc.SendPayments(ctx, input)
+}
+
+func (mw *InstrumentingMiddleware) GetPayment(ctx context.Context, id uint64) (p payment.Payment, err error) {
+	defer mw.record(time.Now(), "GetPayment", &err)
+	return mw.svc.GetPayment(ctx, id)
+}
+
+func (mw *InstrumentingMiddleware) RefundPayment(ctx context.Context, id uint64, input payment.RefundInput) (p payment.Payment, err error) {
+	defer mw.record(time.Now(), "RefundPayment", &err)
+	return mw.svc.RefundPayment(ctx, id, input)
+}
+
+func (mw *InstrumentingMiddleware) GetAvailableAccounts(ctx context.Context) (accounts []account.Account, err error) {
 	defer mw.record(time.Now(), "GetAvailableAccounts", &err)
 	return mw.svc.GetAvailableAccounts(ctx)
 }
 
+func (mw *InstrumentingMiddleware) CreateAccount(ctx context.Context, input account.Account) (acc account.Account, err error) {
+	defer mw.record(time.Now(), "CreateAccount", &err)
+	return mw.svc.CreateAccount(ctx, input)
+}
+
+func (mw *InstrumentingMiddleware) GetAccount(ctx context.Context, id string) (acc account.Account, err error) {
+	defer mw.record(time.Now(), "GetAccount", &err)
+	return mw.svc.GetAccount(ctx, id)
+}
+
+func (mw *InstrumentingMiddleware) UpdateAccount(ctx context.Context, id string, input account.AccountUpdate) (acc account.Account, err error) {
+	defer mw.record(time.Now(), "UpdateAccount", &err)
+	return mw.svc.UpdateAccount(ctx, id, input)
+}
+
+func (mw *InstrumentingMiddleware) CloseAccount(ctx context.Context, id string) (err error) {
+	defer mw.record(time.Now(), "CloseAccount", &err)
+	return mw.svc.CloseAccount(ctx, id)
+}
+
+func (mw *InstrumentingMiddleware) GetStatement(ctx context.Context, id string, from, to *time.Time) (st account.Statement, err error) {
+	defer mw.record(time.Now(), "GetStatement", &err)
+	return mw.svc.GetStatement(ctx, id, from, to)
+}
+
+func (mw *InstrumentingMiddleware) CreateQuote(ctx context.Context, input fx.QuoteInput) (q fx.Quote, err error) {
+	defer mw.record(time.Now(), "CreateQuote", &err)
+	return mw.svc.CreateQuote(ctx, input)
+}
+
+func (mw *InstrumentingMiddleware) CreateSchedule(ctx context.Context, input schedule.ScheduleInput) (sch schedule.Schedule, err error) {
+	defer mw.record(time.Now(), "CreateSchedule", &err)
+	return mw.svc.CreateSchedule(ctx, input)
+}
+
+func (mw *InstrumentingMiddleware) GetSchedules(ctx context.Context, accountID string) (schedules []schedule.Schedule, err error) {
+	defer mw.record(time.Now(), "GetSchedules", &err)
+	return mw.svc.GetSchedules(ctx, accountID)
+}
+
+func (mw *InstrumentingMiddleware) GetSchedule(ctx context.Context, id uint64) (sch schedule.Schedule, err error) {
+	defer mw.record(time.Now(), "GetSchedule", &err)
+	return mw.svc.GetSchedule(ctx, id)
+}
+
+func (mw *InstrumentingMiddleware) CancelSchedule(ctx context.Context, id uint64) (err error) {
+	defer mw.record(time.Now(), "CancelSchedule", &err)
+	return mw.svc.CancelSchedule(ctx, id)
+}
+
+func (mw *InstrumentingMiddleware) AuthorizePayment(ctx context.Context, input hold.AuthorizeInput) (h hold.Hold, err error) {
+	defer mw.record(time.Now(), "AuthorizePayment", &err)
+	return mw.svc.AuthorizePayment(ctx, input)
+}
+
+func (mw *InstrumentingMiddleware) GetHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	defer mw.record(time.Now(), "GetHold", &err)
+	return mw.svc.GetHold(ctx, id)
+}
+
+func (mw *InstrumentingMiddleware) CaptureHold(ctx context.Context, id uint64, input hold.CaptureInput) (h hold.Hold, err error) {
+	defer mw.record(time.Now(), "CaptureHold", &err)
+	return mw.svc.CaptureHold(ctx, id, input)
+}
+
+func (mw *InstrumentingMiddleware) VoidHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	defer mw.record(time.Now(), "VoidHold", &err)
+	return mw.svc.VoidHold(ctx, id)
+}
+
+func (mw *InstrumentingMiddleware) CreateSubscription(ctx context.Context, accountID string, input webhook.SubscriptionInput) (sub webhook.Subscription, err error) {
+	defer mw.record(time.Now(), "CreateSubscription", &err)
+	return mw.svc.CreateSubscription(ctx, accountID, input)
+}
+
+func (mw *InstrumentingMiddleware) GetSubscriptions(ctx context.Context, accountID string) (subs []webhook.Subscription, err error) {
+	defer mw.record(time.Now(), "GetSubscriptions", &err)
+	return mw.svc.GetSubscriptions(ctx, accountID)
+}
+
+func (mw *InstrumentingMiddleware) GetSubscription(ctx context.Context, id uint64) (sub webhook.Subscription, err error) {
+	defer mw.record(time.Now(), "GetSubscription", &err)
+	return mw.svc.GetSubscription(ctx, id)
+}
+
+func (mw *InstrumentingMiddleware) DeleteSubscription(ctx context.Context, id uint64) (err error) {
+	defer mw.record(time.Now(), "DeleteSubscription", &err)
+	return mw.svc.DeleteSubscription(ctx, id)
+}
+
+func (mw *InstrumentingMiddleware) GetDeliveries(ctx context.Context, subscriptionID uint64) (deliveries []webhook.Delivery, err error) {
+	defer mw.record(time.Now(), "GetDeliveries", &err)
+	return mw.svc.GetDeliveries(ctx, subscriptionID)
+}
+
 func (mw *InstrumentingMiddleware) record(beginTime time.Time, method string, err *error) {
 	labels := []string{"method", method, "error", strconv.FormatBool(*err != nil)}
 	mw.histogram.With(labels...).Observe(time.Since(beginTime).Seconds())
@@ -65,21 +180,131 @@ func NewLoggingMiddleware(svc Service, logger log.Logger) *LoggingMiddleware {
 	}
 }
 
-func (mw *LoggingMiddleware) GetAllPayments(ctx context.Context) (payments []payment.Payment, err error) {
+func (mw *LoggingMiddleware) GetAllPayments(ctx context.Context, filter payment.Filter) (page payment.Page, err error) {
 	defer mw.log(time.Now(), "GetAllPayments", &err)
-	return mw.svc.GetAllPayments(ctx)
+	return mw.svc.GetAllPayments(ctx, filter)
 }
 
-func (mw *LoggingMiddleware) SendPayment(ctx context.Context, payment payment.PaymentInput) (err error) {
+func (mw *LoggingMiddleware) SendPayment(ctx context.Context, input payment.PaymentInput) (p payment.Payment, err error) {
 	defer mw.log(time.Now(), "SendPayment", &err)
-	return mw.svc.SendPayment(ctx, payment)
+	return mw.svc.SendPayment(ctx, input)
 }
 
-func (mw *LoggingMiddleware) GetAvailableAccounts(ctx context.Context) (accounts []string, err error) {
+func (mw *LoggingMiddleware) SendPayments(ctx context.Context, input payment.BatchInput) (res payment.BatchResult, err error) {
+	defer mw.log(time.Now(), "SendPayments", &err)
+	return mw.svc.SendPayments(ctx, input)
+}
+
+func (mw *LoggingMiddleware) GetPayment(ctx context.Context, id uint64) (p payment.Payment, err error) {
+	defer mw.log(time.Now(), "GetPayment", &err)
+	return mw.svc.GetPayment(ctx, id)
+}
+
+func (mw *LoggingMiddleware) RefundPayment(ctx context.Context, id uint64, input payment.RefundInput) (p payment.Payment, err error) {
+	defer mw.log(time.Now(), "RefundPayment", &err)
+	return mw.svc.RefundPayment(ctx, id, input)
+}
+
+func (mw *LoggingMiddleware) GetAvailableAccounts(ctx context.Context) (accounts []account.Account, err error) {
 	defer mw.log(time.Now(), "GetAvailableAccounts", &err)
 	return mw.svc.GetAvailableAccounts(ctx)
 }
 
+func (mw *LoggingMiddleware) CreateAccount(ctx context.Context, input account.Account) (acc account.Account, err error) {
+	defer mw.log(time.Now(), "CreateAccount", &err)
+	return mw.svc.CreateAccount(ctx, input)
+}
+
+func (mw *LoggingMiddleware) GetAccount(ctx context.Context, id string) (acc account.Account, err error) {
+	defer mw.log(time.Now(), "GetAccount", &err)
+	return mw.svc.GetAccount(ctx, id)
+}
+
+func (mw *LoggingMiddleware) UpdateAccount(ctx context.Context, id string, input account.AccountUpdate) (acc account.Account, err error) {
+	defer mw.log(time.Now(), "UpdateAccount", &err)
+	return mw.svc.UpdateAccount(ctx, id, input)
+}
+
+func (mw *LoggingMiddleware) CloseAccount(ctx context.Context, id string) (err error) {
+	defer mw.log(time.Now(), "CloseAccount", &err)
+	return mw.svc.CloseAccount(ctx, id)
+}
+
+func (mw *LoggingMiddleware) GetStatement(ctx context.Context, id string, from, to *time.Time) (st account.Statement, err error) {
+	defer mw.log(time.Now(), "GetStatement", &err)
+	return mw.svc.GetStatement(ctx, id, from, to)
+}
+
+func (mw *LoggingMiddleware) CreateQuote(ctx context.Context, input fx.QuoteInput) (q fx.Quote, err error) {
+	defer mw.log(time.Now(), "CreateQuote", &err)
+	return mw.svc.CreateQuote(ctx, input)
+}
+
+func (mw *LoggingMiddleware) CreateSchedule(ctx context.Context, input schedule.ScheduleInput) (sch schedule.Schedule, err error) {
+	defer mw.log(time.Now(), "CreateSchedule", &err)
+	return mw.svc.CreateSchedule(ctx, input)
+}
+
+func (mw *LoggingMiddleware) GetSchedules(ctx context.Context, accountID string) (schedules []schedule.Schedule, err error) {
+	defer mw.log(time.Now(), "GetSchedules", &err)
+	return mw.svc.GetSchedules(ctx, accountID)
+}
+
+func (mw *LoggingMiddleware) GetSchedule(ctx context.Context, id uint64) (sch schedule.Schedule, err error) {
+	defer mw.log(time.Now(), "GetSchedule", &err)
+	return mw.svc.GetSchedule(ctx, id)
+}
+
+func (mw *LoggingMiddleware) CancelSchedule(ctx context.Context, id uint64) (err error) {
+	defer mw.log(time.Now(), "CancelSchedule", &err)
+	return mw.svc.CancelSchedule(ctx, id)
+}
+
+func (mw *LoggingMiddleware) AuthorizePayment(ctx context.Context, input hold.AuthorizeInput) (h hold.Hold, err error) {
+	defer mw.log(time.Now(), "AuthorizePayment", &err)
+	return mw.svc.AuthorizePayment(ctx, input)
+}
+
+func (mw *LoggingMiddleware) GetHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	defer mw.log(time.Now(), "GetHold", &err)
+	return mw.svc.GetHold(ctx, id)
+}
+
+func (mw *LoggingMiddleware) CaptureHold(ctx context.Context, id uint64, input hold.CaptureInput) (h hold.Hold, err error) {
+	defer mw.log(time.Now(), "CaptureHold", &err)
+	return mw.svc.CaptureHold(ctx, id, input)
+}
+
+func (mw *LoggingMiddleware) VoidHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	defer mw.log(time.Now(), "VoidHold", &err)
+	return mw.svc.VoidHold(ctx, id)
+}
+
+func (mw *LoggingMiddleware) CreateSubscription(ctx context.Context, accountID string, input webhook.SubscriptionInput) (sub webhook.Subscription, err error) {
+	defer mw.log(time.Now(), "CreateSubscription", &err)
+	return mw.svc.CreateSubscription(ctx, accountID, input)
+}
+
+func (mw *LoggingMiddleware) GetSubscriptions(ctx context.Context, accountID string) (subs []webhook.Subscription, err error) {
+	defer mw.log(time.Now(), "GetSubscriptions", &err)
+	return mw.svc.GetSubscriptions(ctx, accountID)
+}
+
+func (mw *LoggingMiddleware) GetSubscription(ctx context.Context, id uint64) (sub webhook.Subscription, err error) {
+	defer mw.log(time.Now(), "GetSubscription", &err)
+	return mw.svc.GetSubscription(ctx, id)
+}
+
+func (mw *LoggingMiddleware) DeleteSubscription(ctx context.Context, id uint64) (err error) {
+	defer mw.log(time.Now(), "DeleteSubscription", &err)
+	return mw.svc.DeleteSubscription(ctx, id)
+}
+
+func (mw *LoggingMiddleware) GetDeliveries(ctx context.Context, subscriptionID uint64) (deliveries []webhook.Delivery, err error) {
+	defer mw.log(time.Now(), "GetDeliveries", &err)
+	return mw.svc.GetDeliveries(ctx, subscriptionID)
+}
+
 func (mw *LoggingMiddleware) log(beginTime time.Time, method string, err *error) {
 	if *err != nil {
 		level.Error(mw.logger).Log("method", method, "err", *err, "took", time.Since(beginTime))
@@ -4,16 +4,27 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"net/http/pprof"
 	"time"
 
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/audit"
+	"github.com/donmikel/coins/pkg/auth"
+	"github.com/donmikel/coins/pkg/coinssvc/pb"
+	"github.com/donmikel/coins/pkg/feed"
+	"github.com/donmikel/coins/pkg/fx"
+	"github.com/donmikel/coins/pkg/hold"
+	"github.com/donmikel/coins/pkg/limit"
 	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/pending"
+	"github.com/donmikel/coins/pkg/risk"
+	"github.com/donmikel/coins/pkg/schedule"
+	"github.com/donmikel/coins/pkg/webhook"
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
 	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
 )
 
 // ServerConfig is a server configuration.
@@ -22,41 +33,131 @@ type ServerConfig struct {
 	Logger          log.Logger
 	Storage         Storage
 	Port            string
+	GRPCPort        string
+	AdminPort       string
 	ReadTimeout     time.Duration
 	WriteTimeout    time.Duration
 	ShutdownTimeout time.Duration
 	MetricPrefix    string
+	RateProvider    fx.RateProvider
+	QuoteTTL        time.Duration
+	HoldTTL         time.Duration
+	// HoldMaxTTL is the longest time a hold reserves funds, hold.DefaultMaxTTL if it is zero.
+	HoldMaxTTL time.Duration
+	Feed       *feed.Hub
+
+	// Authenticator authenticates API requests, principals may debit only accounts they own.
+	// The API is not authenticated if it is nil.
+	Authenticator auth.Authenticator
+
+	// RiskRules assess payments sent with SendPayment and refunds, payments are not assessed if there are no rules.
+	RiskRules []risk.Rule
+	// PendingTTL is the time to review a payment parked by RiskRules, parked payments never expire if it is zero.
+	PendingTTL time.Duration
+
+	// TrustProxyHeaders takes client IP addresses of audited calls from the X-Forwarded-For header
+	// set by a proxy, otherwise from the connection.
+	TrustProxyHeaders bool
 }
 
 // Storage is a persistent accounts data storage.
 type Storage interface {
-	GetAllPayments(ctx context.Context) (payments []payment.Payment, err error)
-	SendPayment(ctx context.Context, payment payment.Payment) (err error)
-	GetAvailableAccounts(ctx context.Context) (accounts []string, err error)
+	GetAllPayments(ctx context.Context, filter payment.Filter) (page payment.Page, err error)
+	SendPayment(ctx context.Context, payment payment.Payment) (created payment.Payment, err error)
+	SendPayments(ctx context.Context, payments []payment.Payment, mode payment.BatchMode) (created []payment.Payment, errs []error, err error)
+	GetPayment(ctx context.Context, id uint64) (payment payment.Payment, err error)
+	RefundPayment(ctx context.Context, id uint64, input payment.RefundInput) (created payment.Payment, err error)
+	GetAvailableAccounts(ctx context.Context) (accounts []account.Account, err error)
+	CreateAccount(ctx context.Context, acc account.Account) (created account.Account, err error)
+	GetAccount(ctx context.Context, id string) (acc account.Account, err error)
+	UpdateAccount(ctx context.Context, id string, upd account.AccountUpdate) (acc account.Account, err error)
+	GetStatement(ctx context.Context, id string, from, to *time.Time) (st account.Statement, err error)
+	CreateQuote(ctx context.Context, q fx.Quote) (err error)
+	CreateSchedule(ctx context.Context, sch schedule.Schedule) (created schedule.Schedule, err error)
+	GetSchedules(ctx context.Context, accountID string) (schedules []schedule.Schedule, err error)
+	GetSchedule(ctx context.Context, id uint64) (sch schedule.Schedule, err error)
+	CancelSchedule(ctx context.Context, id uint64) (err error)
+	AuthorizeHold(ctx context.Context, h hold.Hold) (created hold.Hold, err error)
+	GetHold(ctx context.Context, id uint64) (h hold.Hold, err error)
+	CaptureHold(ctx context.Context, id uint64, input hold.CaptureInput) (h hold.Hold, err error)
+	VoidHold(ctx context.Context, id uint64) (h hold.Hold, err error)
+	CreateSubscription(ctx context.Context, sub webhook.Subscription) (created webhook.Subscription, err error)
+	GetSubscription(ctx context.Context, id uint64) (sub webhook.Subscription, err error)
+	GetSubscriptions(ctx context.Context, accountID string) (subs []webhook.Subscription, err error)
+	DeleteSubscription(ctx context.Context, id uint64) (err error)
+	GetDeliveries(ctx context.Context, subscriptionID uint64, limit int) (deliveries []webhook.Delivery, err error)
+	SetAccountStatus(ctx context.Context, change account.Change, from ...account.Status) (acc account.Account, err error)
+	AdjustBalance(ctx context.Context, change account.Change) (acc account.Account, err error)
+	GetAccountChanges(ctx context.Context, id string) (changes []account.Change, err error)
+	AppendAuditRecord(ctx context.Context, r audit.Record) (appended audit.Record, err error)
+	GetAuditRecords(ctx context.Context, f audit.Filter) (page audit.Page, err error)
+	GetLimits(ctx context.Context, scope limit.Scope) (l limit.Limits, err error)
+	SetLimits(ctx context.Context, l limit.Limits) (set limit.Limits, err error)
+	DeleteLimits(ctx context.Context, scope limit.Scope) (err error)
+	CountPayments(ctx context.Context, from, to string, since time.Time) (n int, err error)
+	ParkPayment(ctx context.Context, pp pending.Payment) (parked payment.Payment, err error)
+	GetPendingPayment(ctx context.Context, id uint64) (pp pending.Payment, err error)
+	GetPendingPayments(ctx context.Context, f pending.Filter) (page pending.Page, err error)
+	ApprovePendingPayment(ctx context.Context, id uint64, review pending.Review) (pp pending.Payment, err error)
+	RejectPendingPayment(ctx context.Context, id uint64, review pending.Review) (pp pending.Payment, err error)
 }
 
 // Server is a accounts service server.
 type Server struct {
-	cfg *ServerConfig
-	srv *http.Server
+	cfg      *ServerConfig
+	srv      *http.Server
+	grpcSrv  *grpc.Server
+	adminSrv *http.Server
 }
 
 // NewServer creates a new server.
 func NewServer(cfg ServerConfig) (*Server, error) {
-	var svc Service
-	svc = newService(cfg.Logger, cfg.Storage)
+	if cfg.RateProvider == nil {
+		rates, err := fx.NewStaticProvider(nil)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RateProvider = rates
+	}
+	if cfg.HoldTTL <= 0 {
+		cfg.HoldTTL = hold.DefaultTTL
+	}
+	if cfg.HoldMaxTTL <= 0 {
+		cfg.HoldMaxTTL = hold.DefaultMaxTTL
+	}
+	if cfg.HoldTTL > cfg.HoldMaxTTL {
+		return nil, fmt.Errorf("hold TTL %s exceeds the maximum hold TTL %s", cfg.HoldTTL, cfg.HoldMaxTTL)
+	}
+
+	core := newService(cfg.Logger, cfg.Storage, &fx.Quoter{Provider: cfg.RateProvider, TTL: cfg.QuoteTTL}, cfg.HoldTTL)
+	core.holdMaxTTL = cfg.HoldMaxTTL
+	if len(cfg.RiskRules) > 0 {
+		core.risk = &risk.Engine{Rules: cfg.RiskRules, History: cfg.Storage}
+		core.pendingTTL = cfg.PendingTTL
+	}
+
+	var svc Service = core
+	if cfg.Authenticator != nil {
+		svc = NewAuthorizingMiddleware(svc)
+	}
+	// Calls rejected by the authorization are audited too.
+	svc = NewAuditMiddleware(svc, cfg.Storage, cfg.Logger)
 	svc = NewLoggingMiddleware(svc, cfg.Logger)
 	svc = NewInstrumentingMiddleware(svc, cfg.MetricPrefix)
 
 	router := http.NewServeMux()
-	router.Handle("/metrics", promhttp.Handler())
-	router.Handle("/debug/pprof/profile", http.HandlerFunc(pprof.Profile))
-	router.Handle("/api/v1/", makeHandler(svc))
-
-	var handler http.Handler
-	if len(cfg.AllowedOrigins) == 0 {
-		handler = router
-	} else {
+	router.Handle("/api/v1/", withAuthentication(cfg.Authenticator, makeHandler(svc)))
+	if cfg.Feed != nil {
+		router.Handle("/api/v1/payments/stream", withAuthentication(cfg.Authenticator, &streamHandler{
+			svc:          svc,
+			hub:          cfg.Feed,
+			logger:       cfg.Logger,
+			writeTimeout: cfg.WriteTimeout,
+		}))
+	}
+
+	handler := withRequest(cfg.TrustProxyHeaders, router)
+	if len(cfg.AllowedOrigins) > 0 {
 		handler = handlers.CORS(
 			handlers.AllowedMethods([]string{
 				http.MethodGet,
@@ -64,9 +165,10 @@ func NewServer(cfg ServerConfig) (*Server, error) {
 				http.MethodPatch,
 				http.MethodDelete,
 			}),
-			handlers.AllowedHeaders([]string{"Content-Type"}),
+			handlers.AllowedHeaders([]string{"Content-Type", authorizationHeader, idempotencyKeyHeader, lastEventIDHeader, requestIDHeader}),
+			handlers.ExposedHeaders([]string{requestIDHeader}),
 			handlers.AllowedOrigins(cfg.AllowedOrigins),
-		)(router)
+		)(handler)
 	}
 
 	srv := &http.Server{
@@ -76,9 +178,29 @@ func NewServer(cfg ServerConfig) (*Server, error) {
 		WriteTimeout: cfg.WriteTimeout,
 	}
 
+	interceptors := []grpc.UnaryServerInterceptor{grpcRequestInterceptor(cfg.TrustProxyHeaders)}
+	if cfg.Authenticator != nil {
+		interceptors = append(interceptors, grpcAuthInterceptor(cfg.Authenticator))
+	}
+	grpcSrv := grpc.NewServer(grpc.UnaryInterceptor(chainUnaryInterceptors(interceptors...)))
+	pb.RegisterCoinsServer(grpcSrv, makeGRPCServer(svc))
+
+	adminSvc := &adminAuditMiddleware{
+		svc:     newAdminService(cfg.Logger, cfg.Storage),
+		auditor: auditor{store: cfg.Storage, logger: cfg.Logger},
+	}
+	adminSrv := &http.Server{
+		Handler:     withRequest(cfg.TrustProxyHeaders, makeAdminHandler(adminSvc, cfg.Authenticator)),
+		Addr:        ":" + cfg.AdminPort,
+		ReadTimeout: cfg.ReadTimeout,
+		// No write timeout, since profiles take longer than API requests.
+	}
+
 	s := &Server{
-		cfg: &cfg,
-		srv: srv,
+		cfg:      &cfg,
+		srv:      srv,
+		grpcSrv:  grpcSrv,
+		adminSrv: adminSrv,
 	}
 	return s, nil
 }
@@ -104,6 +226,111 @@ func makeHandler(svc Service) http.Handler {
 		opts...,
 	))
 
+	router.Path("/api/v1/payments/batch").Methods(http.MethodPost).Handler(kithttp.NewServer(
+		makeSendPaymentsEndpoint(svc),
+		decodeSendPaymentsRequest,
+		encodeSendPaymentsResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/payments/{id:[0-9]+}").Methods(http.MethodGet).Handler(kithttp.NewServer(
+		makeGetPaymentEndpoint(svc),
+		decodeGetPaymentRequest,
+		encodeGetPaymentResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/payments/{id:[0-9]+}/refund").Methods(http.MethodPost).Handler(kithttp.NewServer(
+		makeRefundPaymentEndpoint(svc),
+		decodeRefundPaymentRequest,
+		encodeRefundPaymentResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/holds").Methods(http.MethodPost).Handler(kithttp.NewServer(
+		makeAuthorizePaymentEndpoint(svc),
+		decodeAuthorizePaymentRequest,
+		encodeAuthorizePaymentResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/holds/{id:[0-9]+}").Methods(http.MethodGet).Handler(kithttp.NewServer(
+		makeGetHoldEndpoint(svc),
+		decodeGetHoldRequest,
+		encodeHoldResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/holds/{id:[0-9]+}/capture").Methods(http.MethodPost).Handler(kithttp.NewServer(
+		makeCaptureHoldEndpoint(svc),
+		decodeCaptureHoldRequest,
+		encodeHoldResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/holds/{id:[0-9]+}/void").Methods(http.MethodPost).Handler(kithttp.NewServer(
+		makeVoidHoldEndpoint(svc),
+		decodeVoidHoldRequest,
+		encodeHoldResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/quotes").Methods(http.MethodPost).Handler(kithttp.NewServer(
+		makeCreateQuoteEndpoint(svc),
+		decodeCreateQuoteRequest,
+		encodeCreateQuoteResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/schedules").Methods(http.MethodGet).Handler(kithttp.NewServer(
+		makeGetSchedulesEndpoint(svc),
+		decodeGetSchedulesRequest,
+		encodeGetSchedulesResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/schedules").Methods(http.MethodPost).Handler(kithttp.NewServer(
+		makeCreateScheduleEndpoint(svc),
+		decodeCreateScheduleRequest,
+		encodeCreateScheduleResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/schedules/{id:[0-9]+}").Methods(http.MethodGet).Handler(kithttp.NewServer(
+		makeGetScheduleEndpoint(svc),
+		decodeGetScheduleRequest,
+		encodeGetScheduleResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/schedules/{id:[0-9]+}").Methods(http.MethodDelete).Handler(kithttp.NewServer(
+		makeCancelScheduleEndpoint(svc),
+		decodeCancelScheduleRequest,
+		encodeCancelScheduleResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/webhooks/{id:[0-9]+}").Methods(http.MethodGet).Handler(kithttp.NewServer(
+		makeGetSubscriptionEndpoint(svc),
+		decodeGetSubscriptionRequest,
+		encodeGetSubscriptionResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/webhooks/{id:[0-9]+}").Methods(http.MethodDelete).Handler(kithttp.NewServer(
+		makeDeleteSubscriptionEndpoint(svc),
+		decodeDeleteSubscriptionRequest,
+		encodeDeleteSubscriptionResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/webhooks/{id:[0-9]+}/deliveries").Methods(http.MethodGet).Handler(kithttp.NewServer(
+		makeGetDeliveriesEndpoint(svc),
+		decodeGetDeliveriesRequest,
+		encodeGetDeliveriesResponse,
+		opts...,
+	))
+
 	router.Path("/api/v1/accounts").Methods(http.MethodGet).Handler(kithttp.NewServer(
 		makeGetAvailableAccountsEndpoint(svc),
 		decodeGetAvailableAccountsRequest,
@@ -111,36 +338,168 @@ func makeHandler(svc Service) http.Handler {
 		opts...,
 	))
 
+	router.Path("/api/v1/accounts").Methods(http.MethodPost).Handler(kithttp.NewServer(
+		makeCreateAccountEndpoint(svc),
+		decodeCreateAccountRequest,
+		encodeCreateAccountResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/accounts/{id}").Methods(http.MethodGet).Handler(kithttp.NewServer(
+		makeGetAccountEndpoint(svc),
+		decodeGetAccountRequest,
+		encodeGetAccountResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/accounts/{id}").Methods(http.MethodPatch).Handler(kithttp.NewServer(
+		makeUpdateAccountEndpoint(svc),
+		decodeUpdateAccountRequest,
+		encodeUpdateAccountResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/accounts/{id}").Methods(http.MethodDelete).Handler(kithttp.NewServer(
+		makeCloseAccountEndpoint(svc),
+		decodeCloseAccountRequest,
+		encodeCloseAccountResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/accounts/{id}/webhooks").Methods(http.MethodGet).Handler(kithttp.NewServer(
+		makeGetSubscriptionsEndpoint(svc),
+		decodeGetSubscriptionsRequest,
+		encodeGetSubscriptionsResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/accounts/{id}/webhooks").Methods(http.MethodPost).Handler(kithttp.NewServer(
+		makeCreateSubscriptionEndpoint(svc),
+		decodeCreateSubscriptionRequest,
+		encodeCreateSubscriptionResponse,
+		opts...,
+	))
+
+	router.Path("/api/v1/accounts/{id}/statement").Methods(http.MethodGet).Handler(kithttp.NewServer(
+		makeGetStatementEndpoint(svc),
+		decodeGetStatementRequest,
+		encodeGetStatementResponse,
+		opts...,
+	))
+
 	return router
 }
 
 func makeGetAllPaymentsEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
-		payments, err := svc.GetAllPayments(ctx)
-		return getAllPaymentsResponse{payments: payments}, err
+		req := request.(getAllPaymentsRequest)
+		page, err := svc.GetAllPayments(ctx, req.filter)
+		return getAllPaymentsResponse{page: page}, err
 	}
 }
 
 func makeSendPaymentEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(sendPaymentRequest)
-		err := svc.SendPayment(ctx, req.input)
-		return sendPaymentResponse{}, err
+		p, err := svc.SendPayment(ctx, req.input)
+		return sendPaymentResponse{payment: p}, err
+	}
+}
+
+func makeSendPaymentsEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(sendPaymentsRequest)
+		res, err := svc.SendPayments(ctx, req.input)
+		return sendPaymentsResponse{result: res}, err
+	}
+}
+
+func makeGetPaymentEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getPaymentRequest)
+		p, err := svc.GetPayment(ctx, req.id)
+		return getPaymentResponse{payment: p}, err
+	}
+}
+
+func makeRefundPaymentEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(refundPaymentRequest)
+		p, err := svc.RefundPayment(ctx, req.id, req.input)
+		return refundPaymentResponse{payment: p}, err
 	}
 }
 
 func makeGetAvailableAccountsEndpoint(svc Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getAvailableAccountsRequest)
 		accounts, err := svc.GetAvailableAccounts(ctx)
-		return getAvailableAccountsResponse{accounts: accounts}, err
+		return getAvailableAccountsResponse{accounts: accounts, idsOnly: req.idsOnly}, err
+	}
+}
+
+func makeCreateAccountEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(createAccountRequest)
+		acc, err := svc.CreateAccount(ctx, req.input)
+		return createAccountResponse{account: acc}, err
+	}
+}
+
+func makeGetAccountEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getAccountRequest)
+		acc, err := svc.GetAccount(ctx, req.id)
+		return getAccountResponse{account: acc}, err
+	}
+}
+
+func makeUpdateAccountEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(updateAccountRequest)
+		acc, err := svc.UpdateAccount(ctx, req.id, req.input)
+		return updateAccountResponse{account: acc}, err
+	}
+}
+
+func makeCloseAccountEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(closeAccountRequest)
+		err := svc.CloseAccount(ctx, req.id)
+		return closeAccountResponse{}, err
+	}
+}
+
+func makeGetStatementEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getStatementRequest)
+		st, err := svc.GetStatement(ctx, req.id, req.from, req.to)
+		return getStatementResponse{statement: st}, err
+	}
+}
+
+func makeCreateQuoteEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(createQuoteRequest)
+		q, err := svc.CreateQuote(ctx, req.input)
+		return createQuoteResponse{quote: q}, err
 	}
 }
 
 // Serve starts HTTP server and stops it when the provided context is canceled.
 func (s *Server) Serve(ctx context.Context) error {
+	return s.serveHTTP(ctx, s.srv)
+}
+
+// ServeAdmin starts the admin HTTP server and stops it when the provided context is canceled.
+func (s *Server) ServeAdmin(ctx context.Context) error {
+	return s.serveHTTP(ctx, s.adminSrv)
+}
+
+func (s *Server) serveHTTP(ctx context.Context, srv *http.Server) error {
 	errChan := make(chan error, 1)
 	go func() {
-		errChan <- s.srv.ListenAndServe()
+		errChan <- srv.ListenAndServe()
 	}()
 
 	select {
@@ -150,9 +509,113 @@ func (s *Server) Serve(ctx context.Context) error {
 	case <-ctx.Done():
 		ctxShutdown, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
 		defer cancel()
-		if err := s.srv.Shutdown(ctxShutdown); err != nil {
+		if err := srv.Shutdown(ctxShutdown); err != nil {
 			return fmt.Errorf("failed to shutdown server: %w", err)
 		}
 		return nil
 	}
 }
+
+func makeCreateScheduleEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(createScheduleRequest)
+		sch, err := svc.CreateSchedule(ctx, req.input)
+		return createScheduleResponse{schedule: sch}, err
+	}
+}
+
+func makeGetSchedulesEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getSchedulesRequest)
+		schedules, err := svc.GetSchedules(ctx, req.accountID)
+		return getSchedulesResponse{schedules: schedules}, err
+	}
+}
+
+func makeGetScheduleEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getScheduleRequest)
+		sch, err := svc.GetSchedule(ctx, req.id)
+		return getScheduleResponse{schedule: sch}, err
+	}
+}
+
+func makeCancelScheduleEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(cancelScheduleRequest)
+		err := svc.CancelSchedule(ctx, req.id)
+		return cancelScheduleResponse{}, err
+	}
+}
+
+func makeAuthorizePaymentEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(authorizePaymentRequest)
+		h, err := svc.AuthorizePayment(ctx, req.input)
+		return holdResponse{hold: h}, err
+	}
+}
+
+func makeGetHoldEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getHoldRequest)
+		h, err := svc.GetHold(ctx, req.id)
+		return holdResponse{hold: h}, err
+	}
+}
+
+func makeCaptureHoldEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(captureHoldRequest)
+		h, err := svc.CaptureHold(ctx, req.id, req.input)
+		return holdResponse{hold: h}, err
+	}
+}
+
+func makeVoidHoldEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(voidHoldRequest)
+		h, err := svc.VoidHold(ctx, req.id)
+		return holdResponse{hold: h}, err
+	}
+}
+
+func makeCreateSubscriptionEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(createSubscriptionRequest)
+		sub, err := svc.CreateSubscription(ctx, req.accountID, req.input)
+		return createSubscriptionResponse{subscription: sub}, err
+	}
+}
+
+func makeGetSubscriptionsEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getSubscriptionsRequest)
+		subs, err := svc.GetSubscriptions(ctx, req.accountID)
+		return getSubscriptionsResponse{subscriptions: subs}, err
+	}
+}
+
+func makeGetSubscriptionEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getSubscriptionRequest)
+		sub, err := svc.GetSubscription(ctx, req.id)
+		return getSubscriptionResponse{subscription: sub}, err
+	}
+}
+
+func makeDeleteSubscriptionEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(deleteSubscriptionRequest)
+		err := svc.DeleteSubscription(ctx, req.id)
+		return deleteSubscriptionResponse{}, err
+	}
+}
+
+func makeGetDeliveriesEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getDeliveriesRequest)
+		deliveries, err := svc.GetDeliveries(ctx, req.id)
+		return getDeliveriesResponse{deliveries: deliveries}, err
+	}
+}
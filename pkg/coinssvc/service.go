@@ -2,57 +2,599 @@ package coinssvc
 
 import (
 	"context"
+	"errors"
+	"net/http"
+	"time"
 
+	"github.com/donmikel/coins/pkg/account"
 	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/fx"
+	"github.com/donmikel/coins/pkg/hold"
+	"github.com/donmikel/coins/pkg/limit"
 	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/pending"
+	"github.com/donmikel/coins/pkg/risk"
+	"github.com/donmikel/coins/pkg/schedule"
+	"github.com/donmikel/coins/pkg/webhook"
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+	"github.com/shopspring/decimal"
 )
 
 // Service provides payments functionality.
 type Service interface {
-	GetAvailableAccounts(ctx context.Context) (accounts []string, err error)
-	GetAllPayments(ctx context.Context) (payments []payment.Payment, err error)
-	SendPayment(ctx context.Context, input payment.PaymentInput) (err error)
+	GetAvailableAccounts(ctx context.Context) (accounts []account.Account, err error)
+	GetAllPayments(ctx context.Context, filter payment.Filter) (page payment.Page, err error)
+	SendPayment(ctx context.Context, input payment.PaymentInput) (p payment.Payment, err error)
+	SendPayments(ctx context.Context, input payment.BatchInput) (res payment.BatchResult, err error)
+	GetPayment(ctx context.Context, id uint64) (p payment.Payment, err error)
+	RefundPayment(ctx context.Context, id uint64, input payment.RefundInput) (p payment.Payment, err error)
+	CreateAccount(ctx context.Context, input account.Account) (acc account.Account, err error)
+	GetAccount(ctx context.Context, id string) (acc account.Account, err error)
+	UpdateAccount(ctx context.Context, id string, input account.AccountUpdate) (acc account.Account, err error)
+	CloseAccount(ctx context.Context, id string) (err error)
+	GetStatement(ctx context.Context, id string, from, to *time.Time) (st account.Statement, err error)
+	CreateQuote(ctx context.Context, input fx.QuoteInput) (q fx.Quote, err error)
+	CreateSchedule(ctx context.Context, input schedule.ScheduleInput) (sch schedule.Schedule, err error)
+	GetSchedules(ctx context.Context, accountID string) (schedules []schedule.Schedule, err error)
+	GetSchedule(ctx context.Context, id uint64) (sch schedule.Schedule, err error)
+	CancelSchedule(ctx context.Context, id uint64) (err error)
+	AuthorizePayment(ctx context.Context, input hold.AuthorizeInput) (h hold.Hold, err error)
+	GetHold(ctx context.Context, id uint64) (h hold.Hold, err error)
+	CaptureHold(ctx context.Context, id uint64, input hold.CaptureInput) (h hold.Hold, err error)
+	VoidHold(ctx context.Context, id uint64) (h hold.Hold, err error)
+	CreateSubscription(ctx context.Context, accountID string, input webhook.SubscriptionInput) (sub webhook.Subscription, err error)
+	GetSubscriptions(ctx context.Context, accountID string) (subs []webhook.Subscription, err error)
+	GetSubscription(ctx context.Context, id uint64) (sub webhook.Subscription, err error)
+	DeleteSubscription(ctx context.Context, id uint64) (err error)
+	GetDeliveries(ctx context.Context, subscriptionID uint64) (deliveries []webhook.Delivery, err error)
 }
 
 type service struct {
 	logger  log.Logger
 	storage Storage
+	quoter  *fx.Quoter
+	holdTTL time.Duration
+	// holdMaxTTL is the longest time a hold reserves funds.
+	holdMaxTTL time.Duration
+	// risk assesses payments before they are sent, nil if payments are not assessed.
+	risk *risk.Engine
+	// pendingTTL is the time to review a parked payment, zero if parked payments never expire.
+	pendingTTL time.Duration
 }
 
-func newService(logger log.Logger, storage Storage) *service {
+func newService(logger log.Logger, storage Storage, quoter *fx.Quoter, holdTTL time.Duration) *service {
 	return &service{
-		logger:  logger,
-		storage: storage,
+		logger:     logger,
+		storage:    storage,
+		quoter:     quoter,
+		holdTTL:    holdTTL,
+		holdMaxTTL: hold.DefaultMaxTTL,
 	}
 }
 
-func (s *service) GetAllPayments(ctx context.Context) (payments []payment.Payment, err error) {
-	payments, err = s.storage.GetAllPayments(ctx)
+func (s *service) GetAllPayments(ctx context.Context, filter payment.Filter) (page payment.Page, err error) {
+	if err = filter.Validate(); err != nil {
+		return page, coins.ErrBadRequest("invalid filter: %s", err)
+	}
+	page, err = s.storage.GetAllPayments(ctx, filter)
 	if err != nil {
-		return nil, coins.ErrInternal("failed to get all payments: %s", err)
+		return page, coins.ErrInternal("failed to get all payments: %s", err)
 	}
 	return
 }
 
-func (s *service) SendPayment(ctx context.Context, input payment.PaymentInput) (err error) {
-	p := payment.Payment{
-		FromAccount: input.FromAccount,
-		ToAccount:   input.ToAccount,
-		Direction:   input.Direction,
-		Amount:      input.Amount,
+func (s *service) SendPayment(ctx context.Context, input payment.PaymentInput) (p payment.Payment, err error) {
+	p = input.Payment()
+	if err = p.Validate(); err != nil {
+		return p, coins.ErrBadRequest("invalid payment: %s", err)
 	}
-	err = s.storage.SendPayment(ctx, p)
+	a, err := s.assess(ctx, p)
 	if err != nil {
-		return coins.ErrInternal("failed to send payment: %s", err)
+		return p, err
+	}
+	if a.Outcome == risk.Review {
+		pp := pending.New(p, a.Decisions, actor(ctx))
+		if s.pendingTTL > 0 {
+			expiresAt := time.Now().Add(s.pendingTTL)
+			pp.ExpiresAt = &expiresAt
+		}
+		p, err = s.storage.ParkPayment(ctx, pp)
+		if err != nil {
+			return p, paymentError(err)
+		}
+		if p.PendingID != nil {
+			level.Info(s.logger).Log("msg", "payment parked for review", "pending_id", *p.PendingID, "reasons", a)
+		}
+		return p, nil
+	}
+	p, err = s.storage.SendPayment(ctx, p)
+	if err != nil {
+		return p, paymentError(err)
+	}
+	return
+}
+
+// assess assesses the payment with the risk rules, every payment is allowed without rules.
+// A denied payment is returned as an error.
+func (s *service) assess(ctx context.Context, p payment.Payment) (a risk.Assessment, err error) {
+	if s.risk == nil {
+		return risk.Assessment{Outcome: risk.Allow}, nil
+	}
+	a, err = s.risk.Assess(ctx, p)
+	if err != nil {
+		return a, coins.ErrInternal("failed to assess payment: %s", err)
+	}
+	if a.Outcome == risk.Deny {
+		level.Warn(s.logger).Log("msg", "payment denied", "from", p.FromAccount, "to", p.ToAccount,
+			"amount", p.Amount, "reasons", a)
+		return a, coins.ErrUnprocessable("payment is denied by risk rules")
+	}
+	return a, nil
+}
+
+// requireAllowed assesses a payment that can not be parked, such as a batch, scheduled or authorized
+// payment, and returns an error unless the risk rules allow it.
+func (s *service) requireAllowed(ctx context.Context, p payment.Payment) error {
+	a, err := s.assess(ctx, p)
+	if err != nil {
+		return err
+	}
+	if a.Outcome == risk.Review {
+		level.Info(s.logger).Log("msg", "payment requires review", "from", p.FromAccount, "to", p.ToAccount,
+			"amount", p.Amount, "reasons", a)
+		return coins.ErrUnprocessable("payment requires review, send it as a single payment")
+	}
+	return nil
+}
+
+func (s *service) SendPayments(ctx context.Context, input payment.BatchInput) (res payment.BatchResult, err error) {
+	if err = input.Validate(); err != nil {
+		return res, coins.ErrBadRequest("invalid batch: %s", err)
+	}
+
+	res = payment.BatchResult{Mode: input.Mode, Results: make([]payment.BatchItem, len(input.Payments))}
+	// An invalid payment fails an atomic batch, a best effort batch sends only the valid payments.
+	payments := make([]payment.Payment, 0, len(input.Payments))
+	indexes := make([]int, 0, len(input.Payments))
+	for i, in := range input.Payments {
+		p := in.Payment()
+		if err := p.Validate(); err != nil {
+			if input.Mode == payment.Atomic {
+				return payment.BatchResult{}, coins.ErrBadRequest("invalid payment %d: %s", i, err)
+			}
+			res.Results[i] = batchItem(p, coins.ErrBadRequest("invalid payment: %s", err))
+			continue
+		}
+		if err := s.requireAllowed(ctx, p); err != nil {
+			if input.Mode == payment.Atomic || isInternal(err) {
+				return payment.BatchResult{}, err
+			}
+			res.Results[i] = batchItem(p, err)
+			continue
+		}
+		payments = append(payments, p)
+		indexes = append(indexes, i)
+	}
+	if len(payments) == 0 {
+		return res, nil
+	}
+
+	created, errs, err := s.storage.SendPayments(ctx, payments, input.Mode)
+	if err != nil {
+		return payment.BatchResult{}, paymentError(err)
+	}
+	for j, i := range indexes {
+		if errs[j] != nil {
+			itemErr := paymentError(errs[j])
+			if isInternal(itemErr) {
+				level.Error(s.logger).Log("msg", "batch payment failed", "index", i, "err", errs[j])
+			}
+			res.Results[i] = batchItem(payments[j], itemErr)
+			continue
+		}
+		res.Results[i] = batchItem(created[j], nil)
+	}
+	return
+}
+
+// batchItem returns the result of a batch payment, err is the service error of a failed payment.
+func batchItem(p payment.Payment, err error) payment.BatchItem {
+	if err == nil {
+		return payment.BatchItem{Status: http.StatusCreated, Payment: &p}
+	}
+	var e *coins.ServiceError
+	if !errors.As(err, &e) || e.Code == http.StatusInternalServerError {
+		return payment.BatchItem{Status: http.StatusInternalServerError, Error: "internal error"}
+	}
+	return payment.BatchItem{Status: e.Code, Error: e.Message, Limit: e.Limit, Remaining: e.Remaining}
+}
+
+// isInternal reports whether err is an internal service error.
+func isInternal(err error) bool {
+	var e *coins.ServiceError
+	return errors.As(err, &e) && e.Code == http.StatusInternalServerError
+}
+
+func (s *service) GetPayment(ctx context.Context, id uint64) (p payment.Payment, err error) {
+	p, err = s.storage.GetPayment(ctx, id)
+	if errors.Is(err, coins.ErrNotFoundInStorage) {
+		return p, coins.ErrNotFound("payment %d not found", id)
+	}
+	if err != nil {
+		return p, coins.ErrInternal("failed to get payment: %s", err)
+	}
+	return
+}
+
+func (s *service) RefundPayment(ctx context.Context, id uint64, input payment.RefundInput) (p payment.Payment, err error) {
+	if err = input.Validate(); err != nil {
+		return p, coins.ErrBadRequest("invalid refund: %s", err)
+	}
+	if s.risk != nil {
+		// A refund is assessed as the payment from the destination account of the refunded payment.
+		orig, err := s.GetPayment(ctx, id)
+		if err != nil {
+			return p, err
+		}
+		a, err := s.assess(ctx, refundPayment(orig, input))
+		if err != nil {
+			return p, err
+		}
+		if a.Outcome == risk.Review {
+			var amount decimal.Decimal
+			if input.Amount != nil {
+				amount = *input.Amount
+			}
+			pp := pending.NewRefund(id, orig.ToAccount, orig.FromAccount, amount, a.Decisions, actor(ctx))
+			if s.pendingTTL > 0 {
+				expiresAt := time.Now().Add(s.pendingTTL)
+				pp.ExpiresAt = &expiresAt
+			}
+			p, err = s.storage.ParkPayment(ctx, pp)
+			if errors.Is(err, coins.ErrNotFoundInStorage) {
+				return p, coins.ErrNotFound("payment %d not found", id)
+			}
+			if err != nil {
+				return p, paymentError(err)
+			}
+			level.Info(s.logger).Log("msg", "refund parked for review", "pending_id", *p.PendingID, "reasons", a)
+			return p, nil
+		}
+	}
+	p, err = s.storage.RefundPayment(ctx, id, input)
+	if errors.Is(err, coins.ErrNotFoundInStorage) {
+		return p, coins.ErrNotFound("payment %d not found", id)
+	}
+	if err != nil {
+		return p, paymentError(err)
 	}
 	return
 }
 
-func (s *service) GetAvailableAccounts(ctx context.Context) (accounts []string, err error) {
+// refundPayment returns the refund of the payment as it is assessed, the amount refunded without
+// an Amount is bounded by the amount credited by the payment.
+func refundPayment(orig payment.Payment, input payment.RefundInput) payment.Payment {
+	p := payment.Payment{
+		FromAccount: orig.ToAccount,
+		ToAccount:   orig.FromAccount,
+		Amount:      orig.CreditAmount,
+		Currency:    orig.CreditCurrency,
+		Direction:   orig.Direction,
+		RefundOf:    &orig.ID,
+	}
+	if input.Amount != nil {
+		p.Amount = *input.Amount
+		if orig.Currency != orig.CreditCurrency {
+			p.Amount = input.Amount.Mul(orig.Rate)
+		}
+	}
+	return p
+}
+
+// paymentError converts a storage error of a payment operation into a service error.
+func paymentError(err error) error {
+	var exceeded *limit.ExceededError
+	switch {
+	case errors.As(err, &exceeded):
+		return coins.ErrLimitExceeded(string(exceeded.Kind), exceeded.Remaining, "failed to send payment: %s", err)
+	case errors.Is(err, coins.ErrUnknownAccount):
+		return coins.ErrNotFound("failed to send payment: %s", err)
+	case errors.Is(err, coins.ErrCurrencyMismatch), errors.Is(err, coins.ErrIdempotencyKey),
+		errors.Is(err, coins.ErrHoldFinalized):
+		return coins.ErrConflict("failed to send payment: %s", err)
+	case errors.Is(err, coins.ErrInsufficientFunds), errors.Is(err, coins.ErrSameAccount),
+		errors.Is(err, coins.ErrInvalidQuote), errors.Is(err, coins.ErrQuoteExpired),
+		errors.Is(err, coins.ErrInvalidAmount), errors.Is(err, coins.ErrNotRefundable),
+		errors.Is(err, coins.ErrRefundExceeded), errors.Is(err, coins.ErrCaptureExceeded),
+		errors.Is(err, coins.ErrAccountFrozen), errors.Is(err, coins.ErrHoldExpiration):
+		return coins.ErrUnprocessable("failed to send payment: %s", err)
+	default:
+		return coins.ErrInternal("failed to send payment: %s", err)
+	}
+}
+
+func (s *service) GetAvailableAccounts(ctx context.Context) (accounts []account.Account, err error) {
 	accounts, err = s.storage.GetAvailableAccounts(ctx)
 	if err != nil {
 		return nil, coins.ErrInternal("failed to get available accounts: %s", err)
 	}
 	return
 }
+
+func (s *service) CreateAccount(ctx context.Context, input account.Account) (acc account.Account, err error) {
+	if err = input.Validate(); err != nil {
+		return acc, coins.ErrBadRequest("invalid account: %s", err)
+	}
+	input.Status = account.Active
+	acc, err = s.storage.CreateAccount(ctx, input)
+	if errors.Is(err, coins.ErrAlreadyExistsInStorage) {
+		return acc, coins.ErrConflict("account %s already exists", input.ID)
+	}
+	if err != nil {
+		return acc, coins.ErrInternal("failed to create account: %s", err)
+	}
+	return
+}
+
+func (s *service) GetAccount(ctx context.Context, id string) (acc account.Account, err error) {
+	acc, err = s.storage.GetAccount(ctx, id)
+	if errors.Is(err, coins.ErrNotFoundInStorage) {
+		return acc, coins.ErrNotFound("account %s not found", id)
+	}
+	if err != nil {
+		return acc, coins.ErrInternal("failed to get account: %s", err)
+	}
+	return
+}
+
+func (s *service) UpdateAccount(ctx context.Context, id string, input account.AccountUpdate) (acc account.Account, err error) {
+	if err = input.Validate(); err != nil {
+		return acc, coins.ErrBadRequest("invalid account update: %s", err)
+	}
+	acc, err = s.storage.UpdateAccount(ctx, id, input)
+	switch {
+	case errors.Is(err, coins.ErrNotFoundInStorage):
+		return acc, coins.ErrNotFound("account %s not found", id)
+	case errors.Is(err, coins.ErrCurrencyInUse):
+		return acc, coins.ErrConflict("failed to update account: %s", err)
+	case errors.Is(err, coins.ErrInvalidAmount):
+		return acc, coins.ErrBadRequest("invalid account update: %s", err)
+	case err != nil:
+		return acc, coins.ErrInternal("failed to update account: %s", err)
+	}
+	return
+}
+
+// CloseAccount closes an active account, frozen accounts are closed by operators.
+func (s *service) CloseAccount(ctx context.Context, id string) (err error) {
+	change := account.Change{
+		AccountID: id,
+		Type:      account.StatusChange,
+		Status:    account.Closed,
+		Reason:    "closed by the owner",
+		Actor:     actor(ctx),
+	}
+	_, err = s.storage.SetAccountStatus(ctx, change, account.Active)
+	switch {
+	case errors.Is(err, coins.ErrNotFoundInStorage):
+		return coins.ErrNotFound("account %s not found", id)
+	case errors.Is(err, coins.ErrInvalidTransition), errors.Is(err, coins.ErrAccountInUse):
+		return coins.ErrConflict("failed to close account: %s", err)
+	case err != nil:
+		return coins.ErrInternal("failed to close account: %s", err)
+	}
+	return
+}
+
+func (s *service) GetStatement(ctx context.Context, id string, from, to *time.Time) (st account.Statement, err error) {
+	if from != nil && to != nil && from.After(*to) {
+		return st, coins.ErrBadRequest("invalid period: from is after to")
+	}
+	st, err = s.storage.GetStatement(ctx, id, from, to)
+	if errors.Is(err, coins.ErrNotFoundInStorage) {
+		return st, coins.ErrNotFound("account %s not found", id)
+	}
+	if err != nil {
+		return st, coins.ErrInternal("failed to get statement: %s", err)
+	}
+	return
+}
+
+func (s *service) CreateQuote(ctx context.Context, input fx.QuoteInput) (q fx.Quote, err error) {
+	if err = input.Validate(); err != nil {
+		return q, coins.ErrBadRequest("invalid quote: %s", err)
+	}
+	q, err = s.quoter.Quote(ctx, input)
+	if errors.Is(err, fx.ErrRateNotFound) {
+		return q, coins.ErrUnprocessable("failed to create quote: %s", err)
+	}
+	if err != nil {
+		return q, coins.ErrInternal("failed to create quote: %s", err)
+	}
+	if err = s.storage.CreateQuote(ctx, q); err != nil {
+		return q, coins.ErrInternal("failed to create quote: %s", err)
+	}
+	return
+}
+
+func (s *service) CreateSchedule(ctx context.Context, input schedule.ScheduleInput) (sch schedule.Schedule, err error) {
+	if err = input.Validate(); err != nil {
+		return sch, coins.ErrBadRequest("invalid schedule: %s", err)
+	}
+	sch, err = schedule.New(input, time.Now())
+	if err != nil {
+		return sch, coins.ErrBadRequest("invalid schedule: %s", err)
+	}
+	err = s.requireAllowed(ctx, payment.Payment{
+		FromAccount: sch.FromAccount,
+		ToAccount:   sch.ToAccount,
+		Amount:      sch.Amount,
+		Direction:   sch.Direction,
+	})
+	if err != nil {
+		return sch, err
+	}
+	sch, err = s.storage.CreateSchedule(ctx, sch)
+	switch {
+	case errors.Is(err, coins.ErrUnknownAccount):
+		return sch, coins.ErrNotFound("failed to create schedule: %s", err)
+	case errors.Is(err, coins.ErrCurrencyMismatch):
+		return sch, coins.ErrConflict("failed to create schedule: %s", err)
+	case errors.Is(err, coins.ErrInvalidAmount):
+		return sch, coins.ErrUnprocessable("failed to create schedule: %s", err)
+	case err != nil:
+		return sch, coins.ErrInternal("failed to create schedule: %s", err)
+	}
+	return
+}
+
+func (s *service) GetSchedules(ctx context.Context, accountID string) (schedules []schedule.Schedule, err error) {
+	schedules, err = s.storage.GetSchedules(ctx, accountID)
+	if err != nil {
+		return nil, coins.ErrInternal("failed to get schedules: %s", err)
+	}
+	return
+}
+
+func (s *service) GetSchedule(ctx context.Context, id uint64) (sch schedule.Schedule, err error) {
+	sch, err = s.storage.GetSchedule(ctx, id)
+	if errors.Is(err, coins.ErrNotFoundInStorage) {
+		return sch, coins.ErrNotFound("schedule %d not found", id)
+	}
+	if err != nil {
+		return sch, coins.ErrInternal("failed to get schedule: %s", err)
+	}
+	return
+}
+
+func (s *service) CancelSchedule(ctx context.Context, id uint64) (err error) {
+	err = s.storage.CancelSchedule(ctx, id)
+	if errors.Is(err, coins.ErrNotFoundInStorage) {
+		return coins.ErrNotFound("active schedule %d not found", id)
+	}
+	if err != nil {
+		return coins.ErrInternal("failed to cancel schedule: %s", err)
+	}
+	return
+}
+
+func (s *service) AuthorizePayment(ctx context.Context, input hold.AuthorizeInput) (h hold.Hold, err error) {
+	if err = input.Validate(); err != nil {
+		return h, coins.ErrBadRequest("invalid authorization: %s", err)
+	}
+	h, err = hold.New(input, time.Now(), s.holdTTL, s.holdMaxTTL)
+	if err != nil {
+		return h, coins.ErrBadRequest("invalid authorization: %s", err)
+	}
+	// Captures do not exceed the authorized amount, so holds are assessed once.
+	err = s.requireAllowed(ctx, payment.Payment{
+		FromAccount: h.FromAccount,
+		ToAccount:   h.ToAccount,
+		Amount:      h.Amount,
+		Direction:   h.Direction,
+	})
+	if err != nil {
+		return h, err
+	}
+	h, err = s.storage.AuthorizeHold(ctx, h)
+	if err != nil {
+		return h, paymentError(err)
+	}
+	return
+}
+
+func (s *service) GetHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	h, err = s.storage.GetHold(ctx, id)
+	if errors.Is(err, coins.ErrNotFoundInStorage) {
+		return h, coins.ErrNotFound("hold %d not found", id)
+	}
+	if err != nil {
+		return h, coins.ErrInternal("failed to get hold: %s", err)
+	}
+	return
+}
+
+func (s *service) CaptureHold(ctx context.Context, id uint64, input hold.CaptureInput) (h hold.Hold, err error) {
+	if err = input.Validate(); err != nil {
+		return h, coins.ErrBadRequest("invalid capture: %s", err)
+	}
+	h, err = s.storage.CaptureHold(ctx, id, input)
+	if errors.Is(err, coins.ErrNotFoundInStorage) {
+		return h, coins.ErrNotFound("hold %d not found", id)
+	}
+	if err != nil {
+		return h, paymentError(err)
+	}
+	return
+}
+
+func (s *service) VoidHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	h, err = s.storage.VoidHold(ctx, id)
+	if errors.Is(err, coins.ErrNotFoundInStorage) {
+		return h, coins.ErrNotFound("hold %d not found", id)
+	}
+	if err != nil {
+		return h, paymentError(err)
+	}
+	return
+}
+
+func (s *service) CreateSubscription(ctx context.Context, accountID string, input webhook.SubscriptionInput) (sub webhook.Subscription, err error) {
+	if err = input.Validate(); err != nil {
+		return sub, coins.ErrBadRequest("invalid subscription: %s", err)
+	}
+	sub, err = s.storage.CreateSubscription(ctx, webhook.Subscription{
+		AccountID: accountID,
+		URL:       input.URL,
+		Secret:    input.Secret,
+	})
+	if errors.Is(err, coins.ErrUnknownAccount) {
+		return sub, coins.ErrNotFound("account %s not found", accountID)
+	}
+	if err != nil {
+		return sub, coins.ErrInternal("failed to create subscription: %s", err)
+	}
+	return
+}
+
+func (s *service) GetSubscriptions(ctx context.Context, accountID string) (subs []webhook.Subscription, err error) {
+	subs, err = s.storage.GetSubscriptions(ctx, accountID)
+	if err != nil {
+		return nil, coins.ErrInternal("failed to get subscriptions: %s", err)
+	}
+	return
+}
+
+func (s *service) GetSubscription(ctx context.Context, id uint64) (sub webhook.Subscription, err error) {
+	sub, err = s.storage.GetSubscription(ctx, id)
+	if errors.Is(err, coins.ErrNotFoundInStorage) {
+		return sub, coins.ErrNotFound("subscription %d not found", id)
+	}
+	if err != nil {
+		return sub, coins.ErrInternal("failed to get subscription: %s", err)
+	}
+	return
+}
+
+func (s *service) DeleteSubscription(ctx context.Context, id uint64) (err error) {
+	err = s.storage.DeleteSubscription(ctx, id)
+	if errors.Is(err, coins.ErrNotFoundInStorage) {
+		return coins.ErrNotFound("subscription %d not found", id)
+	}
+	if err != nil {
+		return coins.ErrInternal("failed to delete subscription: %s", err)
+	}
+	return
+}
+
+func (s *service) GetDeliveries(ctx context.Context, subscriptionID uint64) (deliveries []webhook.Delivery, err error) {
+	deliveries, err = s.storage.GetDeliveries(ctx, subscriptionID, webhook.DeliveryLogSize)
+	if errors.Is(err, coins.ErrNotFoundInStorage) {
+		return nil, coins.ErrNotFound("subscription %d not found", subscriptionID)
+	}
+	if err != nil {
+		return nil, coins.ErrInternal("failed to get deliveries: %s", err)
+	}
+	return
+}
@@ -0,0 +1,751 @@
+package coinssvc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/auth"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/fx"
+	"github.com/donmikel/coins/pkg/hold"
+	"github.com/donmikel/coins/pkg/limit"
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/pending"
+	"github.com/donmikel/coins/pkg/risk"
+	"github.com/donmikel/coins/pkg/schedule"
+	"github.com/go-kit/kit/log"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockStorage struct {
+	Storage
+	onSendPayment      func(ctx context.Context, payment payment.Payment) (created payment.Payment, err error)
+	onSendPayments     func(ctx context.Context, payments []payment.Payment, mode payment.BatchMode) (created []payment.Payment, errs []error, err error)
+	onRefundPayment    func(ctx context.Context, id uint64, input payment.RefundInput) (created payment.Payment, err error)
+	onGetPayment       func(ctx context.Context, id uint64) (p payment.Payment, err error)
+	onCreateQuote      func(ctx context.Context, q fx.Quote) (err error)
+	onCaptureHold      func(ctx context.Context, id uint64, input hold.CaptureInput) (h hold.Hold, err error)
+	onAuthorizeHold    func(ctx context.Context, h hold.Hold) (created hold.Hold, err error)
+	onCreateSchedule   func(ctx context.Context, sch schedule.Schedule) (created schedule.Schedule, err error)
+	onGetAccount       func(ctx context.Context, id string) (acc account.Account, err error)
+	onUpdateAccount    func(ctx context.Context, id string, upd account.AccountUpdate) (acc account.Account, err error)
+	onSetAccountStatus func(ctx context.Context, change account.Change, from ...account.Status) (acc account.Account, err error)
+	onAdjustBalance    func(ctx context.Context, change account.Change) (acc account.Account, err error)
+	onGetLimits        func(ctx context.Context, scope limit.Scope) (l limit.Limits, err error)
+	onSetLimits        func(ctx context.Context, l limit.Limits) (set limit.Limits, err error)
+	onDeleteLimits     func(ctx context.Context, scope limit.Scope) (err error)
+	onCountPayments    func(ctx context.Context, from, to string, since time.Time) (n int, err error)
+	onParkPayment      func(ctx context.Context, pp pending.Payment) (parked payment.Payment, err error)
+	onApprovePending   func(ctx context.Context, id uint64, review pending.Review) (pp pending.Payment, err error)
+	onRejectPending    func(ctx context.Context, id uint64, review pending.Review) (pp pending.Payment, err error)
+}
+
+func (m *mockStorage) CaptureHold(ctx context.Context, id uint64, input hold.CaptureInput) (h hold.Hold, err error) {
+	return m.onCaptureHold(ctx, id, input)
+}
+
+func (m *mockStorage) AuthorizeHold(ctx context.Context, h hold.Hold) (created hold.Hold, err error) {
+	return m.onAuthorizeHold(ctx, h)
+}
+
+func (m *mockStorage) CreateSchedule(ctx context.Context, sch schedule.Schedule) (created schedule.Schedule, err error) {
+	return m.onCreateSchedule(ctx, sch)
+}
+
+func (m *mockStorage) CreateQuote(ctx context.Context, q fx.Quote) (err error) {
+	return m.onCreateQuote(ctx, q)
+}
+
+func (m *mockStorage) SendPayment(ctx context.Context, payment payment.Payment) (created payment.Payment, err error) {
+	return m.onSendPayment(ctx, payment)
+}
+
+func (m *mockStorage) SendPayments(ctx context.Context, payments []payment.Payment, mode payment.BatchMode) (created []payment.Payment, errs []error, err error) {
+	return m.onSendPayments(ctx, payments, mode)
+}
+
+func (m *mockStorage) RefundPayment(ctx context.Context, id uint64, input payment.RefundInput) (created payment.Payment, err error) {
+	return m.onRefundPayment(ctx, id, input)
+}
+
+func (m *mockStorage) GetPayment(ctx context.Context, id uint64) (p payment.Payment, err error) {
+	return m.onGetPayment(ctx, id)
+}
+
+func (m *mockStorage) GetAccount(ctx context.Context, id string) (acc account.Account, err error) {
+	return m.onGetAccount(ctx, id)
+}
+
+func (m *mockStorage) UpdateAccount(ctx context.Context, id string, upd account.AccountUpdate) (acc account.Account, err error) {
+	return m.onUpdateAccount(ctx, id, upd)
+}
+
+func (m *mockStorage) CountPayments(ctx context.Context, from, to string, since time.Time) (n int, err error) {
+	return m.onCountPayments(ctx, from, to, since)
+}
+
+func (m *mockStorage) ParkPayment(ctx context.Context, pp pending.Payment) (parked payment.Payment, err error) {
+	return m.onParkPayment(ctx, pp)
+}
+
+var _ Storage = (*mockStorage)(nil)
+
+func TestServiceSendPaymentErrors(t *testing.T) {
+	storage := &mockStorage{}
+	svc := newService(log.NewNopLogger(), storage, nil, time.Hour)
+
+	testCases := []struct {
+		name       string
+		input      payment.PaymentInput
+		storageErr error
+		wantCode   int
+	}{
+		{
+			name:     "ok",
+			input:    mustNewPaymentInput(nil),
+			wantCode: 0,
+		},
+		{
+			name:     "invalid input",
+			input:    payment.PaymentInput{FromAccount: "bob123"},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown account",
+			input:      mustNewPaymentInput(nil),
+			storageErr: fmt.Errorf("account alice456: %w", coins.ErrUnknownAccount),
+			wantCode:   http.StatusNotFound,
+		},
+		{
+			name:       "currency mismatch",
+			input:      mustNewPaymentInput(nil),
+			storageErr: fmt.Errorf("USD to EUR: %w", coins.ErrCurrencyMismatch),
+			wantCode:   http.StatusConflict,
+		},
+		{
+			name:       "insufficient funds",
+			input:      mustNewPaymentInput(nil),
+			storageErr: fmt.Errorf("account bob123: %w", coins.ErrInsufficientFunds),
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "same account",
+			input:      mustNewPaymentInput(nil),
+			storageErr: fmt.Errorf("account bob123: %w", coins.ErrSameAccount),
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "expired quote",
+			input:      mustNewPaymentInput(nil),
+			storageErr: fmt.Errorf("quote 1: %w", coins.ErrQuoteExpired),
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "amount precision",
+			input:      mustNewPaymentInput(nil),
+			storageErr: fmt.Errorf("0.001 USD: %w", coins.ErrInvalidAmount),
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "storage failure",
+			input:      mustNewPaymentInput(nil),
+			storageErr: errors.New("connection refused"),
+			wantCode:   http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage.onSendPayment = func(ctx context.Context, p payment.Payment) (created payment.Payment, err error) {
+				return p, tc.storageErr
+			}
+
+			_, gotErr := svc.SendPayment(context.Background(), tc.input)
+
+			if tc.wantCode == 0 {
+				assert.NoError(t, gotErr)
+				return
+			}
+			var e *coins.ServiceError
+			if assert.True(t, errors.As(gotErr, &e)) {
+				assert.Equal(t, tc.wantCode, e.Code)
+			}
+		})
+	}
+}
+
+func TestServiceSendPaymentLimitExceeded(t *testing.T) {
+	storage := &mockStorage{}
+	svc := newService(log.NewNopLogger(), storage, nil, time.Hour)
+
+	exceeded := &limit.ExceededError{Kind: limit.DailyTotal, Max: decimal.NewFromInt(300), Remaining: decimal.NewFromInt(40), Currency: "USD"}
+	storage.onSendPayment = func(ctx context.Context, p payment.Payment) (payment.Payment, error) {
+		return p, fmt.Errorf("account bob123: %w", exceeded)
+	}
+	storage.onSendPayments = func(ctx context.Context, payments []payment.Payment, mode payment.BatchMode) ([]payment.Payment, []error, error) {
+		return make([]payment.Payment, len(payments)), []error{fmt.Errorf("account bob123: %w", exceeded)}, nil
+	}
+
+	_, err := svc.SendPayment(context.Background(), mustNewPaymentInput(nil))
+	var e *coins.ServiceError
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Equal(t, http.StatusUnprocessableEntity, e.Code)
+		assert.Equal(t, "daily_total", e.Limit)
+		assert.True(t, decimal.NewFromInt(40).Equal(*e.Remaining))
+		assert.Contains(t, e.Message, "40 USD remaining")
+	}
+
+	res, err := svc.SendPayments(context.Background(), payment.BatchInput{
+		Mode:     payment.BestEffort,
+		Payments: []payment.PaymentInput{mustNewPaymentInput(nil)},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Results[0].Status)
+	assert.Equal(t, "daily_total", res.Results[0].Limit)
+	assert.True(t, decimal.NewFromInt(40).Equal(*res.Results[0].Remaining))
+}
+
+// stubRule decides the same outcome for every payment.
+type stubRule risk.Outcome
+
+func (r stubRule) Name() string {
+	return "stub"
+}
+
+func (r stubRule) Evaluate(ctx context.Context, p payment.Payment, h risk.History) (risk.Decision, error) {
+	return risk.Decision{Outcome: risk.Outcome(r), Reason: "stubbed"}, nil
+}
+
+func TestServiceSendPaymentRisk(t *testing.T) {
+	storage := &mockStorage{}
+	svc := newService(log.NewNopLogger(), storage, nil, time.Hour)
+	ctx := auth.NewContext(context.Background(), auth.Principal{ID: "bob", Role: auth.Customer})
+
+	var sent bool
+	storage.onSendPayment = func(ctx context.Context, p payment.Payment) (payment.Payment, error) {
+		sent = true
+		return mustNewPayment(nil), nil
+	}
+	var gotPending pending.Payment
+	storage.onParkPayment = func(ctx context.Context, pp pending.Payment) (payment.Payment, error) {
+		gotPending = pp
+		pp.ID = 7
+		return pp.Parked(), nil
+	}
+
+	svc.risk = &risk.Engine{Rules: []risk.Rule{stubRule(risk.Allow)}, History: storage}
+	p, err := svc.SendPayment(ctx, mustNewPaymentInput(nil))
+	assert.NoError(t, err)
+	assert.True(t, sent)
+	assert.Nil(t, p.PendingID)
+
+	sent = false
+	svc.risk = &risk.Engine{Rules: []risk.Rule{stubRule(risk.Review)}, History: storage}
+	p, err = svc.SendPayment(ctx, mustNewPaymentInput(func(pi *payment.PaymentInput) {
+		pi.IdempotencyKey = "key-1"
+	}))
+	assert.NoError(t, err)
+	assert.False(t, sent)
+	if assert.NotNil(t, p.PendingID) {
+		assert.Equal(t, uint64(7), *p.PendingID)
+	}
+	assert.Equal(t, "bob", gotPending.CreatedBy)
+	assert.Equal(t, "key-1", gotPending.IdempotencyKey)
+	assert.Equal(t, []risk.Decision{{Rule: "stub", Outcome: risk.Review, Reason: "stubbed"}}, gotPending.Decisions)
+	assert.Nil(t, gotPending.ExpiresAt)
+
+	svc.pendingTTL = time.Hour
+	_, err = svc.SendPayment(ctx, mustNewPaymentInput(nil))
+	assert.NoError(t, err)
+	if assert.NotNil(t, gotPending.ExpiresAt) {
+		assert.WithinDuration(t, time.Now().Add(time.Hour), *gotPending.ExpiresAt, time.Minute)
+	}
+
+	svc.risk = &risk.Engine{Rules: []risk.Rule{stubRule(risk.Review), stubRule(risk.Deny)}, History: storage}
+	_, err = svc.SendPayment(ctx, mustNewPaymentInput(nil))
+	assert.Equal(t, http.StatusUnprocessableEntity, err.(*coins.ServiceError).Code)
+	assert.False(t, sent)
+
+	svc.risk = &risk.Engine{Rules: []risk.Rule{stubRule(risk.Review)}, History: storage}
+	storage.onParkPayment = func(ctx context.Context, pp pending.Payment) (payment.Payment, error) {
+		return payment.Payment{}, fmt.Errorf("account %s: %w", pp.ToAccount, coins.ErrUnknownAccount)
+	}
+	_, err = svc.SendPayment(ctx, mustNewPaymentInput(nil))
+	assert.Equal(t, http.StatusNotFound, err.(*coins.ServiceError).Code)
+}
+
+func TestServiceRefundPaymentRisk(t *testing.T) {
+	orig := mustNewPayment(func(p *payment.Payment) {
+		p.ID = 3
+		p.Currency, p.CreditCurrency = "USD", "EUR"
+		p.Amount, p.CreditAmount, p.Rate = decimal.NewFromInt(10), decimal.NewFromInt(9), decimal.RequireFromString("0.9")
+	})
+	var refunded bool
+	var gotPending pending.Payment
+	var assessed payment.Payment
+	storage := &mockStorage{
+		onGetPayment: func(ctx context.Context, id uint64) (payment.Payment, error) {
+			if id != orig.ID {
+				return payment.Payment{}, coins.ErrNotFoundInStorage
+			}
+			return orig, nil
+		},
+		onRefundPayment: func(ctx context.Context, id uint64, input payment.RefundInput) (payment.Payment, error) {
+			refunded = true
+			return payment.Payment{ID: 4, RefundOf: &id}, nil
+		},
+		onParkPayment: func(ctx context.Context, pp pending.Payment) (payment.Payment, error) {
+			gotPending = pp
+			pp.ID = 7
+			return pp.Parked(), nil
+		},
+	}
+	svc := newService(log.NewNopLogger(), storage, nil, time.Hour)
+	ctx := auth.NewContext(context.Background(), auth.Principal{ID: "alice", Role: auth.Customer})
+	amount := decimal.NewFromInt(5)
+
+	svc.risk = &risk.Engine{Rules: []risk.Rule{recordingRule{&assessed}, stubRule(risk.Allow)}, History: storage}
+	p, err := svc.RefundPayment(ctx, orig.ID, payment.RefundInput{Amount: &amount})
+	assert.NoError(t, err)
+	assert.True(t, refunded)
+	assert.Nil(t, p.PendingID)
+	// The refund is assessed as a payment from the destination account in its currency.
+	assert.Equal(t, orig.ToAccount, assessed.FromAccount)
+	assert.Equal(t, orig.FromAccount, assessed.ToAccount)
+	assert.Equal(t, "EUR", assessed.Currency)
+	assert.True(t, decimal.RequireFromString("4.5").Equal(assessed.Amount), "got %s", assessed.Amount)
+
+	refunded = false
+	svc.risk = &risk.Engine{Rules: []risk.Rule{stubRule(risk.Review)}, History: storage}
+	p, err = svc.RefundPayment(ctx, orig.ID, payment.RefundInput{Amount: &amount})
+	assert.NoError(t, err)
+	assert.False(t, refunded)
+	if assert.NotNil(t, p.PendingID) {
+		assert.Equal(t, uint64(7), *p.PendingID)
+	}
+	assert.Equal(t, &orig.ID, gotPending.RefundOf)
+	assert.Equal(t, orig.ToAccount, gotPending.FromAccount)
+	assert.True(t, amount.Equal(gotPending.Amount))
+	assert.Equal(t, "alice", gotPending.CreatedBy)
+
+	svc.risk = &risk.Engine{Rules: []risk.Rule{stubRule(risk.Deny)}, History: storage}
+	_, err = svc.RefundPayment(ctx, orig.ID, payment.RefundInput{})
+	assertServiceErrorCode(t, http.StatusUnprocessableEntity, err)
+	_, err = svc.RefundPayment(ctx, orig.ID+1, payment.RefundInput{})
+	assertServiceErrorCode(t, http.StatusNotFound, err)
+	assert.False(t, refunded)
+}
+
+// recordingRule records the assessed payment and allows it.
+type recordingRule struct {
+	p *payment.Payment
+}
+
+func (r recordingRule) Name() string {
+	return "recording"
+}
+
+func (r recordingRule) Evaluate(ctx context.Context, p payment.Payment, h risk.History) (risk.Decision, error) {
+	*r.p = p
+	return risk.Decision{Outcome: risk.Allow}, nil
+}
+
+func TestServiceRiskWithoutParking(t *testing.T) {
+	storage := &mockStorage{
+		onSendPayments: func(ctx context.Context, payments []payment.Payment, mode payment.BatchMode) ([]payment.Payment, []error, error) {
+			return payments, make([]error, len(payments)), nil
+		},
+		onCreateSchedule: func(ctx context.Context, sch schedule.Schedule) (schedule.Schedule, error) {
+			return sch, nil
+		},
+		onAuthorizeHold: func(ctx context.Context, h hold.Hold) (hold.Hold, error) {
+			return h, nil
+		},
+	}
+	svc := newService(log.NewNopLogger(), storage, nil, time.Hour)
+	ctx := context.Background()
+	batch := func(mode payment.BatchMode) payment.BatchInput {
+		return payment.BatchInput{Mode: mode, Payments: []payment.PaymentInput{mustNewPaymentInput(nil)}}
+	}
+	sch := schedule.ScheduleInput{FromAccount: "bob123", ToAccount: "alice456", Amount: decimal.NewFromInt(10), Direction: payment.Outgoing, Spec: "@daily"}
+	authorization := hold.AuthorizeInput{FromAccount: "bob123", ToAccount: "alice456", Amount: decimal.NewFromInt(10), Direction: payment.Outgoing}
+
+	for _, outcome := range []risk.Outcome{risk.Allow, risk.Review, risk.Deny} {
+		t.Run(string(outcome), func(t *testing.T) {
+			svc.risk = &risk.Engine{Rules: []risk.Rule{stubRule(outcome)}, History: storage}
+
+			res, err := svc.SendPayments(ctx, batch(payment.BestEffort))
+			assert.NoError(t, err)
+			_, schErr := svc.CreateSchedule(ctx, sch)
+			_, holdErr := svc.AuthorizePayment(ctx, authorization)
+			if outcome == risk.Allow {
+				assert.Equal(t, http.StatusCreated, res.Results[0].Status)
+				assert.NoError(t, schErr)
+				assert.NoError(t, holdErr)
+				return
+			}
+			// Only single payments are parked, other payments are rejected unless allowed.
+			assert.Equal(t, http.StatusUnprocessableEntity, res.Results[0].Status)
+			_, err = svc.SendPayments(ctx, batch(payment.Atomic))
+			assertServiceErrorCode(t, http.StatusUnprocessableEntity, err)
+			assertServiceErrorCode(t, http.StatusUnprocessableEntity, schErr)
+			assertServiceErrorCode(t, http.StatusUnprocessableEntity, holdErr)
+		})
+	}
+}
+
+func TestServiceApprovalThresholdWithoutParking(t *testing.T) {
+	storage := &mockStorage{
+		onGetAccount: func(ctx context.Context, id string) (account.Account, error) {
+			return mustNewAccount(func(a *account.Account) { a.ID = id }), nil
+		},
+		onSendPayments: func(ctx context.Context, payments []payment.Payment, mode payment.BatchMode) ([]payment.Payment, []error, error) {
+			return payments, make([]error, len(payments)), nil
+		},
+		onCreateSchedule: func(ctx context.Context, sch schedule.Schedule) (schedule.Schedule, error) {
+			return sch, nil
+		},
+		onAuthorizeHold: func(ctx context.Context, h hold.Hold) (hold.Hold, error) {
+			return h, nil
+		},
+	}
+	svc := newService(log.NewNopLogger(), storage, nil, time.Hour)
+	svc.risk = &risk.Engine{
+		Rules:   []risk.Rule{&risk.ApprovalThreshold{Amounts: map[string]decimal.Decimal{"USD": decimal.NewFromInt(50)}, Accounts: storage}},
+		History: storage,
+	}
+	ctx := context.Background()
+
+	// Payments above the threshold are not split into a batch, scheduled or authorized to avoid the approval.
+	res, err := svc.SendPayments(ctx, payment.BatchInput{
+		Mode: payment.BestEffort,
+		Payments: []payment.PaymentInput{
+			mustNewPaymentInput(func(pi *payment.PaymentInput) { pi.Amount = decimal.NewFromInt(50) }),
+			mustNewPaymentInput(nil),
+		},
+	})
+	assert.NoError(t, err)
+	if assert.Len(t, res.Results, 2) {
+		assert.Equal(t, http.StatusCreated, res.Results[0].Status)
+		assert.Equal(t, http.StatusUnprocessableEntity, res.Results[1].Status)
+	}
+
+	_, err = svc.CreateSchedule(ctx, schedule.ScheduleInput{
+		FromAccount: "bob123", ToAccount: "alice456", Amount: decimal.NewFromInt(100), Direction: payment.Outgoing, Spec: "@daily",
+	})
+	assertServiceErrorCode(t, http.StatusUnprocessableEntity, err)
+
+	_, err = svc.AuthorizePayment(ctx, hold.AuthorizeInput{
+		FromAccount: "bob123", ToAccount: "alice456", Amount: decimal.NewFromInt(100), Direction: payment.Outgoing,
+	})
+	assertServiceErrorCode(t, http.StatusUnprocessableEntity, err)
+
+	_, err = svc.AuthorizePayment(ctx, hold.AuthorizeInput{
+		FromAccount: "bob123", ToAccount: "alice456", Amount: decimal.NewFromInt(50), Direction: payment.Outgoing,
+	})
+	assert.NoError(t, err)
+}
+
+func TestServiceSendPayments(t *testing.T) {
+	storage := &mockStorage{}
+	svc := newService(log.NewNopLogger(), storage, nil, time.Hour)
+
+	invalid := mustNewPaymentInput(func(pi *payment.PaymentInput) { pi.Amount = decimal.Zero })
+	storage.onSendPayments = func(ctx context.Context, payments []payment.Payment, mode payment.BatchMode) (created []payment.Payment, errs []error, err error) {
+		if mode == payment.Atomic {
+			return nil, nil, fmt.Errorf("payment 1: %w", coins.ErrInsufficientFunds)
+		}
+		created = make([]payment.Payment, len(payments))
+		errs = make([]error, len(payments))
+		for i, p := range payments {
+			p.ID = uint64(i + 1)
+			created[i] = p
+		}
+		errs[1] = fmt.Errorf("account bob123: %w", coins.ErrInsufficientFunds)
+		return created, errs, nil
+	}
+
+	_, err := svc.SendPayments(context.Background(), payment.BatchInput{Mode: "all", Payments: []payment.PaymentInput{mustNewPaymentInput(nil)}})
+	assertServiceErrorCode(t, http.StatusBadRequest, err)
+
+	_, err = svc.SendPayments(context.Background(), payment.BatchInput{
+		Mode:     payment.Atomic,
+		Payments: []payment.PaymentInput{mustNewPaymentInput(nil), invalid},
+	})
+	assertServiceErrorCode(t, http.StatusBadRequest, err)
+
+	_, err = svc.SendPayments(context.Background(), payment.BatchInput{
+		Mode:     payment.Atomic,
+		Payments: []payment.PaymentInput{mustNewPaymentInput(nil), mustNewPaymentInput(nil)},
+	})
+	assertServiceErrorCode(t, http.StatusUnprocessableEntity, err)
+
+	res, err := svc.SendPayments(context.Background(), payment.BatchInput{
+		Mode:     payment.BestEffort,
+		Payments: []payment.PaymentInput{mustNewPaymentInput(nil), invalid, mustNewPaymentInput(nil)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, res.Results, 3) {
+		assert.Equal(t, http.StatusCreated, res.Results[0].Status)
+		assert.Equal(t, uint64(1), res.Results[0].Payment.ID)
+		assert.Equal(t, http.StatusBadRequest, res.Results[1].Status)
+		assert.Nil(t, res.Results[1].Payment)
+		assert.Equal(t, http.StatusUnprocessableEntity, res.Results[2].Status)
+		assert.Contains(t, res.Results[2].Error, coins.ErrInsufficientFunds.Error())
+	}
+}
+
+func assertServiceErrorCode(t *testing.T, code int, err error) {
+	t.Helper()
+	var e *coins.ServiceError
+	if assert.True(t, errors.As(err, &e), "got %v", err) {
+		assert.Equal(t, code, e.Code)
+	}
+}
+
+func TestServiceRefundPaymentErrors(t *testing.T) {
+	storage := &mockStorage{}
+	svc := newService(log.NewNopLogger(), storage, nil, time.Hour)
+
+	zero := decimal.Zero
+	testCases := []struct {
+		name       string
+		input      payment.RefundInput
+		storageErr error
+		wantCode   int
+	}{
+		{
+			name:     "invalid amount",
+			input:    payment.RefundInput{Amount: &zero},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:       "payment not found",
+			storageErr: fmt.Errorf("payment 1: %w", coins.ErrNotFoundInStorage),
+			wantCode:   http.StatusNotFound,
+		},
+		{
+			name:       "refund exceeded",
+			storageErr: fmt.Errorf("payment 1: %w", coins.ErrRefundExceeded),
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "refund of refund",
+			storageErr: fmt.Errorf("payment 1: %w", coins.ErrNotRefundable),
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage.onRefundPayment = func(ctx context.Context, id uint64, input payment.RefundInput) (created payment.Payment, err error) {
+				return created, tc.storageErr
+			}
+
+			_, gotErr := svc.RefundPayment(context.Background(), 1, tc.input)
+
+			var e *coins.ServiceError
+			if assert.True(t, errors.As(gotErr, &e)) {
+				assert.Equal(t, tc.wantCode, e.Code)
+			}
+		})
+	}
+}
+
+func TestServiceCaptureHoldErrors(t *testing.T) {
+	storage := &mockStorage{}
+	svc := newService(log.NewNopLogger(), storage, nil, time.Hour)
+
+	zero := decimal.Zero
+	testCases := []struct {
+		name       string
+		input      hold.CaptureInput
+		storageErr error
+		wantCode   int
+	}{
+		{
+			name:     "invalid amount",
+			input:    hold.CaptureInput{Amount: &zero},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:       "hold not found",
+			storageErr: fmt.Errorf("hold 1: %w", coins.ErrNotFoundInStorage),
+			wantCode:   http.StatusNotFound,
+		},
+		{
+			name:       "hold finalized",
+			storageErr: fmt.Errorf("hold 1 is voided: %w", coins.ErrHoldFinalized),
+			wantCode:   http.StatusConflict,
+		},
+		{
+			name:       "capture exceeded",
+			storageErr: fmt.Errorf("hold 1 of 10: %w", coins.ErrCaptureExceeded),
+			wantCode:   http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage.onCaptureHold = func(ctx context.Context, id uint64, input hold.CaptureInput) (h hold.Hold, err error) {
+				return h, tc.storageErr
+			}
+
+			_, gotErr := svc.CaptureHold(context.Background(), 1, tc.input)
+
+			var e *coins.ServiceError
+			if assert.True(t, errors.As(gotErr, &e)) {
+				assert.Equal(t, tc.wantCode, e.Code)
+			}
+		})
+	}
+}
+
+func TestServiceCreateAccountValidation(t *testing.T) {
+	svc := newService(log.NewNopLogger(), &mockStorage{}, nil, time.Hour)
+
+	testCases := []account.Account{
+		{ID: "bob123"},
+		{ID: "bob123", Currency: "XYZ"},
+		{ID: "bob123", Currency: "JPY", Balance: decimal.New(5, -1)},
+	}
+
+	for _, input := range testCases {
+		_, gotErr := svc.CreateAccount(context.Background(), input)
+
+		var e *coins.ServiceError
+		if assert.True(t, errors.As(gotErr, &e)) {
+			assert.Equal(t, http.StatusBadRequest, e.Code)
+		}
+	}
+}
+
+func TestServiceUpdateAccountErrors(t *testing.T) {
+	eur, jpy, fraction := "EUR", "JPY", decimal.New(5, -1)
+
+	testCases := []struct {
+		name       string
+		input      account.AccountUpdate
+		storageErr error
+		wantCode   int
+	}{
+		{
+			name:     "balance exceeds the precision of the currency",
+			input:    account.AccountUpdate{Balance: &fraction, Currency: &jpy},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:       "balance exceeds the precision of the account currency",
+			input:      account.AccountUpdate{Balance: &fraction},
+			storageErr: fmt.Errorf("0.5 JPY: %w", coins.ErrInvalidAmount),
+			wantCode:   http.StatusBadRequest,
+		},
+		{
+			name:       "currency of a funded account",
+			input:      account.AccountUpdate{Currency: &eur},
+			storageErr: fmt.Errorf("account bob123: %w", coins.ErrCurrencyInUse),
+			wantCode:   http.StatusConflict,
+		},
+		{
+			name:       "unknown account",
+			input:      account.AccountUpdate{Currency: &eur},
+			storageErr: fmt.Errorf("account bob123: %w", coins.ErrNotFoundInStorage),
+			wantCode:   http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			storage := &mockStorage{
+				onUpdateAccount: func(ctx context.Context, id string, upd account.AccountUpdate) (account.Account, error) {
+					return account.Account{}, tc.storageErr
+				},
+			}
+			svc := newService(log.NewNopLogger(), storage, nil, time.Hour)
+
+			_, gotErr := svc.UpdateAccount(context.Background(), "bob123", tc.input)
+
+			var e *coins.ServiceError
+			if assert.True(t, errors.As(gotErr, &e)) {
+				assert.Equal(t, tc.wantCode, e.Code)
+			}
+		})
+	}
+}
+
+func TestServiceCloseAccount(t *testing.T) {
+	storage := &mockStorage{}
+	svc := newService(log.NewNopLogger(), storage, nil, time.Hour)
+
+	var gotChange account.Change
+	var gotFrom []account.Status
+	storage.onSetAccountStatus = func(ctx context.Context, change account.Change, from ...account.Status) (account.Account, error) {
+		gotChange, gotFrom = change, from
+		switch change.AccountID {
+		case "frozen":
+			return account.Account{}, fmt.Errorf("account frozen is frozen-all: %w", coins.ErrInvalidTransition)
+		case "unknown":
+			return account.Account{}, fmt.Errorf("account unknown: %w", coins.ErrNotFoundInStorage)
+		case "funded":
+			return account.Account{}, fmt.Errorf("account funded has balance 10 and 0 held: %w", coins.ErrAccountInUse)
+		}
+		return mustNewAccount(func(a *account.Account) { a.Status = change.Status }), nil
+	}
+
+	ctx := auth.NewContext(context.Background(), auth.Principal{ID: "bob", Role: auth.Customer})
+	assert.NoError(t, svc.CloseAccount(ctx, "bob123"))
+	assert.Equal(t, account.Change{
+		AccountID: "bob123",
+		Type:      account.StatusChange,
+		Status:    account.Closed,
+		Reason:    "closed by the owner",
+		Actor:     "bob",
+	}, gotChange)
+	// Owners do not close frozen accounts.
+	assert.Equal(t, []account.Status{account.Active}, gotFrom)
+
+	err := svc.CloseAccount(ctx, "frozen")
+	assert.Equal(t, http.StatusConflict, err.(*coins.ServiceError).Code)
+
+	err = svc.CloseAccount(ctx, "unknown")
+	assert.Equal(t, http.StatusNotFound, err.(*coins.ServiceError).Code)
+
+	err = svc.CloseAccount(ctx, "funded")
+	assert.Equal(t, http.StatusConflict, err.(*coins.ServiceError).Code)
+}
+
+func TestServiceCreateQuote(t *testing.T) {
+	rates, err := fx.NewStaticProvider(map[fx.Pair]decimal.Decimal{"EUR/USD": decimal.New(121, -2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored fx.Quote
+	storage := &mockStorage{
+		onCreateQuote: func(ctx context.Context, q fx.Quote) (err error) {
+			stored = q
+			return nil
+		},
+	}
+	svc := newService(log.NewNopLogger(), storage, &fx.Quoter{Provider: rates, TTL: time.Minute}, time.Hour)
+
+	q, err := svc.CreateQuote(context.Background(), fx.QuoteInput{FromCurrency: "EUR", ToCurrency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, stored, q)
+	assert.True(t, decimal.New(121, -2).Equal(q.Rate))
+
+	_, err = svc.CreateQuote(context.Background(), fx.QuoteInput{FromCurrency: "EUR", ToCurrency: "JPY"})
+	var e *coins.ServiceError
+	if assert.True(t, errors.As(err, &e)) {
+		assert.Equal(t, http.StatusUnprocessableEntity, e.Code)
+	}
+}
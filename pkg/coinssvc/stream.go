@@ -0,0 +1,197 @@
+package coinssvc
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/donmikel/coins/pkg/auth"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/feed"
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// lastEventIDHeader is a request header of a resuming stream client with the ID of the last received payment.
+const lastEventIDHeader = "Last-Event-ID"
+
+// streamKeepAliveInterval is the interval of comments keeping an idle stream open through proxies.
+const streamKeepAliveInterval = 15 * time.Second
+
+// streamHandler streams committed payments as server-sent events. A client resuming with
+// Last-Event-ID first gets the payments committed after that payment, then new payments.
+// The stream is written to the hijacked connection, so the server write timeout
+// limits writing every event instead of the whole stream.
+type streamHandler struct {
+	svc          Service
+	hub          *feed.Hub
+	logger       log.Logger
+	writeTimeout time.Duration
+}
+
+func (h *streamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	filter, err := decodeStreamRequest(r)
+	if err != nil {
+		encodeError(ctx, err, w)
+		return
+	}
+
+	// Authenticated clients stream payments of their own accounts only.
+	if _, ok := auth.FromContext(ctx); ok {
+		if filter.Account == "" {
+			encodeError(ctx, coins.ErrForbidden("payments are streamed by account"), w)
+			return
+		}
+		if _, err = h.svc.GetAccount(ctx, filter.Account); err != nil {
+			encodeError(ctx, err, w)
+			return
+		}
+	}
+
+	// The subscription buffers payments committed while the missed payments are sent.
+	sub := h.hub.Subscribe(filter.Account)
+	defer h.hub.Unsubscribe(sub)
+
+	resumed := filter.Cursor
+	var page payment.Page
+	if resumed != 0 {
+		if page, err = h.svc.GetAllPayments(ctx, filter); err != nil {
+			encodeError(ctx, err, w)
+			return
+		}
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		encodeError(ctx, coins.ErrInternal("streaming is not supported"), w)
+		return
+	}
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "close")
+
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		level.Error(h.logger).Log("msg", "failed to hijack connection", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		// The client sends nothing after the request, the read returns when it disconnects.
+		io.Copy(ioutil.Discard, rw.Reader)
+		cancel()
+	}()
+
+	stream := &eventStream{conn: conn, w: rw.Writer, timeout: h.writeTimeout}
+	if err := stream.writeHeader(header); err != nil {
+		return
+	}
+
+	for resumed != 0 {
+		for _, p := range page.Payments {
+			if err := stream.writePayment(p); err != nil {
+				return
+			}
+			resumed = p.ID
+		}
+		if page.NextCursor == 0 {
+			break
+		}
+		filter.Cursor = page.NextCursor
+		if page, err = h.svc.GetAllPayments(ctx, filter); err != nil {
+			level.Error(h.logger).Log("msg", "failed to get missed payments", "err", err)
+			return
+		}
+	}
+
+	ticker := time.NewTicker(streamKeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case p, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			// Payments committed while the missed ones were sent may be sent already.
+			if p.ID <= resumed {
+				continue
+			}
+			if err := stream.writePayment(p); err != nil {
+				return
+			}
+
+		case <-ticker.C:
+			if err := stream.write(": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func decodeStreamRequest(r *http.Request) (f payment.Filter, err error) {
+	f.Account = r.URL.Query().Get("account")
+	f.Limit = payment.MaxLimit
+	if v := r.Header.Get(lastEventIDHeader); v != "" {
+		if f.Cursor, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return f, coins.ErrBadRequest("invalid %s: %v", lastEventIDHeader, err)
+		}
+	}
+
+	return f, nil
+}
+
+// eventStream writes server-sent events to a connection, every write must complete within timeout.
+type eventStream struct {
+	conn    net.Conn
+	w       *bufio.Writer
+	timeout time.Duration
+}
+
+func (s *eventStream) write(format string, v ...interface{}) error {
+	var deadline time.Time
+	if s.timeout > 0 {
+		deadline = time.Now().Add(s.timeout)
+	}
+	if err := s.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.w, format, v...)
+
+	return s.w.Flush()
+}
+
+func (s *eventStream) writeHeader(header http.Header) error {
+	var buf bytes.Buffer
+	buf.WriteString("HTTP/1.1 200 OK\r\n")
+	header.Write(&buf)
+	buf.WriteString("\r\n")
+
+	return s.write("%s", buf.String())
+}
+
+func (s *eventStream) writePayment(p payment.Payment) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	return s.write("id: %d\nevent: payment\ndata: %s\n\n", p.ID, data)
+}
@@ -0,0 +1,125 @@
+package coinssvc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/donmikel/coins/pkg/feed"
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// streamEvent is a server-sent event.
+type streamEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+func readStreamEvent(t *testing.T, r *bufio.Reader) streamEvent {
+	var e streamEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if e.data != "" {
+				return e
+			}
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestStreamPayments(t *testing.T) {
+	svc := &mockService{}
+	hub := &feed.Hub{}
+	server := httptest.NewServer(&streamHandler{
+		svc:          svc,
+		hub:          hub,
+		logger:       log.NewNopLogger(),
+		writeTimeout: time.Second,
+	})
+	defer server.Close()
+
+	var gotFilter payment.Filter
+	svc.onGetAllPayments = func(ctx context.Context, filter payment.Filter) (payment.Page, error) {
+		gotFilter = filter
+		return payment.Page{Payments: []payment.Payment{
+			mustNewPayment(func(p *payment.Payment) { p.ID = 6 }),
+		}}, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+"?account=bob123", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(lastEventIDHeader, "5")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, payment.Filter{Account: "bob123", Cursor: 5, Limit: payment.MaxLimit}, gotFilter)
+
+	r := bufio.NewReader(resp.Body)
+	e := readStreamEvent(t, r)
+	assert.Equal(t, "6", e.id)
+	assert.Equal(t, "payment", e.event)
+
+	// The payment sent as missed is not sent again, payments of other accounts are not sent.
+	hub.Publish(mustNewPayment(func(p *payment.Payment) { p.ID = 6 }))
+	hub.Publish(mustNewPayment(func(p *payment.Payment) {
+		p.ID = 7
+		p.FromAccount, p.ToAccount = "carol789", "alice456"
+	}))
+	hub.Publish(mustNewPayment(func(p *payment.Payment) { p.ID = 8 }))
+
+	e = readStreamEvent(t, r)
+	assert.Equal(t, "8", e.id)
+	var got payment.Payment
+	if err := json.Unmarshal([]byte(e.data), &got); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, mustNewPayment(func(p *payment.Payment) { p.ID = 8 }), got)
+}
+
+func TestStreamPaymentsBadRequest(t *testing.T) {
+	server := httptest.NewServer(&streamHandler{
+		svc:    &mockService{},
+		hub:    &feed.Hub{},
+		logger: log.NewNopLogger(),
+	})
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(lastEventIDHeader, "abc")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -6,11 +6,22 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"time"
 
+	"github.com/donmikel/coins/pkg/account"
 	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/fx"
+	"github.com/donmikel/coins/pkg/hold"
 	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/schedule"
+	"github.com/donmikel/coins/pkg/webhook"
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
 )
 
 func encodeError(ctx context.Context, err error, w http.ResponseWriter) {
@@ -32,15 +43,26 @@ func decodeError(r *http.Response) error {
 	return e
 }
 
+// setAccountPath sets the path of a request to the account resource with the suffix, Path holds
+// the account ID as it is and RawPath the escaped one, so the ID is escaped exactly once.
+func setAccountPath(r *http.Request, id, suffix string) {
+	r.URL.Path = "/api/v1/accounts/" + id + suffix
+	r.URL.RawPath = "/api/v1/accounts/" + url.PathEscape(id) + suffix
+}
+
 type getAllPaymentsRequest struct {
+	filter payment.Filter
 }
 
 type getAllPaymentsResponse struct {
-	payments []payment.Payment
+	page payment.Page
 }
 
 func encodeGetAllPaymentsRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(getAllPaymentsRequest)
 	r.URL.Path = "/api/v1/payments"
+	r.URL.RawQuery = encodePaymentFilter(req.filter).Encode()
+
 	return nil
 }
 
@@ -49,7 +71,7 @@ func decodeGetAllPaymentsResponse(ctx context.Context, r *http.Response) (interf
 		return nil, decodeError(r)
 	}
 	res := getAllPaymentsResponse{}
-	if err := json.NewDecoder(r.Body).Decode(&res.payments); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&res.page); err != nil {
 		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
 	}
 
@@ -57,29 +79,140 @@ func decodeGetAllPaymentsResponse(ctx context.Context, r *http.Response) (interf
 }
 
 func decodeGetAllPaymentsRequest(ctx context.Context, r *http.Request) (interface{}, error) {
-	return getAllPaymentsRequest{}, nil
+	filter, err := decodePaymentFilter(r.URL.Query())
+	if err != nil {
+		return nil, err
+	}
+
+	return getAllPaymentsRequest{filter: filter}, nil
 }
 
 func encodeGetAllPaymentsResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	res := response.(getAllPaymentsResponse)
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(res.payments); err != nil {
+	if err := json.NewEncoder(w).Encode(res.page); err != nil {
 		return coins.ErrInternal("failed to encode JSON response: %s", err)
 	}
 
 	return nil
 }
 
+func encodePaymentFilter(f payment.Filter) url.Values {
+	q := url.Values{}
+	if f.Account != "" {
+		q.Set("account", f.Account)
+	}
+	if f.Counterparty != "" {
+		q.Set("counterparty", f.Counterparty)
+	}
+	if f.Direction != nil {
+		q.Set("direction", strconv.FormatUint(uint64(*f.Direction), 10))
+	}
+	if f.MinAmount != nil {
+		q.Set("min_amount", f.MinAmount.String())
+	}
+	if f.MaxAmount != nil {
+		q.Set("max_amount", f.MaxAmount.String())
+	}
+	if f.From != nil {
+		q.Set("from", f.From.Format(time.RFC3339Nano))
+	}
+	if f.To != nil {
+		q.Set("to", f.To.Format(time.RFC3339Nano))
+	}
+	if f.Cursor != 0 {
+		q.Set("cursor", strconv.FormatUint(f.Cursor, 10))
+	}
+	if f.Limit != 0 {
+		q.Set("limit", strconv.Itoa(f.Limit))
+	}
+
+	return q
+}
+
+func decodePaymentFilter(q url.Values) (f payment.Filter, err error) {
+	f.Account = q.Get("account")
+	f.Counterparty = q.Get("counterparty")
+	if v := q.Get("direction"); v != "" {
+		d, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return f, coins.ErrBadRequest("invalid direction: %v", err)
+		}
+		direction := payment.Direction(d)
+		f.Direction = &direction
+	}
+	if f.MinAmount, err = decodeDecimalParam(q, "min_amount"); err != nil {
+		return f, err
+	}
+	if f.MaxAmount, err = decodeDecimalParam(q, "max_amount"); err != nil {
+		return f, err
+	}
+	if f.From, err = decodeTimeParam(q, "from"); err != nil {
+		return f, err
+	}
+	if f.To, err = decodeTimeParam(q, "to"); err != nil {
+		return f, err
+	}
+	if v := q.Get("cursor"); v != "" {
+		if f.Cursor, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return f, coins.ErrBadRequest("invalid cursor: %v", err)
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if f.Limit, err = strconv.Atoi(v); err != nil {
+			return f, coins.ErrBadRequest("invalid limit: %v", err)
+		}
+	}
+
+	return f, nil
+}
+
+func decodeDecimalParam(q url.Values, name string) (*decimal.Decimal, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	d, err := decimal.NewFromString(v)
+	if err != nil {
+		return nil, coins.ErrBadRequest("invalid %s: %v", name, err)
+	}
+
+	return &d, nil
+}
+
+func decodeTimeParam(q url.Values, name string) (*time.Time, error) {
+	v := q.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, v)
+	if err != nil {
+		return nil, coins.ErrBadRequest("invalid %s: %v", name, err)
+	}
+
+	return &t, nil
+}
+
+// idempotencyKeyHeader is a request header that makes payment submission safe to retry.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLen is the maximum length of an idempotency key.
+const maxIdempotencyKeyLen = 255
+
 type sendPaymentRequest struct {
 	input payment.PaymentInput
 }
 
 type sendPaymentResponse struct {
+	payment payment.Payment
 }
 
 func encodeSendPaymentRequest(ctx context.Context, r *http.Request, request interface{}) error {
 	req := request.(sendPaymentRequest)
 	r.URL.Path = "/api/v1/payments"
+	if req.input.IdempotencyKey != "" {
+		r.Header.Set(idempotencyKeyHeader, req.input.IdempotencyKey)
+	}
 	var buf bytes.Buffer
 	if err := json.NewEncoder(&buf).Encode(req.input); err != nil {
 		return err
@@ -93,8 +226,12 @@ func decodeSendPaymentResponse(ctx context.Context, r *http.Response) (interface
 	if r.StatusCode < 200 || r.StatusCode > 299 {
 		return nil, decodeError(r)
 	}
+	res := sendPaymentResponse{}
+	if err := json.NewDecoder(r.Body).Decode(&res.payment); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
+	}
 
-	return sendPaymentResponse{}, nil
+	return res, nil
 }
 
 func decodeSendPaymentRequest(ctx context.Context, r *http.Request) (interface{}, error) {
@@ -102,21 +239,201 @@ func decodeSendPaymentRequest(ctx context.Context, r *http.Request) (interface{}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		return nil, coins.ErrBadRequest("failed to decode JSON request: %v", err)
 	}
+	input.IdempotencyKey = r.Header.Get(idempotencyKeyHeader)
+	if len(input.IdempotencyKey) > maxIdempotencyKeyLen {
+		return nil, coins.ErrBadRequest("%s is longer than %d characters", idempotencyKeyHeader, maxIdempotencyKeyLen)
+	}
 
 	return sendPaymentRequest{input: input}, nil
 }
 
 func encodeSendPaymentResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
-	w.WriteHeader(http.StatusOK)
+	res := response.(sendPaymentResponse)
+	w.Header().Set("Content-Type", "application/json")
+	if res.payment.PendingID != nil {
+		w.WriteHeader(http.StatusAccepted)
+	} else {
+		w.Header().Set("Location", "/api/v1/payments/"+strconv.FormatUint(res.payment.ID, 10))
+		w.WriteHeader(http.StatusCreated)
+	}
+	if err := json.NewEncoder(w).Encode(res.payment); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+type sendPaymentsRequest struct {
+	input payment.BatchInput
+}
+
+type sendPaymentsResponse struct {
+	result payment.BatchResult
+}
+
+func encodeSendPaymentsRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(sendPaymentsRequest)
+	r.URL.Path = "/api/v1/payments/batch"
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(req.input); err != nil {
+		return err
+	}
+	r.Body = ioutil.NopCloser(&buf)
+
+	return nil
+}
+
+func decodeSendPaymentsResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, decodeError(r)
+	}
+	res := sendPaymentsResponse{}
+	if err := json.NewDecoder(r.Body).Decode(&res.result); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+
+	return res, nil
+}
+
+func decodeSendPaymentsRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var input payment.BatchInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, coins.ErrBadRequest("failed to decode JSON request: %v", err)
+	}
+
+	return sendPaymentsRequest{input: input}, nil
+}
+
+func encodeSendPaymentsResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(sendPaymentsResponse)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res.result); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+type getPaymentRequest struct {
+	id uint64
+}
+
+type getPaymentResponse struct {
+	payment payment.Payment
+}
+
+func encodeGetPaymentRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(getPaymentRequest)
+	r.URL.Path = "/api/v1/payments/" + strconv.FormatUint(req.id, 10)
+
+	return nil
+}
+
+func decodeGetPaymentResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, decodeError(r)
+	}
+	res := getPaymentResponse{}
+	if err := json.NewDecoder(r.Body).Decode(&res.payment); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+
+	return res, nil
+}
+
+func decodeGetPaymentRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return nil, coins.ErrBadRequest("invalid payment id: %v", err)
+	}
+
+	return getPaymentRequest{id: id}, nil
+}
+
+func encodeGetPaymentResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(getPaymentResponse)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res.payment); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+type refundPaymentRequest struct {
+	id    uint64
+	input payment.RefundInput
+}
+
+type refundPaymentResponse struct {
+	payment payment.Payment
+}
+
+func encodeRefundPaymentRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(refundPaymentRequest)
+	r.URL.Path = "/api/v1/payments/" + strconv.FormatUint(req.id, 10) + "/refund"
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(req.input); err != nil {
+		return err
+	}
+	r.Body = ioutil.NopCloser(&buf)
+
+	return nil
+}
+
+func decodeRefundPaymentResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, decodeError(r)
+	}
+	res := refundPaymentResponse{}
+	if err := json.NewDecoder(r.Body).Decode(&res.payment); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+
+	return res, nil
+}
+
+func decodeRefundPaymentRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return nil, coins.ErrBadRequest("invalid payment id: %v", err)
+	}
+	var input payment.RefundInput
+	// An empty body refunds the whole payment.
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		return nil, coins.ErrBadRequest("failed to decode JSON request: %v", err)
+	}
+
+	return refundPaymentRequest{id: id, input: input}, nil
+}
+
+func encodeRefundPaymentResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(refundPaymentResponse)
+	w.Header().Set("Content-Type", "application/json")
+	if res.payment.PendingID != nil {
+		w.WriteHeader(http.StatusAccepted)
+	} else {
+		w.Header().Set("Location", "/api/v1/payments/"+strconv.FormatUint(res.payment.ID, 10))
+		w.WriteHeader(http.StatusCreated)
+	}
+	if err := json.NewEncoder(w).Encode(res.payment); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
 
 	return nil
 }
 
+// accountsFormatIDs is a value of the "format" query parameter of GET /accounts
+// that keeps the legacy response made of bare account IDs.
+const accountsFormatIDs = "ids"
+
 type getAvailableAccountsRequest struct {
+	idsOnly bool
 }
 
 type getAvailableAccountsResponse struct {
-	accounts []string
+	accounts []account.Account
+	idsOnly  bool
 }
 
 func encodeGetAvailableAccountsRequest(ctx context.Context, r *http.Request, request interface{}) error {
@@ -138,15 +455,931 @@ func decodeGetAvailableAccountsResponse(ctx context.Context, r *http.Response) (
 }
 
 func decodeGetAvailableAccountsRequest(ctx context.Context, r *http.Request) (interface{}, error) {
-	return getAvailableAccountsRequest{}, nil
+	switch format := r.URL.Query().Get("format"); format {
+	case "":
+		return getAvailableAccountsRequest{}, nil
+	case accountsFormatIDs:
+		return getAvailableAccountsRequest{idsOnly: true}, nil
+	default:
+		return nil, coins.ErrBadRequest("unknown format: %s", format)
+	}
 }
 
 func encodeGetAvailableAccountsResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	res := response.(getAvailableAccountsResponse)
+	var body interface{} = res.accounts
+	if res.idsOnly {
+		ids := make([]string, 0, len(res.accounts))
+		for _, acc := range res.accounts {
+			ids = append(ids, acc.ID)
+		}
+		body = ids
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+func decodeAccountID(r *http.Request) (string, error) {
+	id := mux.Vars(r)["id"]
+	if id == "" {
+		return "", coins.ErrBadRequest("empty account id")
+	}
+
+	return id, nil
+}
+
+func decodeAccountResponse(r *http.Response) (account.Account, error) {
+	var acc account.Account
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return acc, decodeError(r)
+	}
+	if err := json.NewDecoder(r.Body).Decode(&acc); err != nil {
+		return acc, fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+
+	return acc, nil
+}
+
+func encodeAccountResponse(w http.ResponseWriter, code int, acc account.Account) error {
 	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(res.accounts); err != nil {
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(acc); err != nil {
 		return coins.ErrInternal("failed to encode JSON response: %s", err)
 	}
 
 	return nil
 }
+
+type createAccountRequest struct {
+	input account.Account
+}
+
+type createAccountResponse struct {
+	account account.Account
+}
+
+func encodeCreateAccountRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(createAccountRequest)
+	r.URL.Path = "/api/v1/accounts"
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(req.input); err != nil {
+		return err
+	}
+	r.Body = ioutil.NopCloser(&buf)
+
+	return nil
+}
+
+func decodeCreateAccountResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	acc, err := decodeAccountResponse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return createAccountResponse{account: acc}, nil
+}
+
+func decodeCreateAccountRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var input account.Account
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, coins.ErrBadRequest("failed to decode JSON request: %v", err)
+	}
+
+	return createAccountRequest{input: input}, nil
+}
+
+func encodeCreateAccountResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(createAccountResponse)
+	return encodeAccountResponse(w, http.StatusCreated, res.account)
+}
+
+type getAccountRequest struct {
+	id string
+}
+
+type getAccountResponse struct {
+	account account.Account
+}
+
+func encodeGetAccountRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(getAccountRequest)
+	setAccountPath(r, req.id, "")
+
+	return nil
+}
+
+func decodeGetAccountResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	acc, err := decodeAccountResponse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return getAccountResponse{account: acc}, nil
+}
+
+func decodeGetAccountRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeAccountID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return getAccountRequest{id: id}, nil
+}
+
+func encodeGetAccountResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(getAccountResponse)
+	return encodeAccountResponse(w, http.StatusOK, res.account)
+}
+
+type updateAccountRequest struct {
+	id    string
+	input account.AccountUpdate
+}
+
+type updateAccountResponse struct {
+	account account.Account
+}
+
+func encodeUpdateAccountRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(updateAccountRequest)
+	setAccountPath(r, req.id, "")
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(req.input); err != nil {
+		return err
+	}
+	r.Body = ioutil.NopCloser(&buf)
+
+	return nil
+}
+
+func decodeUpdateAccountResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	acc, err := decodeAccountResponse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return updateAccountResponse{account: acc}, nil
+}
+
+func decodeUpdateAccountRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeAccountID(r)
+	if err != nil {
+		return nil, err
+	}
+	var input account.AccountUpdate
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, coins.ErrBadRequest("failed to decode JSON request: %v", err)
+	}
+
+	return updateAccountRequest{id: id, input: input}, nil
+}
+
+func encodeUpdateAccountResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(updateAccountResponse)
+	return encodeAccountResponse(w, http.StatusOK, res.account)
+}
+
+type closeAccountRequest struct {
+	id string
+}
+
+type closeAccountResponse struct {
+}
+
+func encodeCloseAccountRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(closeAccountRequest)
+	setAccountPath(r, req.id, "")
+
+	return nil
+}
+
+func decodeCloseAccountResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, decodeError(r)
+	}
+
+	return closeAccountResponse{}, nil
+}
+
+func decodeCloseAccountRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeAccountID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return closeAccountRequest{id: id}, nil
+}
+
+func encodeCloseAccountResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+type getStatementRequest struct {
+	id   string
+	from *time.Time
+	to   *time.Time
+}
+
+type getStatementResponse struct {
+	statement account.Statement
+}
+
+func encodeGetStatementRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(getStatementRequest)
+	setAccountPath(r, req.id, "/statement")
+	q := url.Values{}
+	if req.from != nil {
+		q.Set("from", req.from.Format(time.RFC3339Nano))
+	}
+	if req.to != nil {
+		q.Set("to", req.to.Format(time.RFC3339Nano))
+	}
+	r.URL.RawQuery = q.Encode()
+
+	return nil
+}
+
+func decodeGetStatementResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, decodeError(r)
+	}
+	res := getStatementResponse{}
+	if err := json.NewDecoder(r.Body).Decode(&res.statement); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+
+	return res, nil
+}
+
+func decodeGetStatementRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeAccountID(r)
+	if err != nil {
+		return nil, err
+	}
+	req := getStatementRequest{id: id}
+	if req.from, err = decodeTimeParam(r.URL.Query(), "from"); err != nil {
+		return nil, err
+	}
+	if req.to, err = decodeTimeParam(r.URL.Query(), "to"); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+func encodeGetStatementResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(getStatementResponse)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res.statement); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+type createQuoteRequest struct {
+	input fx.QuoteInput
+}
+
+type createQuoteResponse struct {
+	quote fx.Quote
+}
+
+func encodeCreateQuoteRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(createQuoteRequest)
+	r.URL.Path = "/api/v1/quotes"
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(req.input); err != nil {
+		return err
+	}
+	r.Body = ioutil.NopCloser(&buf)
+
+	return nil
+}
+
+func decodeCreateQuoteResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, decodeError(r)
+	}
+	res := createQuoteResponse{}
+	if err := json.NewDecoder(r.Body).Decode(&res.quote); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+
+	return res, nil
+}
+
+func decodeCreateQuoteRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var input fx.QuoteInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, coins.ErrBadRequest("failed to decode JSON request: %v", err)
+	}
+
+	return createQuoteRequest{input: input}, nil
+}
+
+func encodeCreateQuoteResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(createQuoteResponse)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(res.quote); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+type createScheduleRequest struct {
+	input schedule.ScheduleInput
+}
+
+type createScheduleResponse struct {
+	schedule schedule.Schedule
+}
+
+func encodeCreateScheduleRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(createScheduleRequest)
+	r.URL.Path = "/api/v1/schedules"
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(req.input); err != nil {
+		return err
+	}
+	r.Body = ioutil.NopCloser(&buf)
+
+	return nil
+}
+
+func decodeCreateScheduleResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, decodeError(r)
+	}
+	res := createScheduleResponse{}
+	if err := json.NewDecoder(r.Body).Decode(&res.schedule); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+
+	return res, nil
+}
+
+func decodeCreateScheduleRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var input schedule.ScheduleInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, coins.ErrBadRequest("failed to decode JSON request: %v", err)
+	}
+
+	return createScheduleRequest{input: input}, nil
+}
+
+func encodeCreateScheduleResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(createScheduleResponse)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/v1/schedules/"+strconv.FormatUint(res.schedule.ID, 10))
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(res.schedule); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+type getSchedulesRequest struct {
+	accountID string
+}
+
+type getSchedulesResponse struct {
+	schedules []schedule.Schedule
+}
+
+func encodeGetSchedulesRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(getSchedulesRequest)
+	r.URL.Path = "/api/v1/schedules"
+	q := url.Values{}
+	if req.accountID != "" {
+		q.Set("account", req.accountID)
+	}
+	r.URL.RawQuery = q.Encode()
+
+	return nil
+}
+
+func decodeGetSchedulesResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, decodeError(r)
+	}
+	res := getSchedulesResponse{}
+	if err := json.NewDecoder(r.Body).Decode(&res.schedules); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+
+	return res, nil
+}
+
+func decodeGetSchedulesRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	return getSchedulesRequest{accountID: r.URL.Query().Get("account")}, nil
+}
+
+func encodeGetSchedulesResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(getSchedulesResponse)
+	schedules := res.schedules
+	if schedules == nil {
+		schedules = []schedule.Schedule{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(schedules); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+type getScheduleRequest struct {
+	id uint64
+}
+
+type getScheduleResponse struct {
+	schedule schedule.Schedule
+}
+
+func encodeGetScheduleRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(getScheduleRequest)
+	r.URL.Path = "/api/v1/schedules/" + strconv.FormatUint(req.id, 10)
+
+	return nil
+}
+
+func decodeGetScheduleResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, decodeError(r)
+	}
+	res := getScheduleResponse{}
+	if err := json.NewDecoder(r.Body).Decode(&res.schedule); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+
+	return res, nil
+}
+
+func decodeGetScheduleRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeScheduleID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return getScheduleRequest{id: id}, nil
+}
+
+func encodeGetScheduleResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(getScheduleResponse)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res.schedule); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+type cancelScheduleRequest struct {
+	id uint64
+}
+
+type cancelScheduleResponse struct {
+}
+
+func encodeCancelScheduleRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(cancelScheduleRequest)
+	r.URL.Path = "/api/v1/schedules/" + strconv.FormatUint(req.id, 10)
+
+	return nil
+}
+
+func decodeCancelScheduleResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, decodeError(r)
+	}
+
+	return cancelScheduleResponse{}, nil
+}
+
+func decodeCancelScheduleRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeScheduleID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return cancelScheduleRequest{id: id}, nil
+}
+
+func encodeCancelScheduleResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+func decodeScheduleID(r *http.Request) (uint64, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return 0, coins.ErrBadRequest("invalid schedule id: %v", err)
+	}
+
+	return id, nil
+}
+
+// holdResponse is a response of all hold operations.
+type holdResponse struct {
+	hold hold.Hold
+}
+
+func decodeHoldResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, decodeError(r)
+	}
+	res := holdResponse{}
+	if err := json.NewDecoder(r.Body).Decode(&res.hold); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+
+	return res, nil
+}
+
+func encodeHoldResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(holdResponse)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res.hold); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+type authorizePaymentRequest struct {
+	input hold.AuthorizeInput
+}
+
+func encodeAuthorizePaymentRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(authorizePaymentRequest)
+	r.URL.Path = "/api/v1/holds"
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(req.input); err != nil {
+		return err
+	}
+	r.Body = ioutil.NopCloser(&buf)
+
+	return nil
+}
+
+func decodeAuthorizePaymentRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var input hold.AuthorizeInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, coins.ErrBadRequest("failed to decode JSON request: %v", err)
+	}
+
+	return authorizePaymentRequest{input: input}, nil
+}
+
+func encodeAuthorizePaymentResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(holdResponse)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/v1/holds/"+strconv.FormatUint(res.hold.ID, 10))
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(res.hold); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+type getHoldRequest struct {
+	id uint64
+}
+
+func encodeGetHoldRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(getHoldRequest)
+	r.URL.Path = "/api/v1/holds/" + strconv.FormatUint(req.id, 10)
+
+	return nil
+}
+
+func decodeGetHoldRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeHoldID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return getHoldRequest{id: id}, nil
+}
+
+type captureHoldRequest struct {
+	id    uint64
+	input hold.CaptureInput
+}
+
+func encodeCaptureHoldRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(captureHoldRequest)
+	r.URL.Path = "/api/v1/holds/" + strconv.FormatUint(req.id, 10) + "/capture"
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(req.input); err != nil {
+		return err
+	}
+	r.Body = ioutil.NopCloser(&buf)
+
+	return nil
+}
+
+func decodeCaptureHoldRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeHoldID(r)
+	if err != nil {
+		return nil, err
+	}
+	var input hold.CaptureInput
+	// An empty body captures the whole hold.
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		return nil, coins.ErrBadRequest("failed to decode JSON request: %v", err)
+	}
+
+	return captureHoldRequest{id: id, input: input}, nil
+}
+
+type voidHoldRequest struct {
+	id uint64
+}
+
+func encodeVoidHoldRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(voidHoldRequest)
+	r.URL.Path = "/api/v1/holds/" + strconv.FormatUint(req.id, 10) + "/void"
+
+	return nil
+}
+
+func decodeVoidHoldRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeHoldID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return voidHoldRequest{id: id}, nil
+}
+
+func decodeHoldID(r *http.Request) (uint64, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return 0, coins.ErrBadRequest("invalid hold id: %v", err)
+	}
+
+	return id, nil
+}
+
+type createSubscriptionRequest struct {
+	accountID string
+	input     webhook.SubscriptionInput
+}
+
+type createSubscriptionResponse struct {
+	subscription webhook.Subscription
+}
+
+func encodeCreateSubscriptionRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(createSubscriptionRequest)
+	setAccountPath(r, req.accountID, "/webhooks")
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(req.input); err != nil {
+		return err
+	}
+	r.Body = ioutil.NopCloser(&buf)
+
+	return nil
+}
+
+func decodeCreateSubscriptionResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, decodeError(r)
+	}
+	res := createSubscriptionResponse{}
+	if err := json.NewDecoder(r.Body).Decode(&res.subscription); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+
+	return res, nil
+}
+
+func decodeCreateSubscriptionRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeAccountID(r)
+	if err != nil {
+		return nil, err
+	}
+	var input webhook.SubscriptionInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		return nil, coins.ErrBadRequest("failed to decode JSON request: %v", err)
+	}
+
+	return createSubscriptionRequest{accountID: id, input: input}, nil
+}
+
+func encodeCreateSubscriptionResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(createSubscriptionResponse)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/v1/webhooks/"+strconv.FormatUint(res.subscription.ID, 10))
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(res.subscription); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+type getSubscriptionsRequest struct {
+	accountID string
+}
+
+type getSubscriptionsResponse struct {
+	subscriptions []webhook.Subscription
+}
+
+func encodeGetSubscriptionsRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(getSubscriptionsRequest)
+	setAccountPath(r, req.accountID, "/webhooks")
+
+	return nil
+}
+
+func decodeGetSubscriptionsResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, decodeError(r)
+	}
+	res := getSubscriptionsResponse{}
+	if err := json.NewDecoder(r.Body).Decode(&res.subscriptions); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+
+	return res, nil
+}
+
+func decodeGetSubscriptionsRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeAccountID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return getSubscriptionsRequest{accountID: id}, nil
+}
+
+func encodeGetSubscriptionsResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(getSubscriptionsResponse)
+	subs := res.subscriptions
+	if subs == nil {
+		subs = []webhook.Subscription{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(subs); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+type getSubscriptionRequest struct {
+	id uint64
+}
+
+type getSubscriptionResponse struct {
+	subscription webhook.Subscription
+}
+
+func encodeGetSubscriptionRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(getSubscriptionRequest)
+	r.URL.Path = "/api/v1/webhooks/" + strconv.FormatUint(req.id, 10)
+
+	return nil
+}
+
+func decodeGetSubscriptionResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, decodeError(r)
+	}
+	res := getSubscriptionResponse{}
+	if err := json.NewDecoder(r.Body).Decode(&res.subscription); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+
+	return res, nil
+}
+
+func decodeGetSubscriptionRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeSubscriptionID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return getSubscriptionRequest{id: id}, nil
+}
+
+func encodeGetSubscriptionResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(getSubscriptionResponse)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(res.subscription); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+type deleteSubscriptionRequest struct {
+	id uint64
+}
+
+type deleteSubscriptionResponse struct {
+}
+
+func encodeDeleteSubscriptionRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(deleteSubscriptionRequest)
+	r.URL.Path = "/api/v1/webhooks/" + strconv.FormatUint(req.id, 10)
+
+	return nil
+}
+
+func decodeDeleteSubscriptionResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, decodeError(r)
+	}
+
+	return deleteSubscriptionResponse{}, nil
+}
+
+func decodeDeleteSubscriptionRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeSubscriptionID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return deleteSubscriptionRequest{id: id}, nil
+}
+
+func encodeDeleteSubscriptionResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	w.WriteHeader(http.StatusNoContent)
+
+	return nil
+}
+
+type getDeliveriesRequest struct {
+	id uint64
+}
+
+type getDeliveriesResponse struct {
+	deliveries []webhook.Delivery
+}
+
+func encodeGetDeliveriesRequest(ctx context.Context, r *http.Request, request interface{}) error {
+	req := request.(getDeliveriesRequest)
+	r.URL.Path = "/api/v1/webhooks/" + strconv.FormatUint(req.id, 10) + "/deliveries"
+
+	return nil
+}
+
+func decodeGetDeliveriesResponse(ctx context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return nil, decodeError(r)
+	}
+	res := getDeliveriesResponse{}
+	if err := json.NewDecoder(r.Body).Decode(&res.deliveries); err != nil {
+		return nil, fmt.Errorf("failed to decode JSON response: %w", err)
+	}
+
+	return res, nil
+}
+
+func decodeGetDeliveriesRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	id, err := decodeSubscriptionID(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return getDeliveriesRequest{id: id}, nil
+}
+
+func encodeGetDeliveriesResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	res := response.(getDeliveriesResponse)
+	deliveries := res.deliveries
+	if deliveries == nil {
+		deliveries = []webhook.Delivery{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+		return coins.ErrInternal("failed to encode JSON response: %s", err)
+	}
+
+	return nil
+}
+
+func decodeSubscriptionID(r *http.Request) (uint64, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return 0, coins.ErrBadRequest("invalid subscription id: %v", err)
+	}
+
+	return id, nil
+}
@@ -2,33 +2,151 @@ package coinssvc
 
 import (
 	"context"
+	"encoding/json"
+	"github.com/donmikel/coins/pkg/account"
 	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/fx"
+	"github.com/donmikel/coins/pkg/hold"
 	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/schedule"
+	"github.com/donmikel/coins/pkg/webhook"
 	"github.com/shopspring/decimal"
 	"github.com/stretchr/testify/assert"
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
 
 type mockService struct {
-	onGetAvailableAccounts func(ctx context.Context) (accounts []string, err error)
-	onGetAllPayments       func(ctx context.Context) (payments []payment.Payment, err error)
-	onSendPayments         func(ctx context.Context, payment payment.PaymentInput) (err error)
+	onGetAvailableAccounts func(ctx context.Context) (accounts []account.Account, err error)
+	onGetAllPayments       func(ctx context.Context, filter payment.Filter) (page payment.Page, err error)
+	onSendPayments         func(ctx context.Context, payment payment.PaymentInput) (p payment.Payment, err error)
+	onSendPaymentsBatch    func(ctx context.Context, input payment.BatchInput) (res payment.BatchResult, err error)
+	onGetPayment           func(ctx context.Context, id uint64) (p payment.Payment, err error)
+	onRefundPayment        func(ctx context.Context, id uint64, input payment.RefundInput) (p payment.Payment, err error)
+	onCreateAccount        func(ctx context.Context, input account.Account) (acc account.Account, err error)
+	onGetAccount           func(ctx context.Context, id string) (acc account.Account, err error)
+	onUpdateAccount        func(ctx context.Context, id string, input account.AccountUpdate) (acc account.Account, err error)
+	onCloseAccount         func(ctx context.Context, id string) (err error)
+	onGetStatement         func(ctx context.Context, id string, from, to *time.Time) (st account.Statement, err error)
+	onCreateQuote          func(ctx context.Context, input fx.QuoteInput) (q fx.Quote, err error)
+	onCreateSchedule       func(ctx context.Context, input schedule.ScheduleInput) (sch schedule.Schedule, err error)
+	onGetSchedules         func(ctx context.Context, accountID string) (schedules []schedule.Schedule, err error)
+	onGetSchedule          func(ctx context.Context, id uint64) (sch schedule.Schedule, err error)
+	onCancelSchedule       func(ctx context.Context, id uint64) (err error)
+	onAuthorizePayment     func(ctx context.Context, input hold.AuthorizeInput) (h hold.Hold, err error)
+	onGetHold              func(ctx context.Context, id uint64) (h hold.Hold, err error)
+	onCaptureHold          func(ctx context.Context, id uint64, input hold.CaptureInput) (h hold.Hold, err error)
+	onVoidHold             func(ctx context.Context, id uint64) (h hold.Hold, err error)
+	onCreateSubscription   func(ctx context.Context, accountID string, input webhook.SubscriptionInput) (sub webhook.Subscription, err error)
+	onGetSubscriptions     func(ctx context.Context, accountID string) (subs []webhook.Subscription, err error)
+	onGetSubscription      func(ctx context.Context, id uint64) (sub webhook.Subscription, err error)
+	onDeleteSubscription   func(ctx context.Context, id uint64) (err error)
+	onGetDeliveries        func(ctx context.Context, subscriptionID uint64) (deliveries []webhook.Delivery, err error)
 }
 
-func (m *mockService) GetAvailableAccounts(ctx context.Context) (accounts []string, err error) {
+func (m *mockService) GetAvailableAccounts(ctx context.Context) (accounts []account.Account, err error) {
 	return m.onGetAvailableAccounts(ctx)
 }
 
-func (m *mockService) GetAllPayments(ctx context.Context) (payments []payment.Payment, err error) {
-	return m.onGetAllPayments(ctx)
+func (m *mockService) GetAllPayments(ctx context.Context, filter payment.Filter) (page payment.Page, err error) {
+	return m.onGetAllPayments(ctx, filter)
 }
 
-func (m *mockService) SendPayment(ctx context.Context, payment payment.PaymentInput) (err error) {
+func (m *mockService) SendPayment(ctx context.Context, payment payment.PaymentInput) (p payment.Payment, err error) {
 	return m.onSendPayments(ctx, payment)
 }
 
+func (m *mockService) SendPayments(ctx context.Context, input payment.BatchInput) (res payment.BatchResult, err error) {
+	return m.onSendPaymentsBatch(ctx, input)
+}
+
+func (m *mockService) GetPayment(ctx context.Context, id uint64) (p payment.Payment, err error) {
+	return m.onGetPayment(ctx, id)
+}
+
+func (m *mockService) RefundPayment(ctx context.Context, id uint64, input payment.RefundInput) (p payment.Payment, err error) {
+	return m.onRefundPayment(ctx, id, input)
+}
+
+func (m *mockService) CreateAccount(ctx context.Context, input account.Account) (acc account.Account, err error) {
+	return m.onCreateAccount(ctx, input)
+}
+
+func (m *mockService) GetAccount(ctx context.Context, id string) (acc account.Account, err error) {
+	return m.onGetAccount(ctx, id)
+}
+
+func (m *mockService) UpdateAccount(ctx context.Context, id string, input account.AccountUpdate) (acc account.Account, err error) {
+	return m.onUpdateAccount(ctx, id, input)
+}
+
+func (m *mockService) CloseAccount(ctx context.Context, id string) (err error) {
+	return m.onCloseAccount(ctx, id)
+}
+
+func (m *mockService) GetStatement(ctx context.Context, id string, from, to *time.Time) (st account.Statement, err error) {
+	return m.onGetStatement(ctx, id, from, to)
+}
+
+func (m *mockService) CreateQuote(ctx context.Context, input fx.QuoteInput) (q fx.Quote, err error) {
+	return m.onCreateQuote(ctx, input)
+}
+
+func (m *mockService) CreateSchedule(ctx context.Context, input schedule.ScheduleInput) (sch schedule.Schedule, err error) {
+	return m.onCreateSchedule(ctx, input)
+}
+
+func (m *mockService) GetSchedules(ctx context.Context, accountID string) (schedules []schedule.Schedule, err error) {
+	return m.onGetSchedules(ctx, accountID)
+}
+
+func (m *mockService) GetSchedule(ctx context.Context, id uint64) (sch schedule.Schedule, err error) {
+	return m.onGetSchedule(ctx, id)
+}
+
+func (m *mockService) CancelSchedule(ctx context.Context, id uint64) (err error) {
+	return m.onCancelSchedule(ctx, id)
+}
+
+func (m *mockService) AuthorizePayment(ctx context.Context, input hold.AuthorizeInput) (h hold.Hold, err error) {
+	return m.onAuthorizePayment(ctx, input)
+}
+
+func (m *mockService) GetHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	return m.onGetHold(ctx, id)
+}
+
+func (m *mockService) CaptureHold(ctx context.Context, id uint64, input hold.CaptureInput) (h hold.Hold, err error) {
+	return m.onCaptureHold(ctx, id, input)
+}
+
+func (m *mockService) VoidHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	return m.onVoidHold(ctx, id)
+}
+
+func (m *mockService) CreateSubscription(ctx context.Context, accountID string, input webhook.SubscriptionInput) (sub webhook.Subscription, err error) {
+	return m.onCreateSubscription(ctx, accountID, input)
+}
+
+func (m *mockService) GetSubscriptions(ctx context.Context, accountID string) (subs []webhook.Subscription, err error) {
+	return m.onGetSubscriptions(ctx, accountID)
+}
+
+func (m *mockService) GetSubscription(ctx context.Context, id uint64) (sub webhook.Subscription, err error) {
+	return m.onGetSubscription(ctx, id)
+}
+
+func (m *mockService) DeleteSubscription(ctx context.Context, id uint64) (err error) {
+	return m.onDeleteSubscription(ctx, id)
+}
+
+func (m *mockService) GetDeliveries(ctx context.Context, subscriptionID uint64) (deliveries []webhook.Delivery, err error) {
+	return m.onGetDeliveries(ctx, subscriptionID)
+}
+
 func initTransportTest(t *testing.T) (*httptest.Server, *Client, *mockService) {
 	svc := &mockService{}
 	handler := makeHandler(svc)
@@ -49,14 +167,17 @@ func TestTransportGetAvailableAccounts(t *testing.T) {
 
 	testCases := []struct {
 		name   string
-		result []string
+		result []account.Account
 		err    error
 	}{
 		{
 			name: "ok",
-			result: []string{
-				"bob123",
-				"alice456",
+			result: []account.Account{
+				mustNewAccount(nil),
+				mustNewAccount(func(a *account.Account) {
+					a.ID = "alice456"
+					a.Balance = decimal.New(1, -2)
+				}),
 			},
 			err: nil,
 		},
@@ -69,49 +190,110 @@ func TestTransportGetAvailableAccounts(t *testing.T) {
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			svc.onGetAvailableAccounts = func(ctx context.Context) (accounts []string, err error) {
+			svc.onGetAvailableAccounts = func(ctx context.Context) (accounts []account.Account, err error) {
 				return tc.result, tc.err
 			}
 
 			gotResult, gotErr := client.GetAvailableAccounts(context.Background())
 
 			assert.Equal(t, tc.err, gotErr)
-			assert.Equal(t, tc.result, gotResult)
+			assert.Equal(t, len(tc.result), len(gotResult))
+			for i := range tc.result {
+				assert.Equal(t, tc.result[i].ID, gotResult[i].ID)
+				assert.Equal(t, tc.result[i].Currency, gotResult[i].Currency)
+				assert.True(t, tc.result[i].Balance.Equal(gotResult[i].Balance))
+			}
 		})
 	}
 }
 
+func TestTransportGetAvailableAccountsIDs(t *testing.T) {
+	server, _, svc := initTransportTest(t)
+	defer server.Close()
+
+	svc.onGetAvailableAccounts = func(ctx context.Context) (accounts []account.Account, err error) {
+		return []account.Account{mustNewAccount(nil)}, nil
+	}
+
+	resp, err := http.Get(server.URL + "/api/v1/accounts?format=ids")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var got []string
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"bob123"}, got)
+}
+
 func TestTransportGetAllPayments(t *testing.T) {
 	server, client, svc := initTransportTest(t)
 	defer server.Close()
 
+	direction := payment.Outgoing
+	minAmount := decimal.NewFromInt(10)
+	maxAmount := decimal.New(2505, -1)
+	from := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC)
+
 	testCases := []struct {
 		name    string
-		result  []payment.Payment
+		filter  payment.Filter
+		result  payment.Page
 		wantErr error
 	}{
 		{
-			name: "ok",
-			result: []payment.Payment{
-				mustNewPayment(nil),
+			name:   "ok",
+			filter: payment.Filter{},
+			result: payment.Page{
+				Payments: []payment.Payment{
+					mustNewPayment(nil),
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "ok with filter",
+			filter: payment.Filter{
+				Account:      "bob123",
+				Counterparty: "alice456",
+				Direction:    &direction,
+				MinAmount:    &minAmount,
+				MaxAmount:    &maxAmount,
+				From:         &from,
+				To:           &to,
+				Cursor:       42,
+				Limit:        10,
+			},
+			result: payment.Page{
+				Payments: []payment.Payment{
+					mustNewPayment(nil),
+				},
+				NextCursor: 1,
 			},
 			wantErr: nil,
 		},
 		{
 			name:    "error bad request",
-			result:  nil,
+			filter:  payment.Filter{},
+			result:  payment.Page{},
 			wantErr: coins.ErrBadRequest("some validation error"),
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			svc.onGetAllPayments = func(ctx context.Context) (payments []payment.Payment, err error) {
+			var gotFilter payment.Filter
+			svc.onGetAllPayments = func(ctx context.Context, filter payment.Filter) (page payment.Page, err error) {
+				gotFilter = filter
 				return tc.result, tc.wantErr
 			}
 
-			gotResult, gotErr := client.GetAllPayments(context.Background())
+			gotResult, gotErr := client.GetAllPayments(context.Background(), tc.filter)
 
+			assert.Equal(t, tc.filter, gotFilter)
 			assert.Equal(t, tc.wantErr, gotErr)
 			assert.Equal(t, tc.result, gotResult)
 		})
@@ -125,50 +307,1082 @@ func TestTransportSendPayment(t *testing.T) {
 	testCases := []struct {
 		name    string
 		input   payment.PaymentInput
+		result  payment.Payment
 		wantErr error
 	}{
 		{
 			name:    "ok",
 			input:   mustNewPaymentInput(nil),
+			result:  mustNewPayment(nil),
+			wantErr: nil,
+		},
+		{
+			name: "ok with idempotency key",
+			input: mustNewPaymentInput(func(pi *payment.PaymentInput) {
+				pi.IdempotencyKey = "key-1"
+			}),
+			result:  mustNewPayment(nil),
+			wantErr: nil,
+		},
+		{
+			name:  "ok parked for review",
+			input: mustNewPaymentInput(nil),
+			result: mustNewPayment(func(p *payment.Payment) {
+				pendingID := uint64(7)
+				p.ID = 0
+				p.PendingID = &pendingID
+			}),
 			wantErr: nil,
 		},
 		{
 			name:    "error bad request",
 			input:   mustNewPaymentInput(nil),
+			result:  payment.Payment{},
 			wantErr: coins.ErrBadRequest("some validation error"),
 		},
+		{
+			name:    "error limit exceeded",
+			input:   mustNewPaymentInput(nil),
+			result:  payment.Payment{},
+			wantErr: coins.ErrLimitExceeded("max_payment", decimal.NewFromInt(50), "max_payment limit of 50 USD exceeded, 50 USD remaining"),
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			var gotInput payment.PaymentInput
-			svc.onSendPayments = func(ctx context.Context, payment payment.PaymentInput) (err error) {
+			svc.onSendPayments = func(ctx context.Context, payment payment.PaymentInput) (p payment.Payment, err error) {
 				gotInput = payment
-				return tc.wantErr
+				return tc.result, tc.wantErr
 			}
 
-			gotErr := client.SendPayment(context.Background(), tc.input)
+			gotResult, gotErr := client.SendPayment(context.Background(), tc.input)
 
+			assert.NotEmpty(t, gotInput.IdempotencyKey)
+			if tc.input.IdempotencyKey == "" {
+				gotInput.IdempotencyKey = ""
+			}
 			assert.Equal(t, tc.input, gotInput)
 			assert.Equal(t, tc.wantErr, gotErr)
+			assert.Equal(t, tc.result, gotResult)
 		})
 	}
 }
-func mustNewPayment(fn func(pi payment.Payment)) payment.Payment {
-	pi := payment.Payment{
-		ID:          1,
-		FromAccount: "bob123",
-		ToAccount:   "alice456",
-		Amount:      decimal.NewFromInt(100),
-		Direction:   payment.Incomming,
-		Dt:          nil,
+
+func TestTransportSendPaymentLocation(t *testing.T) {
+	server, _, svc := initTransportTest(t)
+	defer server.Close()
+
+	svc.onSendPayments = func(ctx context.Context, input payment.PaymentInput) (p payment.Payment, err error) {
+		return mustNewPayment(nil), nil
+	}
+
+	resp, err := http.Post(server.URL+"/api/v1/payments", "application/json",
+		strings.NewReader(`{"from_account":"bob123","to_account":"alice456","amount":"100"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "/api/v1/payments/1", resp.Header.Get("Location"))
+
+	svc.onSendPayments = func(ctx context.Context, input payment.PaymentInput) (p payment.Payment, err error) {
+		return mustNewPayment(func(p *payment.Payment) {
+			pendingID := uint64(7)
+			p.ID = 0
+			p.PendingID = &pendingID
+		}), nil
+	}
+
+	resp, err = http.Post(server.URL+"/api/v1/payments", "application/json",
+		strings.NewReader(`{"from_account":"bob123","to_account":"alice456","amount":"100"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Location"))
+}
+
+func TestTransportSendPayments(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	p := mustNewPayment(nil)
+	testCases := []struct {
+		name    string
+		input   payment.BatchInput
+		result  payment.BatchResult
+		wantErr error
+	}{
+		{
+			name: "ok atomic",
+			input: payment.BatchInput{
+				Mode:     payment.Atomic,
+				Payments: []payment.PaymentInput{mustNewPaymentInput(nil)},
+			},
+			result: payment.BatchResult{
+				Mode:    payment.Atomic,
+				Results: []payment.BatchItem{{Status: http.StatusCreated, Payment: &p}},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "ok best effort",
+			input: payment.BatchInput{
+				Mode:     payment.BestEffort,
+				Payments: []payment.PaymentInput{mustNewPaymentInput(nil), mustNewPaymentInput(nil)},
+			},
+			result: payment.BatchResult{
+				Mode: payment.BestEffort,
+				Results: []payment.BatchItem{
+					{Status: http.StatusCreated, Payment: &p},
+					{Status: http.StatusUnprocessableEntity, Error: "insufficient funds"},
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name: "error atomic",
+			input: payment.BatchInput{
+				Mode:     payment.Atomic,
+				Payments: []payment.PaymentInput{mustNewPaymentInput(nil)},
+			},
+			result:  payment.BatchResult{},
+			wantErr: coins.ErrUnprocessable("payment 0: insufficient funds"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotInput payment.BatchInput
+			svc.onSendPaymentsBatch = func(ctx context.Context, input payment.BatchInput) (res payment.BatchResult, err error) {
+				gotInput = input
+				return tc.result, tc.wantErr
+			}
+
+			gotResult, gotErr := client.SendPayments(context.Background(), tc.input)
+
+			assert.Equal(t, tc.input.Mode, gotInput.Mode)
+			assert.Len(t, gotInput.Payments, len(tc.input.Payments))
+			assert.Equal(t, tc.wantErr, gotErr)
+			assert.Equal(t, tc.result, gotResult)
+		})
+	}
+}
+
+func TestTransportGetPayment(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	testCases := []struct {
+		name    string
+		id      uint64
+		result  payment.Payment
+		wantErr error
+	}{
+		{
+			name:    "ok",
+			id:      1,
+			result:  mustNewPayment(nil),
+			wantErr: nil,
+		},
+		{
+			name:    "error not found",
+			id:      2,
+			result:  payment.Payment{},
+			wantErr: coins.ErrNotFound("payment 2 not found"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotID uint64
+			svc.onGetPayment = func(ctx context.Context, id uint64) (p payment.Payment, err error) {
+				gotID = id
+				return tc.result, tc.wantErr
+			}
+
+			gotResult, gotErr := client.GetPayment(context.Background(), tc.id)
+
+			assert.Equal(t, tc.id, gotID)
+			assert.Equal(t, tc.wantErr, gotErr)
+			assert.Equal(t, tc.result, gotResult)
+		})
+	}
+}
+
+func TestTransportRefundPayment(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	amount := decimal.NewFromInt(5)
+	refundOf := uint64(1)
+	testCases := []struct {
+		name    string
+		id      uint64
+		input   payment.RefundInput
+		result  payment.Payment
+		wantErr error
+	}{
+		{
+			name:  "ok full",
+			id:    1,
+			input: payment.RefundInput{},
+			result: mustNewPayment(func(p *payment.Payment) {
+				p.ID = 2
+				p.RefundOf = &refundOf
+			}),
+			wantErr: nil,
+		},
+		{
+			name:  "ok partial",
+			id:    1,
+			input: payment.RefundInput{Amount: &amount},
+			result: mustNewPayment(func(p *payment.Payment) {
+				p.ID = 3
+				p.RefundOf = &refundOf
+			}),
+			wantErr: nil,
+		},
+		{
+			name:  "ok parked",
+			id:    1,
+			input: payment.RefundInput{Amount: &amount},
+			result: mustNewPayment(func(p *payment.Payment) {
+				pendingID := uint64(7)
+				p.RefundOf = &refundOf
+				p.PendingID = &pendingID
+			}),
+			wantErr: nil,
+		},
+		{
+			name:    "error refund exceeded",
+			id:      1,
+			input:   payment.RefundInput{Amount: &amount},
+			result:  payment.Payment{},
+			wantErr: coins.ErrUnprocessable("refund exceeds the payment amount"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotID uint64
+			var gotInput payment.RefundInput
+			svc.onRefundPayment = func(ctx context.Context, id uint64, input payment.RefundInput) (p payment.Payment, err error) {
+				gotID, gotInput = id, input
+				return tc.result, tc.wantErr
+			}
+
+			gotResult, gotErr := client.RefundPayment(context.Background(), tc.id, tc.input)
+
+			assert.Equal(t, tc.id, gotID)
+			assert.Equal(t, tc.input, gotInput)
+			assert.Equal(t, tc.wantErr, gotErr)
+			assert.Equal(t, tc.result, gotResult)
+		})
+	}
+}
+
+func TestTransportCreateAccount(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	testCases := []struct {
+		name    string
+		input   account.Account
+		result  account.Account
+		wantErr error
+	}{
+		{
+			name:    "ok",
+			input:   mustNewAccount(nil),
+			result:  mustNewAccount(nil),
+			wantErr: nil,
+		},
+		{
+			name:    "error conflict",
+			input:   mustNewAccount(nil),
+			result:  account.Account{},
+			wantErr: coins.ErrConflict("account bob123 already exists"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotInput account.Account
+			svc.onCreateAccount = func(ctx context.Context, input account.Account) (acc account.Account, err error) {
+				gotInput = input
+				return tc.result, tc.wantErr
+			}
+
+			gotResult, gotErr := client.CreateAccount(context.Background(), tc.input)
+
+			assert.True(t, tc.input.Balance.Equal(gotInput.Balance))
+			assert.Equal(t, tc.input.ID, gotInput.ID)
+			assert.Equal(t, tc.wantErr, gotErr)
+			assert.Equal(t, tc.result.ID, gotResult.ID)
+			assert.True(t, tc.result.Balance.Equal(gotResult.Balance))
+		})
+	}
+}
+
+func TestTransportGetAccount(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	testCases := []struct {
+		name    string
+		id      string
+		result  account.Account
+		wantErr error
+	}{
+		{
+			name:    "ok",
+			id:      "bob123",
+			result:  mustNewAccount(nil),
+			wantErr: nil,
+		},
+		{
+			name:    "error not found",
+			id:      "unknown",
+			result:  account.Account{},
+			wantErr: coins.ErrNotFound("account unknown not found"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotID string
+			svc.onGetAccount = func(ctx context.Context, id string) (acc account.Account, err error) {
+				gotID = id
+				return tc.result, tc.wantErr
+			}
+
+			gotResult, gotErr := client.GetAccount(context.Background(), tc.id)
+
+			assert.Equal(t, tc.id, gotID)
+			assert.Equal(t, tc.wantErr, gotErr)
+			assert.Equal(t, tc.result.ID, gotResult.ID)
+			assert.Equal(t, tc.result.Currency, gotResult.Currency)
+		})
+	}
+}
+
+func TestTransportUpdateAccount(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	currency := "EUR"
+	testCases := []struct {
+		name    string
+		id      string
+		input   account.AccountUpdate
+		result  account.Account
+		wantErr error
+	}{
+		{
+			name:  "ok",
+			id:    "bob123",
+			input: account.AccountUpdate{Currency: &currency},
+			result: mustNewAccount(func(a *account.Account) {
+				a.Currency = currency
+			}),
+			wantErr: nil,
+		},
+		{
+			name:    "error bad request",
+			id:      "bob123",
+			input:   account.AccountUpdate{},
+			result:  account.Account{},
+			wantErr: coins.ErrBadRequest("invalid account update: nothing to update"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotID string
+			var gotInput account.AccountUpdate
+			svc.onUpdateAccount = func(ctx context.Context, id string, input account.AccountUpdate) (acc account.Account, err error) {
+				gotID = id
+				gotInput = input
+				return tc.result, tc.wantErr
+			}
+
+			gotResult, gotErr := client.UpdateAccount(context.Background(), tc.id, tc.input)
+
+			assert.Equal(t, tc.id, gotID)
+			assert.Equal(t, tc.input, gotInput)
+			assert.Equal(t, tc.wantErr, gotErr)
+			assert.Equal(t, tc.result.Currency, gotResult.Currency)
+		})
+	}
+}
+
+func TestTransportCloseAccount(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	testCases := []struct {
+		name    string
+		id      string
+		wantErr error
+	}{
+		{
+			name:    "ok",
+			id:      "bob123",
+			wantErr: nil,
+		},
+		{
+			name:    "error not found",
+			id:      "unknown",
+			wantErr: coins.ErrNotFound("account unknown not found"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotID string
+			svc.onCloseAccount = func(ctx context.Context, id string) (err error) {
+				gotID = id
+				return tc.wantErr
+			}
+
+			gotErr := client.CloseAccount(context.Background(), tc.id)
+
+			assert.Equal(t, tc.id, gotID)
+			assert.Equal(t, tc.wantErr, gotErr)
+		})
+	}
+}
+
+func TestTransportGetStatement(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	from := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC)
+	pay := mustNewPayment(nil)
+
+	testCases := []struct {
+		name    string
+		id      string
+		from    *time.Time
+		to      *time.Time
+		result  account.Statement
+		wantErr error
+	}{
+		{
+			name: "ok",
+			id:   "bob123",
+			from: &from,
+			to:   &to,
+			result: account.Statement{
+				AccountID:      "bob123",
+				Currency:       "USD",
+				From:           &from,
+				To:             &to,
+				OpeningBalance: decimal.NewFromInt(200),
+				ClosingBalance: decimal.NewFromInt(100),
+				Lines: []account.StatementLine{
+					{
+						Payment: &pay,
+						Amount:  decimal.NewFromInt(-100),
+						Balance: decimal.NewFromInt(100),
+					},
+				},
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "error not found",
+			id:      "unknown",
+			result:  account.Statement{},
+			wantErr: coins.ErrNotFound("account unknown not found"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotID string
+			var gotFrom, gotTo *time.Time
+			svc.onGetStatement = func(ctx context.Context, id string, from, to *time.Time) (st account.Statement, err error) {
+				gotID, gotFrom, gotTo = id, from, to
+				return tc.result, tc.wantErr
+			}
+
+			gotResult, gotErr := client.GetStatement(context.Background(), tc.id, tc.from, tc.to)
+
+			assert.Equal(t, tc.id, gotID)
+			assert.Equal(t, tc.from, gotFrom)
+			assert.Equal(t, tc.to, gotTo)
+			assert.Equal(t, tc.wantErr, gotErr)
+			assert.Equal(t, tc.result, gotResult)
+		})
+	}
+}
+
+func TestTransportCreateQuote(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	testCases := []struct {
+		name    string
+		input   fx.QuoteInput
+		result  fx.Quote
+		wantErr error
+	}{
+		{
+			name:  "ok",
+			input: fx.QuoteInput{FromCurrency: "EUR", ToCurrency: "USD"},
+			result: fx.Quote{
+				ID:           "quote1",
+				FromCurrency: "EUR",
+				ToCurrency:   "USD",
+				Rate:         decimal.New(121, -2),
+				ExpiresAt:    time.Date(2020, 12, 1, 0, 0, 30, 0, time.UTC),
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "error unprocessable",
+			input:   fx.QuoteInput{FromCurrency: "EUR", ToCurrency: "JPY"},
+			result:  fx.Quote{},
+			wantErr: coins.ErrUnprocessable("failed to create quote: EUR/JPY: exchange rate not found"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotInput fx.QuoteInput
+			svc.onCreateQuote = func(ctx context.Context, input fx.QuoteInput) (q fx.Quote, err error) {
+				gotInput = input
+				return tc.result, tc.wantErr
+			}
+
+			gotResult, gotErr := client.CreateQuote(context.Background(), tc.input)
+
+			assert.Equal(t, tc.input, gotInput)
+			assert.Equal(t, tc.wantErr, gotErr)
+			assert.Equal(t, tc.result.ID, gotResult.ID)
+			assert.True(t, tc.result.ExpiresAt.Equal(gotResult.ExpiresAt))
+			assert.True(t, tc.result.Rate.Equal(gotResult.Rate))
+		})
+	}
+}
+
+func TestTransportCreateSchedule(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	input := schedule.ScheduleInput{
+		FromAccount: "bob123",
+		ToAccount:   "alice456",
+		Amount:      decimal.NewFromInt(10),
+		Direction:   payment.Outgoing,
+		Spec:        "0 9 * * 1",
+	}
+	testCases := []struct {
+		name    string
+		input   schedule.ScheduleInput
+		result  schedule.Schedule
+		wantErr error
+	}{
+		{
+			name:    "ok",
+			input:   input,
+			result:  mustNewSchedule(nil),
+			wantErr: nil,
+		},
+		{
+			name:    "error bad request",
+			input:   schedule.ScheduleInput{Amount: decimal.NewFromInt(10), Spec: "@daily"},
+			result:  schedule.Schedule{},
+			wantErr: coins.ErrBadRequest("invalid schedule: empty FromAccount"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotInput schedule.ScheduleInput
+			svc.onCreateSchedule = func(ctx context.Context, input schedule.ScheduleInput) (sch schedule.Schedule, err error) {
+				gotInput = input
+				return tc.result, tc.wantErr
+			}
+
+			gotResult, gotErr := client.CreateSchedule(context.Background(), tc.input)
+
+			assert.Equal(t, tc.input, gotInput)
+			assert.Equal(t, tc.wantErr, gotErr)
+			assert.Equal(t, tc.result, gotResult)
+		})
+	}
+}
+
+func TestTransportGetSchedules(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	testCases := []struct {
+		name      string
+		accountID string
+		result    []schedule.Schedule
+		wantErr   error
+	}{
+		{
+			name:      "ok",
+			accountID: "",
+			result:    []schedule.Schedule{mustNewSchedule(nil)},
+			wantErr:   nil,
+		},
+		{
+			name:      "ok by account",
+			accountID: "bob123",
+			result:    []schedule.Schedule{},
+			wantErr:   nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotAccountID string
+			svc.onGetSchedules = func(ctx context.Context, accountID string) (schedules []schedule.Schedule, err error) {
+				gotAccountID = accountID
+				return tc.result, tc.wantErr
+			}
+
+			gotResult, gotErr := client.GetSchedules(context.Background(), tc.accountID)
+
+			assert.Equal(t, tc.accountID, gotAccountID)
+			assert.Equal(t, tc.wantErr, gotErr)
+			assert.Equal(t, tc.result, gotResult)
+		})
+	}
+}
+
+func TestTransportGetSchedule(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	svc.onGetSchedule = func(ctx context.Context, id uint64) (sch schedule.Schedule, err error) {
+		if id != 1 {
+			return sch, coins.ErrNotFound("schedule %d not found", id)
+		}
+		return mustNewSchedule(nil), nil
+	}
+
+	got, err := client.GetSchedule(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, mustNewSchedule(nil), got)
+
+	_, err = client.GetSchedule(context.Background(), 2)
+	assert.Equal(t, coins.ErrNotFound("schedule 2 not found"), err)
+}
+
+func TestTransportCancelSchedule(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	testCases := []struct {
+		name    string
+		id      uint64
+		wantErr error
+	}{
+		{
+			name:    "ok",
+			id:      1,
+			wantErr: nil,
+		},
+		{
+			name:    "error not found",
+			id:      2,
+			wantErr: coins.ErrNotFound("active schedule 2 not found"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotID uint64
+			svc.onCancelSchedule = func(ctx context.Context, id uint64) (err error) {
+				gotID = id
+				return tc.wantErr
+			}
+
+			gotErr := client.CancelSchedule(context.Background(), tc.id)
+
+			assert.Equal(t, tc.id, gotID)
+			assert.Equal(t, tc.wantErr, gotErr)
+		})
+	}
+}
+
+func TestTransportAuthorizePayment(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	testCases := []struct {
+		name    string
+		input   hold.AuthorizeInput
+		result  hold.Hold
+		wantErr error
+	}{
+		{
+			name: "ok",
+			input: hold.AuthorizeInput{
+				FromAccount: "bob123",
+				ToAccount:   "alice456",
+				Amount:      decimal.NewFromInt(10),
+				Direction:   payment.Outgoing,
+			},
+			result:  mustNewHold(nil),
+			wantErr: nil,
+		},
+		{
+			name:    "error insufficient funds",
+			input:   hold.AuthorizeInput{FromAccount: "bob123", ToAccount: "alice456", Amount: decimal.NewFromInt(1000)},
+			result:  hold.Hold{},
+			wantErr: coins.ErrUnprocessable("account bob123: insufficient funds"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotInput hold.AuthorizeInput
+			svc.onAuthorizePayment = func(ctx context.Context, input hold.AuthorizeInput) (h hold.Hold, err error) {
+				gotInput = input
+				return tc.result, tc.wantErr
+			}
+
+			gotResult, gotErr := client.AuthorizePayment(context.Background(), tc.input)
+
+			assert.Equal(t, tc.input.FromAccount, gotInput.FromAccount)
+			assert.True(t, tc.input.Amount.Equal(gotInput.Amount))
+			assert.Equal(t, tc.wantErr, gotErr)
+			assert.Equal(t, tc.result, gotResult)
+		})
+	}
+}
+
+func TestTransportGetHold(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	svc.onGetHold = func(ctx context.Context, id uint64) (h hold.Hold, err error) {
+		if id != 1 {
+			return h, coins.ErrNotFound("hold %d not found", id)
+		}
+		return mustNewHold(nil), nil
+	}
+
+	got, err := client.GetHold(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, mustNewHold(nil), got)
+
+	_, err = client.GetHold(context.Background(), 2)
+	assert.Equal(t, coins.ErrNotFound("hold 2 not found"), err)
+}
+
+func TestTransportCaptureHold(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	partial := decimal.NewFromInt(4)
+	paymentID := uint64(7)
+	testCases := []struct {
+		name    string
+		input   hold.CaptureInput
+		result  hold.Hold
+		wantErr error
+	}{
+		{
+			name:  "ok full",
+			input: hold.CaptureInput{},
+			result: mustNewHold(func(h *hold.Hold) {
+				h.Status = hold.Captured
+				h.PaymentID = &paymentID
+			}),
+			wantErr: nil,
+		},
+		{
+			name:  "ok partial",
+			input: hold.CaptureInput{Amount: &partial},
+			result: mustNewHold(func(h *hold.Hold) {
+				h.Status = hold.Captured
+				h.PaymentID = &paymentID
+			}),
+			wantErr: nil,
+		},
+		{
+			name:    "error finalized",
+			input:   hold.CaptureInput{},
+			result:  hold.Hold{},
+			wantErr: coins.ErrConflict("hold 1 is voided"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotInput hold.CaptureInput
+			svc.onCaptureHold = func(ctx context.Context, id uint64, input hold.CaptureInput) (h hold.Hold, err error) {
+				gotInput = input
+				return tc.result, tc.wantErr
+			}
+
+			gotResult, gotErr := client.CaptureHold(context.Background(), 1, tc.input)
+
+			if tc.input.Amount == nil {
+				assert.Nil(t, gotInput.Amount)
+			} else if assert.NotNil(t, gotInput.Amount) {
+				assert.True(t, tc.input.Amount.Equal(*gotInput.Amount))
+			}
+			assert.Equal(t, tc.wantErr, gotErr)
+			assert.Equal(t, tc.result, gotResult)
+		})
+	}
+}
+
+func TestTransportVoidHold(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	var gotID uint64
+	svc.onVoidHold = func(ctx context.Context, id uint64) (h hold.Hold, err error) {
+		gotID = id
+		return mustNewHold(func(h *hold.Hold) { h.Status = hold.Voided }), nil
+	}
+
+	got, err := client.VoidHold(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), gotID)
+	assert.Equal(t, hold.Voided, got.Status)
+}
+
+func TestTransportCreateSubscription(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	testCases := []struct {
+		name      string
+		accountID string
+		input     webhook.SubscriptionInput
+		result    webhook.Subscription
+		wantErr   error
+	}{
+		{
+			name:      "ok",
+			accountID: "bob123",
+			input:     webhook.SubscriptionInput{URL: "https://example.com/hooks", Secret: "0123456789abcdef"},
+			result:    mustNewSubscription(nil),
+			wantErr:   nil,
+		},
+		{
+			name:      "error account not found",
+			accountID: "unknown",
+			input:     webhook.SubscriptionInput{URL: "https://example.com/hooks", Secret: "0123456789abcdef"},
+			result:    webhook.Subscription{},
+			wantErr:   coins.ErrNotFound("account unknown not found"),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotAccountID string
+			var gotInput webhook.SubscriptionInput
+			svc.onCreateSubscription = func(ctx context.Context, accountID string, input webhook.SubscriptionInput) (sub webhook.Subscription, err error) {
+				gotAccountID, gotInput = accountID, input
+				return tc.result, tc.wantErr
+			}
+
+			gotResult, gotErr := client.CreateSubscription(context.Background(), tc.accountID, tc.input)
+
+			assert.Equal(t, tc.accountID, gotAccountID)
+			assert.Equal(t, tc.input, gotInput)
+			assert.Equal(t, tc.wantErr, gotErr)
+			assert.Equal(t, tc.result, gotResult)
+		})
+	}
+}
+
+func TestTransportGetSubscriptions(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	svc.onGetSubscriptions = func(ctx context.Context, accountID string) (subs []webhook.Subscription, err error) {
+		if accountID != "bob123" {
+			return nil, nil
+		}
+		return []webhook.Subscription{mustNewSubscription(nil)}, nil
+	}
+
+	got, err := client.GetSubscriptions(context.Background(), "bob123")
+	assert.NoError(t, err)
+	assert.Equal(t, []webhook.Subscription{mustNewSubscription(nil)}, got)
+
+	got, err = client.GetSubscriptions(context.Background(), "alice456")
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+
+	// The account ID is escaped once.
+	var gotAccountID string
+	svc.onGetSubscriptions = func(ctx context.Context, accountID string) (subs []webhook.Subscription, err error) {
+		gotAccountID = accountID
+		return nil, nil
+	}
+	_, err = client.GetSubscriptions(context.Background(), "bob 123")
+	assert.NoError(t, err)
+	assert.Equal(t, "bob 123", gotAccountID)
+}
+
+func TestTransportGetSubscription(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	svc.onGetSubscription = func(ctx context.Context, id uint64) (sub webhook.Subscription, err error) {
+		if id != 1 {
+			return sub, coins.ErrNotFound("subscription %d not found", id)
+		}
+		return mustNewSubscription(nil), nil
+	}
+
+	got, err := client.GetSubscription(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, mustNewSubscription(nil), got)
+
+	_, err = client.GetSubscription(context.Background(), 2)
+	assert.Equal(t, coins.ErrNotFound("subscription 2 not found"), err)
+}
+
+func TestTransportDeleteSubscription(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	var gotID uint64
+	svc.onDeleteSubscription = func(ctx context.Context, id uint64) (err error) {
+		gotID = id
+		if id != 1 {
+			return coins.ErrNotFound("subscription %d not found", id)
+		}
+		return nil
+	}
+
+	assert.NoError(t, client.DeleteSubscription(context.Background(), 1))
+	assert.Equal(t, uint64(1), gotID)
+	assert.Equal(t, coins.ErrNotFound("subscription 2 not found"), client.DeleteSubscription(context.Background(), 2))
+}
+
+func TestTransportGetDeliveries(t *testing.T) {
+	server, client, svc := initTransportTest(t)
+	defer server.Close()
+
+	lastAttempt := time.Date(2020, 12, 25, 10, 0, 0, 0, time.UTC)
+	deliveries := []webhook.Delivery{{
+		ID:             2,
+		SubscriptionID: 1,
+		EventID:        7,
+		EventType:      "payment.created",
+		Status:         webhook.Dead,
+		Attempts:       8,
+		LastAttempt:    &lastAttempt,
+		ResponseStatus: http.StatusInternalServerError,
+		LastError:      "webhook returned status 500",
+		CreatedAt:      lastAttempt.Add(-time.Hour),
+	}}
+	svc.onGetDeliveries = func(ctx context.Context, subscriptionID uint64) ([]webhook.Delivery, error) {
+		if subscriptionID != 1 {
+			return nil, coins.ErrNotFound("subscription %d not found", subscriptionID)
+		}
+		return deliveries, nil
+	}
+
+	got, err := client.GetDeliveries(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Equal(t, deliveries, got)
+
+	_, err = client.GetDeliveries(context.Background(), 2)
+	assert.Equal(t, coins.ErrNotFound("subscription 2 not found"), err)
+}
+
+func mustNewSubscription(fn func(s *webhook.Subscription)) webhook.Subscription {
+	s := webhook.Subscription{
+		ID:        1,
+		AccountID: "bob123",
+		URL:       "https://example.com/hooks",
+		CreatedAt: time.Date(2020, 12, 25, 10, 0, 0, 0, time.UTC),
+	}
+	if fn != nil {
+		fn(&s)
+	}
+	return s
+}
+
+func mustNewHold(fn func(h *hold.Hold)) hold.Hold {
+	h := hold.Hold{
+		ID:          1,
+		FromAccount: "bob123",
+		ToAccount:   "alice456",
+		Amount:      decimal.NewFromInt(10),
+		Direction:   payment.Outgoing,
+		Status:      hold.Authorized,
+		CreatedAt:   time.Date(2020, 12, 25, 10, 0, 0, 0, time.UTC),
+		ExpiresAt:   time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC),
+	}
+	if fn != nil {
+		fn(&h)
+	}
+	return h
+}
+
+func mustNewSchedule(fn func(s *schedule.Schedule)) schedule.Schedule {
+	s := schedule.Schedule{
+		ID:          1,
+		FromAccount: "bob123",
+		ToAccount:   "alice456",
+		Amount:      decimal.NewFromInt(10),
+		Direction:   payment.Outgoing,
+		Spec:        "0 9 * * 1",
+		Status:      schedule.Active,
+		NextRun:     time.Date(2020, 12, 28, 9, 0, 0, 0, time.UTC),
+	}
+	if fn != nil {
+		fn(&s)
+	}
+	return s
+}
+
+func mustNewAccount(fn func(a *account.Account)) account.Account {
+	a := account.Account{
+		ID:       "bob123",
+		Balance:  decimal.NewFromInt(100),
+		Currency: "USD",
+	}
+	if fn != nil {
+		fn(&a)
+	}
+	return a
+}
+
+func mustNewPayment(fn func(pi *payment.Payment)) payment.Payment {
+	pi := payment.Payment{
+		ID:          1,
+		FromAccount: "bob123",
+		ToAccount:   "alice456",
+		Amount:      decimal.NewFromInt(100),
+		Direction:   payment.Incomming,
+		Dt:          nil,
+
+		Currency:       "USD",
+		CreditAmount:   decimal.NewFromInt(100),
+		CreditCurrency: "USD",
+		Rate:           decimal.NewFromInt(1),
 	}
 	if fn != nil {
-		fn(pi)
+		fn(&pi)
 	}
 	return pi
 }
-func mustNewPaymentInput(fn func(pi payment.PaymentInput)) payment.PaymentInput {
+func mustNewPaymentInput(fn func(pi *payment.PaymentInput)) payment.PaymentInput {
 	pi := payment.PaymentInput{
 		FromAccount: "bob123",
 		ToAccount:   "alice456",
@@ -176,7 +1390,7 @@ func mustNewPaymentInput(fn func(pi payment.PaymentInput)) payment.PaymentInput
 		Direction:   payment.Incomming,
 	}
 	if fn != nil {
-		fn(pi)
+		fn(&pi)
 	}
 	return pi
 }
@@ -0,0 +1,55 @@
+package currency
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLookup(t *testing.T) {
+	c, err := Lookup("JPY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Currency{Code: "JPY", MinorUnits: 0}, c)
+
+	_, err = Lookup("usd")
+	assert.True(t, errors.Is(err, ErrUnknownCurrency))
+	assert.False(t, Valid("XYZ"))
+}
+
+func TestFits(t *testing.T) {
+	testCases := []struct {
+		code   string
+		amount string
+		want   bool
+	}{
+		{code: "USD", amount: "0.01", want: true},
+		{code: "USD", amount: "10.500", want: true},
+		{code: "USD", amount: "0.001", want: false},
+		{code: "JPY", amount: "100", want: true},
+		{code: "JPY", amount: "0.0001", want: false},
+		{code: "KWD", amount: "1.125", want: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.code+" "+tc.amount, func(t *testing.T) {
+			c, err := Lookup(tc.code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.want, c.Fits(decimal.RequireFromString(tc.amount)))
+		})
+	}
+}
+
+func TestRound(t *testing.T) {
+	usd, _ := Lookup("USD")
+	assert.Equal(t, "1.12", usd.Round(decimal.RequireFromString("1.125")).String())
+	assert.Equal(t, "1.14", usd.Round(decimal.RequireFromString("1.135")).String())
+
+	jpy, _ := Lookup("JPY")
+	assert.Equal(t, "2", jpy.Round(decimal.RequireFromString("2.5")).String())
+}
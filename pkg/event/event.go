@@ -0,0 +1,40 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Type is an event type.
+type Type string
+
+// Payment lifecycle event types.
+const (
+	PaymentCreated  Type = "payment.created"
+	PaymentRefunded Type = "payment.refunded"
+	HoldAuthorized  Type = "hold.authorized"
+	HoldCaptured    Type = "hold.captured"
+	HoldVoided      Type = "hold.voided"
+	HoldExpired     Type = "hold.expired"
+)
+
+// Event is a state change written to the outbox in the transaction of the change.
+// Payload is the JSON of the changed payment or hold.
+type Event struct {
+	ID          uint64          `json:"id" db:"id"`
+	Type        Type            `json:"type" db:"type"`
+	Payload     json.RawMessage `json:"payload" db:"payload"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+	PublishedAt *time.Time      `json:"-" db:"published_at"`
+}
+
+// New creates an event of the given type with v encoded as the payload.
+func New(typ Type, v interface{}) (Event, error) {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return Event{}, fmt.Errorf("failed to encode %s event: %w", typ, err)
+	}
+
+	return Event{Type: typ, Payload: payload}, nil
+}
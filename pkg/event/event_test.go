@@ -0,0 +1,117 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryPublisher(t *testing.T) {
+	p := &MemoryPublisher{Size: 2}
+	for id := uint64(1); id <= 3; id++ {
+		assert.NoError(t, p.Publish(context.Background(), Event{ID: id}))
+	}
+
+	events := p.Events()
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, uint64(2), events[0].ID)
+		assert.Equal(t, uint64(3), events[1].ID)
+	}
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	var got Event
+	var gotType string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotType = r.Header.Get(EventTypeHeader)
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil || got.ID == 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	e, err := New(PaymentCreated, map[string]int{"id": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.ID = 1
+	p := &WebhookPublisher{URL: server.URL}
+
+	assert.NoError(t, p.Publish(context.Background(), e))
+	assert.Equal(t, string(PaymentCreated), gotType)
+	assert.Equal(t, e.ID, got.ID)
+	assert.JSONEq(t, `{"id":1}`, string(got.Payload))
+
+	e.ID = 2
+	assert.Error(t, p.Publish(context.Background(), e))
+}
+
+type mockOutbox struct {
+	events    []Event
+	published []uint64
+}
+
+func (m *mockOutbox) UnpublishedEvents(ctx context.Context, limit int) (events []Event, err error) {
+	for _, e := range m.events {
+		if e.PublishedAt == nil && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (m *mockOutbox) MarkPublished(ctx context.Context, id uint64) (err error) {
+	now := time.Now()
+	for i := range m.events {
+		if m.events[i].ID == id {
+			m.events[i].PublishedAt = &now
+		}
+	}
+	m.published = append(m.published, id)
+	return nil
+}
+
+type failingPublisher struct {
+	failID uint64
+	cancel func()
+}
+
+func (p *failingPublisher) Publish(ctx context.Context, e Event) error {
+	if e.ID == p.failID {
+		p.cancel()
+		return errors.New("publisher is down")
+	}
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	outbox := &mockOutbox{events: []Event{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}}}
+	r := &Relay{
+		Outbox:    outbox,
+		Publisher: &failingPublisher{failID: 3, cancel: cancel},
+		Interval:  time.Hour,
+		BatchSize: 2,
+		Logger:    log.NewNopLogger(),
+	}
+
+	assert.NoError(t, r.Run(ctx))
+	// Events after the failed one are not published to keep the order.
+	assert.Equal(t, []uint64{1, 2}, outbox.published)
+}
+
+func TestMulti(t *testing.T) {
+	first, second := &MemoryPublisher{}, &MemoryPublisher{}
+	p := Multi(first, second)
+
+	assert.NoError(t, p.Publish(context.Background(), Event{ID: 1}))
+	assert.Len(t, first.Events(), 1)
+	assert.Len(t, second.Events(), 1)
+}
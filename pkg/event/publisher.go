@@ -0,0 +1,113 @@
+package event
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Publisher publishes events to downstream consumers.
+type Publisher interface {
+	// Publish publishes the event, an event is published at least once.
+	Publish(ctx context.Context, e Event) error
+}
+
+// MemoryPublisher keeps the last Size published events in memory,
+// it is used in development and tests.
+type MemoryPublisher struct {
+	Size int
+
+	mu     sync.Mutex
+	events []Event
+}
+
+var _ Publisher = (*MemoryPublisher)(nil)
+
+// Publish stores the event dropping the oldest one if the publisher is full.
+func (p *MemoryPublisher) Publish(ctx context.Context, e Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = append(p.events, e)
+	if p.Size > 0 && len(p.events) > p.Size {
+		p.events = p.events[len(p.events)-p.Size:]
+	}
+
+	return nil
+}
+
+// Events returns the stored events in the order of publication.
+func (p *MemoryPublisher) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	events := make([]Event, len(p.events))
+	copy(events, p.events)
+	return events
+}
+
+// Multi returns a publisher publishing every event to all the publishers in turn.
+// An event failed by any publisher is published to all of them again.
+func Multi(publishers ...Publisher) Publisher {
+	return multiPublisher(publishers)
+}
+
+type multiPublisher []Publisher
+
+func (m multiPublisher) Publish(ctx context.Context, e Event) error {
+	for _, p := range m {
+		if err := p.Publish(ctx, e); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Event headers of a webhook request.
+const (
+	EventIDHeader   = "X-Event-ID"
+	EventTypeHeader = "X-Event-Type"
+)
+
+// WebhookPublisher posts every event as JSON to the URL, a non 2xx response fails the publication.
+type WebhookPublisher struct {
+	URL    string
+	Client *http.Client
+}
+
+var _ Publisher = (*WebhookPublisher)(nil)
+
+// Publish posts the event to the webhook URL.
+func (p *WebhookPublisher) Publish(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, strconv.FormatUint(e.ID, 10))
+	req.Header.Set(EventTypeHeader, string(e.Type))
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post event %d: %w", e.ID, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("failed to post event %d: webhook returned status %d", e.ID, resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package event
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// Outbox stores events until they are published.
+type Outbox interface {
+	// UnpublishedEvents returns up to limit unpublished events in the order they were written.
+	UnpublishedEvents(ctx context.Context, limit int) (events []Event, err error)
+	// MarkPublished marks the event as published.
+	MarkPublished(ctx context.Context, id uint64) (err error)
+}
+
+// Relay periodically publishes outbox events in the order they were written.
+// A failed event is retried on the next poll before any later event is published.
+type Relay struct {
+	Outbox    Outbox
+	Publisher Publisher
+	Interval  time.Duration
+	BatchSize int
+	Logger    log.Logger
+}
+
+// Run publishes outbox events every Interval until the context is canceled.
+func (r *Relay) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		r.relay(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// relay publishes all unpublished events.
+func (r *Relay) relay(ctx context.Context) {
+	for ctx.Err() == nil {
+		events, err := r.Outbox.UnpublishedEvents(ctx, r.BatchSize)
+		if err != nil {
+			level.Error(r.Logger).Log("msg", "failed to get unpublished events", "err", err)
+			return
+		}
+		for _, e := range events {
+			if err := r.Publisher.Publish(ctx, e); err != nil {
+				level.Warn(r.Logger).Log("msg", "failed to publish event", "event", e.ID, "type", e.Type, "err", err)
+				return
+			}
+			if err := r.Outbox.MarkPublished(ctx, e.ID); err != nil {
+				level.Error(r.Logger).Log("msg", "failed to mark event published", "event", e.ID, "err", err)
+				return
+			}
+		}
+		if len(events) == 0 || len(events) < r.BatchSize {
+			return
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package feed
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// DefaultBuffer is the default number of payments buffered for a subscriber.
+const DefaultBuffer = 100
+
+// retryDelay is the delay before listening again after the listener failed.
+const retryDelay = time.Second
+
+// Listener listens for committed payments.
+type Listener interface {
+	// ListenPayments calls fn for every committed payment until the context is canceled.
+	// fn is called with nil if payments could be missed, e.g. after a reconnect.
+	ListenPayments(ctx context.Context, fn func(p *payment.Payment)) error
+}
+
+// Subscription receives committed payments from or to the account, or all payments
+// if the account is empty. C is closed when the subscription ends.
+type Subscription struct {
+	C <-chan payment.Payment
+
+	c       chan payment.Payment
+	account string
+}
+
+func (s *Subscription) matches(p payment.Payment) bool {
+	return s.account == "" || p.FromAccount == s.account || p.ToAccount == s.account
+}
+
+// Hub broadcasts committed payments to subscribers. A subscription is closed if it
+// falls behind by more than Buffer payments or payments could be missed, so that
+// its client resumes from the last payment it received.
+type Hub struct {
+	Listener Listener
+	Buffer   int
+	Logger   log.Logger
+
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscribe subscribes to committed payments of the account.
+func (h *Hub) Subscribe(account string) *Subscription {
+	size := h.Buffer
+	if size <= 0 {
+		size = DefaultBuffer
+	}
+	c := make(chan payment.Payment, size)
+	s := &Subscription{C: c, c: c, account: account}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.subs == nil {
+		h.subs = make(map[*Subscription]struct{})
+	}
+	h.subs[s] = struct{}{}
+
+	return s
+}
+
+// Unsubscribe ends the subscription.
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.remove(s)
+}
+
+func (h *Hub) remove(s *Subscription) {
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.c)
+	}
+}
+
+// Publish sends the payment to the matching subscriptions, full subscriptions are closed.
+func (h *Hub) Publish(p payment.Payment) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subs {
+		if !s.matches(p) {
+			continue
+		}
+		select {
+		case s.c <- p:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+// closeAll ends all subscriptions.
+func (h *Hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for s := range h.subs {
+		h.remove(s)
+	}
+}
+
+// Run broadcasts payments received from the listener until the context is canceled.
+// All subscriptions end when the hub stops.
+func (h *Hub) Run(ctx context.Context) error {
+	defer h.closeAll()
+
+	for {
+		err := h.Listener.ListenPayments(ctx, func(p *payment.Payment) {
+			if p == nil {
+				h.closeAll()
+				return
+			}
+			h.Publish(*p)
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		level.Error(h.Logger).Log("msg", "failed to listen for payments", "err", err)
+		h.closeAll()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retryDelay):
+		}
+	}
+}
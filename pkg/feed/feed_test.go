@@ -0,0 +1,91 @@
+package feed
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+type listenerFunc func(ctx context.Context, fn func(p *payment.Payment)) error
+
+func (f listenerFunc) ListenPayments(ctx context.Context, fn func(p *payment.Payment)) error {
+	return f(ctx, fn)
+}
+
+func TestHubPublish(t *testing.T) {
+	h := &Hub{Buffer: 2}
+	all := h.Subscribe("")
+	bob := h.Subscribe("bob123")
+	carol := h.Subscribe("carol789")
+
+	h.Publish(payment.Payment{ID: 1, FromAccount: "bob123", ToAccount: "alice456"})
+	h.Publish(payment.Payment{ID: 2, FromAccount: "alice456", ToAccount: "bob123"})
+
+	assert.Equal(t, uint64(1), (<-all.C).ID)
+	assert.Equal(t, uint64(2), (<-all.C).ID)
+	assert.Equal(t, uint64(1), (<-bob.C).ID)
+	assert.Equal(t, uint64(2), (<-bob.C).ID)
+	assert.Len(t, carol.C, 0)
+
+	h.Unsubscribe(carol)
+	_, ok := <-carol.C
+	assert.False(t, ok)
+	// Unsubscribing twice is safe.
+	h.Unsubscribe(carol)
+}
+
+func TestHubSlowSubscriber(t *testing.T) {
+	h := &Hub{Buffer: 1}
+	s := h.Subscribe("")
+
+	h.Publish(payment.Payment{ID: 1})
+	h.Publish(payment.Payment{ID: 2})
+
+	p, ok := <-s.C
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), p.ID)
+	_, ok = <-s.C
+	assert.False(t, ok, "a subscriber falling behind must be closed")
+}
+
+func TestHubRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	calls := 0
+	h := &Hub{
+		Listener: listenerFunc(func(ctx context.Context, fn func(p *payment.Payment)) error {
+			calls++
+			if calls == 1 {
+				return errors.New("connection refused")
+			}
+			fn(&payment.Payment{ID: 1})
+			fn(nil)
+			<-ctx.Done()
+			return nil
+		}),
+		Logger: log.NewNopLogger(),
+	}
+	s := h.Subscribe("")
+
+	done := make(chan error)
+	go func() {
+		done <- h.Run(ctx)
+	}()
+
+	// The listener failure ends the subscription.
+	select {
+	case _, ok := <-s.C:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("subscription is not closed")
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+}
@@ -0,0 +1,26 @@
+package fx
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// NewFileProvider creates a static rate provider with rates loaded from a JSON file
+// mapping currency pairs to rates, e.g. {"EUR/USD": "1.21"}.
+func NewFileProvider(path string) (*StaticProvider, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rates file: %w", err)
+	}
+	var rates map[string]string
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return nil, fmt.Errorf("failed to decode rates file: %w", err)
+	}
+	parsed, err := ParseRates(rates)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewStaticProvider(parsed)
+}
@@ -0,0 +1,163 @@
+package fx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/donmikel/coins/pkg/currency"
+	"github.com/shopspring/decimal"
+)
+
+// ErrRateNotFound is returned by a RateProvider that has no rate for a currency pair.
+var ErrRateNotFound = errors.New("exchange rate not found")
+
+// RateProvider provides exchange rates.
+type RateProvider interface {
+	// Rate returns the amount of the to currency paid for one unit of the from currency.
+	Rate(ctx context.Context, from, to string) (decimal.Decimal, error)
+}
+
+// Pair is a currency pair in the "EUR/USD" notation.
+type Pair string
+
+// NewPair creates a currency pair.
+func NewPair(from, to string) Pair {
+	return Pair(from + "/" + to)
+}
+
+// Split returns currencies of the pair.
+func (p Pair) Split() (from, to string, err error) {
+	parts := strings.Split(string(p), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid currency pair %q", p)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// StaticProvider is a RateProvider backed by a fixed table of rates.
+// A missing rate is derived from the rate of the inverse pair.
+type StaticProvider struct {
+	rates map[Pair]decimal.Decimal
+}
+
+var _ RateProvider = (*StaticProvider)(nil)
+
+// NewStaticProvider creates a new static rate provider.
+func NewStaticProvider(rates map[Pair]decimal.Decimal) (*StaticProvider, error) {
+	for pair, rate := range rates {
+		if _, _, err := pair.Split(); err != nil {
+			return nil, err
+		}
+		if !rate.IsPositive() {
+			return nil, fmt.Errorf("invalid rate of %s: %s", pair, rate)
+		}
+	}
+
+	return &StaticProvider{rates: rates}, nil
+}
+
+// ParseRates parses rates given as strings, e.g. {"EUR/USD": "1.21"}.
+func ParseRates(rates map[string]string) (map[Pair]decimal.Decimal, error) {
+	parsed := make(map[Pair]decimal.Decimal, len(rates))
+	for pair, value := range rates {
+		rate, err := decimal.NewFromString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate of %s: %w", pair, err)
+		}
+		parsed[Pair(pair)] = rate
+	}
+
+	return parsed, nil
+}
+
+// Rate returns the exchange rate of the currency pair.
+func (p *StaticProvider) Rate(ctx context.Context, from, to string) (decimal.Decimal, error) {
+	if from == to {
+		return decimal.NewFromInt(1), nil
+	}
+	if rate, ok := p.rates[NewPair(from, to)]; ok {
+		return rate, nil
+	}
+	if rate, ok := p.rates[NewPair(to, from)]; ok {
+		return decimal.NewFromInt(1).DivRound(rate, 16), nil
+	}
+
+	return decimal.Decimal{}, fmt.Errorf("%s: %w", NewPair(from, to), ErrRateNotFound)
+}
+
+// Quote is an exchange rate locked until ExpiresAt.
+type Quote struct {
+	ID           string          `json:"id" db:"id"`
+	FromCurrency string          `json:"from_currency" db:"from_currency"`
+	ToCurrency   string          `json:"to_currency" db:"to_currency"`
+	Rate         decimal.Decimal `json:"rate" db:"rate"`
+	ExpiresAt    time.Time       `json:"expires_at" db:"expires_at"`
+}
+
+// QuoteInput is an input structure used to request a quote.
+type QuoteInput struct {
+	FromCurrency string `json:"from_currency"`
+	ToCurrency   string `json:"to_currency"`
+}
+
+// Validate validates the given QuoteInput structure
+func (q QuoteInput) Validate() error {
+	if q.FromCurrency == "" {
+		return errors.New("empty FromCurrency")
+	}
+	if q.ToCurrency == "" {
+		return errors.New("empty ToCurrency")
+	}
+	if q.FromCurrency == q.ToCurrency {
+		return errors.New("same FromCurrency and ToCurrency")
+	}
+	if !currency.Valid(q.FromCurrency) {
+		return errors.New("unknown FromCurrency")
+	}
+	if !currency.Valid(q.ToCurrency) {
+		return errors.New("unknown ToCurrency")
+	}
+
+	return nil
+}
+
+// Quoter issues quotes using rates of the provider.
+type Quoter struct {
+	Provider RateProvider
+	TTL      time.Duration
+}
+
+// Quote returns a new quote for the currency pair.
+func (q *Quoter) Quote(ctx context.Context, input QuoteInput) (Quote, error) {
+	rate, err := q.Provider.Rate(ctx, input.FromCurrency, input.ToCurrency)
+	if err != nil {
+		return Quote{}, err
+	}
+	id, err := newQuoteID()
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return Quote{
+		ID:           id,
+		FromCurrency: input.FromCurrency,
+		ToCurrency:   input.ToCurrency,
+		Rate:         rate,
+		ExpiresAt:    time.Now().Add(q.TTL).UTC(),
+	}, nil
+}
+
+func newQuoteID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate quote id: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
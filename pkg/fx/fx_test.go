@@ -0,0 +1,94 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaticProviderRate(t *testing.T) {
+	p, err := NewStaticProvider(map[Pair]decimal.Decimal{
+		"EUR/USD": decimal.NewFromFloat(1.25),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name     string
+		from, to string
+		want     decimal.Decimal
+		wantErr  error
+	}{
+		{name: "direct", from: "EUR", to: "USD", want: decimal.NewFromFloat(1.25)},
+		{name: "inverse", from: "USD", to: "EUR", want: decimal.NewFromFloat(0.8)},
+		{name: "same currency", from: "USD", to: "USD", want: decimal.NewFromInt(1)},
+		{name: "unknown", from: "USD", to: "JPY", wantErr: ErrRateNotFound},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := p.Rate(context.Background(), tc.from, tc.to)
+			if tc.wantErr != nil {
+				assert.True(t, errors.Is(err, tc.wantErr), "got %v", err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.True(t, tc.want.Equal(got), "got %s", got)
+		})
+	}
+}
+
+func TestNewStaticProviderInvalid(t *testing.T) {
+	_, err := NewStaticProvider(map[Pair]decimal.Decimal{"EURUSD": decimal.NewFromInt(1)})
+	assert.Error(t, err)
+
+	_, err = NewStaticProvider(map[Pair]decimal.Decimal{"EUR/USD": decimal.Zero})
+	assert.Error(t, err)
+}
+
+func TestFileProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rates.json")
+	if err := ioutil.WriteFile(path, []byte(`{"EUR/USD": "1.21"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewFileProvider(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := p.Rate(context.Background(), "EUR", "USD")
+	assert.NoError(t, err)
+	assert.True(t, decimal.NewFromFloat(1.21).Equal(got))
+
+	_, err = NewFileProvider(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestQuoter(t *testing.T) {
+	p, err := NewStaticProvider(map[Pair]decimal.Decimal{"EUR/USD": decimal.NewFromFloat(1.25)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := &Quoter{Provider: p, TTL: time.Minute}
+
+	quote, err := q.Quote(context.Background(), QuoteInput{FromCurrency: "EUR", ToCurrency: "USD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotEmpty(t, quote.ID)
+	assert.True(t, decimal.NewFromFloat(1.25).Equal(quote.Rate))
+	assert.True(t, quote.ExpiresAt.After(time.Now()))
+}
@@ -0,0 +1,132 @@
+package hold
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/shopspring/decimal"
+)
+
+// Status is a hold status.
+type Status string
+
+// Hold statuses. Only an authorized hold reserves funds.
+const (
+	Authorized Status = "authorized"
+	Captured   Status = "captured"
+	Voided     Status = "voided"
+	Expired    Status = "expired"
+)
+
+// DefaultTTL is the default time an authorized hold reserves funds.
+const DefaultTTL = 7 * 24 * time.Hour
+
+// DefaultMaxTTL is the default longest time an authorized hold reserves funds.
+const DefaultMaxTTL = 30 * 24 * time.Hour
+
+// Hold is an authorization reserving funds of the source account for a payment
+// captured later. Held funds reduce the available balance but not the balance of the account.
+type Hold struct {
+	ID          uint64            `json:"id" db:"id"`
+	FromAccount string            `json:"from_account" db:"from_account"`
+	ToAccount   string            `json:"to_account" db:"to_account"`
+	Amount      decimal.Decimal   `json:"amount" db:"amount"`
+	Direction   payment.Direction `json:"direction" db:"direction"`
+	Status      Status            `json:"status" db:"status"`
+	CreatedAt   time.Time         `json:"created_at" db:"created_at"`
+	ExpiresAt   time.Time         `json:"expires_at" db:"expires_at"`
+
+	// PaymentID is the payment of the captured amount.
+	PaymentID *uint64 `json:"payment_id,omitempty" db:"payment_id"`
+}
+
+// AuthorizeInput is an input structure used to authorize a payment.
+type AuthorizeInput struct {
+	FromAccount string            `json:"from_account"`
+	ToAccount   string            `json:"to_account"`
+	Amount      decimal.Decimal   `json:"amount"`
+	Direction   payment.Direction `json:"direction"`
+
+	// ExpiresAt is the time the hold is released unless captured, the service default is used if nil.
+	// It is in the future and no later than the longest time the service reserves funds.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Validate validates the given AuthorizeInput structure
+func (a AuthorizeInput) Validate() error {
+	if a.FromAccount == "" {
+		return errors.New("empty FromAccount")
+	}
+	if a.ToAccount == "" {
+		return errors.New("empty ToAccount")
+	}
+	if !a.Amount.IsPositive() {
+		return errors.New("invalid Amount")
+	}
+	if a.ExpiresAt != nil && a.ExpiresAt.IsZero() {
+		return errors.New("invalid ExpiresAt")
+	}
+
+	return nil
+}
+
+// New creates an authorized hold from the input, the hold expires after ttl unless the input sets the expiration.
+// An expiration in the past or more than maxTTL after now is rejected.
+func New(input AuthorizeInput, now time.Time, ttl, maxTTL time.Duration) (Hold, error) {
+	expiresAt := now.Add(ttl)
+	if input.ExpiresAt != nil {
+		expiresAt = *input.ExpiresAt
+	}
+	if !expiresAt.After(now) {
+		return Hold{}, errors.New("ExpiresAt is in the past")
+	}
+	if expiresAt.After(now.Add(maxTTL)) {
+		return Hold{}, fmt.Errorf("ExpiresAt is more than %s ahead", maxTTL)
+	}
+
+	return Hold{
+		FromAccount: input.FromAccount,
+		ToAccount:   input.ToAccount,
+		Amount:      input.Amount,
+		Direction:   input.Direction,
+		Status:      Authorized,
+		ExpiresAt:   expiresAt.UTC(),
+	}, nil
+}
+
+// CaptureInput is an input structure used to capture a hold. A nil Amount captures
+// the whole hold, the rest of a partially captured hold is released.
+type CaptureInput struct {
+	Amount *decimal.Decimal `json:"amount,omitempty"`
+
+	// QuoteID is an exchange rate quote required to capture a hold between accounts
+	// with different currencies.
+	QuoteID string `json:"quote_id,omitempty"`
+}
+
+// Validate validates the given CaptureInput structure
+func (c CaptureInput) Validate() error {
+	if c.Amount != nil && !c.Amount.IsPositive() {
+		return errors.New("invalid Amount")
+	}
+
+	return nil
+}
+
+// Payment returns the payment of the captured amount.
+func (h Hold) Payment(input CaptureInput) payment.Payment {
+	amount := h.Amount
+	if input.Amount != nil {
+		amount = *input.Amount
+	}
+
+	return payment.Payment{
+		FromAccount: h.FromAccount,
+		ToAccount:   h.ToAccount,
+		Amount:      amount,
+		Direction:   h.Direction,
+		QuoteID:     input.QuoteID,
+	}
+}
@@ -0,0 +1,78 @@
+package hold
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	now := time.Date(2020, 12, 25, 10, 0, 0, 0, time.UTC)
+	input := AuthorizeInput{FromAccount: "bob123", ToAccount: "alice456", Amount: decimal.NewFromInt(10)}
+
+	h, err := New(input, now, time.Hour, DefaultMaxTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Authorized, h.Status)
+	assert.Equal(t, now.Add(time.Hour), h.ExpiresAt)
+
+	past := now.Add(-time.Minute)
+	input.ExpiresAt = &past
+	_, err = New(input, now, time.Hour, DefaultMaxTTL)
+	assert.Error(t, err)
+
+	latest := now.Add(DefaultMaxTTL)
+	input.ExpiresAt = &latest
+	h, err = New(input, now, time.Hour, DefaultMaxTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, latest, h.ExpiresAt)
+
+	tooLate := latest.Add(time.Second)
+	input.ExpiresAt = &tooLate
+	_, err = New(input, now, time.Hour, DefaultMaxTTL)
+	assert.Error(t, err)
+
+	// The default expiration is bounded too.
+	input.ExpiresAt = nil
+	_, err = New(input, now, DefaultMaxTTL+time.Hour, DefaultMaxTTL)
+	assert.Error(t, err)
+}
+
+func TestPayment(t *testing.T) {
+	h := Hold{FromAccount: "bob123", ToAccount: "alice456", Amount: decimal.NewFromInt(10)}
+
+	p := h.Payment(CaptureInput{})
+	assert.True(t, decimal.NewFromInt(10).Equal(p.Amount))
+
+	partial := decimal.NewFromInt(4)
+	p = h.Payment(CaptureInput{Amount: &partial, QuoteID: "quote1"})
+	assert.True(t, partial.Equal(p.Amount))
+	assert.Equal(t, "quote1", p.QuoteID)
+}
+
+type mockExpirer struct {
+	calls  int
+	onCall func()
+}
+
+func (m *mockExpirer) ExpireHolds(ctx context.Context, now time.Time) (n int64, err error) {
+	m.calls++
+	m.onCall()
+	return 1, nil
+}
+
+func TestSweeper(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	expirer := &mockExpirer{onCall: cancel}
+	s := &Sweeper{Expirer: expirer, Interval: time.Hour, Logger: log.NewNopLogger()}
+
+	assert.NoError(t, s.Run(ctx))
+	assert.Equal(t, 1, expirer.calls)
+}
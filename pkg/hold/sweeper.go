@@ -0,0 +1,44 @@
+package hold
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// Expirer releases expired holds.
+type Expirer interface {
+	// ExpireHolds releases authorized holds expired at now and returns the number of released holds.
+	ExpireHolds(ctx context.Context, now time.Time) (n int64, err error)
+}
+
+// Sweeper periodically releases expired holds.
+type Sweeper struct {
+	Expirer  Expirer
+	Interval time.Duration
+	Logger   log.Logger
+}
+
+// Run releases expired holds every Interval until the context is canceled.
+func (s *Sweeper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.Expirer.ExpireHolds(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			level.Error(s.Logger).Log("msg", "failed to expire holds", "err", err)
+		}
+		if n > 0 {
+			level.Info(s.Logger).Log("msg", "expired holds released", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
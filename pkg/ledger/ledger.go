@@ -0,0 +1,96 @@
+package ledger
+
+import (
+	"errors"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// System accounts are ledger-only counterparties that have no row in accounts.
+const (
+	OpeningAccount    = "@opening"
+	AdjustmentAccount = "@adjustment"
+	ExchangeAccount   = "@exchange"
+)
+
+// Posting is a single signed movement of a journal transaction.
+// A positive Amount increases the account balance, a negative one decreases it.
+type Posting struct {
+	AccountID string          `json:"account_id" db:"account_id"`
+	Amount    decimal.Decimal `json:"amount" db:"amount"`
+	Currency  string          `json:"currency" db:"currency"`
+}
+
+// Transaction is a journal transaction made of postings that sum up to zero in every currency.
+type Transaction struct {
+	PaymentID   *uint64
+	Description string
+	Postings    []Posting
+}
+
+// Transfer creates a balanced transaction moving amount from one account to another.
+func Transfer(from, to string, amount decimal.Decimal, currency string) Transaction {
+	return Transaction{
+		Postings: []Posting{
+			{AccountID: from, Amount: amount.Neg(), Currency: currency},
+			{AccountID: to, Amount: amount, Currency: currency},
+		},
+	}
+}
+
+// Exchange creates a balanced transaction debiting amount in one currency and crediting
+// the converted amount in another one. The exchange system account takes both sides.
+func Exchange(from, to string, amount decimal.Decimal, currency string, credit decimal.Decimal, creditCurrency string) Transaction {
+	return Transaction{
+		Postings: []Posting{
+			{AccountID: from, Amount: amount.Neg(), Currency: currency},
+			{AccountID: ExchangeAccount, Amount: amount, Currency: currency},
+			{AccountID: ExchangeAccount, Amount: credit.Neg(), Currency: creditCurrency},
+			{AccountID: to, Amount: credit, Currency: creditCurrency},
+		},
+	}
+}
+
+// Validate validates the given Transaction structure
+func (t Transaction) Validate() error {
+	if len(t.Postings) < 2 {
+		return errors.New("less than two postings")
+	}
+	sums := make(map[string]decimal.Decimal)
+	for _, p := range t.Postings {
+		if p.AccountID == "" {
+			return errors.New("empty AccountID")
+		}
+		if p.Currency == "" {
+			return errors.New("empty Currency")
+		}
+		sums[p.Currency] = sums[p.Currency].Add(p.Amount)
+	}
+	for currency, sum := range sums {
+		if !sum.IsZero() {
+			return errors.New("unbalanced postings in " + currency)
+		}
+	}
+
+	return nil
+}
+
+// Entry is a posting recorded in the ledger of an account.
+type Entry struct {
+	ID          uint64          `json:"id" db:"id"`
+	JournalID   uint64          `json:"journal_id" db:"journal_id"`
+	PaymentID   *uint64         `json:"payment_id,omitempty" db:"payment_id"`
+	AccountID   string          `json:"account_id" db:"account_id"`
+	Amount      decimal.Decimal `json:"amount" db:"amount"`
+	Currency    string          `json:"currency" db:"currency"`
+	Description string          `json:"description" db:"description"`
+	Dt          *time.Time      `json:"dt" db:"dt"`
+}
+
+// Mismatch is an account whose stored balance differs from the sum of its postings.
+type Mismatch struct {
+	AccountID     string          `json:"account_id" db:"account_id"`
+	Balance       decimal.Decimal `json:"balance" db:"balance"`
+	LedgerBalance decimal.Decimal `json:"ledger_balance" db:"ledger_balance"`
+}
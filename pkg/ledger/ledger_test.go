@@ -0,0 +1,57 @@
+package ledger
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransactionValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		tx      Transaction
+		wantErr bool
+	}{
+		{
+			name:    "transfer",
+			tx:      Transfer("bob123", "alice456", decimal.NewFromInt(10), "USD"),
+			wantErr: false,
+		},
+		{
+			name:    "exchange",
+			tx:      Exchange("bob123", "alice456", decimal.NewFromInt(10), "USD", decimal.NewFromInt(8), "EUR"),
+			wantErr: false,
+		},
+		{
+			name: "unbalanced",
+			tx: Transaction{Postings: []Posting{
+				{AccountID: "bob123", Amount: decimal.NewFromInt(-10), Currency: "USD"},
+				{AccountID: "alice456", Amount: decimal.NewFromInt(9), Currency: "USD"},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "balanced across currencies only",
+			tx: Transaction{Postings: []Posting{
+				{AccountID: "bob123", Amount: decimal.NewFromInt(-10), Currency: "USD"},
+				{AccountID: "alice456", Amount: decimal.NewFromInt(10), Currency: "EUR"},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "single posting",
+			tx: Transaction{Postings: []Posting{
+				{AccountID: "bob123", Amount: decimal.Zero, Currency: "USD"},
+			}},
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.tx.Validate()
+			assert.Equal(t, tc.wantErr, err != nil, "got %v", err)
+		})
+	}
+}
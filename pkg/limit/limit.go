@@ -0,0 +1,147 @@
+// Package limit defines transfer limits of accounts. Limits of a currency apply to every
+// account in the currency that has no limits of its own.
+package limit
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// Kind is a kind of transfer limit.
+type Kind string
+
+// Possible kinds of transfer limits.
+const (
+	// MaxPayment limits the amount of a single payment.
+	MaxPayment Kind = "max_payment"
+	// DailyTotal limits the total amount sent during a calendar day.
+	DailyTotal Kind = "daily_total"
+	// MonthlyTotal limits the total amount sent during a calendar month.
+	MonthlyTotal Kind = "monthly_total"
+	// HourlyCount limits the number of payments sent during the last hour.
+	HourlyCount Kind = "hourly_count"
+)
+
+// Scope identifies limits of an account or of a currency, exactly one of the fields is set.
+type Scope struct {
+	AccountID string `json:"account_id,omitempty"`
+	Currency  string `json:"currency,omitempty"`
+}
+
+// Validate validates the given Scope structure
+func (s Scope) Validate() error {
+	if (s.AccountID == "") == (s.Currency == "") {
+		return errors.New("exactly one of AccountID and Currency must be set")
+	}
+
+	return nil
+}
+
+// Limits are transfer limits of an account or of a currency. Amounts are in Currency,
+// a nil limit is not enforced.
+type Limits struct {
+	AccountID    string           `json:"account_id,omitempty" db:"account_id"`
+	Currency     string           `json:"currency" db:"currency"`
+	MaxPayment   *decimal.Decimal `json:"max_payment,omitempty" db:"max_payment"`
+	DailyTotal   *decimal.Decimal `json:"daily_total,omitempty" db:"daily_total"`
+	MonthlyTotal *decimal.Decimal `json:"monthly_total,omitempty" db:"monthly_total"`
+	HourlyCount  *int             `json:"hourly_count,omitempty" db:"hourly_count"`
+	UpdatedBy    string           `json:"updated_by,omitempty" db:"updated_by"`
+}
+
+// Input is an input structure used to set limits. Limits missing in the input are not enforced.
+type Input struct {
+	MaxPayment   *decimal.Decimal `json:"max_payment,omitempty"`
+	DailyTotal   *decimal.Decimal `json:"daily_total,omitempty"`
+	MonthlyTotal *decimal.Decimal `json:"monthly_total,omitempty"`
+	HourlyCount  *int             `json:"hourly_count,omitempty"`
+}
+
+// Validate validates the given Input structure
+func (in Input) Validate() error {
+	for _, l := range []struct {
+		name  string
+		value *decimal.Decimal
+	}{
+		{"MaxPayment", in.MaxPayment},
+		{"DailyTotal", in.DailyTotal},
+		{"MonthlyTotal", in.MonthlyTotal},
+	} {
+		if l.value != nil && l.value.IsNegative() {
+			return fmt.Errorf("invalid %s", l.name)
+		}
+	}
+	if in.HourlyCount != nil && *in.HourlyCount < 0 {
+		return errors.New("invalid HourlyCount")
+	}
+
+	return nil
+}
+
+// Limits returns the limits of the scope requested by the input.
+func (in Input) Limits(s Scope) Limits {
+	return Limits{
+		AccountID:    s.AccountID,
+		Currency:     s.Currency,
+		MaxPayment:   in.MaxPayment,
+		DailyTotal:   in.DailyTotal,
+		MonthlyTotal: in.MonthlyTotal,
+		HourlyCount:  in.HourlyCount,
+	}
+}
+
+// Usage is the outgoing payments of an account counted against its limits.
+type Usage struct {
+	DailyTotal   decimal.Decimal `db:"daily_total"`
+	MonthlyTotal decimal.Decimal `db:"monthly_total"`
+	HourlyCount  int             `db:"hourly_count"`
+}
+
+// Check returns an *ExceededError if a payment of the amount on top of the usage exceeds a limit.
+func (l Limits) Check(amount decimal.Decimal, u Usage) error {
+	if l.MaxPayment != nil && amount.GreaterThan(*l.MaxPayment) {
+		return l.exceeded(MaxPayment, *l.MaxPayment, *l.MaxPayment)
+	}
+	if l.HourlyCount != nil && u.HourlyCount >= *l.HourlyCount {
+		max := decimal.NewFromInt(int64(*l.HourlyCount))
+		return l.exceeded(HourlyCount, max, remaining(max, decimal.NewFromInt(int64(u.HourlyCount))))
+	}
+	if l.DailyTotal != nil && u.DailyTotal.Add(amount).GreaterThan(*l.DailyTotal) {
+		return l.exceeded(DailyTotal, *l.DailyTotal, remaining(*l.DailyTotal, u.DailyTotal))
+	}
+	if l.MonthlyTotal != nil && u.MonthlyTotal.Add(amount).GreaterThan(*l.MonthlyTotal) {
+		return l.exceeded(MonthlyTotal, *l.MonthlyTotal, remaining(*l.MonthlyTotal, u.MonthlyTotal))
+	}
+
+	return nil
+}
+
+func (l Limits) exceeded(kind Kind, max, remaining decimal.Decimal) error {
+	return &ExceededError{Kind: kind, Max: max, Remaining: remaining, Currency: l.Currency}
+}
+
+// remaining returns the part of the limit not used yet, zero if the limit is used up.
+func remaining(max, used decimal.Decimal) decimal.Decimal {
+	if used.GreaterThanOrEqual(max) {
+		return decimal.Zero
+	}
+	return max.Sub(used)
+}
+
+// ExceededError is returned for a payment exceeding a limit. Remaining is the allowance left
+// under the limit: an amount in Currency, or a number of payments for the HourlyCount limit.
+type ExceededError struct {
+	Kind      Kind
+	Max       decimal.Decimal
+	Remaining decimal.Decimal
+	Currency  string
+}
+
+func (e *ExceededError) Error() string {
+	if e.Kind == HourlyCount {
+		return fmt.Sprintf("%s limit of %s payments exceeded, %s remaining", e.Kind, e.Max, e.Remaining)
+	}
+	return fmt.Sprintf("%s limit of %s %s exceeded, %s %s remaining", e.Kind, e.Max, e.Currency, e.Remaining, e.Currency)
+}
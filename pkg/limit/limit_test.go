@@ -0,0 +1,119 @@
+package limit
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitsCheck(t *testing.T) {
+	d := func(v int64) *decimal.Decimal {
+		d := decimal.NewFromInt(v)
+		return &d
+	}
+	n := func(v int) *int { return &v }
+	l := Limits{
+		Currency:     "USD",
+		MaxPayment:   d(100),
+		DailyTotal:   d(300),
+		MonthlyTotal: d(1000),
+		HourlyCount:  n(3),
+	}
+
+	testCases := []struct {
+		name          string
+		limits        Limits
+		amount        int64
+		usage         Usage
+		wantKind      Kind
+		wantRemaining int64
+	}{
+		{
+			name:   "within limits",
+			limits: l,
+			amount: 100,
+			usage:  Usage{DailyTotal: decimal.NewFromInt(200), MonthlyTotal: decimal.NewFromInt(900), HourlyCount: 2},
+		},
+		{
+			name:          "single payment",
+			limits:        l,
+			amount:        101,
+			wantKind:      MaxPayment,
+			wantRemaining: 100,
+		},
+		{
+			name:     "hourly count",
+			limits:   l,
+			amount:   1,
+			usage:    Usage{HourlyCount: 3},
+			wantKind: HourlyCount,
+		},
+		{
+			name:          "daily total",
+			limits:        l,
+			amount:        50,
+			usage:         Usage{DailyTotal: decimal.NewFromInt(260), MonthlyTotal: decimal.NewFromInt(260)},
+			wantKind:      DailyTotal,
+			wantRemaining: 40,
+		},
+		{
+			name:          "monthly total",
+			limits:        l,
+			amount:        50,
+			usage:         Usage{MonthlyTotal: decimal.NewFromInt(970)},
+			wantKind:      MonthlyTotal,
+			wantRemaining: 30,
+		},
+		{
+			name:          "used up limit",
+			limits:        Limits{Currency: "USD", DailyTotal: d(300)},
+			amount:        1,
+			usage:         Usage{DailyTotal: decimal.NewFromInt(350)},
+			wantKind:      DailyTotal,
+			wantRemaining: 0,
+		},
+		{
+			name:   "no limits",
+			limits: Limits{Currency: "USD"},
+			amount: 1000000,
+			usage:  Usage{DailyTotal: decimal.NewFromInt(1000000), HourlyCount: 1000},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.limits.Check(decimal.NewFromInt(tc.amount), tc.usage)
+			if tc.wantKind == "" {
+				assert.NoError(t, err)
+				return
+			}
+			e, ok := err.(*ExceededError)
+			if !ok {
+				t.Fatalf("got %v, want *ExceededError", err)
+			}
+			assert.Equal(t, tc.wantKind, e.Kind)
+			assert.True(t, decimal.NewFromInt(tc.wantRemaining).Equal(e.Remaining), "remaining %s", e.Remaining)
+		})
+	}
+}
+
+func TestExceededError(t *testing.T) {
+	err := &ExceededError{Kind: DailyTotal, Max: decimal.NewFromInt(300), Remaining: decimal.NewFromInt(40), Currency: "USD"}
+	assert.Equal(t, "daily_total limit of 300 USD exceeded, 40 USD remaining", err.Error())
+
+	err = &ExceededError{Kind: HourlyCount, Max: decimal.NewFromInt(3), Remaining: decimal.Zero, Currency: "USD"}
+	assert.Equal(t, "hourly_count limit of 3 payments exceeded, 0 remaining", err.Error())
+}
+
+func TestValidate(t *testing.T) {
+	negative := decimal.NewFromInt(-1)
+	zero := 0
+	assert.NoError(t, Input{HourlyCount: &zero}.Validate())
+	assert.Error(t, Input{DailyTotal: &negative}.Validate())
+
+	assert.NoError(t, Scope{AccountID: "bob123"}.Validate())
+	assert.NoError(t, Scope{Currency: "USD"}.Validate())
+	assert.Error(t, Scope{}.Validate())
+	assert.Error(t, Scope{AccountID: "bob123", Currency: "USD"}.Validate())
+}
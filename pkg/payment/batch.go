@@ -0,0 +1,60 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/shopspring/decimal"
+)
+
+// BatchMode defines how a batch handles failed payments.
+type BatchMode string
+
+// Batch modes.
+const (
+	// Atomic batch sends all payments or none of them.
+	Atomic BatchMode = "atomic"
+	// BestEffort batch sends every payment that succeeds and reports failures per payment.
+	BestEffort BatchMode = "best_effort"
+)
+
+// MaxBatchSize is the maximum number of payments in a batch.
+const MaxBatchSize = 1000
+
+// BatchInput is an input structure used to send a batch of payments.
+type BatchInput struct {
+	Mode     BatchMode      `json:"mode"`
+	Payments []PaymentInput `json:"payments"`
+}
+
+// Validate validates the given BatchInput structure
+func (b BatchInput) Validate() error {
+	if b.Mode != Atomic && b.Mode != BestEffort {
+		return fmt.Errorf("invalid Mode %q", b.Mode)
+	}
+	if len(b.Payments) == 0 {
+		return errors.New("empty Payments")
+	}
+	if len(b.Payments) > MaxBatchSize {
+		return fmt.Errorf("more than %d Payments", MaxBatchSize)
+	}
+
+	return nil
+}
+
+// BatchResult is a result of a batch, Results are in the order of the batch payments.
+type BatchResult struct {
+	Mode    BatchMode   `json:"mode"`
+	Results []BatchItem `json:"results"`
+}
+
+// BatchItem is a result of a single payment of a batch. Status is the HTTP status
+// the payment would get if sent alone, Error is set for failed payments. Limit and
+// Remaining describe the transfer limit exceeded by a failed payment.
+type BatchItem struct {
+	Status    int              `json:"status"`
+	Payment   *Payment         `json:"payment,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	Limit     string           `json:"limit,omitempty"`
+	Remaining *decimal.Decimal `json:"remaining,omitempty"`
+}
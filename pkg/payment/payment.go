@@ -23,6 +23,29 @@ type Payment struct {
 	ToAccount   string          `json:"to_account" db:"to_account"`
 	Direction   Direction       `json:"direction" db:"direction"`
 	Dt          *time.Time      `json:"dt" db:"dt"`
+
+	// Amount is debited in Currency of the source account, CreditAmount is credited
+	// in CreditCurrency of the destination account, CreditAmount = Amount * Rate.
+	Currency       string          `json:"currency" db:"currency"`
+	CreditAmount   decimal.Decimal `json:"credit_amount" db:"credit_amount"`
+	CreditCurrency string          `json:"credit_currency" db:"credit_currency"`
+	Rate           decimal.Decimal `json:"rate" db:"rate"`
+	QuoteID        string          `json:"quote_id,omitempty" db:"quote_id"`
+
+	// RefundOf is the ID of the payment refunded by this payment.
+	RefundOf *uint64 `json:"refund_of,omitempty" db:"refund_of"`
+
+	// InitiatedBy and ApprovedBy are the principals that requested and approved
+	// a payment sent on an approval, both are empty for other payments.
+	InitiatedBy string `json:"initiated_by,omitempty" db:"initiated_by"`
+	ApprovedBy  string `json:"approved_by,omitempty" db:"approved_by"`
+
+	// PendingID is set instead of ID for a payment parked for a review, the payment
+	// is sent once an operator approves it.
+	PendingID *uint64 `json:"pending_id,omitempty" db:"-"`
+
+	// IdempotencyKey identifies retries of the same payment request.
+	IdempotencyKey string `json:"-" db:"-"`
 }
 
 // PaymentInput is an input structure used to create new payment aka send payment.
@@ -31,6 +54,26 @@ type PaymentInput struct {
 	Amount      decimal.Decimal `json:"amount"`
 	ToAccount   string          `json:"to_account"`
 	Direction   Direction       `json:"direction"`
+
+	// QuoteID is an exchange rate quote required to send money between accounts
+	// with different currencies.
+	QuoteID string `json:"quote_id,omitempty"`
+
+	// IdempotencyKey is transferred in the Idempotency-Key header.
+	IdempotencyKey string `json:"-"`
+}
+
+// Payment returns the payment requested by the input.
+func (in PaymentInput) Payment() Payment {
+	return Payment{
+		FromAccount: in.FromAccount,
+		ToAccount:   in.ToAccount,
+		Direction:   in.Direction,
+		Amount:      in.Amount,
+		QuoteID:     in.QuoteID,
+
+		IdempotencyKey: in.IdempotencyKey,
+	}
 }
 
 // Validate validates the given Payment structure
@@ -47,3 +90,63 @@ func (p Payment) Validate() error {
 
 	return nil
 }
+
+// RefundInput is an input structure used to refund a payment. Amount is given
+// in the currency debited by the refunded payment, a nil Amount refunds the rest
+// of the payment that is not refunded yet.
+type RefundInput struct {
+	Amount *decimal.Decimal `json:"amount,omitempty"`
+}
+
+// Validate validates the given RefundInput structure
+func (r RefundInput) Validate() error {
+	if r.Amount != nil && !r.Amount.IsPositive() {
+		return errors.New("invalid Amount")
+	}
+
+	return nil
+}
+
+// Payment history page size limits.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Filter describes a page of the payment history. Payments are ordered by ID,
+// the page starts after the payment with ID equal to Cursor.
+type Filter struct {
+	Account      string
+	Counterparty string
+	Direction    *Direction
+	MinAmount    *decimal.Decimal
+	MaxAmount    *decimal.Decimal
+	From         *time.Time
+	To           *time.Time
+	Cursor       uint64
+	Limit        int
+}
+
+// Validate validates the given Filter structure
+func (f Filter) Validate() error {
+	if f.Counterparty != "" && f.Account == "" {
+		return errors.New("Counterparty requires Account")
+	}
+	if f.MinAmount != nil && f.MaxAmount != nil && f.MinAmount.GreaterThan(*f.MaxAmount) {
+		return errors.New("MinAmount is greater than MaxAmount")
+	}
+	if f.From != nil && f.To != nil && f.From.After(*f.To) {
+		return errors.New("From is after To")
+	}
+	if f.Limit < 0 || f.Limit > MaxLimit {
+		return errors.New("invalid Limit")
+	}
+
+	return nil
+}
+
+// Page is a page of the payment history. NextCursor is zero on the last page.
+type Page struct {
+	Payments   []Payment `json:"payments"`
+	NextCursor uint64    `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,173 @@
+// Package pending defines payments parked until an operator approves or rejects them.
+package pending
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/risk"
+	"github.com/shopspring/decimal"
+)
+
+// Status is a status of a pending payment.
+type Status string
+
+// Possible statuses of pending payments.
+const (
+	// Pending payment waits for a review.
+	Pending Status = "pending"
+	// Approved payment is sent, PaymentID is the ID of the sent payment.
+	Approved Status = "approved"
+	// Rejected payment is not sent.
+	Rejected Status = "rejected"
+	// Expired payment is not sent, since it was not reviewed before ExpiresAt.
+	Expired Status = "expired"
+)
+
+// Payment is a payment request parked for a review. Decisions are the reasons to park it.
+type Payment struct {
+	ID           uint64            `json:"id" db:"id"`
+	FromAccount  string            `json:"from_account" db:"from_account"`
+	ToAccount    string            `json:"to_account" db:"to_account"`
+	Amount       decimal.Decimal   `json:"amount" db:"amount"`
+	Currency     string            `json:"currency" db:"currency"`
+	Direction    payment.Direction `json:"direction" db:"direction"`
+	QuoteID      string            `json:"quote_id,omitempty" db:"quote_id"`
+	Status       Status            `json:"status" db:"status"`
+	Decisions    []risk.Decision   `json:"decisions" db:"-"`
+	CreatedBy    string            `json:"created_by" db:"created_by"`
+	CreatedAt    time.Time         `json:"created_at" db:"created_at"`
+	ExpiresAt    *time.Time        `json:"expires_at,omitempty" db:"expires_at"`
+	ReviewedBy   string            `json:"reviewed_by,omitempty" db:"reviewed_by"`
+	ReviewedAt   *time.Time        `json:"reviewed_at,omitempty" db:"reviewed_at"`
+	ReviewReason string            `json:"review_reason,omitempty" db:"review_reason"`
+	PaymentID    *uint64           `json:"payment_id,omitempty" db:"payment_id"`
+	// RefundOf is the ID of the payment refunded by a pending refund, Amount of a refund is given
+	// in the currency of the refunded payment as in a refund request.
+	RefundOf *uint64 `json:"refund_of,omitempty" db:"refund_of"`
+
+	// IdempotencyKey of the payment request, replays of the request return the pending
+	// payment until it is approved and the sent payment afterwards.
+	IdempotencyKey string `json:"-" db:"-"`
+}
+
+// New returns a pending payment of the payment request parked for the decisions.
+// The payment never expires unless ExpiresAt is set.
+func New(p payment.Payment, decisions []risk.Decision, createdBy string) Payment {
+	return Payment{
+		FromAccount:    p.FromAccount,
+		ToAccount:      p.ToAccount,
+		Amount:         p.Amount,
+		Direction:      p.Direction,
+		QuoteID:        p.QuoteID,
+		Status:         Pending,
+		Decisions:      decisions,
+		CreatedBy:      createdBy,
+		IdempotencyKey: p.IdempotencyKey,
+	}
+}
+
+// RequiresApproval reports whether the payment is parked by the approval threshold rule,
+// such a payment is approved by an authenticated principal other than its creator.
+func (pp Payment) RequiresApproval() bool {
+	for _, d := range pp.Decisions {
+		if d.Rule == risk.ApprovalThresholdRule {
+			return true
+		}
+	}
+	return false
+}
+
+// Payment returns the payment request of the pending payment.
+func (pp Payment) Payment() payment.Payment {
+	return payment.Payment{
+		FromAccount:    pp.FromAccount,
+		ToAccount:      pp.ToAccount,
+		Amount:         pp.Amount,
+		Direction:      pp.Direction,
+		QuoteID:        pp.QuoteID,
+		RefundOf:       pp.RefundOf,
+		IdempotencyKey: pp.IdempotencyKey,
+	}
+}
+
+// NewRefund returns a pending refund of the payment with the given ID parked for the decisions.
+// The refund debits the from account, a zero amount refunds the rest of the payment that is
+// not refunded when the refund is parked.
+func NewRefund(id uint64, from, to string, amount decimal.Decimal, decisions []risk.Decision, createdBy string) Payment {
+	return Payment{
+		FromAccount: from,
+		ToAccount:   to,
+		Amount:      amount,
+		Status:      Pending,
+		Decisions:   decisions,
+		CreatedBy:   createdBy,
+		RefundOf:    &id,
+	}
+}
+
+// Parked returns the payment request of the pending payment as it is returned to the sender.
+func (pp Payment) Parked() payment.Payment {
+	p := pp.Payment()
+	p.Currency = pp.Currency
+	p.PendingID = &pp.ID
+	return p
+}
+
+// Review is an approval or a rejection of a pending payment by the By principal.
+// A payment is never approved by the principal that created it.
+type Review struct {
+	By     string
+	Reason string
+}
+
+// ReviewInput is an input structure used to approve or reject a pending payment.
+type ReviewInput struct {
+	Reason string `json:"reason"`
+}
+
+// Validate validates the given ReviewInput structure
+func (in ReviewInput) Validate() error {
+	if in.Reason == "" {
+		return errors.New("empty Reason")
+	}
+
+	return nil
+}
+
+// Pending payments page size limits.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// Filter describes a page of pending payments. Payments are ordered by ID,
+// the page starts after the payment with ID equal to Cursor.
+type Filter struct {
+	Status  Status
+	Account string
+	Cursor  uint64
+	Limit   int
+}
+
+// Validate validates the given Filter structure
+func (f Filter) Validate() error {
+	switch f.Status {
+	case "", Pending, Approved, Rejected, Expired:
+	default:
+		return fmt.Errorf("invalid Status %q", f.Status)
+	}
+	if f.Limit < 0 || f.Limit > MaxLimit {
+		return errors.New("invalid Limit")
+	}
+
+	return nil
+}
+
+// Page is a page of pending payments. NextCursor is zero on the last page.
+type Page struct {
+	Payments   []Payment `json:"payments"`
+	NextCursor uint64    `json:"next_cursor,omitempty"`
+}
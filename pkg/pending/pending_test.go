@@ -0,0 +1,76 @@
+package pending
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/risk"
+	"github.com/go-kit/kit/log"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaymentRoundTrip(t *testing.T) {
+	p := payment.Payment{
+		FromAccount:    "bob123",
+		ToAccount:      "alice456",
+		Amount:         decimal.NewFromInt(1500),
+		Direction:      payment.Incomming,
+		QuoteID:        "q-1",
+		IdempotencyKey: "key-1",
+	}
+	decisions := []risk.Decision{{Rule: "new_counterparty", Outcome: risk.Review, Reason: "first payment"}}
+
+	pp := New(p, decisions, "bob")
+	assert.Equal(t, Pending, pp.Status)
+	assert.Equal(t, "bob", pp.CreatedBy)
+	assert.Equal(t, p, pp.Payment())
+
+	pp.ID, pp.Currency = 7, "USD"
+	parked := pp.Parked()
+	assert.Equal(t, "USD", parked.Currency)
+	if assert.NotNil(t, parked.PendingID) {
+		assert.Equal(t, uint64(7), *parked.PendingID)
+	}
+	assert.Zero(t, parked.ID)
+	assert.False(t, pp.RequiresApproval())
+
+	pp.Decisions = append(pp.Decisions, risk.Decision{Rule: risk.ApprovalThresholdRule, Outcome: risk.Review})
+	assert.True(t, pp.RequiresApproval())
+}
+
+func TestFilterValidate(t *testing.T) {
+	assert.NoError(t, Filter{}.Validate())
+	assert.NoError(t, Filter{Status: Rejected, Limit: MaxLimit}.Validate())
+	assert.NoError(t, Filter{Status: Expired}.Validate())
+	assert.Error(t, Filter{Status: "parked"}.Validate())
+	assert.Error(t, Filter{Limit: MaxLimit + 1}.Validate())
+	assert.Error(t, Filter{Limit: -1}.Validate())
+}
+
+func TestReviewInputValidate(t *testing.T) {
+	assert.NoError(t, ReviewInput{Reason: "known supplier"}.Validate())
+	assert.Error(t, ReviewInput{}.Validate())
+}
+
+type mockExpirer struct {
+	calls  int
+	onCall func()
+}
+
+func (m *mockExpirer) ExpirePendingPayments(ctx context.Context, now time.Time) (n int64, err error) {
+	m.calls++
+	m.onCall()
+	return 1, nil
+}
+
+func TestSweeper(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	expirer := &mockExpirer{onCall: cancel}
+	s := &Sweeper{Expirer: expirer, Interval: time.Hour, Logger: log.NewNopLogger()}
+
+	assert.NoError(t, s.Run(ctx))
+	assert.Equal(t, 1, expirer.calls)
+}
@@ -0,0 +1,44 @@
+package pending
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// Expirer expires pending payments.
+type Expirer interface {
+	// ExpirePendingPayments expires pending payments expired at now and returns the number of expired payments.
+	ExpirePendingPayments(ctx context.Context, now time.Time) (n int64, err error)
+}
+
+// Sweeper periodically expires pending payments not reviewed in time.
+type Sweeper struct {
+	Expirer  Expirer
+	Interval time.Duration
+	Logger   log.Logger
+}
+
+// Run expires pending payments every Interval until the context is canceled.
+func (s *Sweeper) Run(ctx context.Context) error {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.Expirer.ExpirePendingPayments(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			level.Error(s.Logger).Log("msg", "failed to expire pending payments", "err", err)
+		}
+		if n > 0 {
+			level.Info(s.Logger).Log("msg", "pending payments expired", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Package risk assesses payments before they are sent. Every rule of an engine decides
+// to allow, review or deny a payment, the most severe outcome applies.
+package risk
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/donmikel/coins/pkg/payment"
+)
+
+// Outcome is an outcome of a payment assessment.
+type Outcome string
+
+// Possible outcomes, ordered by severity.
+const (
+	// Allow sends the payment.
+	Allow Outcome = "allow"
+	// Review parks the payment until an operator approves it.
+	Review Outcome = "review"
+	// Deny rejects the payment.
+	Deny Outcome = "deny"
+)
+
+func (o Outcome) severity() int {
+	switch o {
+	case Review:
+		return 1
+	case Deny:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// Valid reports whether the outcome is known.
+func (o Outcome) Valid() bool {
+	return o == Allow || o == Review || o == Deny
+}
+
+// Decision is an outcome of a rule for a payment with the reason of the outcome.
+type Decision struct {
+	Rule    string  `json:"rule"`
+	Outcome Outcome `json:"outcome"`
+	Reason  string  `json:"reason"`
+}
+
+// History is the history of payments available to rules.
+type History interface {
+	// CountPayments returns the number of payments sent from an account to another one since the time,
+	// all of them if the time is zero.
+	CountPayments(ctx context.Context, from, to string, since time.Time) (n int, err error)
+}
+
+// Rule is a risk rule. Evaluate returns an Allow decision for a payment the rule does not object to.
+type Rule interface {
+	Name() string
+	Evaluate(ctx context.Context, p payment.Payment, h History) (d Decision, err error)
+}
+
+// Assessment is an outcome of all rules for a payment. Decisions are the decisions of rules
+// that do not allow the payment.
+type Assessment struct {
+	Outcome   Outcome
+	Decisions []Decision
+}
+
+// String returns the reasons of the assessment.
+func (a Assessment) String() string {
+	reasons := make([]string, 0, len(a.Decisions))
+	for _, d := range a.Decisions {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", d.Rule, d.Reason))
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// Engine evaluates rules against the payment history.
+type Engine struct {
+	Rules   []Rule
+	History History
+}
+
+// Assess evaluates every rule for the payment.
+func (e *Engine) Assess(ctx context.Context, p payment.Payment) (a Assessment, err error) {
+	a.Outcome = Allow
+	for _, r := range e.Rules {
+		d, err := r.Evaluate(ctx, p, e.History)
+		if err != nil {
+			return a, fmt.Errorf("rule %s: %w", r.Name(), err)
+		}
+		if d.Outcome.severity() == 0 {
+			continue
+		}
+		d.Rule = r.Name()
+		a.Decisions = append(a.Decisions, d)
+		if d.Outcome.severity() > a.Outcome.severity() {
+			a.Outcome = d.Outcome
+		}
+	}
+
+	return a, nil
+}
+
+// Allowed assesses a payment that can not be parked, such as a scheduled payment,
+// and returns an error with the reasons unless the rules allow it.
+func (e *Engine) Allowed(ctx context.Context, p payment.Payment) error {
+	a, err := e.Assess(ctx, p)
+	if err != nil {
+		return err
+	}
+	if a.Outcome != Allow {
+		return fmt.Errorf("payment requires %s by risk rules: %s", a.Outcome, a)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+type sentPayment struct {
+	from, to string
+	at       time.Time
+}
+
+type memoryHistory []sentPayment
+
+func (h memoryHistory) CountPayments(ctx context.Context, from, to string, since time.Time) (n int, err error) {
+	for _, p := range h {
+		if p.from == from && p.to == to && !p.at.Before(since) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+type failingHistory struct{}
+
+func (failingHistory) CountPayments(ctx context.Context, from, to string, since time.Time) (int, error) {
+	return 0, errors.New("connection refused")
+}
+
+func newPayment(amount int64) payment.Payment {
+	return payment.Payment{FromAccount: "bob123", ToAccount: "alice456", Amount: decimal.NewFromInt(amount)}
+}
+
+func TestNewCounterparty(t *testing.T) {
+	r := &NewCounterparty{Amount: decimal.NewFromInt(1000)}
+	ctx := context.Background()
+
+	d, err := r.Evaluate(ctx, newPayment(1000), memoryHistory{})
+	assert.NoError(t, err)
+	assert.Equal(t, Review, d.Outcome)
+
+	d, err = r.Evaluate(ctx, newPayment(999), memoryHistory{})
+	assert.NoError(t, err)
+	assert.Equal(t, Allow, d.Outcome)
+
+	d, err = r.Evaluate(ctx, newPayment(5000), memoryHistory{{from: "bob123", to: "alice456"}})
+	assert.NoError(t, err)
+	assert.Equal(t, Allow, d.Outcome)
+
+	r.Outcome = Deny
+	d, err = r.Evaluate(ctx, newPayment(5000), memoryHistory{{from: "alice456", to: "bob123"}})
+	assert.NoError(t, err)
+	assert.Equal(t, Deny, d.Outcome)
+}
+
+func TestRoundTrip(t *testing.T) {
+	now := time.Date(2020, 12, 25, 12, 0, 0, 0, time.UTC)
+	r := &RoundTrip{Window: time.Hour, Now: func() time.Time { return now }}
+	ctx := context.Background()
+
+	d, err := r.Evaluate(ctx, newPayment(10), memoryHistory{{from: "alice456", to: "bob123", at: now.Add(-30 * time.Minute)}})
+	assert.NoError(t, err)
+	assert.Equal(t, Review, d.Outcome)
+	assert.Equal(t, "alice456 paid bob123 1 times during the last 1h0m0s", d.Reason)
+
+	d, err = r.Evaluate(ctx, newPayment(10), memoryHistory{{from: "alice456", to: "bob123", at: now.Add(-2 * time.Hour)}})
+	assert.NoError(t, err)
+	assert.Equal(t, Allow, d.Outcome)
+
+	d, err = r.Evaluate(ctx, newPayment(10), memoryHistory{{from: "bob123", to: "alice456", at: now}})
+	assert.NoError(t, err)
+	assert.Equal(t, Allow, d.Outcome)
+}
+
+func TestUnusualHour(t *testing.T) {
+	at := func(hour int) func() time.Time {
+		return func() time.Time { return time.Date(2020, 12, 25, hour, 30, 0, 0, time.UTC) }
+	}
+	testCases := []struct {
+		name     string
+		from, to int
+		hour     int
+		want     Outcome
+	}{
+		{name: "within hours", from: 1, to: 5, hour: 3, want: Review},
+		{name: "first hour", from: 1, to: 5, hour: 1, want: Review},
+		{name: "last hour is excluded", from: 1, to: 5, hour: 5, want: Allow},
+		{name: "wrapped hours before midnight", from: 22, to: 6, hour: 23, want: Review},
+		{name: "wrapped hours after midnight", from: 22, to: 6, hour: 2, want: Review},
+		{name: "outside wrapped hours", from: 22, to: 6, hour: 12, want: Allow},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &UnusualHour{From: tc.from, To: tc.to, Now: at(tc.hour)}
+			d, err := r.Evaluate(context.Background(), newPayment(10), memoryHistory{})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, d.Outcome)
+		})
+	}
+}
+
+func TestEngineAssess(t *testing.T) {
+	now := time.Date(2020, 12, 25, 3, 0, 0, 0, time.UTC)
+	e := &Engine{
+		Rules: []Rule{
+			&NewCounterparty{Amount: decimal.NewFromInt(1000)},
+			&RoundTrip{Window: time.Hour, Outcome: Deny, Now: func() time.Time { return now }},
+			&UnusualHour{From: 1, To: 5, Now: func() time.Time { return now }},
+		},
+		History: memoryHistory{{from: "bob123", to: "alice456", at: now.Add(-time.Minute)}},
+	}
+	ctx := context.Background()
+
+	a, err := e.Assess(ctx, newPayment(10))
+	assert.NoError(t, err)
+	assert.Equal(t, Review, a.Outcome)
+	if assert.Len(t, a.Decisions, 1) {
+		assert.Equal(t, "unusual_hour", a.Decisions[0].Rule)
+	}
+
+	// The most severe outcome applies.
+	a, err = e.Assess(ctx, payment.Payment{FromAccount: "alice456", ToAccount: "bob123", Amount: decimal.NewFromInt(5000)})
+	assert.NoError(t, err)
+	assert.Equal(t, Deny, a.Outcome)
+	assert.Len(t, a.Decisions, 3)
+	assert.Contains(t, a.String(), "round_trip: bob123 paid alice456 1 times")
+
+	a, err = (&Engine{}).Assess(ctx, newPayment(10))
+	assert.NoError(t, err)
+	assert.Equal(t, Assessment{Outcome: Allow}, a)
+
+	e.History = failingHistory{}
+	_, err = e.Assess(ctx, newPayment(5000))
+	assert.Error(t, err)
+}
+
+func TestEngineAllowed(t *testing.T) {
+	e := &Engine{Rules: []Rule{&NewCounterparty{Amount: decimal.NewFromInt(1000)}}, History: memoryHistory{}}
+	ctx := context.Background()
+
+	assert.NoError(t, e.Allowed(ctx, newPayment(999)))
+	err := e.Allowed(ctx, newPayment(1000))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "new_counterparty")
+	}
+
+	e.History = failingHistory{}
+	assert.Error(t, e.Allowed(ctx, newPayment(1000)))
+}
+
+func TestParseHours(t *testing.T) {
+	from, to, err := ParseHours("22-6")
+	assert.NoError(t, err)
+	assert.Equal(t, 22, from)
+	assert.Equal(t, 6, to)
+
+	for _, s := range []string{"", "1", "5-5", "25-3", "night"} {
+		_, _, err := ParseHours(s)
+		assert.Error(t, err, s)
+	}
+}
+
+type accountCurrencies map[string]string
+
+func (a accountCurrencies) GetAccount(ctx context.Context, id string) (account.Account, error) {
+	c, ok := a[id]
+	if !ok {
+		return account.Account{}, coins.ErrNotFoundInStorage
+	}
+	return account.Account{ID: id, Currency: c}, nil
+}
+
+func TestApprovalThreshold(t *testing.T) {
+	r := &ApprovalThreshold{
+		Amounts:  map[string]decimal.Decimal{"USD": decimal.NewFromInt(10000)},
+		Accounts: accountCurrencies{"bob123": "USD", "carol789": "EUR"},
+	}
+	ctx := context.Background()
+
+	d, err := r.Evaluate(ctx, newPayment(10001), memoryHistory{})
+	assert.NoError(t, err)
+	assert.Equal(t, Review, d.Outcome)
+	assert.Equal(t, "10001 USD is above the approval threshold of 10000 USD", d.Reason)
+
+	d, err = r.Evaluate(ctx, newPayment(10000), memoryHistory{})
+	assert.NoError(t, err)
+	assert.Equal(t, Allow, d.Outcome)
+
+	p := newPayment(50000)
+	p.FromAccount = "carol789"
+	d, err = r.Evaluate(ctx, p, memoryHistory{})
+	assert.NoError(t, err)
+	assert.Equal(t, Allow, d.Outcome)
+
+	p.FromAccount = "dave000"
+	d, err = r.Evaluate(ctx, p, memoryHistory{})
+	assert.NoError(t, err)
+	assert.Equal(t, Allow, d.Outcome)
+}
+
+func TestParseThresholds(t *testing.T) {
+	got, err := ParseThresholds(map[string]string{"USD": "10000", "EUR": "9000.50"})
+	assert.NoError(t, err)
+	assert.True(t, decimal.NewFromInt(10000).Equal(got["USD"]))
+	assert.True(t, decimal.New(900050, -2).Equal(got["EUR"]))
+
+	for _, amounts := range []map[string]string{{"XXY": "1"}, {"USD": "lots"}, {"USD": "-1"}} {
+		_, err := ParseThresholds(amounts)
+		assert.Error(t, err, amounts)
+	}
+}
@@ -0,0 +1,200 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/currency"
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/shopspring/decimal"
+)
+
+// outcomeOrReview returns the outcome of a matched rule, Review by default.
+func outcomeOrReview(o Outcome) Outcome {
+	if o == "" {
+		return Review
+	}
+	return o
+}
+
+func now(clock func() time.Time) time.Time {
+	if clock == nil {
+		return time.Now()
+	}
+	return clock()
+}
+
+// NewCounterparty matches payments of at least Amount to an account the source account
+// has never paid before. Amount is in the currency of the source account.
+type NewCounterparty struct {
+	Amount  decimal.Decimal
+	Outcome Outcome
+}
+
+// Name returns the name of the rule.
+func (r *NewCounterparty) Name() string {
+	return "new_counterparty"
+}
+
+// Evaluate evaluates the rule for the payment.
+func (r *NewCounterparty) Evaluate(ctx context.Context, p payment.Payment, h History) (d Decision, err error) {
+	if p.Amount.LessThan(r.Amount) {
+		return Decision{Outcome: Allow}, nil
+	}
+	n, err := h.CountPayments(ctx, p.FromAccount, p.ToAccount, time.Time{})
+	if err != nil {
+		return d, err
+	}
+	if n > 0 {
+		return Decision{Outcome: Allow}, nil
+	}
+
+	return Decision{
+		Outcome: outcomeOrReview(r.Outcome),
+		Reason:  fmt.Sprintf("first payment to %s is %s, at least %s", p.ToAccount, p.Amount, r.Amount),
+	}, nil
+}
+
+// RoundTrip matches payments returning money to an account that paid the source account
+// during the last Window.
+type RoundTrip struct {
+	Window  time.Duration
+	Outcome Outcome
+	Now     func() time.Time
+}
+
+// Name returns the name of the rule.
+func (r *RoundTrip) Name() string {
+	return "round_trip"
+}
+
+// Evaluate evaluates the rule for the payment.
+func (r *RoundTrip) Evaluate(ctx context.Context, p payment.Payment, h History) (d Decision, err error) {
+	n, err := h.CountPayments(ctx, p.ToAccount, p.FromAccount, now(r.Now).Add(-r.Window))
+	if err != nil {
+		return d, err
+	}
+	if n == 0 {
+		return Decision{Outcome: Allow}, nil
+	}
+
+	return Decision{
+		Outcome: outcomeOrReview(r.Outcome),
+		Reason:  fmt.Sprintf("%s paid %s %d times during the last %s", p.ToAccount, p.FromAccount, n, r.Window),
+	}, nil
+}
+
+// UnusualHour matches payments sent from the From hour up to the To hour of the day in Location,
+// the hours wrap around midnight if From is after To.
+type UnusualHour struct {
+	From     int
+	To       int
+	Location *time.Location
+	Outcome  Outcome
+	Now      func() time.Time
+}
+
+// Name returns the name of the rule.
+func (r *UnusualHour) Name() string {
+	return "unusual_hour"
+}
+
+// Evaluate evaluates the rule for the payment.
+func (r *UnusualHour) Evaluate(ctx context.Context, p payment.Payment, h History) (d Decision, err error) {
+	loc := r.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t := now(r.Now).In(loc)
+	hour := t.Hour()
+	unusual := hour >= r.From && hour < r.To
+	if r.From > r.To {
+		unusual = hour >= r.From || hour < r.To
+	}
+	if !unusual {
+		return Decision{Outcome: Allow}, nil
+	}
+
+	return Decision{
+		Outcome: outcomeOrReview(r.Outcome),
+		Reason:  fmt.Sprintf("sent at %s, between %02d:00 and %02d:00", t.Format("15:04 MST"), r.From, r.To),
+	}, nil
+}
+
+// Accounts returns accounts of payments.
+type Accounts interface {
+	GetAccount(ctx context.Context, id string) (acc account.Account, err error)
+}
+
+// ApprovalThresholdRule is the name of the ApprovalThreshold rule.
+const ApprovalThresholdRule = "approval_threshold"
+
+// ApprovalThreshold matches payments of more than the amount set for the currency of the source
+// account, such payments are always parked for an approval by a second principal. Payments in
+// currencies without an amount are allowed.
+type ApprovalThreshold struct {
+	Amounts  map[string]decimal.Decimal
+	Accounts Accounts
+}
+
+// Name returns the name of the rule.
+func (r *ApprovalThreshold) Name() string {
+	return ApprovalThresholdRule
+}
+
+// Evaluate evaluates the rule for the payment.
+func (r *ApprovalThreshold) Evaluate(ctx context.Context, p payment.Payment, h History) (d Decision, err error) {
+	acc, err := r.Accounts.GetAccount(ctx, p.FromAccount)
+	if errors.Is(err, coins.ErrNotFoundInStorage) {
+		// The payment fails when it is sent.
+		return Decision{Outcome: Allow}, nil
+	}
+	if err != nil {
+		return d, err
+	}
+	max, ok := r.Amounts[acc.Currency]
+	if !ok || !p.Amount.GreaterThan(max) {
+		return Decision{Outcome: Allow}, nil
+	}
+
+	return Decision{
+		Outcome: Review,
+		Reason:  fmt.Sprintf("%s %s is above the approval threshold of %s %s", p.Amount, acc.Currency, max, acc.Currency),
+	}, nil
+}
+
+// ParseThresholds parses approval thresholds given as amounts by currency codes.
+func ParseThresholds(amounts map[string]string) (map[string]decimal.Decimal, error) {
+	parsed := make(map[string]decimal.Decimal, len(amounts))
+	for code, value := range amounts {
+		if !currency.Valid(code) {
+			return nil, fmt.Errorf("unknown currency %q", code)
+		}
+		amount, err := decimal.NewFromString(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid threshold of %s: %w", code, err)
+		}
+		if amount.IsNegative() {
+			return nil, fmt.Errorf("invalid threshold of %s: negative amount", code)
+		}
+		parsed[code] = amount
+	}
+
+	return parsed, nil
+}
+
+// ParseHours parses hours of the day given as "from-to", e.g. "1-5" or "22-6".
+func ParseHours(s string) (from, to int, err error) {
+	if _, err := fmt.Sscanf(s, "%d-%d", &from, &to); err != nil {
+		return 0, 0, fmt.Errorf("invalid hours %q: %v", s, err)
+	}
+	if from < 0 || from > 23 || to < 0 || to > 24 || from == to {
+		return 0, 0, fmt.Errorf("invalid hours %q", s)
+	}
+
+	return from, to, nil
+}
@@ -0,0 +1,162 @@
+package schedule
+
+import (
+	"errors"
+	"time"
+
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/shopspring/decimal"
+)
+
+// Status is a schedule status.
+type Status string
+
+// Schedule statuses.
+const (
+	Active    Status = "active"
+	Cancelled Status = "cancelled"
+)
+
+// Schedule is a payment sent repeatedly according to Spec.
+type Schedule struct {
+	ID          uint64            `json:"id" db:"id"`
+	FromAccount string            `json:"from_account" db:"from_account"`
+	ToAccount   string            `json:"to_account" db:"to_account"`
+	Amount      decimal.Decimal   `json:"amount" db:"amount"`
+	Direction   payment.Direction `json:"direction" db:"direction"`
+	Spec        string            `json:"schedule" db:"spec"`
+	Status      Status            `json:"status" db:"status"`
+
+	// NextRun is the next scheduled run, a failed run is retried at RetryAt.
+	NextRun  time.Time  `json:"next_run" db:"next_run"`
+	RetryAt  *time.Time `json:"retry_at,omitempty" db:"retry_at"`
+	Attempts int        `json:"attempts" db:"attempts"`
+
+	// Last run result, LastError is empty if the last run sent a payment.
+	LastRun       *time.Time `json:"last_run,omitempty" db:"last_run"`
+	LastPaymentID *uint64    `json:"last_payment_id,omitempty" db:"last_payment_id"`
+	LastError     string     `json:"last_error,omitempty" db:"last_error"`
+}
+
+// ScheduleInput is an input structure used to create a schedule. The first run is at StartAt
+// if it is set, otherwise at the first time matching the schedule.
+type ScheduleInput struct {
+	FromAccount string            `json:"from_account"`
+	ToAccount   string            `json:"to_account"`
+	Amount      decimal.Decimal   `json:"amount"`
+	Direction   payment.Direction `json:"direction"`
+	Spec        string            `json:"schedule"`
+	StartAt     *time.Time        `json:"start_at,omitempty"`
+}
+
+// Validate validates the given ScheduleInput structure
+func (s ScheduleInput) Validate() error {
+	if s.FromAccount == "" {
+		return errors.New("empty FromAccount")
+	}
+	if s.ToAccount == "" {
+		return errors.New("empty ToAccount")
+	}
+	if s.FromAccount == s.ToAccount {
+		return errors.New("same FromAccount and ToAccount")
+	}
+	if !s.Amount.IsPositive() {
+		return errors.New("invalid Amount")
+	}
+	if _, err := Parse(s.Spec); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// New creates an active schedule from the input.
+func New(input ScheduleInput, now time.Time) (Schedule, error) {
+	spec, err := Parse(input.Spec)
+	if err != nil {
+		return Schedule{}, err
+	}
+	next := spec.Next(now)
+	if input.StartAt != nil {
+		next = *input.StartAt
+	}
+	if next.IsZero() {
+		return Schedule{}, errors.New("schedule never runs")
+	}
+
+	return Schedule{
+		FromAccount: input.FromAccount,
+		ToAccount:   input.ToAccount,
+		Amount:      input.Amount,
+		Direction:   input.Direction,
+		Spec:        input.Spec,
+		Status:      Active,
+		NextRun:     next.UTC(),
+	}, nil
+}
+
+// Payment returns the payment sent by a run of the schedule.
+func (s Schedule) Payment() payment.Payment {
+	return payment.Payment{
+		FromAccount: s.FromAccount,
+		ToAccount:   s.ToAccount,
+		Amount:      s.Amount,
+		Direction:   s.Direction,
+	}
+}
+
+// Retry is a retry policy of failed runs. A run is retried up to MaxAttempts times in total
+// with the Delay doubled after every attempt, then the run is skipped.
+type Retry struct {
+	MaxAttempts int
+	Delay       time.Duration
+}
+
+// Complete returns the schedule updated with the result of a run at now: either the sent payment
+// or the error the payment failed with.
+func (s Schedule) Complete(now time.Time, p payment.Payment, runErr error, retry Retry) Schedule {
+	now = now.UTC()
+	s.LastRun = &now
+	if runErr == nil {
+		s.LastPaymentID = &p.ID
+		s.LastError = ""
+	} else {
+		s.LastPaymentID = nil
+		s.LastError = runErr.Error()
+		s.Attempts++
+		if s.Attempts < retry.MaxAttempts {
+			retryAt := now.Add(retry.Delay << uint(s.Attempts-1))
+			s.RetryAt = &retryAt
+			return s
+		}
+	}
+
+	s.Attempts = 0
+	s.RetryAt = nil
+	s.NextRun = s.next(now)
+	if s.NextRun.IsZero() {
+		s.Status = Cancelled
+	}
+	return s
+}
+
+// next returns the first run time after now following the current run,
+// runs missed while the service was down are skipped.
+func (s Schedule) next(now time.Time) time.Time {
+	spec, err := Parse(s.Spec)
+	if err != nil {
+		return time.Time{}
+	}
+	next := spec.Next(s.NextRun)
+	if !next.IsZero() && !next.After(now) {
+		if _, ok := spec.(interval); ok {
+			// Keep the interval phase instead of realigning to now.
+			for !next.IsZero() && !next.After(now) {
+				next = spec.Next(next)
+			}
+		} else {
+			next = spec.Next(now)
+		}
+	}
+	return next
+}
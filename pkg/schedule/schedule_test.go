@@ -0,0 +1,116 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/go-kit/kit/log"
+	"github.com/shopspring/decimal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	from := time.Date(2020, 12, 25, 10, 30, 0, 0, time.UTC) // Friday
+
+	testCases := []struct {
+		spec    string
+		want    time.Time
+		wantErr bool
+	}{
+		{spec: "@every 168h", want: from.Add(168 * time.Hour)},
+		{spec: "@daily", want: time.Date(2020, 12, 26, 0, 0, 0, 0, time.UTC)},
+		{spec: "@monthly", want: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 9 * * 1", want: time.Date(2020, 12, 28, 9, 0, 0, 0, time.UTC)},
+		{spec: "*/15 * * * *", want: time.Date(2020, 12, 25, 10, 45, 0, 0, time.UTC)},
+		{spec: "0 12 1,15 * *", want: time.Date(2021, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{spec: "0 0 * * 7", want: time.Date(2020, 12, 27, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 31 2 *", want: time.Time{}},
+		{spec: "@every 1s", wantErr: true},
+		{spec: "0 25 * * *", wantErr: true},
+		{spec: "* * *", wantErr: true},
+		{spec: "", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			spec, err := Parse(tc.spec)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tc.want, spec.Next(from))
+		})
+	}
+}
+
+func TestComplete(t *testing.T) {
+	now := time.Date(2020, 12, 25, 10, 0, 30, 0, time.UTC)
+	retry := Retry{MaxAttempts: 3, Delay: time.Minute}
+	s := Schedule{ID: 1, Spec: "@every 1h", Status: Active, NextRun: time.Date(2020, 12, 25, 10, 0, 0, 0, time.UTC)}
+
+	ok := s.Complete(now, payment.Payment{ID: 7}, nil, retry)
+	assert.Equal(t, time.Date(2020, 12, 25, 11, 0, 0, 0, time.UTC), ok.NextRun)
+	assert.Equal(t, uint64(7), *ok.LastPaymentID)
+	assert.Empty(t, ok.LastError)
+
+	failed := s.Complete(now, payment.Payment{}, errors.New("insufficient funds"), retry)
+	assert.Equal(t, s.NextRun, failed.NextRun)
+	assert.Equal(t, now.Add(time.Minute), *failed.RetryAt)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, "insufficient funds", failed.LastError)
+
+	failed = failed.Complete(now, payment.Payment{}, errors.New("insufficient funds"), retry)
+	assert.Equal(t, now.Add(2*time.Minute), *failed.RetryAt)
+
+	skipped := failed.Complete(now.Add(5*time.Hour), payment.Payment{}, errors.New("insufficient funds"), retry)
+	assert.Nil(t, skipped.RetryAt)
+	assert.Equal(t, 0, skipped.Attempts)
+	assert.Equal(t, time.Date(2020, 12, 25, 16, 0, 0, 0, time.UTC), skipped.NextRun)
+	assert.Equal(t, "insufficient funds", skipped.LastError)
+}
+
+func TestNew(t *testing.T) {
+	now := time.Date(2020, 12, 25, 10, 30, 0, 0, time.UTC)
+	input := ScheduleInput{FromAccount: "bob123", ToAccount: "alice456", Amount: decimal.NewFromInt(10), Spec: "@daily"}
+	assert.NoError(t, input.Validate())
+
+	s, err := New(input, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Active, s.Status)
+	assert.Equal(t, time.Date(2020, 12, 26, 0, 0, 0, 0, time.UTC), s.NextRun)
+
+	input.Spec = "0 0 31 2 *"
+	_, err = New(input, now)
+	assert.Error(t, err)
+}
+
+type mockRunner struct {
+	due    []Schedule
+	onIdle func()
+}
+
+func (m *mockRunner) RunDueSchedule(ctx context.Context, now time.Time, retry Retry, check Check) (s Schedule, ok bool, err error) {
+	if len(m.due) == 0 {
+		m.onIdle()
+		return s, false, nil
+	}
+	s, m.due = m.due[0], m.due[1:]
+	return s, true, nil
+}
+
+func TestWorkerRunsAllDue(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	runner := &mockRunner{due: []Schedule{{ID: 1}, {ID: 2, LastError: "insufficient funds"}}, onIdle: cancel}
+	w := &Worker{Runner: runner, Interval: time.Hour, Logger: log.NewNopLogger()}
+
+	assert.NoError(t, w.Run(ctx))
+	assert.Empty(t, runner.due)
+}
@@ -0,0 +1,64 @@
+package schedule
+
+import (
+	"context"
+	"time"
+
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// Check checks the payment of a schedule before it is sent, a run of a payment that fails
+// the check is not sent and fails with the error of the check.
+type Check func(ctx context.Context, p payment.Payment) error
+
+// Runner executes due schedules.
+type Runner interface {
+	// RunDueSchedule sends the payment of the earliest schedule due at now and stores
+	// the run result. It returns false if no schedule is due. A nil check sends every payment.
+	RunDueSchedule(ctx context.Context, now time.Time, retry Retry, check Check) (s Schedule, ok bool, err error)
+}
+
+// Worker periodically runs due schedules.
+type Worker struct {
+	Runner   Runner
+	Interval time.Duration
+	Retry    Retry
+	Check    Check
+	Logger   log.Logger
+}
+
+// Run runs due schedules every Interval until the context is canceled.
+func (w *Worker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.runDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDue runs all schedules due now.
+func (w *Worker) runDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		s, ok, err := w.Runner.RunDueSchedule(ctx, time.Now(), w.Retry, w.Check)
+		if err != nil {
+			level.Error(w.Logger).Log("msg", "failed to run schedule", "err", err)
+			return
+		}
+		if !ok {
+			return
+		}
+		if s.LastError != "" {
+			level.Warn(w.Logger).Log("msg", "scheduled payment failed", "schedule", s.ID,
+				"attempts", s.Attempts, "err", s.LastError)
+		}
+	}
+}
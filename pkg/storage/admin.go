@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/currency"
+	"github.com/donmikel/coins/pkg/hold"
+	"github.com/donmikel/coins/pkg/ledger"
+	"github.com/donmikel/coins/pkg/pending"
+	"github.com/donmikel/coins/pkg/schedule"
+	"github.com/jmoiron/sqlx"
+)
+
+// changeColumns is a list of account_changes table columns scanned into account.Change.
+const changeColumns = `id, account_id, type, status, amount, reason, actor, created_at`
+
+// SetAccountStatus function changes the status of an open account to the status of the change
+// and records the change. If from statuses are given, the account must have one of them.
+func (s *Storage) SetAccountStatus(ctx context.Context, change account.Change, from ...account.Status) (acc account.Account, err error) {
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		old, err := lockOpenAccount(ctx, tx, change.AccountID)
+		if err != nil {
+			return err
+		}
+		if !old.Status.CanTransition(change.Status) || (len(from) > 0 && !hasStatus(old.Status, from)) {
+			return fmt.Errorf("account %s is %s, not changed to %s: %w", old.ID, old.Status, change.Status, coins.ErrInvalidTransition)
+		}
+		if change.Status == account.Closed {
+			if err = checkClosable(ctx, tx, old); err != nil {
+				return err
+			}
+		}
+
+		err = tx.GetContext(ctx, &acc, `update accounts set status = $2 where id = $1
+			returning `+accountColumns, old.ID, change.Status)
+		if err != nil {
+			return fmt.Errorf("failed to change account status: %w", err)
+		}
+
+		return addChange(ctx, tx, change)
+	})
+
+	return acc, err
+}
+
+// checkClosable returns ErrAccountInUse unless the locked account is empty and has no active schedules,
+// authorized holds or pending payments. New ones wait for the lock, so they see the closed account.
+func checkClosable(ctx context.Context, tx *sqlx.Tx, acc account.Account) error {
+	if !acc.Empty() {
+		return fmt.Errorf("account %s has balance %s and %s held: %w", acc.ID, acc.Balance, acc.Held, coins.ErrAccountInUse)
+	}
+
+	var obligations struct {
+		Schedules int `db:"schedules"`
+		Holds     int `db:"holds"`
+		Pending   int `db:"pending"`
+	}
+	err := tx.GetContext(ctx, &obligations, `select
+		(select count(*) from schedules where status = $2 and (from_account = $1 or to_account = $1)) as schedules,
+		(select count(*) from holds where status = $3 and (from_account = $1 or to_account = $1)) as holds,
+		(select count(*) from pending_payments where status = $4 and (from_account = $1 or to_account = $1)) as pending`,
+		acc.ID, schedule.Active, hold.Authorized, pending.Pending)
+	if err != nil {
+		return fmt.Errorf("failed to get account obligations: %w", err)
+	}
+	if obligations.Schedules > 0 || obligations.Holds > 0 || obligations.Pending > 0 {
+		return fmt.Errorf("account %s has %d active schedules, %d authorized holds and %d pending payments: %w",
+			acc.ID, obligations.Schedules, obligations.Holds, obligations.Pending, coins.ErrAccountInUse)
+	}
+
+	return nil
+}
+
+func hasStatus(s account.Status, statuses []account.Status) bool {
+	for _, status := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// AdjustBalance function adds the change amount to the balance of an open account,
+// posts the adjustment to the ledger and records the change.
+func (s *Storage) AdjustBalance(ctx context.Context, change account.Change) (acc account.Account, err error) {
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		old, err := lockOpenAccount(ctx, tx, change.AccountID)
+		if err != nil {
+			return err
+		}
+		amount := *change.Amount
+		c, err := currency.Lookup(old.Currency)
+		if err != nil {
+			return fmt.Errorf("account %s: %w", old.ID, err)
+		}
+		if !c.Fits(amount) {
+			return fmt.Errorf("%s %s: %w", amount, old.Currency, coins.ErrInvalidAmount)
+		}
+		if old.Available().Add(amount).IsNegative() {
+			return fmt.Errorf("account %s: %w", old.ID, coins.ErrInsufficientFunds)
+		}
+
+		err = tx.GetContext(ctx, &acc, `update accounts set balance = balance + $2 where id = $1
+			returning `+accountColumns, old.ID, amount)
+		if err != nil {
+			return fmt.Errorf("failed to adjust balance: %w", err)
+		}
+
+		t := ledger.Transfer(ledger.AdjustmentAccount, acc.ID, amount, acc.Currency)
+		t.Description = "manual adjustment: " + change.Reason
+		if err := postTransaction(ctx, tx, t); err != nil {
+			return err
+		}
+
+		return addChange(ctx, tx, change)
+	})
+
+	return acc, err
+}
+
+// GetAccountChanges function returns changes of the account in the order they were made
+func (s *Storage) GetAccountChanges(ctx context.Context, id string) (changes []account.Change, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return nil, err
+	}
+
+	changes = make([]account.Change, 0)
+	err = conn.SelectContext(ctx, &changes, `select `+changeColumns+` from account_changes
+		where account_id = $1 order by id`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get account changes: %w", err)
+	}
+
+	return changes, nil
+}
+
+// lockOpenAccount locks an open account for update.
+func lockOpenAccount(ctx context.Context, tx *sqlx.Tx, id string) (acc account.Account, err error) {
+	accounts, err := lockAccounts(ctx, tx, id)
+	if err != nil {
+		return acc, err
+	}
+	acc, ok := accounts[id]
+	if !ok || acc.Status == account.Closed {
+		return acc, fmt.Errorf("account %s: %w", id, coins.ErrNotFoundInStorage)
+	}
+
+	return acc, nil
+}
+
+func addChange(ctx context.Context, tx *sqlx.Tx, change account.Change) error {
+	_, err := tx.ExecContext(ctx, `insert into account_changes (account_id, type, status, amount, reason, actor)
+		values ($1, $2, $3, $4, $5, $6)`, change.AccountID, change.Type, change.Status, change.Amount, change.Reason, change.Actor)
+	if err != nil {
+		return fmt.Errorf("failed to record account change: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donmikel/coins/pkg/audit"
+	"github.com/jmoiron/sqlx"
+)
+
+// auditColumns is a list of audit_log table columns scanned into audit.Record.
+const auditColumns = `id, principal, request_id, client_ip, method, input, outcome, error, created_at, prev_hash, hash`
+
+// AppendAuditRecord function appends the record to the hash chain of the audit log.
+// Appends are serialized by a table lock, so every record follows the last appended one.
+func (s *Storage) AppendAuditRecord(ctx context.Context, r audit.Record) (appended audit.Record, err error) {
+	if len(r.Input) == 0 {
+		r.Input = []byte("null")
+	}
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		// Reads are not blocked by the exclusive mode.
+		if _, err := tx.ExecContext(ctx, `lock table audit_log in exclusive mode`); err != nil {
+			return fmt.Errorf("failed to lock audit log: %w", err)
+		}
+		err := tx.GetContext(ctx, &r.PrevHash, `select hash from audit_log order by id desc limit 1`)
+		if errors.Is(err, sql.ErrNoRows) {
+			r.PrevHash = ""
+		} else if err != nil {
+			return fmt.Errorf("failed to get last audit record: %w", err)
+		}
+		if err := tx.GetContext(ctx, &r.ID, `select nextval('audit_log_id_seq')`); err != nil {
+			return fmt.Errorf("failed to get audit record id: %w", err)
+		}
+		// Postgres keeps microseconds, the hash must cover the stored time.
+		r.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+		r.Hash = r.ComputeHash()
+
+		_, err = tx.ExecContext(ctx, `insert into audit_log (`+auditColumns+`)
+			values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`,
+			r.ID, r.Principal, r.RequestID, r.ClientIP, r.Method, string(r.Input), r.Outcome, r.Error,
+			r.CreatedAt, r.PrevHash, r.Hash)
+		if err != nil {
+			return fmt.Errorf("failed to append audit record: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return appended, err
+	}
+
+	return r, nil
+}
+
+// GetAuditRecords function returns a page of audit records matching the filter
+func (s *Storage) GetAuditRecords(ctx context.Context, f audit.Filter) (page audit.Page, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return page, err
+	}
+
+	limit := f.Limit
+	if limit == 0 {
+		limit = audit.DefaultLimit
+	}
+
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	where := []string{"id > " + arg(f.Cursor)}
+	if f.Principal != "" {
+		where = append(where, "principal = "+arg(f.Principal))
+	}
+	if f.Method != "" {
+		where = append(where, "method = "+arg(f.Method))
+	}
+	if f.RequestID != "" {
+		where = append(where, "request_id = "+arg(f.RequestID))
+	}
+	if f.From != nil {
+		where = append(where, "created_at >= "+arg(*f.From))
+	}
+	if f.To != nil {
+		where = append(where, "created_at < "+arg(*f.To))
+	}
+
+	page.Records = make([]audit.Record, 0, limit+1)
+	err = conn.SelectContext(ctx, &page.Records, `select `+auditColumns+` from audit_log
+		where `+strings.Join(where, " and ")+`
+		order by id
+		limit `+arg(limit+1), args...)
+	if err != nil {
+		return page, fmt.Errorf("failed to get audit records: %w", err)
+	}
+	if len(page.Records) > limit {
+		page.Records = page.Records[:limit]
+		page.NextCursor = page.Records[limit-1].ID
+	}
+
+	return page, nil
+}
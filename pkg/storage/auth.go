@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/donmikel/coins/pkg/auth"
+	"github.com/donmikel/coins/pkg/coins"
+)
+
+// CreateAPIKey function stores an API key hash of the principal.
+func (s *Storage) CreateAPIKey(ctx context.Context, hash string, p auth.Principal) (err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, `insert into api_keys (key_hash, principal, role) values ($1, $2, $3)`, hash, p.ID, p.Role)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("api key: %w", coins.ErrAlreadyExistsInStorage)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return nil
+}
+
+// GetAPIKey function returns the principal of the active API key with the given hash
+func (s *Storage) GetAPIKey(ctx context.Context, hash string) (p auth.Principal, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return p, err
+	}
+
+	err = conn.QueryRowxContext(ctx, `select principal, role from api_keys
+		where key_hash = $1 and revoked_at is null`, hash).Scan(&p.ID, &p.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, fmt.Errorf("api key: %w", coins.ErrNotFoundInStorage)
+	}
+	if err != nil {
+		return p, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/jmoiron/sqlx"
+)
+
+// SendPayments function sends a batch of payments in a single transaction. An atomic batch
+// is rolled back if any payment fails. A best effort batch rolls back only the failed payments,
+// their errors are returned in errs at the index of the payment.
+func (s *Storage) SendPayments(ctx context.Context, payments []payment.Payment, mode payment.BatchMode) (created []payment.Payment, errs []error, err error) {
+	created = make([]payment.Payment, len(payments))
+	errs = make([]error, len(payments))
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		// All accounts of the batch are locked upfront in ID order,
+		// so concurrent batches with overlapping accounts cannot deadlock.
+		ids := make([]string, 0, 2*len(payments))
+		for _, p := range payments {
+			ids = append(ids, p.FromAccount, p.ToAccount)
+		}
+		if _, err := lockAccounts(ctx, tx, ids...); err != nil {
+			return err
+		}
+
+		for i, p := range payments {
+			if mode == payment.Atomic {
+				created[i], err = sendPayment(ctx, tx, p)
+				if err != nil {
+					return fmt.Errorf("payment %d: %w", i, err)
+				}
+				continue
+			}
+			errs[i] = inSavepoint(ctx, tx, "send_payment", func() error {
+				var err error
+				created[i], err = sendPayment(ctx, tx, p)
+				return err
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return created, errs, nil
+}
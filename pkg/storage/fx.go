@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/fx"
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateQuote function stores an exchange rate quote
+func (s *Storage) CreateQuote(ctx context.Context, q fx.Quote) (err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, `insert into fx_quotes (id, from_currency, to_currency, rate, expires_at) values ($1, $2, $3, $4, $5)`,
+		q.ID, q.FromCurrency, q.ToCurrency, q.Rate, q.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create quote: %w", err)
+	}
+
+	return nil
+}
+
+// useQuote locks an unused and unexpired quote and marks it as used, so a quote pays for a single payment.
+func useQuote(ctx context.Context, tx *sqlx.Tx, id string) (q fx.Quote, err error) {
+	var row struct {
+		fx.Quote
+		Used bool `db:"used"`
+	}
+	err = tx.GetContext(ctx, &row, `select id, from_currency, to_currency, rate, expires_at, used from fx_quotes where id = $1 for update`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return q, fmt.Errorf("quote %s not found: %w", id, coins.ErrInvalidQuote)
+	}
+	if err != nil {
+		return q, fmt.Errorf("failed to get quote: %w", err)
+	}
+	if row.Used {
+		return q, fmt.Errorf("quote %s already used: %w", id, coins.ErrInvalidQuote)
+	}
+	if !time.Now().Before(row.ExpiresAt) {
+		return q, fmt.Errorf("quote %s: %w", id, coins.ErrQuoteExpired)
+	}
+
+	_, err = tx.ExecContext(ctx, `update fx_quotes set used = true where id = $1`, id)
+	if err != nil {
+		return q, fmt.Errorf("failed to use quote: %w", err)
+	}
+
+	return row.Quote, nil
+}
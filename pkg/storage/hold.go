@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/currency"
+	"github.com/donmikel/coins/pkg/event"
+	"github.com/donmikel/coins/pkg/hold"
+	"github.com/jmoiron/sqlx"
+)
+
+// holdColumns is a list of holds table columns scanned into hold.Hold.
+const holdColumns = `id, from_account, to_account, amount, direction, status, created_at, expires_at, payment_id`
+
+// AuthorizeHold function reserves the hold amount on the source account and stores the hold.
+// The hold amount is checked against the limits of the source account as a payment would be.
+// A hold expiring before it is stored is rejected, the longest hold is bounded by the service.
+func (s *Storage) AuthorizeHold(ctx context.Context, h hold.Hold) (created hold.Hold, err error) {
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if h.FromAccount == h.ToAccount {
+			return fmt.Errorf("account %s: %w", h.FromAccount, coins.ErrSameAccount)
+		}
+		if !h.ExpiresAt.After(time.Now()) {
+			return fmt.Errorf("hold expires at %s: %w", h.ExpiresAt, coins.ErrHoldExpiration)
+		}
+		accounts, err := lockAccounts(ctx, tx, h.FromAccount, h.ToAccount)
+		if err != nil {
+			return err
+		}
+		from, _, err := paymentAccounts(accounts, h.FromAccount, h.ToAccount)
+		if err != nil {
+			return err
+		}
+		c, err := currency.Lookup(from.Currency)
+		if err != nil {
+			return fmt.Errorf("account %s: %w", h.FromAccount, err)
+		}
+		if !c.Fits(h.Amount) {
+			return fmt.Errorf("%s %s: %w", h.Amount, from.Currency, coins.ErrInvalidAmount)
+		}
+		if from.Available().LessThan(h.Amount) {
+			return fmt.Errorf("account %s: %w", h.FromAccount, coins.ErrInsufficientFunds)
+		}
+		if err = checkLimits(ctx, tx, h.Payment(hold.CaptureInput{}), from); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `update accounts set held = held + $2 where id = $1`, h.FromAccount, h.Amount)
+		if err != nil {
+			return fmt.Errorf("failed to hold funds: %w", err)
+		}
+		err = tx.GetContext(ctx, &created, `insert into holds (from_account, to_account, amount, direction, status, expires_at)
+			values ($1, $2, $3, $4, $5, $6)
+			returning `+holdColumns,
+			h.FromAccount, h.ToAccount, h.Amount, h.Direction, h.Status, h.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to insert hold: %w", err)
+		}
+
+		return addEvent(ctx, tx, event.HoldAuthorized, created)
+	})
+
+	return created, err
+}
+
+// GetHold function returns the hold with the given ID
+func (s *Storage) GetHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return h, err
+	}
+
+	err = conn.GetContext(ctx, &h, `select `+holdColumns+` from holds where id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return h, fmt.Errorf("hold %d: %w", id, coins.ErrNotFoundInStorage)
+	}
+	if err != nil {
+		return h, fmt.Errorf("failed to get hold: %w", err)
+	}
+
+	return h, nil
+}
+
+// CaptureHold function releases the hold and sends the payment of the captured amount.
+// The rest of a partially captured hold is released as well.
+func (s *Storage) CaptureHold(ctx context.Context, id uint64, input hold.CaptureInput) (h hold.Hold, err error) {
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		h, err = releaseHold(ctx, tx, id, hold.Captured)
+		if err != nil {
+			return err
+		}
+		p := h.Payment(input)
+		if p.Amount.GreaterThan(h.Amount) {
+			return fmt.Errorf("hold %d of %s: %w", id, h.Amount, coins.ErrCaptureExceeded)
+		}
+
+		created, err := sendPayment(ctx, tx, p)
+		if err != nil {
+			return err
+		}
+		h.PaymentID = &created.ID
+		_, err = tx.ExecContext(ctx, `update holds set payment_id = $2 where id = $1`, id, created.ID)
+		if err != nil {
+			return fmt.Errorf("failed to update hold: %w", err)
+		}
+
+		return addEvent(ctx, tx, event.HoldCaptured, h)
+	})
+
+	return h, err
+}
+
+// VoidHold function releases the hold without payment.
+func (s *Storage) VoidHold(ctx context.Context, id uint64) (h hold.Hold, err error) {
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		h, err = releaseHold(ctx, tx, id, hold.Voided)
+		if err != nil {
+			return err
+		}
+
+		return addEvent(ctx, tx, event.HoldVoided, h)
+	})
+
+	return h, err
+}
+
+// releaseHold locks an authorized unexpired hold, returns its amount to the available
+// balance of the source account and sets the final status of the hold.
+func releaseHold(ctx context.Context, tx *sqlx.Tx, id uint64, status hold.Status) (h hold.Hold, err error) {
+	err = tx.GetContext(ctx, &h, `select `+holdColumns+` from holds where id = $1 for update`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return h, fmt.Errorf("hold %d: %w", id, coins.ErrNotFoundInStorage)
+	}
+	if err != nil {
+		return h, fmt.Errorf("failed to get hold: %w", err)
+	}
+	if h.Status != hold.Authorized {
+		return h, fmt.Errorf("hold %d is %s: %w", id, h.Status, coins.ErrHoldFinalized)
+	}
+	if !time.Now().Before(h.ExpiresAt) {
+		return h, fmt.Errorf("hold %d expired: %w", id, coins.ErrHoldFinalized)
+	}
+
+	// Both accounts are locked in ID order as in payments, so a capture cannot deadlock with them.
+	if _, err = lockAccounts(ctx, tx, h.FromAccount, h.ToAccount); err != nil {
+		return h, err
+	}
+	_, err = tx.ExecContext(ctx, `update accounts set held = held - $2 where id = $1`, h.FromAccount, h.Amount)
+	if err != nil {
+		return h, fmt.Errorf("failed to release funds: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `update holds set status = $2 where id = $1`, id, status)
+	if err != nil {
+		return h, fmt.Errorf("failed to update hold: %w", err)
+	}
+	h.Status = status
+
+	return h, nil
+}
+
+// ExpireHolds function releases authorized holds expired at now and returns the number of released holds.
+func (s *Storage) ExpireHolds(ctx context.Context, now time.Time) (n int64, err error) {
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		var expired []hold.Hold
+		err := tx.SelectContext(ctx, &expired, `select `+holdColumns+` from holds
+			where status = $1 and expires_at <= $2
+			order by id
+			for update skip locked`, hold.Authorized, now)
+		if err != nil {
+			return fmt.Errorf("failed to get expired holds: %w", err)
+		}
+
+		ids := make([]string, 0, len(expired))
+		for _, h := range expired {
+			ids = append(ids, h.FromAccount)
+		}
+		if _, err = lockAccounts(ctx, tx, ids...); err != nil {
+			return err
+		}
+		for _, h := range expired {
+			_, err = tx.ExecContext(ctx, `update accounts set held = held - $2 where id = $1`, h.FromAccount, h.Amount)
+			if err != nil {
+				return fmt.Errorf("failed to release funds: %w", err)
+			}
+			_, err = tx.ExecContext(ctx, `update holds set status = $2 where id = $1`, h.ID, hold.Expired)
+			if err != nil {
+				return fmt.Errorf("failed to update hold: %w", err)
+			}
+			h.Status = hold.Expired
+			if err = addEvent(ctx, tx, event.HoldExpired, h); err != nil {
+				return err
+			}
+		}
+		n = int64(len(expired))
+
+		return nil
+	})
+
+	return n, err
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/donmikel/coins/pkg/ledger"
+	"github.com/jmoiron/sqlx"
+)
+
+// postTransaction writes a balanced journal transaction and its postings.
+func postTransaction(ctx context.Context, tx *sqlx.Tx, t ledger.Transaction) error {
+	if err := t.Validate(); err != nil {
+		return fmt.Errorf("invalid journal transaction: %w", err)
+	}
+
+	var journalID uint64
+	err := tx.GetContext(ctx, &journalID, `insert into journal (payment_id, description) values ($1, $2) returning id`,
+		t.PaymentID, t.Description)
+	if err != nil {
+		return fmt.Errorf("failed to insert journal transaction: %w", err)
+	}
+	for _, p := range t.Postings {
+		_, err = tx.ExecContext(ctx, `insert into postings (journal_id, account_id, amount, currency) values ($1, $2, $3, $4)`,
+			journalID, p.AccountID, p.Amount, p.Currency)
+		if err != nil {
+			return fmt.Errorf("failed to insert posting: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// GetLedgerEntries function returns all ledger entries of the account ordered by posting time
+func (s *Storage) GetLedgerEntries(ctx context.Context, accountID string) (entries []ledger.Entry, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return nil, err
+	}
+
+	entries = make([]ledger.Entry, 0)
+	err = conn.SelectContext(ctx, &entries, `select p.id, p.journal_id, j.payment_id, p.account_id, p.amount, p.currency, j.description, j.dt
+		from postings as p join journal as j on j.id = p.journal_id
+		where p.account_id = $1
+		order by p.id`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ledger entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// VerifyLedger function returns accounts whose balance is not equal to the sum of their postings
+func (s *Storage) VerifyLedger(ctx context.Context) (mismatches []ledger.Mismatch, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return nil, err
+	}
+
+	mismatches = make([]ledger.Mismatch, 0)
+	err = conn.SelectContext(ctx, &mismatches, `select a.id as account_id, a.balance, coalesce(sum(p.amount), 0) as ledger_balance
+		from accounts as a left join postings as p on p.account_id = a.id
+		group by a.id, a.balance
+		having a.balance <> coalesce(sum(p.amount), 0)
+		order by a.id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify ledger: %w", err)
+	}
+
+	return mismatches, nil
+}
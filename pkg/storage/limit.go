@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/currency"
+	"github.com/donmikel/coins/pkg/hold"
+	"github.com/donmikel/coins/pkg/limit"
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+)
+
+// limitColumns is a list of transfer_limits table columns scanned into limit.Limits.
+const limitColumns = `account_id, currency, max_payment, daily_total, monthly_total, hourly_count, updated_by`
+
+// GetLimits function returns the limits of a currency, or the limits enforced for an account:
+// its own limits or the limits of its currency. Limits are empty if none are set.
+func (s *Storage) GetLimits(ctx context.Context, scope limit.Scope) (l limit.Limits, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return l, err
+	}
+
+	if scope.AccountID == "" {
+		return currencyLimits(ctx, conn, scope.Currency)
+	}
+	acc, err := s.GetAccount(ctx, scope.AccountID)
+	if err != nil {
+		return l, err
+	}
+	if acc.Status == account.Closed {
+		return l, fmt.Errorf("account %s: %w", acc.ID, coins.ErrNotFoundInStorage)
+	}
+
+	return accountLimits(ctx, conn, acc)
+}
+
+// SetLimits function replaces the limits of the account or the currency of the given limits.
+// Limits of an account are in the currency of the account.
+func (s *Storage) SetLimits(ctx context.Context, l limit.Limits) (set limit.Limits, err error) {
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if l.AccountID != "" {
+			acc, err := lockOpenAccount(ctx, tx, l.AccountID)
+			if err != nil {
+				return err
+			}
+			l.Currency = acc.Currency
+		}
+		c, err := currency.Lookup(l.Currency)
+		if err != nil {
+			return err
+		}
+		for _, amount := range []*decimal.Decimal{l.MaxPayment, l.DailyTotal, l.MonthlyTotal} {
+			if amount != nil && !c.Fits(*amount) {
+				return fmt.Errorf("%s %s: %w", amount, l.Currency, coins.ErrInvalidAmount)
+			}
+		}
+
+		err = tx.GetContext(ctx, &set, `insert into transfer_limits
+			(account_id, currency, max_payment, daily_total, monthly_total, hourly_count, updated_by)
+			values ($1, $2, $3, $4, $5, $6, $7)
+			on conflict (currency, account_id) do update set
+				max_payment = excluded.max_payment, daily_total = excluded.daily_total,
+				monthly_total = excluded.monthly_total, hourly_count = excluded.hourly_count,
+				updated_by = excluded.updated_by, updated_at = now()
+			returning `+limitColumns,
+			l.AccountID, l.Currency, l.MaxPayment, l.DailyTotal, l.MonthlyTotal, l.HourlyCount, l.UpdatedBy)
+		if err != nil {
+			return fmt.Errorf("failed to set limits: %w", err)
+		}
+
+		return nil
+	})
+
+	return set, err
+}
+
+// DeleteLimits function deletes the limits of the account or the currency, an account
+// without limits of its own falls back to the limits of its currency.
+func (s *Storage) DeleteLimits(ctx context.Context, scope limit.Scope) (err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return err
+	}
+
+	var res sql.Result
+	if scope.AccountID != "" {
+		res, err = conn.ExecContext(ctx, `delete from transfer_limits where account_id = $1`, scope.AccountID)
+	} else {
+		res, err = conn.ExecContext(ctx, `delete from transfer_limits where account_id = '' and currency = $1`, scope.Currency)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete limits: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete limits: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("limits of %s%s: %w", scope.AccountID, scope.Currency, coins.ErrNotFoundInStorage)
+	}
+
+	return nil
+}
+
+// checkLimits returns a *limit.ExceededError if the payment exceeds the limits of the source account.
+// The source account must be locked, so that concurrent payments of the account are counted in turn.
+func checkLimits(ctx context.Context, tx *sqlx.Tx, p payment.Payment, from account.Account) error {
+	l, err := accountLimits(ctx, tx, from)
+	if err != nil {
+		return err
+	}
+	if l.MaxPayment == nil && l.DailyTotal == nil && l.MonthlyTotal == nil && l.HourlyCount == nil {
+		return nil
+	}
+
+	// Payments are stamped with the local time of the database, so are the windows of the limits.
+	// Refunds return money received by the account and are not counted. Authorized holds count
+	// as payments of the held amount when they are authorized, until they are captured or released.
+	var u limit.Usage
+	err = tx.GetContext(ctx, &u, `select
+			coalesce(sum(amount) filter (where dt >= date_trunc('day', localtimestamp)), 0) as daily_total,
+			coalesce(sum(amount) filter (where dt >= date_trunc('month', localtimestamp)), 0) as monthly_total,
+			count(*) filter (where dt > localtimestamp - interval '1 hour') as hourly_count
+		from (
+			select amount, dt from payments
+			where from_account = $1 and refund_of is null
+			union all
+			select amount, created_at::timestamp as dt from holds
+			where from_account = $1 and status = $2
+		) as usage
+		where dt >= least(date_trunc('month', localtimestamp), localtimestamp - interval '1 hour')`, from.ID, hold.Authorized)
+	if err != nil {
+		return fmt.Errorf("failed to get usage of limits: %w", err)
+	}
+	if err := l.Check(p.Amount, u); err != nil {
+		return fmt.Errorf("account %s: %w", from.ID, err)
+	}
+
+	return nil
+}
+
+// accountLimits returns the limits of the account, or the limits of its currency
+// if the account has no limits of its own.
+func accountLimits(ctx context.Context, q sqlx.QueryerContext, acc account.Account) (l limit.Limits, err error) {
+	err = sqlx.GetContext(ctx, q, &l, `select `+limitColumns+` from transfer_limits
+		where currency = $1 and account_id in ('', $2) order by account_id desc limit 1`, acc.Currency, acc.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return limit.Limits{Currency: acc.Currency}, nil
+	}
+	if err != nil {
+		return l, fmt.Errorf("failed to get limits: %w", err)
+	}
+
+	return l, nil
+}
+
+func currencyLimits(ctx context.Context, q sqlx.QueryerContext, code string) (l limit.Limits, err error) {
+	err = sqlx.GetContext(ctx, q, &l, `select `+limitColumns+` from transfer_limits
+		where currency = $1 and account_id = ''`, code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return limit.Limits{Currency: code}, nil
+	}
+	if err != nil {
+		return l, fmt.Errorf("failed to get limits: %w", err)
+	}
+
+	return l, nil
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/donmikel/coins/pkg/event"
+	"github.com/jmoiron/sqlx"
+)
+
+// addEvent writes an event of the given type with v as the payload to the outbox
+// in the transaction of the state change.
+func addEvent(ctx context.Context, tx *sqlx.Tx, typ event.Type, v interface{}) error {
+	e, err := event.New(typ, v)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `insert into outbox (type, payload) values ($1, $2)`, e.Type, []byte(e.Payload))
+	if err != nil {
+		return fmt.Errorf("failed to add %s event: %w", typ, err)
+	}
+
+	return nil
+}
+
+// UnpublishedEvents function returns up to limit unpublished events ordered by ID
+func (s *Storage) UnpublishedEvents(ctx context.Context, limit int) (events []event.Event, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.SelectContext(ctx, &events, `select id, type, payload, created_at, published_at from outbox
+		where published_at is null order by id limit $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get unpublished events: %w", err)
+	}
+
+	return events, nil
+}
+
+// MarkPublished function marks the event as published
+func (s *Storage) MarkPublished(ctx context.Context, id uint64) (err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, `update outbox set published_at = now() where id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark event published: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,335 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/currency"
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/pending"
+	"github.com/jmoiron/sqlx"
+)
+
+// pendingColumns is a list of pending_payments table columns scanned into pendingRow.
+const pendingColumns = `id, from_account, to_account, amount, currency, direction, quote_id, status, decisions,
+	created_by, created_at, expires_at, reviewed_by, reviewed_at, review_reason, payment_id, refund_of`
+
+// pendingRow is a row of the pending_payments table, decisions are stored as JSON.
+type pendingRow struct {
+	pending.Payment
+	Decisions []byte `db:"decisions"`
+}
+
+func (r pendingRow) pendingPayment() (pending.Payment, error) {
+	pp := r.Payment
+	if err := json.Unmarshal(r.Decisions, &pp.Decisions); err != nil {
+		return pp, fmt.Errorf("failed to decode decisions of pending payment %d: %w", pp.ID, err)
+	}
+
+	return pp, nil
+}
+
+// ParkPayment function stores the payment request for a review and returns it with PendingID set.
+// The accounts of the payment are checked as when it is sent. A request with an idempotency key
+// is parked at most once, replays return the parked payment or the payment sent with the key.
+func (s *Storage) ParkPayment(ctx context.Context, pp pending.Payment) (parked payment.Payment, err error) {
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if pp.IdempotencyKey != "" {
+			replayed, claimed, err := claimIdempotencyKey(ctx, tx, pp.Payment())
+			if err != nil || !claimed {
+				parked = replayed
+				return err
+			}
+		}
+
+		if pp.RefundOf != nil {
+			parked, err = parkRefund(ctx, tx, pp)
+			return err
+		}
+		if pp.FromAccount == pp.ToAccount {
+			return fmt.Errorf("account %s: %w", pp.FromAccount, coins.ErrSameAccount)
+		}
+		accounts, err := lockAccounts(ctx, tx, pp.FromAccount, pp.ToAccount)
+		if err != nil {
+			return err
+		}
+		from, _, err := paymentAccounts(accounts, pp.FromAccount, pp.ToAccount)
+		if err != nil {
+			return err
+		}
+		c, err := currency.Lookup(from.Currency)
+		if err != nil {
+			return fmt.Errorf("account %s: %w", pp.FromAccount, err)
+		}
+		if !c.Fits(pp.Amount) {
+			return fmt.Errorf("%s %s: %w", pp.Amount, from.Currency, coins.ErrInvalidAmount)
+		}
+
+		pp.Currency = from.Currency
+		created, err := insertPendingPayment(ctx, tx, pp)
+		if err != nil {
+			return err
+		}
+
+		if pp.IdempotencyKey != "" {
+			_, err = tx.ExecContext(ctx, `update idempotency_keys set pending_id = $2 where key = $1`, pp.IdempotencyKey, created.ID)
+			if err != nil {
+				return fmt.Errorf("failed to store idempotency key: %w", err)
+			}
+		}
+		parked = created.Parked()
+
+		return nil
+	})
+
+	return parked, err
+}
+
+// parkRefund parks the refund of the payment with ID RefundOf, Amount and Currency of the refund
+// are in the currency of the refunded payment. The refund is checked as when it is sent.
+func parkRefund(ctx context.Context, tx *sqlx.Tx, pp pending.Payment) (parked payment.Payment, err error) {
+	input := payment.RefundInput{}
+	if !pp.Amount.IsZero() {
+		input.Amount = &pp.Amount
+	}
+	p, err := newRefund(ctx, tx, *pp.RefundOf, input)
+	if err != nil {
+		return parked, err
+	}
+	accounts, err := lockAccounts(ctx, tx, p.FromAccount, p.ToAccount)
+	if err != nil {
+		return parked, err
+	}
+	if _, _, err = paymentAccounts(accounts, p.FromAccount, p.ToAccount); err != nil {
+		return parked, err
+	}
+
+	pp.FromAccount, pp.ToAccount, pp.Direction = p.FromAccount, p.ToAccount, p.Direction
+	pp.Amount, pp.Currency = p.CreditAmount, p.CreditCurrency
+	created, err := insertPendingPayment(ctx, tx, pp)
+	if err != nil {
+		return parked, err
+	}
+
+	return created.Parked(), nil
+}
+
+// insertPendingPayment inserts the pending payment and returns it as it is stored.
+func insertPendingPayment(ctx context.Context, tx *sqlx.Tx, pp pending.Payment) (created pending.Payment, err error) {
+	decisions, err := json.Marshal(pp.Decisions)
+	if err != nil {
+		return created, fmt.Errorf("failed to encode decisions: %w", err)
+	}
+	var row pendingRow
+	err = tx.GetContext(ctx, &row, `insert into pending_payments
+		(from_account, to_account, amount, currency, direction, quote_id, status, decisions, created_by, expires_at, refund_of)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		returning `+pendingColumns,
+		pp.FromAccount, pp.ToAccount, pp.Amount, pp.Currency, pp.Direction, pp.QuoteID, pending.Pending, decisions, pp.CreatedBy,
+		pp.ExpiresAt, pp.RefundOf)
+	if err != nil {
+		return created, fmt.Errorf("failed to insert pending payment: %w", err)
+	}
+	created, err = row.pendingPayment()
+	if err != nil {
+		return created, err
+	}
+	created.IdempotencyKey = pp.IdempotencyKey
+
+	return created, nil
+}
+
+// GetPendingPayment function returns the pending payment with the given ID
+func (s *Storage) GetPendingPayment(ctx context.Context, id uint64) (pp pending.Payment, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return pp, err
+	}
+
+	return getPendingPayment(ctx, conn, id)
+}
+
+func getPendingPayment(ctx context.Context, q sqlx.QueryerContext, id uint64) (pp pending.Payment, err error) {
+	var row pendingRow
+	err = sqlx.GetContext(ctx, q, &row, `select `+pendingColumns+` from pending_payments where id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return pp, fmt.Errorf("pending payment %d: %w", id, coins.ErrNotFoundInStorage)
+	}
+	if err != nil {
+		return pp, fmt.Errorf("failed to get pending payment: %w", err)
+	}
+
+	return row.pendingPayment()
+}
+
+// GetPendingPayments function returns a page of pending payments matching the filter
+func (s *Storage) GetPendingPayments(ctx context.Context, f pending.Filter) (page pending.Page, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return page, err
+	}
+
+	limit := f.Limit
+	if limit == 0 {
+		limit = pending.DefaultLimit
+	}
+
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	where := []string{"id > " + arg(f.Cursor)}
+	if f.Status != "" {
+		where = append(where, "status = "+arg(f.Status))
+	}
+	if f.Account != "" {
+		a := arg(f.Account)
+		where = append(where, fmt.Sprintf("(from_account = %s or to_account = %s)", a, a))
+	}
+
+	// One extra row is selected to find out whether there is a next page.
+	var rows []pendingRow
+	err = conn.SelectContext(ctx, &rows, `select `+pendingColumns+` from pending_payments
+		where `+strings.Join(where, " and ")+`
+		order by id limit `+arg(limit+1), args...)
+	if err != nil {
+		return page, fmt.Errorf("failed to get pending payments: %w", err)
+	}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		page.NextCursor = rows[limit-1].ID
+	}
+	page.Payments = make([]pending.Payment, 0, len(rows))
+	for _, row := range rows {
+		pp, err := row.pendingPayment()
+		if err != nil {
+			return page, err
+		}
+		page.Payments = append(page.Payments, pp)
+	}
+
+	return page, nil
+}
+
+// ApprovePendingPayment function sends a pending payment on behalf of its creator and the reviewer
+// and records the review. The creator may not approve the payment, nor an anonymous reviewer a payment
+// above an approval threshold. The payment is checked as any other payment when it is sent,
+// the pending payment stays pending if it fails.
+func (s *Storage) ApprovePendingPayment(ctx context.Context, id uint64, review pending.Review) (pp pending.Payment, err error) {
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		pp, err = lockPendingPayment(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if review.By == "" && pp.RequiresApproval() {
+			return fmt.Errorf("pending payment %d: %w", id, coins.ErrAnonymousApproval)
+		}
+		if review.By != "" && review.By == pp.CreatedBy {
+			return fmt.Errorf("pending payment %d created by %s: %w", id, pp.CreatedBy, coins.ErrSelfApproval)
+		}
+		created, err := sendPendingPayment(ctx, tx, pp, review)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `update idempotency_keys set payment_id = $2 where pending_id = $1`, id, created.ID)
+		if err != nil {
+			return fmt.Errorf("failed to store idempotency key: %w", err)
+		}
+
+		pp, err = reviewPendingPayment(ctx, tx, id, pending.Approved, review, &created.ID)
+		return err
+	})
+
+	return pp, err
+}
+
+// sendPendingPayment sends the approved pending payment or refund.
+func sendPendingPayment(ctx context.Context, tx *sqlx.Tx, pp pending.Payment, review pending.Review) (created payment.Payment, err error) {
+	if pp.RefundOf == nil {
+		p := pp.Payment()
+		p.InitiatedBy, p.ApprovedBy = pp.CreatedBy, review.By
+		return sendPayment(ctx, tx, p)
+	}
+
+	p, err := newRefund(ctx, tx, *pp.RefundOf, payment.RefundInput{Amount: &pp.Amount})
+	if err != nil {
+		return created, err
+	}
+	p.InitiatedBy, p.ApprovedBy = pp.CreatedBy, review.By
+	return sendRefund(ctx, tx, p)
+}
+
+// RejectPendingPayment function records the review of a pending payment that is not sent.
+func (s *Storage) RejectPendingPayment(ctx context.Context, id uint64, review pending.Review) (pp pending.Payment, err error) {
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err = lockPendingPayment(ctx, tx, id); err != nil {
+			return err
+		}
+
+		pp, err = reviewPendingPayment(ctx, tx, id, pending.Rejected, review, nil)
+		return err
+	})
+
+	return pp, err
+}
+
+// ExpirePendingPayments function expires pending payments expired at now and returns the number of expired payments.
+func (s *Storage) ExpirePendingPayments(ctx context.Context, now time.Time) (n int64, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := conn.ExecContext(ctx, `update pending_payments set status = $2
+		where status = $1 and expires_at <= $3`, pending.Pending, pending.Expired, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire pending payments: %w", err)
+	}
+	n, err = res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to expire pending payments: %w", err)
+	}
+
+	return n, nil
+}
+
+// lockPendingPayment locks a pending payment that is neither reviewed nor expired yet.
+func lockPendingPayment(ctx context.Context, tx *sqlx.Tx, id uint64) (pp pending.Payment, err error) {
+	var row pendingRow
+	err = tx.GetContext(ctx, &row, `select `+pendingColumns+` from pending_payments where id = $1 for update`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return pp, fmt.Errorf("pending payment %d: %w", id, coins.ErrNotFoundInStorage)
+	}
+	if err != nil {
+		return pp, fmt.Errorf("failed to get pending payment: %w", err)
+	}
+	if row.Status == pending.Expired || row.ExpiresAt != nil && !row.ExpiresAt.After(time.Now()) {
+		return pp, fmt.Errorf("pending payment %d: %w", id, coins.ErrPaymentExpired)
+	}
+	if row.Status != pending.Pending {
+		return pp, fmt.Errorf("pending payment %d is %s: %w", id, row.Status, coins.ErrPaymentReviewed)
+	}
+
+	return row.pendingPayment()
+}
+
+func reviewPendingPayment(ctx context.Context, tx *sqlx.Tx, id uint64, status pending.Status, review pending.Review, paymentID *uint64) (pp pending.Payment, err error) {
+	var row pendingRow
+	err = tx.GetContext(ctx, &row, `update pending_payments
+		set status = $2, reviewed_by = $3, reviewed_at = $4, review_reason = $5, payment_id = $6
+		where id = $1
+		returning `+pendingColumns, id, status, review.By, time.Now(), review.Reason, paymentID)
+	if err != nil {
+		return pp, fmt.Errorf("failed to update pending payment: %w", err)
+	}
+
+	return row.pendingPayment()
+}
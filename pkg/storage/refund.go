@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/currency"
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/jmoiron/sqlx"
+	"github.com/shopspring/decimal"
+)
+
+// RefundPayment sends the money of the payment back from its destination to its source account
+// and returns the compensating payment linked to the refunded one.
+// The refunded payment is locked, so concurrent refunds never exceed its amount in total.
+func (s *Storage) RefundPayment(ctx context.Context, id uint64, input payment.RefundInput) (created payment.Payment, err error) {
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		created, err = refundPayment(ctx, tx, id, input)
+		return err
+	})
+
+	return created, err
+}
+
+func refundPayment(ctx context.Context, tx *sqlx.Tx, id uint64, input payment.RefundInput) (created payment.Payment, err error) {
+	p, err := newRefund(ctx, tx, id, input)
+	if err != nil {
+		return created, err
+	}
+
+	return sendRefund(ctx, tx, p)
+}
+
+// refundedPayment locks the payment refunded with the given ID and returns it
+// with the amount left to refund in its debit currency.
+func refundedPayment(ctx context.Context, tx *sqlx.Tx, id uint64) (orig payment.Payment, remaining decimal.Decimal, err error) {
+	err = tx.GetContext(ctx, &orig, `select `+paymentColumns+` from payments where id = $1 for update`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return orig, remaining, fmt.Errorf("payment %d: %w", id, coins.ErrNotFoundInStorage)
+	}
+	if err != nil {
+		return orig, remaining, fmt.Errorf("failed to get payment: %w", err)
+	}
+	if orig.RefundOf != nil {
+		return orig, remaining, fmt.Errorf("payment %d is a refund: %w", id, coins.ErrNotRefundable)
+	}
+
+	var refunded decimal.Decimal
+	err = tx.GetContext(ctx, &refunded, `select coalesce(sum(credit_amount), 0) from payments where refund_of = $1`, id)
+	if err != nil {
+		return orig, remaining, fmt.Errorf("failed to get refunded amount: %w", err)
+	}
+
+	return orig, orig.Amount.Sub(refunded), nil
+}
+
+// newRefund returns the compensating payment of the refund of the payment with the given ID,
+// the refunded payment is locked.
+func newRefund(ctx context.Context, tx *sqlx.Tx, id uint64, input payment.RefundInput) (p payment.Payment, err error) {
+	orig, remaining, err := refundedPayment(ctx, tx, id)
+	if err != nil {
+		return p, err
+	}
+
+	amount := remaining
+	if input.Amount != nil {
+		amount = *input.Amount
+	}
+	if !amount.IsPositive() || amount.GreaterThan(remaining) {
+		return p, fmt.Errorf("payment %d has %s %s left to refund: %w", id, remaining, orig.Currency, coins.ErrRefundExceeded)
+	}
+
+	// Refunds debit the destination account in the credit currency of the payment
+	// and credit the source account in its debit currency.
+	var refundedDebit decimal.Decimal
+	err = tx.GetContext(ctx, &refundedDebit, `select coalesce(sum(amount), 0) from payments where refund_of = $1`, id)
+	if err != nil {
+		return p, fmt.Errorf("failed to get refunded amount: %w", err)
+	}
+
+	debitCurrency, err := currency.Lookup(orig.CreditCurrency)
+	if err != nil {
+		return p, fmt.Errorf("payment %d: %w", id, err)
+	}
+	creditCurrency, err := currency.Lookup(orig.Currency)
+	if err != nil {
+		return p, fmt.Errorf("payment %d: %w", id, err)
+	}
+	if !creditCurrency.Fits(amount) {
+		return p, fmt.Errorf("%s %s: %w", amount, orig.Currency, coins.ErrInvalidAmount)
+	}
+
+	p = payment.Payment{
+		FromAccount:    orig.ToAccount,
+		ToAccount:      orig.FromAccount,
+		Direction:      orig.Direction,
+		Currency:       orig.CreditCurrency,
+		CreditAmount:   amount,
+		CreditCurrency: orig.Currency,
+		Rate:           decimal.NewFromInt(1),
+		RefundOf:       &orig.ID,
+	}
+	switch {
+	case orig.Currency == orig.CreditCurrency:
+		p.Amount = amount
+	case amount.Equal(remaining):
+		// The last refund returns exactly what is left, so rounding never leaves a residue.
+		p.Amount = orig.CreditAmount.Sub(refundedDebit)
+		p.Rate = amount.DivRound(p.Amount, 16)
+	default:
+		p.Amount = debitCurrency.Round(amount.Mul(orig.Rate))
+		if !p.Amount.IsPositive() {
+			return p, fmt.Errorf("%s %s debits nothing in %s: %w", amount, orig.Currency, orig.CreditCurrency, coins.ErrInvalidAmount)
+		}
+		p.Rate = amount.DivRound(p.Amount, 16)
+	}
+
+	return p, nil
+}
+
+// sendRefund sends the compensating payment of a refund.
+func sendRefund(ctx context.Context, tx *sqlx.Tx, p payment.Payment) (created payment.Payment, err error) {
+	accounts, err := lockAccounts(ctx, tx, p.FromAccount, p.ToAccount)
+	if err != nil {
+		return created, err
+	}
+	from, to, err := paymentAccounts(accounts, p.FromAccount, p.ToAccount)
+	if err != nil {
+		return created, err
+	}
+	if from.Currency != p.Currency || to.Currency != p.CreditCurrency {
+		return created, fmt.Errorf("accounts of payment %d changed currency: %w", *p.RefundOf, coins.ErrCurrencyMismatch)
+	}
+	if from.Available().LessThan(p.Amount) {
+		return created, fmt.Errorf("account %s: %w", p.FromAccount, coins.ErrInsufficientFunds)
+	}
+
+	return postPayment(ctx, tx, p, "refund")
+}
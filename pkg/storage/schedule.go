@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/currency"
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/schedule"
+	"github.com/jmoiron/sqlx"
+)
+
+// scheduleColumns is a list of schedules table columns scanned into schedule.Schedule.
+const scheduleColumns = `id, from_account, to_account, amount, direction, spec, status,
+	next_run, retry_at, attempts, last_run, last_payment_id, last_error`
+
+// CreateSchedule function stores a new schedule. Accounts of the schedule must exist
+// and have the same currency, the amount must fit the currency precision.
+func (s *Storage) CreateSchedule(ctx context.Context, sch schedule.Schedule) (created schedule.Schedule, err error) {
+	// The accounts are locked, so a schedule is never created for an account being closed.
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		accounts, err := lockAccounts(ctx, tx, sch.FromAccount, sch.ToAccount)
+		if err != nil {
+			return err
+		}
+		for _, id := range []string{sch.FromAccount, sch.ToAccount} {
+			if acc, ok := accounts[id]; !ok || acc.Status == account.Closed {
+				return fmt.Errorf("account %s: %w", id, coins.ErrUnknownAccount)
+			}
+		}
+		from, to := accounts[sch.FromAccount], accounts[sch.ToAccount]
+		if from.Currency != to.Currency {
+			return fmt.Errorf("%s to %s: %w", from.Currency, to.Currency, coins.ErrCurrencyMismatch)
+		}
+		c, err := currency.Lookup(from.Currency)
+		if err != nil {
+			return fmt.Errorf("account %s: %w", from.ID, err)
+		}
+		if !c.Fits(sch.Amount) {
+			return fmt.Errorf("%s %s: %w", sch.Amount, from.Currency, coins.ErrInvalidAmount)
+		}
+
+		err = tx.GetContext(ctx, &created, `insert into schedules (from_account, to_account, amount, direction, spec, status, next_run)
+			values ($1, $2, $3, $4, $5, $6, $7)
+			returning `+scheduleColumns,
+			sch.FromAccount, sch.ToAccount, sch.Amount, sch.Direction, sch.Spec, sch.Status, sch.NextRun)
+		if err != nil {
+			return fmt.Errorf("failed to create schedule: %w", err)
+		}
+
+		return nil
+	})
+
+	return created, err
+}
+
+// GetSchedule function returns the schedule with the given ID
+func (s *Storage) GetSchedule(ctx context.Context, id uint64) (sch schedule.Schedule, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return sch, err
+	}
+
+	err = conn.GetContext(ctx, &sch, `select `+scheduleColumns+` from schedules where id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sch, fmt.Errorf("schedule %d: %w", id, coins.ErrNotFoundInStorage)
+	}
+	if err != nil {
+		return sch, fmt.Errorf("failed to get schedule: %w", err)
+	}
+
+	return sch, nil
+}
+
+// GetSchedules function returns schedules sending money from the account, or all schedules if the account is empty
+func (s *Storage) GetSchedules(ctx context.Context, accountID string) (schedules []schedule.Schedule, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.SelectContext(ctx, &schedules, `select `+scheduleColumns+` from schedules
+		where $1 = '' or from_account = $1 order by id`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get schedules: %w", err)
+	}
+
+	return schedules, nil
+}
+
+// CancelSchedule function cancels an active schedule
+func (s *Storage) CancelSchedule(ctx context.Context, id uint64) (err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return err
+	}
+
+	res, err := conn.ExecContext(ctx, `update schedules set status = $2, retry_at = null where id = $1 and status = $3`,
+		id, schedule.Cancelled, schedule.Active)
+	if err != nil {
+		return fmt.Errorf("failed to cancel schedule: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to cancel schedule: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("schedule %d: %w", id, coins.ErrNotFoundInStorage)
+	}
+
+	return nil
+}
+
+// RunDueSchedule sends the payment of the earliest schedule due at now and stores the run result.
+// The schedule is locked with skip locked, so concurrent workers run different schedules.
+// It returns false if no schedule is due. A payment that fails the check is not sent, the run
+// fails and is retried as a failed payment.
+func (s *Storage) RunDueSchedule(ctx context.Context, now time.Time, retry schedule.Retry, check schedule.Check) (sch schedule.Schedule, ok bool, err error) {
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, &sch, `select `+scheduleColumns+` from schedules
+			where status = $1 and coalesce(retry_at, next_run) <= $2
+			order by coalesce(retry_at, next_run), id limit 1
+			for update skip locked`, schedule.Active, now)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get due schedule: %w", err)
+		}
+		ok = true
+
+		var p payment.Payment
+		runErr := runCheck(ctx, check, sch)
+		if runErr == nil {
+			p, runErr = runSchedule(ctx, tx, sch)
+		}
+		sch = sch.Complete(now, p, runErr, retry)
+		_, err = tx.ExecContext(ctx, `update schedules set status = $2, next_run = $3, retry_at = $4, attempts = $5,
+			last_run = $6, last_payment_id = $7, last_error = $8 where id = $1`,
+			sch.ID, sch.Status, sch.NextRun, sch.RetryAt, sch.Attempts, sch.LastRun, sch.LastPaymentID, sch.LastError)
+		if err != nil {
+			return fmt.Errorf("failed to update schedule: %w", err)
+		}
+
+		return nil
+	})
+
+	return sch, ok, err
+}
+
+// runCheck checks the payment of the schedule, the run is skipped if it fails the check.
+func runCheck(ctx context.Context, check schedule.Check, sch schedule.Schedule) error {
+	if check == nil {
+		return nil
+	}
+	if err := check(ctx, sch.Payment()); err != nil {
+		return fmt.Errorf("payment is not sent: %w", err)
+	}
+	return nil
+}
+
+// runSchedule sends the payment of the schedule within a savepoint,
+// so a failed payment is rolled back without aborting the transaction.
+func runSchedule(ctx context.Context, tx *sqlx.Tx, sch schedule.Schedule) (created payment.Payment, err error) {
+	err = inSavepoint(ctx, tx, "run_schedule", func() error {
+		created, err = sendPayment(ctx, tx, sch.Payment())
+		return err
+	})
+
+	return created, err
+}
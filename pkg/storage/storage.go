@@ -2,17 +2,44 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/currency"
+	"github.com/donmikel/coins/pkg/event"
+	"github.com/donmikel/coins/pkg/ledger"
 	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/pending"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
 )
 
 var errNoConnection = errors.New("no connection to database")
 
+// paymentColumns is a list of payments table columns scanned into payment.Payment.
+const paymentColumns = `id, from_account, to_account, amount, direction, dt, currency, credit_amount, credit_currency, rate, quote_id, refund_of,
+	initiated_by, approved_by`
+
+// accountColumns is a list of accounts table columns scanned into account.Account.
+const accountColumns = `id, balance, currency, status, held, owner`
+
+// pqUniqueViolation is the Postgres error code reported when a unique constraint is violated.
+const pqUniqueViolation = "23505"
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == pqUniqueViolation
+}
+
 // Config is a storage configuration.
 type Config struct {
 	PostgresAddress  string
@@ -64,7 +91,8 @@ func (pc *Config) getConnString() string {
 
 // Storage is a Postgres persistent payments storage.
 type Storage struct {
-	db *sqlx.DB
+	db         *sqlx.DB
+	connString string
 }
 
 func (s *Storage) getConn() (*sqlx.DB, error) {
@@ -75,6 +103,62 @@ func (s *Storage) getConn() (*sqlx.DB, error) {
 	return s.db, nil
 }
 
+// inTx runs fn inside a database transaction. The transaction is committed
+// if fn succeeds and rolled back otherwise.
+func (s *Storage) inTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	conn, err := s.getConn()
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// inSavepoint runs fn within a savepoint of the transaction, so an error of fn
+// rolls back the changes made by fn without aborting the transaction.
+func inSavepoint(ctx context.Context, tx *sqlx.Tx, name string, fn func() error) error {
+	if _, err := tx.ExecContext(ctx, `savepoint `+name); err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+	if err := fn(); err != nil {
+		if _, rbErr := tx.ExecContext(ctx, `rollback to savepoint `+name); rbErr != nil {
+			return fmt.Errorf("failed to rollback to savepoint: %w", rbErr)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// inReadTx runs fn inside a read-only repeatable read transaction,
+// so that all queries of fn see the same snapshot of the database.
+func (s *Storage) inReadTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	conn, err := s.getConn()
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTxx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	return fn(tx)
+}
+
 // New creates a new storage.
 func New(cfg Config) (*Storage, error) {
 	if err := cfg.validate(); err != nil {
@@ -87,52 +171,349 @@ func New(cfg Config) (*Storage, error) {
 	}
 
 	s := &Storage{
-		db: pgdb,
+		db:         pgdb,
+		connString: cfg.getConnString(),
 	}
 
 	return s, nil
 }
 
-// SendPayment function make a send payment in storage
-func (s *Storage) SendPayment(ctx context.Context, payment payment.Payment) (err error) {
+// SendPayment function make a send payment in storage and returns the persisted payment.
+// A payment with an idempotency key is executed at most once, replays return the original payment.
+func (s *Storage) SendPayment(ctx context.Context, p payment.Payment) (created payment.Payment, err error) {
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		if p.IdempotencyKey == "" {
+			created, err = sendPayment(ctx, tx, p)
+		} else {
+			created, err = sendIdempotentPayment(ctx, tx, p)
+		}
+		return err
+	})
+
+	return created, err
+}
+
+// sendIdempotentPayment claims the payment idempotency key and sends the payment,
+// or returns the payment already sent with the same key and request.
+// A concurrent request with the same key blocks on the key row until the first one completes.
+func sendIdempotentPayment(ctx context.Context, tx *sqlx.Tx, p payment.Payment) (created payment.Payment, err error) {
+	replayed, claimed, err := claimIdempotencyKey(ctx, tx, p)
+	if err != nil || !claimed {
+		return replayed, err
+	}
+
+	created, err = sendPayment(ctx, tx, p)
+	if err != nil {
+		return created, err
+	}
+	_, err = tx.ExecContext(ctx, `update idempotency_keys set payment_id = $2 where key = $1`, p.IdempotencyKey, created.ID)
+	if err != nil {
+		return created, fmt.Errorf("failed to store idempotency key: %w", err)
+	}
+
+	return created, nil
+}
+
+// claimIdempotencyKey claims the idempotency key of the payment request. If the key is already claimed
+// by the same request, it returns the payment sent with the key or the payment parked with it for a review.
+func claimIdempotencyKey(ctx context.Context, tx *sqlx.Tx, p payment.Payment) (replayed payment.Payment, claimed bool, err error) {
+	hash := requestHash(p)
+	res, err := tx.ExecContext(ctx, `insert into idempotency_keys (key, request_hash) values ($1, $2)
+		on conflict (key) do nothing`, p.IdempotencyKey, hash)
+	if err != nil {
+		return replayed, false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return replayed, false, fmt.Errorf("failed to claim idempotency key: %w", err)
+	}
+	if n > 0 {
+		return replayed, true, nil
+	}
+
+	var stored struct {
+		RequestHash string        `db:"request_hash"`
+		PaymentID   sql.NullInt64 `db:"payment_id"`
+		PendingID   sql.NullInt64 `db:"pending_id"`
+	}
+	err = tx.GetContext(ctx, &stored, `select request_hash, payment_id, pending_id from idempotency_keys where key = $1`, p.IdempotencyKey)
+	if err != nil {
+		return replayed, false, fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	if stored.RequestHash != hash {
+		return replayed, false, fmt.Errorf("key %s: %w", p.IdempotencyKey, coins.ErrIdempotencyKey)
+	}
+	switch {
+	case stored.PaymentID.Valid:
+		replayed, err = getPayment(ctx, tx, uint64(stored.PaymentID.Int64))
+	case stored.PendingID.Valid:
+		var pp pending.Payment
+		pp, err = getPendingPayment(ctx, tx, uint64(stored.PendingID.Int64))
+		replayed = pp.Parked()
+	default:
+		err = fmt.Errorf("idempotency key %s has no payment", p.IdempotencyKey)
+	}
+
+	return replayed, false, err
+}
+
+// requestHash returns a digest of the payment request fields, used to detect
+// an idempotency key reused for a different request.
+func requestHash(p payment.Payment) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%d\n%s", p.FromAccount, p.ToAccount, p.Amount.String(), p.Direction, p.QuoteID)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// sendPayment moves the payment amount between accounts and records the payment.
+// Both accounts are locked for the duration of the given transaction.
+func sendPayment(ctx context.Context, tx *sqlx.Tx, p payment.Payment) (created payment.Payment, err error) {
+	if p.FromAccount == p.ToAccount {
+		return created, fmt.Errorf("account %s: %w", p.FromAccount, coins.ErrSameAccount)
+	}
+
+	accounts, err := lockAccounts(ctx, tx, p.FromAccount, p.ToAccount)
+	if err != nil {
+		return created, err
+	}
+	from, to, err := paymentAccounts(accounts, p.FromAccount, p.ToAccount)
+	if err != nil {
+		return created, err
+	}
+	debitCurrency, err := currency.Lookup(from.Currency)
+	if err != nil {
+		return created, fmt.Errorf("account %s: %w", p.FromAccount, err)
+	}
+	creditCurrency, err := currency.Lookup(to.Currency)
+	if err != nil {
+		return created, fmt.Errorf("account %s: %w", p.ToAccount, err)
+	}
+	if !debitCurrency.Fits(p.Amount) {
+		return created, fmt.Errorf("%s %s: %w", p.Amount, from.Currency, coins.ErrInvalidAmount)
+	}
+	if from.Available().LessThan(p.Amount) {
+		return created, fmt.Errorf("account %s: %w", p.FromAccount, coins.ErrInsufficientFunds)
+	}
+	if err = checkLimits(ctx, tx, p, from); err != nil {
+		return created, err
+	}
+
+	p.Currency, p.CreditCurrency = from.Currency, to.Currency
+	p.Rate, p.CreditAmount = decimal.NewFromInt(1), p.Amount
+	if from.Currency != to.Currency {
+		if p.QuoteID == "" {
+			return created, fmt.Errorf("%s to %s: %w", from.Currency, to.Currency, coins.ErrCurrencyMismatch)
+		}
+		quote, err := useQuote(ctx, tx, p.QuoteID)
+		if err != nil {
+			return created, err
+		}
+		if quote.FromCurrency != from.Currency || quote.ToCurrency != to.Currency {
+			return created, fmt.Errorf("quote %s is for %s to %s: %w", quote.ID, quote.FromCurrency, quote.ToCurrency, coins.ErrInvalidQuote)
+		}
+		p.Rate, p.CreditAmount = quote.Rate, creditCurrency.Round(p.Amount.Mul(quote.Rate))
+		if !p.CreditAmount.IsPositive() {
+			return created, fmt.Errorf("%s %s credits nothing in %s: %w", p.Amount, from.Currency, to.Currency, coins.ErrInvalidAmount)
+		}
+	} else {
+		p.QuoteID = ""
+	}
+
+	return postPayment(ctx, tx, p, "payment")
+}
+
+// postPayment debits and credits the locked accounts of the payment, records the payment
+// and posts it to the ledger. Currencies and amounts of both sides must be already set.
+func postPayment(ctx context.Context, tx *sqlx.Tx, p payment.Payment, description string) (created payment.Payment, err error) {
+	_, err = tx.ExecContext(ctx, `update accounts set balance = balance - $2 where id = $1`, p.FromAccount, p.Amount)
+	if err != nil {
+		return created, fmt.Errorf("failed to debit account: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, `update accounts set balance = balance + $2 where id = $1`, p.ToAccount, p.CreditAmount)
+	if err != nil {
+		return created, fmt.Errorf("failed to credit account: %w", err)
+	}
+	err = tx.GetContext(ctx, &created, `insert into payments
+		(from_account, to_account, amount, direction, currency, credit_amount, credit_currency, rate, quote_id, refund_of,
+		initiated_by, approved_by)
+		values ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		returning `+paymentColumns,
+		p.FromAccount, p.ToAccount, p.Amount, p.Direction, p.Currency, p.CreditAmount, p.CreditCurrency, p.Rate, p.QuoteID, p.RefundOf,
+		p.InitiatedBy, p.ApprovedBy)
+	if err != nil {
+		return created, fmt.Errorf("failed to insert payment: %w", err)
+	}
+
+	t := ledger.Transfer(p.FromAccount, p.ToAccount, p.Amount, p.Currency)
+	if p.Currency != p.CreditCurrency {
+		t = ledger.Exchange(p.FromAccount, p.ToAccount, p.Amount, p.Currency, p.CreditAmount, p.CreditCurrency)
+	}
+	t.PaymentID = &created.ID
+	t.Description = description
+	if err = postTransaction(ctx, tx, t); err != nil {
+		return created, err
+	}
+
+	typ := event.PaymentCreated
+	if created.RefundOf != nil {
+		typ = event.PaymentRefunded
+	}
+	if err = addEvent(ctx, tx, typ, created); err != nil {
+		return created, err
+	}
+	if err = notifyPayment(ctx, tx, created); err != nil {
+		return created, err
+	}
+
+	return created, nil
+}
+
+// lockAccounts selects the given accounts for update. Rows are locked in ID order
+// so that concurrent transfers between the same accounts cannot deadlock.
+func lockAccounts(ctx context.Context, tx *sqlx.Tx, ids ...string) (map[string]account.Account, error) {
+	var rows []account.Account
+	err := tx.SelectContext(ctx, &rows, `select `+accountColumns+` from accounts
+		where id = any($1) order by id for update`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock accounts: %w", err)
+	}
+
+	accounts := make(map[string]account.Account, len(rows))
+	for _, acc := range rows {
+		accounts[acc.ID] = acc
+	}
+
+	return accounts, nil
+}
+
+// paymentAccounts returns the source and the destination account of a payment, checking
+// that the status of the source allows debits and the status of the destination allows credits.
+func paymentAccounts(accounts map[string]account.Account, fromID, toID string) (from, to account.Account, err error) {
+	from, ok := accounts[fromID]
+	if !ok || from.Status == account.Closed {
+		return from, to, fmt.Errorf("account %s: %w", fromID, coins.ErrUnknownAccount)
+	}
+	to, ok = accounts[toID]
+	if !ok || to.Status == account.Closed {
+		return from, to, fmt.Errorf("account %s: %w", toID, coins.ErrUnknownAccount)
+	}
+	if !from.Status.CanDebit() {
+		return from, to, fmt.Errorf("account %s is %s: %w", fromID, from.Status, coins.ErrAccountFrozen)
+	}
+	if !to.Status.CanCredit() {
+		return from, to, fmt.Errorf("account %s is %s: %w", toID, to.Status, coins.ErrAccountFrozen)
+	}
+
+	return from, to, nil
+}
+
+// GetAllPayments function returns a page of payments matching the filter
+func (s *Storage) GetAllPayments(ctx context.Context, f payment.Filter) (page payment.Page, err error) {
 	conn, err := s.getConn()
 	if err != nil {
-		return err
+		return page, err
+	}
+
+	limit := f.Limit
+	if limit == 0 {
+		limit = payment.DefaultLimit
+	}
+
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	where := []string{"id > " + arg(f.Cursor)}
+	if f.Account != "" {
+		a := arg(f.Account)
+		if f.Counterparty != "" {
+			c := arg(f.Counterparty)
+			where = append(where, fmt.Sprintf("((from_account = %s and to_account = %s) or (from_account = %s and to_account = %s))", a, c, c, a))
+		} else {
+			where = append(where, fmt.Sprintf("(from_account = %s or to_account = %s)", a, a))
+		}
+	}
+	if f.Direction != nil {
+		where = append(where, "direction = "+arg(*f.Direction))
+	}
+	if f.MinAmount != nil {
+		where = append(where, "amount >= "+arg(*f.MinAmount))
+	}
+	if f.MaxAmount != nil {
+		where = append(where, "amount <= "+arg(*f.MaxAmount))
+	}
+	if f.From != nil {
+		where = append(where, "dt >= "+arg(*f.From))
+	}
+	if f.To != nil {
+		where = append(where, "dt < "+arg(*f.To))
 	}
 
-	_, err = conn.ExecContext(ctx, `call send_payment_proc($1, $2, $3, $4)`, payment.FromAccount, payment.ToAccount, payment.Amount, payment.Direction)
+	page.Payments = make([]payment.Payment, 0, limit+1)
+	err = conn.SelectContext(ctx, &page.Payments, `select `+paymentColumns+` from payments
+		where `+strings.Join(where, " and ")+`
+		order by id
+		limit `+arg(limit+1), args...)
 	if err != nil {
-		return fmt.Errorf("failed to call send_payment_proc: %w", err)
+		return page, fmt.Errorf("failed to get payments: %w", err)
+	}
+	if len(page.Payments) > limit {
+		page.Payments = page.Payments[:limit]
+		page.NextCursor = page.Payments[limit-1].ID
 	}
 
-	return nil
+	return page, nil
 }
 
-// GetAllPayments function return all payments
-func (s *Storage) GetAllPayments(ctx context.Context) (payments []payment.Payment, err error) {
+// GetPayment function returns the payment with the given ID
+func (s *Storage) GetPayment(ctx context.Context, id uint64) (p payment.Payment, err error) {
 	conn, err := s.getConn()
 	if err != nil {
-		return nil, err
+		return p, err
+	}
+
+	return getPayment(ctx, conn, id)
+}
+
+func getPayment(ctx context.Context, q sqlx.QueryerContext, id uint64) (p payment.Payment, err error) {
+	err = sqlx.GetContext(ctx, q, &p, `select `+paymentColumns+` from payments where id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return p, fmt.Errorf("payment %d: %w", id, coins.ErrNotFoundInStorage)
+	}
+	if err != nil {
+		return p, fmt.Errorf("failed to get payment: %w", err)
+	}
+
+	return p, nil
+}
+
+// CountPayments function returns the number of payments sent from an account to another one since the time.
+// Refunds are not counted.
+func (s *Storage) CountPayments(ctx context.Context, from, to string, since time.Time) (n int, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return 0, err
 	}
 
-	payments = make([]payment.Payment, 0)
-	err = conn.SelectContext(ctx, &payments, `select id, from_account, to_account, amount, direction, dt from payments`)
+	err = conn.GetContext(ctx, &n, `select count(*) from payments
+		where from_account = $1 and to_account = $2 and refund_of is null and dt >= $3`, from, to, since)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get payments: %w", err)
+		return 0, fmt.Errorf("failed to count payments: %w", err)
 	}
 
-	return payments, nil
+	return n, nil
 }
 
 // GetAvailableAccounts function return all accounts available to send payment
-func (s *Storage) GetAvailableAccounts(ctx context.Context) (accounts []string, err error) {
+func (s *Storage) GetAvailableAccounts(ctx context.Context) (accounts []account.Account, err error) {
 	conn, err := s.getConn()
 	if err != nil {
 		return nil, err
 	}
 
-	accounts = make([]string, 0)
-	err = conn.SelectContext(ctx, &accounts, "select id from accounts")
+	accounts = make([]account.Account, 0)
+	err = conn.SelectContext(ctx, &accounts, `select `+accountColumns+` from accounts where status <> $1`, account.Closed)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get accounts: %w", err)
 	}
@@ -140,6 +521,192 @@ func (s *Storage) GetAvailableAccounts(ctx context.Context) (accounts []string,
 	return accounts, nil
 }
 
+// CreateAccount function creates a new account
+func (s *Storage) CreateAccount(ctx context.Context, acc account.Account) (created account.Account, err error) {
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, &created, `insert into accounts (id, balance, currency, owner) values ($1, $2, $3, $4)
+			returning `+accountColumns, acc.ID, acc.Balance, acc.Currency, acc.Owner)
+		if isUniqueViolation(err) {
+			return fmt.Errorf("account %s: %w", acc.ID, coins.ErrAlreadyExistsInStorage)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to create account: %w", err)
+		}
+		if created.Balance.IsZero() {
+			return nil
+		}
+
+		t := ledger.Transfer(ledger.OpeningAccount, created.ID, created.Balance, created.Currency)
+		t.Description = "opening balance"
+		return postTransaction(ctx, tx, t)
+	})
+
+	return created, err
+}
+
+// GetAccount function returns the account with the given ID
+func (s *Storage) GetAccount(ctx context.Context, id string) (acc account.Account, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return acc, err
+	}
+
+	err = conn.GetContext(ctx, &acc, `select `+accountColumns+` from accounts where id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return acc, fmt.Errorf("account %s: %w", id, coins.ErrNotFoundInStorage)
+	}
+	if err != nil {
+		return acc, fmt.Errorf("failed to get account: %w", err)
+	}
+
+	return acc, nil
+}
+
+// UpdateAccount function applies the given update to an open account
+func (s *Storage) UpdateAccount(ctx context.Context, id string, upd account.AccountUpdate) (acc account.Account, err error) {
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		accounts, err := lockAccounts(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		old, ok := accounts[id]
+		if !ok || old.Status == account.Closed {
+			return fmt.Errorf("account %s: %w", id, coins.ErrNotFoundInStorage)
+		}
+
+		code := old.Currency
+		if upd.Currency != nil && *upd.Currency != old.Currency {
+			if err = checkUnused(ctx, tx, old); err != nil {
+				return err
+			}
+			code = *upd.Currency
+		}
+		if upd.Balance != nil {
+			c, err := currency.Lookup(code)
+			if err != nil {
+				return err
+			}
+			if !c.Fits(*upd.Balance) {
+				return fmt.Errorf("%s %s: %w", upd.Balance, code, coins.ErrInvalidAmount)
+			}
+		}
+
+		err = tx.GetContext(ctx, &acc, `update accounts
+			set balance = coalesce($2, balance), currency = coalesce($3, currency)
+			where id = $1
+			returning `+accountColumns, id, upd.Balance, upd.Currency)
+		if err != nil {
+			return fmt.Errorf("failed to update account: %w", err)
+		}
+
+		delta := acc.Balance.Sub(old.Balance)
+		if delta.IsZero() {
+			return nil
+		}
+		t := ledger.Transfer(ledger.AdjustmentAccount, acc.ID, delta, acc.Currency)
+		t.Description = "balance adjustment"
+		return postTransaction(ctx, tx, t)
+	})
+
+	return acc, err
+}
+
+// checkUnused returns an error if the locked account has funds, holds or ledger postings,
+// the currency of such an account can not be changed without re-denominating its balance
+func checkUnused(ctx context.Context, tx *sqlx.Tx, acc account.Account) error {
+	if !acc.Balance.IsZero() || !acc.Held.IsZero() {
+		return fmt.Errorf("account %s: %w", acc.ID, coins.ErrCurrencyInUse)
+	}
+
+	var posted bool
+	err := tx.GetContext(ctx, &posted, `select exists(select 1 from postings where account_id = $1)`, acc.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check postings: %w", err)
+	}
+	if posted {
+		return fmt.Errorf("account %s: %w", acc.ID, coins.ErrCurrencyInUse)
+	}
+
+	return nil
+}
+
+// GetStatement function returns the account statement for the period from inclusive to exclusive,
+// a nil bound leaves the period open on that side
+func (s *Storage) GetStatement(ctx context.Context, id string, from, to *time.Time) (st account.Statement, err error) {
+	err = s.inReadTx(ctx, func(tx *sqlx.Tx) error {
+		var acc account.Account
+		err := tx.GetContext(ctx, &acc, `select `+accountColumns+` from accounts where id = $1`, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("account %s: %w", id, coins.ErrNotFoundInStorage)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get account: %w", err)
+		}
+
+		var opening decimal.Decimal
+		if from != nil {
+			err = tx.GetContext(ctx, &opening, `select coalesce(sum(p.amount), 0)
+				from postings as p join journal as j on j.id = p.journal_id
+				where p.account_id = $1 and j.dt < $2`, id, from)
+			if err != nil {
+				return fmt.Errorf("failed to get opening balance: %w", err)
+			}
+		}
+
+		var entries []ledger.Entry
+		err = tx.SelectContext(ctx, &entries, `select p.id, p.journal_id, j.payment_id, p.account_id, p.amount, p.currency, j.description, j.dt
+			from postings as p join journal as j on j.id = p.journal_id
+			where p.account_id = $1
+			  and ($2::timestamp is null or j.dt >= $2)
+			  and ($3::timestamp is null or j.dt < $3)
+			order by p.id`, id, from, to)
+		if err != nil {
+			return fmt.Errorf("failed to get statement postings: %w", err)
+		}
+
+		var payments []payment.Payment
+		err = tx.SelectContext(ctx, &payments, `select `+paymentColumns+`
+			from payments
+			where id in (select j.payment_id
+				from postings as p join journal as j on j.id = p.journal_id
+				where p.account_id = $1
+				  and ($2::timestamp is null or j.dt >= $2)
+				  and ($3::timestamp is null or j.dt < $3))`, id, from, to)
+		if err != nil {
+			return fmt.Errorf("failed to get statement payments: %w", err)
+		}
+		byID := make(map[uint64]payment.Payment, len(payments))
+		for _, p := range payments {
+			byID[p.ID] = p
+		}
+
+		st = account.Statement{
+			AccountID:      acc.ID,
+			Currency:       acc.Currency,
+			From:           from,
+			To:             to,
+			OpeningBalance: opening,
+			Lines:          make([]account.StatementLine, 0, len(entries)),
+		}
+		balance := st.OpeningBalance
+		for _, e := range entries {
+			balance = balance.Add(e.Amount)
+			line := account.StatementLine{Description: e.Description, Amount: e.Amount, Balance: balance}
+			if e.PaymentID != nil {
+				if p, ok := byID[*e.PaymentID]; ok {
+					line.Payment = &p
+				}
+			}
+			st.Lines = append(st.Lines, line)
+		}
+		st.ClosingBalance = balance
+
+		return nil
+	})
+
+	return st, err
+}
+
 func (s *Storage) Close() error {
 	if s.db != nil {
 		err := s.db.Close()
@@ -2,8 +2,22 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/donmikel/coins/pkg/account"
+	"github.com/donmikel/coins/pkg/audit"
+	"github.com/donmikel/coins/pkg/auth"
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/event"
+	"github.com/donmikel/coins/pkg/fx"
+	"github.com/donmikel/coins/pkg/hold"
+	"github.com/donmikel/coins/pkg/limit"
 	"github.com/donmikel/coins/pkg/payment"
+	"github.com/donmikel/coins/pkg/pending"
+	"github.com/donmikel/coins/pkg/risk"
+	"github.com/donmikel/coins/pkg/schedule"
+	"github.com/donmikel/coins/pkg/webhook"
 	"github.com/jmoiron/sqlx"
 	_ "github.com/lib/pq"
 	"github.com/shopspring/decimal"
@@ -11,6 +25,7 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Environment variables used to connect to a test PostgresSQL database.
@@ -59,7 +74,8 @@ func getTestStorage(tb testing.TB) (*Storage, func()) {
 
 	//Clear test data
 
-	_, err = db.Exec("TRUNCATE TABLE accounts; TRUNCATE TABLE payments; ")
+	_, err = db.Exec("TRUNCATE TABLE accounts, payments, idempotency_keys, journal, postings, fx_quotes, schedules, holds, outbox, " +
+		"webhook_subscriptions, webhook_deliveries, api_keys, account_changes, transfer_limits, pending_payments;")
 	if err != nil {
 		tb.Fatalf("failed to truncate table: %s", err)
 	}
@@ -103,7 +119,91 @@ func TestAccounts(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	assert.ElementsMatch(t, wantAccounts, result)
+	ids := make([]string, 0, len(result))
+	for _, acc := range result {
+		ids = append(ids, acc.ID)
+		assert.Equal(t, "USD", acc.Currency)
+	}
+	assert.ElementsMatch(t, wantAccounts, ids)
+}
+
+func TestAccountCRUD(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+
+	created, err := s.CreateAccount(ctx, account.Account{ID: "carol789", Balance: decimal.NewFromInt(5), Currency: "USD", Owner: "carol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "carol789", created.ID)
+	assert.Equal(t, "carol", created.Owner)
+	assert.Equal(t, account.Active, created.Status)
+
+	_, err = s.CreateAccount(ctx, account.Account{ID: "carol789", Currency: "USD"})
+	assert.True(t, errors.Is(err, coins.ErrAlreadyExistsInStorage))
+
+	// The currency of a funded account is not changed, it would re-denominate the balance.
+	currency := "EUR"
+	_, err = s.UpdateAccount(ctx, "carol789", account.AccountUpdate{Currency: &currency})
+	assert.True(t, errors.Is(err, coins.ErrCurrencyInUse))
+
+	if _, err = s.CreateAccount(ctx, account.Account{ID: "carol790", Currency: "USD", Owner: "carol"}); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := s.UpdateAccount(ctx, "carol790", account.AccountUpdate{Currency: &currency})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, currency, updated.Currency)
+
+	balance := decimal.New(1, -3)
+	_, err = s.UpdateAccount(ctx, "carol790", account.AccountUpdate{Balance: &balance})
+	assert.True(t, errors.Is(err, coins.ErrInvalidAmount))
+
+	balance = decimal.NewFromInt(5)
+	if _, err = s.UpdateAccount(ctx, "carol790", account.AccountUpdate{Balance: &balance}); err != nil {
+		t.Fatal(err)
+	}
+	// An adjusted account has postings even if its balance is adjusted back to zero.
+	balance = decimal.Zero
+	if _, err = s.UpdateAccount(ctx, "carol790", account.AccountUpdate{Balance: &balance}); err != nil {
+		t.Fatal(err)
+	}
+	currency = "USD"
+	_, err = s.UpdateAccount(ctx, "carol790", account.AccountUpdate{Currency: &currency})
+	assert.True(t, errors.Is(err, coins.ErrCurrencyInUse))
+
+	// An account with funds is not closed.
+	closing := account.Change{AccountID: "carol789", Type: account.StatusChange, Status: account.Closed, Reason: "closed by the owner", Actor: "carol"}
+	_, err = s.SetAccountStatus(ctx, closing, account.Active)
+	assert.True(t, errors.Is(err, coins.ErrAccountInUse), "got %v", err)
+	balance = decimal.Zero
+	if _, err = s.UpdateAccount(ctx, "carol789", account.AccountUpdate{Balance: &balance}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.SetAccountStatus(ctx, closing, account.Active); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.SetAccountStatus(ctx, closing, account.Active)
+	assert.True(t, errors.Is(err, coins.ErrNotFoundInStorage))
+
+	got, err := s.GetAccount(ctx, "carol789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, account.Closed, got.Status)
+
+	accounts, err := s.GetAvailableAccounts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, acc := range accounts {
+		assert.NotEqual(t, "carol789", acc.ID)
+	}
+
+	_, err = s.GetAccount(ctx, "unknown")
+	assert.True(t, errors.Is(err, coins.ErrNotFoundInStorage))
 }
 
 func TestPayments(t *testing.T) {
@@ -124,13 +224,17 @@ func TestPayments(t *testing.T) {
 	}
 	t.Log(wantPayments)
 	for _, wantPayment := range wantPayments {
-		err := s.SendPayment(context.Background(), wantPayment)
+		created, err := s.SendPayment(context.Background(), wantPayment)
 		t.Log(wantPayment)
 		if err != nil {
 			t.Fatal(err)
 		}
-		var resultPayment payment.Payment
-		s.db.Get(&resultPayment, "SELECT * FROM payments WHERE from_account = $1", wantPayment.FromAccount)
+		assert.NotZero(t, created.ID)
+		assert.NotNil(t, created.Dt)
+		resultPayment, err := s.GetPayment(context.Background(), created.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
 
 		wf, _ := wantPayment.Amount.Float64()
 		rf, _ := resultPayment.Amount.Float64()
@@ -141,11 +245,12 @@ func TestPayments(t *testing.T) {
 		assert.Equal(t, wantPayment.Direction, resultPayment.Direction)
 	}
 
-	allPayments, err := s.GetAllPayments(context.Background())
-	t.Log(len(allPayments))
+	page, err := s.GetAllPayments(context.Background(), payment.Filter{})
 	if err != nil {
 		t.Fatal(err)
 	}
+	allPayments := page.Payments
+	t.Log(len(allPayments))
 	t.Log(wantPayments)
 	t.Log(allPayments)
 
@@ -162,16 +267,1235 @@ func TestPayments(t *testing.T) {
 	}
 }
 
-func mustNewPayment(fn func(c payment.Payment)) payment.Payment {
-	c := payment.Payment{
-		FromAccount: "bob123",
-		Amount:      decimal.NewFromInt(100),
-		ToAccount:   "alice456",
-		Direction:   1,
+func TestPaymentsPagination(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if _, err := s.SendPayment(ctx, mustNewPayment(func(p *payment.Payment) {
+			p.Amount = decimal.NewFromInt(int64(i + 1))
+		})); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.SendPayment(ctx, mustNewPayment(func(p *payment.Payment) {
+		p.FromAccount = "alice456"
+		p.ToAccount = "bob123"
+		p.Amount = decimal.NewFromInt(1)
+		p.Direction = payment.Incomming
+	})); err != nil {
+		t.Fatal(err)
 	}
 
-	if fn != nil {
-		fn(c)
+	var got []payment.Payment
+	filter := payment.Filter{Account: "bob123", Limit: 2}
+	for {
+		page, err := s.GetAllPayments(ctx, filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.LessOrEqual(t, len(page.Payments), 2)
+		got = append(got, page.Payments...)
+		if page.NextCursor == 0 {
+			break
+		}
+		filter.Cursor = page.NextCursor
 	}
-	return c
+	assert.Len(t, got, 6)
+	for i := 1; i < len(got); i++ {
+		assert.Less(t, got[i-1].ID, got[i].ID)
+	}
+
+	direction := payment.Incomming
+	page, err := s.GetAllPayments(ctx, payment.Filter{Account: "bob123", Counterparty: "alice456", Direction: &direction})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, page.Payments, 1)
+
+	minAmount, maxAmount := decimal.NewFromInt(2), decimal.NewFromInt(4)
+	page, err = s.GetAllPayments(ctx, payment.Filter{MinAmount: &minAmount, MaxAmount: &maxAmount})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, page.Payments, 3)
+}
+
+func TestStatement(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+
+	for _, p := range []payment.Payment{
+		mustNewPayment(func(p *payment.Payment) { p.Amount = decimal.NewFromInt(30) }),
+		mustNewPayment(func(p *payment.Payment) {
+			p.FromAccount, p.ToAccount = "alice456", "bob123"
+			p.Amount = decimal.NewFromInt(5)
+		}),
+	} {
+		if _, err := s.SendPayment(ctx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	amount := decimal.NewFromInt(-20)
+	adjust := account.Change{AccountID: "bob123", Type: account.Adjustment, Amount: &amount, Reason: "chargeback", Actor: "ops"}
+	if _, err := s.AdjustBalance(ctx, adjust); err != nil {
+		t.Fatal(err)
+	}
+
+	// The opening balance and adjustments are statement lines without a payment.
+	st, err := s.GetStatement(ctx, "bob123", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, decimal.Zero.Equal(st.OpeningBalance), "got %s", st.OpeningBalance)
+	assert.True(t, decimal.NewFromInt(55).Equal(st.ClosingBalance), "got %s", st.ClosingBalance)
+	if assert.Len(t, st.Lines, 4) {
+		assert.Nil(t, st.Lines[0].Payment)
+		assert.Equal(t, "opening balance", st.Lines[0].Description)
+		assert.True(t, decimal.NewFromInt(100).Equal(st.Lines[0].Balance))
+		if assert.NotNil(t, st.Lines[1].Payment) {
+			assert.Equal(t, "alice456", st.Lines[1].Payment.ToAccount)
+		}
+		assert.True(t, decimal.NewFromInt(-30).Equal(st.Lines[1].Amount))
+		assert.True(t, decimal.NewFromInt(70).Equal(st.Lines[1].Balance))
+		assert.True(t, decimal.NewFromInt(5).Equal(st.Lines[2].Amount))
+		assert.True(t, decimal.NewFromInt(75).Equal(st.Lines[2].Balance))
+		assert.Nil(t, st.Lines[3].Payment)
+		assert.Equal(t, "manual adjustment: chargeback", st.Lines[3].Description)
+		assert.True(t, decimal.NewFromInt(55).Equal(st.Lines[3].Balance))
+	}
+
+	// The opening balance of a period includes adjustments made before it.
+	from := time.Now().Add(time.Minute)
+	st, err = s.GetStatement(ctx, "bob123", &from, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, decimal.NewFromInt(55).Equal(st.OpeningBalance), "got %s", st.OpeningBalance)
+	assert.Empty(t, st.Lines)
+
+	_, err = s.GetStatement(ctx, "unknown", nil, nil)
+	assert.True(t, errors.Is(err, coins.ErrNotFoundInStorage))
+}
+
+func TestExchangePayment(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+
+	if _, err := s.CreateAccount(ctx, account.Account{ID: "eve000", Currency: "EUR"}); err != nil {
+		t.Fatal(err)
+	}
+	quotes := []fx.Quote{
+		{ID: "quote1", FromCurrency: "USD", ToCurrency: "EUR", Rate: decimal.New(8, -1), ExpiresAt: time.Now().Add(time.Minute)},
+		{ID: "quote2", FromCurrency: "USD", ToCurrency: "EUR", Rate: decimal.New(8, -1), ExpiresAt: time.Now().Add(-time.Minute)},
+		{ID: "quote3", FromCurrency: "USD", ToCurrency: "EUR", Rate: decimal.New(8333, -4), ExpiresAt: time.Now().Add(time.Minute)},
+	}
+	for _, q := range quotes {
+		if err := s.CreateQuote(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p := mustNewPayment(func(p *payment.Payment) {
+		p.ToAccount = "eve000"
+		p.Amount = decimal.NewFromInt(10)
+		p.QuoteID = "quote1"
+	})
+	created, err := s.SendPayment(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "USD", created.Currency)
+	assert.Equal(t, "EUR", created.CreditCurrency)
+	assert.True(t, decimal.NewFromInt(8).Equal(created.CreditAmount))
+	assert.True(t, decimal.New(8, -1).Equal(created.Rate))
+
+	eve, err := s.GetAccount(ctx, "eve000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, decimal.NewFromInt(8).Equal(eve.Balance))
+
+	_, err = s.SendPayment(ctx, p)
+	assert.True(t, errors.Is(err, coins.ErrInvalidQuote), "got %v", err)
+
+	p.QuoteID = "quote2"
+	_, err = s.SendPayment(ctx, p)
+	assert.True(t, errors.Is(err, coins.ErrQuoteExpired), "got %v", err)
+
+	p.QuoteID = "quote3"
+	p.Amount = decimal.New(103, -2)
+	created, err = s.SendPayment(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "0.86", created.CreditAmount.String())
+}
+
+func TestPaymentErrors(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+
+	_, err := s.CreateAccount(ctx, account.Account{ID: "eve000", Balance: decimal.NewFromInt(10), Currency: "EUR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCases := []struct {
+		name    string
+		payment payment.Payment
+		wantErr error
+	}{
+		{
+			name: "unknown account",
+			payment: mustNewPayment(func(p *payment.Payment) {
+				p.ToAccount = "unknown"
+			}),
+			wantErr: coins.ErrUnknownAccount,
+		},
+		{
+			name: "currency mismatch",
+			payment: mustNewPayment(func(p *payment.Payment) {
+				p.ToAccount = "eve000"
+			}),
+			wantErr: coins.ErrCurrencyMismatch,
+		},
+		{
+			name: "insufficient funds",
+			payment: mustNewPayment(func(p *payment.Payment) {
+				p.Amount = decimal.NewFromInt(1000)
+			}),
+			wantErr: coins.ErrInsufficientFunds,
+		},
+		{
+			name: "same account",
+			payment: mustNewPayment(func(p *payment.Payment) {
+				p.ToAccount = p.FromAccount
+			}),
+			wantErr: coins.ErrSameAccount,
+		},
+		{
+			name: "amount precision",
+			payment: mustNewPayment(func(p *payment.Payment) {
+				p.Amount = decimal.New(1, -3)
+			}),
+			wantErr: coins.ErrInvalidAmount,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := s.SendPayment(ctx, tc.payment)
+			assert.True(t, errors.Is(err, tc.wantErr), "got %v", err)
+		})
+	}
+
+	bob, err := s.GetAccount(ctx, "bob123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, decimal.NewFromInt(100).Equal(bob.Balance))
+}
+
+func TestIdempotentPayment(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+
+	p := mustNewPayment(func(p *payment.Payment) {
+		p.Amount = decimal.NewFromInt(10)
+		p.IdempotencyKey = "key-1"
+	})
+	first, err := s.SendPayment(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replay, err := s.SendPayment(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, first.ID, replay.ID)
+
+	bob, err := s.GetAccount(ctx, "bob123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, decimal.NewFromInt(90).Equal(bob.Balance))
+
+	p.Amount = decimal.NewFromInt(20)
+	_, err = s.SendPayment(ctx, p)
+	assert.True(t, errors.Is(err, coins.ErrIdempotencyKey), "got %v", err)
+}
+
+func TestLedger(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+
+	for _, acc := range []account.Account{
+		{ID: "dave001", Balance: decimal.NewFromInt(50), Currency: "USD"},
+		{ID: "erin002", Currency: "USD"},
+	} {
+		if _, err := s.CreateAccount(ctx, acc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	created, err := s.SendPayment(ctx, mustNewPayment(func(p *payment.Payment) {
+		p.FromAccount = "dave001"
+		p.ToAccount = "erin002"
+		p.Amount = decimal.NewFromInt(20)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	balance := decimal.NewFromInt(45)
+	if _, err := s.UpdateAccount(ctx, "erin002", account.AccountUpdate{Balance: &balance}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := s.GetLedgerEntries(ctx, "dave001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, entries, 2) {
+		assert.True(t, decimal.NewFromInt(50).Equal(entries[0].Amount))
+		assert.True(t, decimal.NewFromInt(-20).Equal(entries[1].Amount))
+		if assert.NotNil(t, entries[1].PaymentID) {
+			assert.Equal(t, created.ID, *entries[1].PaymentID)
+		}
+	}
+
+	entries, err = s.GetLedgerEntries(ctx, "erin002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, entries, 2) {
+		assert.True(t, decimal.NewFromInt(20).Equal(entries[0].Amount))
+		assert.True(t, decimal.NewFromInt(25).Equal(entries[1].Amount))
+	}
+
+	mismatches, err := s.VerifyLedger(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range mismatches {
+		assert.NotEqual(t, "dave001", m.AccountID)
+		assert.NotEqual(t, "erin002", m.AccountID)
+	}
+}
+
+func TestRefundPayment(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+
+	sent, err := s.SendPayment(ctx, mustNewPayment(func(p *payment.Payment) {
+		p.Amount = decimal.NewFromInt(10)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	amount := decimal.NewFromInt(4)
+	partial, err := s.RefundPayment(ctx, sent.ID, payment.RefundInput{Amount: &amount})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "alice456", partial.FromAccount)
+	assert.Equal(t, "bob123", partial.ToAccount)
+	assert.Equal(t, &sent.ID, partial.RefundOf)
+	assert.True(t, amount.Equal(partial.Amount))
+
+	rest, err := s.RefundPayment(ctx, sent.ID, payment.RefundInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, decimal.NewFromInt(6).Equal(rest.Amount))
+
+	_, err = s.RefundPayment(ctx, sent.ID, payment.RefundInput{})
+	assert.True(t, errors.Is(err, coins.ErrRefundExceeded), "got %v", err)
+	_, err = s.RefundPayment(ctx, rest.ID, payment.RefundInput{})
+	assert.True(t, errors.Is(err, coins.ErrNotRefundable), "got %v", err)
+	_, err = s.RefundPayment(ctx, rest.ID+1, payment.RefundInput{})
+	assert.True(t, errors.Is(err, coins.ErrNotFoundInStorage), "got %v", err)
+
+	bob, err := s.GetAccount(ctx, "bob123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, decimal.NewFromInt(100).Equal(bob.Balance))
+}
+
+func TestParkRefund(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+
+	sent, err := s.SendPayment(ctx, mustNewPayment(func(p *payment.Payment) {
+		p.Amount = decimal.NewFromInt(10)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A refund parked without an amount refunds the rest of the payment.
+	decisions := []risk.Decision{{Rule: risk.ApprovalThresholdRule, Outcome: risk.Review, Reason: "above threshold"}}
+	parked, err := s.ParkPayment(ctx, pending.NewRefund(sent.ID, "alice456", "bob123", decimal.Zero, decisions, "alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.NotNil(t, parked.PendingID) {
+		return
+	}
+	assert.Equal(t, &sent.ID, parked.RefundOf)
+	assert.True(t, decimal.NewFromInt(10).Equal(parked.Amount))
+
+	amount := decimal.NewFromInt(11)
+	_, err = s.ParkPayment(ctx, pending.NewRefund(sent.ID, "alice456", "bob123", amount, decisions, "alice"))
+	assert.True(t, errors.Is(err, coins.ErrRefundExceeded), "got %v", err)
+
+	pp, err := s.ApprovePendingPayment(ctx, *parked.PendingID, pending.Review{By: "ops", Reason: "returned goods"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.NotNil(t, pp.PaymentID) {
+		refund, err := s.GetPayment(ctx, *pp.PaymentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, &sent.ID, refund.RefundOf)
+		assert.Equal(t, "alice", refund.InitiatedBy)
+		assert.Equal(t, "ops", refund.ApprovedBy)
+	}
+
+	bob, err := s.GetAccount(ctx, "bob123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, decimal.NewFromInt(100).Equal(bob.Balance))
+}
+
+func TestSchedules(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	retry := schedule.Retry{MaxAttempts: 2, Delay: time.Minute}
+	// The check skips payments above 500, as risk rules do.
+	check := func(ctx context.Context, p payment.Payment) error {
+		if p.Amount.GreaterThan(decimal.NewFromInt(500)) {
+			return errors.New("denied")
+		}
+		return nil
+	}
+
+	newSchedule := func(amount int64) schedule.Schedule {
+		return schedule.Schedule{
+			FromAccount: "bob123",
+			ToAccount:   "alice456",
+			Amount:      decimal.NewFromInt(amount),
+			Spec:        "@every 1h",
+			Status:      schedule.Active,
+			NextRun:     now.Add(-time.Minute),
+		}
+	}
+
+	ok, err := s.CreateSchedule(ctx, newSchedule(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing, err := s.CreateSchedule(ctx, newSchedule(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unknown := newSchedule(10)
+	unknown.ToAccount = "unknown"
+	_, err = s.CreateSchedule(ctx, unknown)
+	assert.True(t, errors.Is(err, coins.ErrUnknownAccount), "got %v", err)
+
+	for i := 0; i < 2; i++ {
+		_, due, err := s.RunDueSchedule(ctx, now, retry, check)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, due)
+	}
+	_, due, err := s.RunDueSchedule(ctx, now, retry, check)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, due)
+
+	ok, err = s.GetSchedule(ctx, ok.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, ok.LastPaymentID)
+	assert.Empty(t, ok.LastError)
+	assert.True(t, now.Add(59*time.Minute).Equal(ok.NextRun), "got %v", ok.NextRun)
+
+	failing, err = s.GetSchedule(ctx, failing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, failing.Attempts)
+	assert.NotNil(t, failing.RetryAt)
+	assert.Contains(t, failing.LastError, "denied")
+	assert.Nil(t, failing.LastPaymentID)
+
+	bob, err := s.GetAccount(ctx, "bob123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, decimal.NewFromInt(90).Equal(bob.Balance))
+
+	if err := s.CancelSchedule(ctx, failing.ID); err != nil {
+		t.Fatal(err)
+	}
+	err = s.CancelSchedule(ctx, failing.ID)
+	assert.True(t, errors.Is(err, coins.ErrNotFoundInStorage), "got %v", err)
+
+	schedules, err := s.GetSchedules(ctx, "bob123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, schedules, 2) {
+		assert.Equal(t, schedule.Cancelled, schedules[1].Status)
+	}
+}
+
+func TestSendPayments(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+
+	newPayment := func(amount int64) payment.Payment {
+		return mustNewPayment(func(p *payment.Payment) { p.Amount = decimal.NewFromInt(amount) })
+	}
+
+	// The second payment overdraws the account, so the atomic batch sends nothing.
+	_, _, err := s.SendPayments(ctx, []payment.Payment{newPayment(60), newPayment(60)}, payment.Atomic)
+	assert.True(t, errors.Is(err, coins.ErrInsufficientFunds), "got %v", err)
+	bob, err := s.GetAccount(ctx, "bob123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, decimal.NewFromInt(100).Equal(bob.Balance))
+
+	created, errs, err := s.SendPayments(ctx, []payment.Payment{newPayment(60), newPayment(60), newPayment(40)}, payment.BestEffort)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, errs[0])
+	assert.True(t, errors.Is(errs[1], coins.ErrInsufficientFunds), "got %v", errs[1])
+	assert.NoError(t, errs[2])
+	assert.NotZero(t, created[0].ID)
+	assert.NotZero(t, created[2].ID)
+
+	bob, err = s.GetAccount(ctx, "bob123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, bob.Balance.IsZero())
+}
+
+func TestOutbox(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+
+	p, err := s.SendPayment(ctx, mustNewPayment(func(p *payment.Payment) { p.Amount = decimal.NewFromInt(10) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	refund, err := s.RefundPayment(ctx, p.ID, payment.RefundInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A failed payment writes no event.
+	_, err = s.SendPayment(ctx, mustNewPayment(func(p *payment.Payment) { p.Amount = decimal.NewFromInt(1000) }))
+	assert.Error(t, err)
+
+	events, err := s.UnpublishedEvents(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, event.PaymentCreated, events[0].Type)
+		assert.Equal(t, event.PaymentRefunded, events[1].Type)
+		var got payment.Payment
+		if err := json.Unmarshal(events[1].Payload, &got); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, refund.ID, got.ID)
+
+		if err := s.MarkPublished(ctx, events[0].ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	events, err = s.UnpublishedEvents(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, events, 1)
+}
+
+func TestWebhooks(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+	now := time.Now()
+
+	sub, err := s.CreateSubscription(ctx, webhook.Subscription{AccountID: "alice456", URL: "https://example.com/hooks", Secret: "0123456789abcdef"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.CreateSubscription(ctx, webhook.Subscription{AccountID: "unknown", URL: "https://example.com/hooks", Secret: "0123456789abcdef"})
+	assert.True(t, errors.Is(err, coins.ErrUnknownAccount), "got %v", err)
+
+	_, err = s.SendPayment(ctx, mustNewPayment(func(p *payment.Payment) { p.Amount = decimal.NewFromInt(10) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	events, err := s.UnpublishedEvents(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, events, 1) {
+		return
+	}
+	// Enqueuing the same event again adds no deliveries.
+	for i, want := range []int64{1, 0} {
+		n, err := s.EnqueueDeliveries(ctx, events[0], []string{"bob123", "alice456"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, want, n, "enqueue %d", i)
+	}
+
+	task, ok, err := s.ClaimDelivery(ctx, now.Add(time.Second), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, sub.Secret, task.Subscription.Secret)
+	assert.Equal(t, events[0].ID, task.Event.ID)
+	assert.Equal(t, event.PaymentCreated, task.Delivery.EventType)
+
+	// A claimed delivery is leased.
+	_, ok, err = s.ClaimDelivery(ctx, now.Add(time.Second), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, ok)
+
+	d := task.Delivery.Complete(now, 200, nil, webhook.Retry{MaxAttempts: 3, Delay: time.Minute})
+	if err := s.CompleteDelivery(ctx, d); err != nil {
+		t.Fatal(err)
+	}
+	deliveries, err := s.GetDeliveries(ctx, sub.ID, webhook.DeliveryLogSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, deliveries, 1) {
+		assert.Equal(t, webhook.Delivered, deliveries[0].Status)
+		assert.Equal(t, 1, deliveries[0].Attempts)
+	}
+
+	if err := s.DeleteSubscription(ctx, sub.ID); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.GetDeliveries(ctx, sub.ID, webhook.DeliveryLogSize)
+	assert.True(t, errors.Is(err, coins.ErrNotFoundInStorage), "got %v", err)
+}
+
+func TestHolds(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	newHold := func(amount int64, expiresAt time.Time) hold.Hold {
+		return hold.Hold{
+			FromAccount: "bob123",
+			ToAccount:   "alice456",
+			Amount:      decimal.NewFromInt(amount),
+			Direction:   payment.Outgoing,
+			Status:      hold.Authorized,
+			ExpiresAt:   expiresAt,
+		}
+	}
+
+	captured, err := s.AuthorizeHold(ctx, newHold(40, now.Add(time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	voided, err := s.AuthorizeHold(ctx, newHold(30, now.Add(time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := s.AuthorizeHold(ctx, newHold(20, now.Add(time.Second)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.AuthorizeHold(ctx, newHold(10, now.Add(-time.Second)))
+	assert.True(t, errors.Is(err, coins.ErrHoldExpiration), "got %v", err)
+
+	// Held funds are not available for other payments and holds.
+	_, err = s.AuthorizeHold(ctx, newHold(20, now.Add(time.Hour)))
+	assert.True(t, errors.Is(err, coins.ErrInsufficientFunds), "got %v", err)
+	_, err = s.SendPayment(ctx, mustNewPayment(func(p *payment.Payment) { p.Amount = decimal.NewFromInt(20) }))
+	assert.True(t, errors.Is(err, coins.ErrInsufficientFunds), "got %v", err)
+
+	bob, err := s.GetAccount(ctx, "bob123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, decimal.NewFromInt(100).Equal(bob.Balance))
+	assert.True(t, decimal.NewFromInt(10).Equal(bob.Available()))
+
+	over := decimal.NewFromInt(50)
+	_, err = s.CaptureHold(ctx, captured.ID, hold.CaptureInput{Amount: &over})
+	assert.True(t, errors.Is(err, coins.ErrCaptureExceeded), "got %v", err)
+
+	partial := decimal.NewFromInt(25)
+	captured, err = s.CaptureHold(ctx, captured.ID, hold.CaptureInput{Amount: &partial})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, hold.Captured, captured.Status)
+	if assert.NotNil(t, captured.PaymentID) {
+		p, err := s.GetPayment(ctx, *captured.PaymentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.True(t, partial.Equal(p.Amount))
+	}
+
+	voided, err = s.VoidHold(ctx, voided.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, hold.Voided, voided.Status)
+	_, err = s.CaptureHold(ctx, voided.ID, hold.CaptureInput{})
+	assert.True(t, errors.Is(err, coins.ErrHoldFinalized), "got %v", err)
+
+	n, err := s.ExpireHolds(ctx, now.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(1), n)
+	expired, err = s.GetHold(ctx, expired.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, hold.Expired, expired.Status)
+
+	bob, err = s.GetAccount(ctx, "bob123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, decimal.NewFromInt(75).Equal(bob.Balance))
+	assert.True(t, bob.Held.IsZero())
+
+	_, err = s.GetHold(ctx, 0)
+	assert.True(t, errors.Is(err, coins.ErrNotFoundInStorage), "got %v", err)
+}
+
+func mustNewPayment(fn func(c *payment.Payment)) payment.Payment {
+	c := payment.Payment{
+		FromAccount: "bob123",
+		Amount:      decimal.NewFromInt(100),
+		ToAccount:   "alice456",
+		Direction:   1,
+	}
+
+	if fn != nil {
+		fn(&c)
+	}
+	return c
+}
+
+func TestListenPayments(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	got := make(chan *payment.Payment, 10)
+	done := make(chan error)
+	go func() {
+		done <- s.ListenPayments(ctx, func(p *payment.Payment) { got <- p })
+	}()
+	// Give the listener time to start listening.
+	time.Sleep(100 * time.Millisecond)
+
+	// A failed payment is not notified.
+	_, err := s.SendPayment(ctx, mustNewPayment(func(p *payment.Payment) { p.Amount = decimal.NewFromInt(1000) }))
+	assert.Error(t, err)
+	p, err := s.SendPayment(ctx, mustNewPayment(func(p *payment.Payment) { p.Amount = decimal.NewFromInt(10) }))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case n := <-got:
+		if assert.NotNil(t, n) {
+			assert.Equal(t, p.ID, n.ID)
+			assert.True(t, p.Amount.Equal(n.Amount))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("payment is not notified")
+	}
+
+	cancel()
+	assert.NoError(t, <-done)
+	assert.Len(t, got, 0)
+}
+
+func TestAPIKeys(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+
+	if err := s.CreateAPIKey(ctx, "hash", auth.Principal{ID: "ops", Role: auth.Operator}); err != nil {
+		t.Fatal(err)
+	}
+	err := s.CreateAPIKey(ctx, "hash", auth.Principal{ID: "alice", Role: auth.Customer})
+	assert.True(t, errors.Is(err, coins.ErrAlreadyExistsInStorage))
+
+	p, err := s.GetAPIKey(ctx, "hash")
+	assert.NoError(t, err)
+	assert.Equal(t, auth.Principal{ID: "ops", Role: auth.Operator}, p)
+
+	_, err = s.GetAPIKey(ctx, "unknown")
+	assert.True(t, errors.Is(err, coins.ErrNotFoundInStorage))
+}
+
+func TestAccountChanges(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+
+	status := func(id string, status account.Status) account.Change {
+		return account.Change{AccountID: id, Type: account.StatusChange, Status: status, Reason: "fraud investigation", Actor: "ops"}
+	}
+
+	acc, err := s.SetAccountStatus(ctx, status("bob123", account.FrozenDebit))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, account.FrozenDebit, acc.Status)
+
+	_, err = s.SetAccountStatus(ctx, status("bob123", account.FrozenDebit))
+	assert.True(t, errors.Is(err, coins.ErrInvalidTransition))
+
+	// The owner closes only active accounts.
+	_, err = s.SetAccountStatus(ctx, status("bob123", account.Closed), account.Active)
+	assert.True(t, errors.Is(err, coins.ErrInvalidTransition))
+
+	if _, err = s.SetAccountStatus(ctx, status("bob123", account.Active)); err != nil {
+		t.Fatal(err)
+	}
+
+	amount := decimal.NewFromInt(-40)
+	adjust := account.Change{AccountID: "bob123", Type: account.Adjustment, Amount: &amount, Reason: "chargeback", Actor: "ops"}
+	acc, err = s.AdjustBalance(ctx, adjust)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, decimal.NewFromInt(60).Equal(acc.Balance))
+
+	tooMuch := decimal.NewFromInt(-100)
+	adjust.Amount = &tooMuch
+	_, err = s.AdjustBalance(ctx, adjust)
+	assert.True(t, errors.Is(err, coins.ErrInsufficientFunds))
+
+	_, err = s.SetAccountStatus(ctx, status("unknown", account.FrozenAll))
+	assert.True(t, errors.Is(err, coins.ErrNotFoundInStorage))
+
+	changes, err := s.GetAccountChanges(ctx, "bob123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := make([]account.ChangeType, 0, len(changes))
+	for _, c := range changes {
+		types = append(types, c.Type)
+		assert.Equal(t, "ops", c.Actor)
+	}
+	assert.Equal(t, []account.ChangeType{account.StatusChange, account.StatusChange, account.Adjustment}, types)
+	assert.Equal(t, account.FrozenDebit, changes[0].Status)
+	assert.Equal(t, account.Active, changes[1].Status)
+	assert.True(t, amount.Equal(*changes[2].Amount))
+}
+
+func TestAccountStatusPayments(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+
+	setStatus := func(id string, status account.Status) {
+		_, err := s.SetAccountStatus(ctx, account.Change{AccountID: id, Type: account.StatusChange, Status: status, Reason: "test", Actor: "ops"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	send := func(from, to string) error {
+		_, err := s.SendPayment(ctx, mustNewPayment(func(p *payment.Payment) {
+			p.FromAccount, p.ToAccount, p.Amount = from, to, decimal.New(1, -2)
+		}))
+		return err
+	}
+
+	// A frozen-debit account receives payments but does not send them.
+	setStatus("alice456", account.FrozenDebit)
+	assert.NoError(t, send("bob123", "alice456"))
+	assert.True(t, errors.Is(send("alice456", "bob123"), coins.ErrAccountFrozen))
+	_, err := s.AuthorizeHold(ctx, hold.Hold{FromAccount: "alice456", ToAccount: "bob123", Amount: decimal.New(1, -2),
+		Status: hold.Authorized, ExpiresAt: time.Now().Add(time.Hour)})
+	assert.True(t, errors.Is(err, coins.ErrAccountFrozen))
+
+	// A frozen-all account neither sends nor receives them.
+	setStatus("alice456", account.FrozenAll)
+	assert.True(t, errors.Is(send("bob123", "alice456"), coins.ErrAccountFrozen))
+
+	// An account is closed only without funds and obligations.
+	_, err = s.SetAccountStatus(ctx, account.Change{AccountID: "alice456", Type: account.StatusChange, Status: account.Closed, Reason: "test", Actor: "ops"})
+	assert.True(t, errors.Is(err, coins.ErrAccountInUse), "got %v", err)
+	emptied := decimal.New(-2, -2)
+	if _, err = s.AdjustBalance(ctx, account.Change{AccountID: "alice456", Type: account.Adjustment, Amount: &emptied, Reason: "test", Actor: "ops"}); err != nil {
+		t.Fatal(err)
+	}
+	sch, err := s.CreateSchedule(ctx, schedule.Schedule{FromAccount: "bob123", ToAccount: "alice456", Amount: decimal.NewFromInt(1),
+		Spec: "@daily", Status: schedule.Active, NextRun: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.SetAccountStatus(ctx, account.Change{AccountID: "alice456", Type: account.StatusChange, Status: account.Closed, Reason: "test", Actor: "ops"})
+	assert.True(t, errors.Is(err, coins.ErrAccountInUse), "got %v", err)
+	if err = s.CancelSchedule(ctx, sch.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	setStatus("alice456", account.Closed)
+	assert.True(t, errors.Is(send("bob123", "alice456"), coins.ErrUnknownAccount))
+	accounts, err := s.GetAvailableAccounts(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, acc := range accounts {
+		assert.NotEqual(t, "alice456", acc.ID)
+	}
+
+	// Closed accounts are final.
+	_, err = s.SetAccountStatus(ctx, account.Change{AccountID: "alice456", Type: account.StatusChange, Status: account.Active, Reason: "test", Actor: "ops"})
+	assert.True(t, errors.Is(err, coins.ErrNotFoundInStorage))
+}
+
+func TestTransferLimits(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+
+	amount := func(v int64) *decimal.Decimal {
+		d := decimal.NewFromInt(v)
+		return &d
+	}
+	send := func(v int64) error {
+		_, err := s.SendPayment(ctx, mustNewPayment(func(p *payment.Payment) {
+			p.FromAccount, p.ToAccount, p.Amount = "bob123", "alice456", decimal.NewFromInt(v)
+		}))
+		return err
+	}
+
+	// Limits of the currency apply to accounts without limits of their own.
+	_, err := s.SetLimits(ctx, limit.Limits{Currency: "USD", MaxPayment: amount(10), UpdatedBy: "ops"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exceeded *limit.ExceededError
+	if assert.True(t, errors.As(send(11), &exceeded)) {
+		assert.Equal(t, limit.MaxPayment, exceeded.Kind)
+		assert.True(t, decimal.NewFromInt(10).Equal(exceeded.Remaining))
+	}
+	// Holds reserve no more than a payment may send.
+	_, err = s.AuthorizeHold(ctx, hold.Hold{
+		FromAccount: "bob123",
+		ToAccount:   "alice456",
+		Amount:      decimal.NewFromInt(11),
+		Direction:   payment.Outgoing,
+		Status:      hold.Authorized,
+		ExpiresAt:   time.Now().Add(time.Hour),
+	})
+	if assert.True(t, errors.As(err, &exceeded), "got %v", err) {
+		assert.Equal(t, limit.MaxPayment, exceeded.Kind)
+	}
+
+	// Limits of the account replace the limits of the currency.
+	hourly := 3
+	l, err := s.SetLimits(ctx, limit.Limits{AccountID: "bob123", DailyTotal: amount(30), HourlyCount: &hourly, UpdatedBy: "ops"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "USD", l.Currency)
+	got, err := s.GetLimits(ctx, limit.Scope{AccountID: "bob123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, l, got)
+
+	assert.NoError(t, send(20))
+	if assert.True(t, errors.As(send(11), &exceeded)) {
+		assert.Equal(t, limit.DailyTotal, exceeded.Kind)
+		assert.True(t, decimal.NewFromInt(10).Equal(exceeded.Remaining))
+	}
+	// Authorized holds count until they are released.
+	h, err := s.AuthorizeHold(ctx, hold.Hold{
+		FromAccount: "bob123",
+		ToAccount:   "alice456",
+		Amount:      decimal.NewFromInt(4),
+		Direction:   payment.Outgoing,
+		Status:      hold.Authorized,
+		ExpiresAt:   time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.True(t, errors.As(send(7), &exceeded)) {
+		assert.Equal(t, limit.DailyTotal, exceeded.Kind)
+		assert.True(t, decimal.NewFromInt(6).Equal(exceeded.Remaining))
+	}
+	if _, err = s.VoidHold(ctx, h.ID); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, send(5))
+	assert.NoError(t, send(5))
+	if assert.True(t, errors.As(send(1), &exceeded)) {
+		assert.Equal(t, limit.HourlyCount, exceeded.Kind)
+	}
+
+	// A rejected payment changes nothing.
+	acc, err := s.GetAccount(ctx, "bob123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, decimal.NewFromInt(70).Equal(acc.Balance))
+
+	assert.NoError(t, s.DeleteLimits(ctx, limit.Scope{AccountID: "bob123"}))
+	assert.True(t, errors.Is(s.DeleteLimits(ctx, limit.Scope{AccountID: "bob123"}), coins.ErrNotFoundInStorage))
+	got, err = s.GetLimits(ctx, limit.Scope{AccountID: "bob123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "", got.AccountID)
+	assert.True(t, decimal.NewFromInt(10).Equal(*got.MaxPayment))
+
+	_, err = s.SetLimits(ctx, limit.Limits{AccountID: "carol789", MaxPayment: amount(1)})
+	assert.True(t, errors.Is(err, coins.ErrNotFoundInStorage))
+	_, err = s.SetLimits(ctx, limit.Limits{Currency: "USD", MaxPayment: amount(0)})
+	assert.NoError(t, err)
+	precise := decimal.New(1, -3)
+	_, err = s.SetLimits(ctx, limit.Limits{Currency: "USD", MaxPayment: &precise})
+	assert.True(t, errors.Is(err, coins.ErrInvalidAmount))
+}
+
+func TestPendingPayments(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+
+	n, err := s.CountPayments(ctx, "bob123", "alice456", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, n)
+
+	decisions := []risk.Decision{{Rule: "new_counterparty", Outcome: risk.Review, Reason: "first payment"}}
+	p := mustNewPayment(func(p *payment.Payment) {
+		p.Amount = decimal.NewFromInt(60)
+		p.IdempotencyKey = "key-1"
+	})
+	parked, err := s.ParkPayment(ctx, pending.New(p, decisions, "bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.NotNil(t, parked.PendingID) {
+		return
+	}
+	id := *parked.PendingID
+	assert.Equal(t, "USD", parked.Currency)
+
+	// A replay returns the parked payment, nothing is sent.
+	replay, err := s.ParkPayment(ctx, pending.New(p, decisions, "bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &id, replay.PendingID)
+	replay, err = s.SendPayment(ctx, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, &id, replay.PendingID)
+
+	pp, err := s.GetPendingPayment(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, pending.Pending, pp.Status)
+	assert.Equal(t, decisions, pp.Decisions)
+	assert.Equal(t, "bob", pp.CreatedBy)
+
+	page, err := s.GetPendingPayments(ctx, pending.Filter{Status: pending.Pending, Account: "alice456"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, page.Payments, 1)
+
+	// The creator of a payment may not approve it.
+	_, err = s.ApprovePendingPayment(ctx, id, pending.Review{By: "bob", Reason: "my own"})
+	assert.True(t, errors.Is(err, coins.ErrSelfApproval), "got %v", err)
+
+	pp, err = s.ApprovePendingPayment(ctx, id, pending.Review{By: "ops", Reason: "known supplier"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, pending.Approved, pp.Status)
+	assert.Equal(t, "ops", pp.ReviewedBy)
+	if assert.NotNil(t, pp.PaymentID) {
+		replay, err = s.SendPayment(ctx, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, *pp.PaymentID, replay.ID)
+		assert.Nil(t, replay.PendingID)
+		assert.Equal(t, "bob", replay.InitiatedBy)
+		assert.Equal(t, "ops", replay.ApprovedBy)
+	}
+	n, err = s.CountPayments(ctx, "bob123", "alice456", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, n)
+
+	_, err = s.RejectPendingPayment(ctx, id, pending.Review{By: "ops", Reason: "fraud"})
+	assert.True(t, errors.Is(err, coins.ErrPaymentReviewed), "got %v", err)
+
+	// An approval failing the checks of a payment leaves the payment pending.
+	parked, err = s.ParkPayment(ctx, pending.New(mustNewPayment(func(p *payment.Payment) {
+		p.Amount = decimal.NewFromInt(60)
+	}), decisions, "bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.ApprovePendingPayment(ctx, *parked.PendingID, pending.Review{By: "ops", Reason: "known supplier"})
+	assert.True(t, errors.Is(err, coins.ErrInsufficientFunds), "got %v", err)
+	pp, err = s.RejectPendingPayment(ctx, *parked.PendingID, pending.Review{By: "ops", Reason: "fraud"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, pending.Rejected, pp.Status)
+	assert.Nil(t, pp.PaymentID)
+
+	// A payment not reviewed in time expires.
+	expiresAt := time.Now().Add(time.Hour)
+	pp = pending.New(mustNewPayment(nil), decisions, "bob")
+	pp.ExpiresAt = &expiresAt
+	parked, err = s.ParkPayment(ctx, pp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n64, err := s.ExpirePendingPayments(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(0), n64)
+	n64, err = s.ExpirePendingPayments(ctx, expiresAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, int64(1), n64)
+	pp, err = s.GetPendingPayment(ctx, *parked.PendingID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, pending.Expired, pp.Status)
+	_, err = s.ApprovePendingPayment(ctx, *parked.PendingID, pending.Review{By: "ops", Reason: "known supplier"})
+	assert.True(t, errors.Is(err, coins.ErrPaymentExpired), "got %v", err)
+
+	// A payment above an approval threshold is approved by a known principal only.
+	parked, err = s.ParkPayment(ctx, pending.New(mustNewPayment(nil), []risk.Decision{
+		{Rule: risk.ApprovalThresholdRule, Outcome: risk.Review, Reason: "above the approval threshold"},
+	}, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.ApprovePendingPayment(ctx, *parked.PendingID, pending.Review{Reason: "known supplier"})
+	assert.True(t, errors.Is(err, coins.ErrAnonymousApproval), "got %v", err)
+
+	_, err = s.GetPendingPayment(ctx, 1<<40)
+	assert.True(t, errors.Is(err, coins.ErrNotFoundInStorage))
+	_, err = s.ParkPayment(ctx, pending.New(mustNewPayment(func(p *payment.Payment) {
+		p.ToAccount = "carol789"
+	}), decisions, "bob"))
+	assert.True(t, errors.Is(err, coins.ErrUnknownAccount), "got %v", err)
+}
+
+func TestAuditLog(t *testing.T) {
+	s, teardown := getTestStorage(t)
+	defer teardown()
+	ctx := context.Background()
+
+	// The audit log is append-only, records of previous runs are kept.
+	requestID := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	var appended []audit.Record
+	for _, principal := range []string{"bob", "alice", "bob"} {
+		r, err := s.AppendAuditRecord(ctx, audit.Record{
+			Principal: principal,
+			RequestID: requestID,
+			ClientIP:  "192.0.2.1",
+			Method:    "SendPayment",
+			Input:     json.RawMessage(`{"from_account": "bob123",  "amount": "10"}`),
+			Outcome:   audit.Success,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		appended = append(appended, r)
+	}
+	assert.Equal(t, appended[0].Hash, appended[1].PrevHash)
+	assert.Equal(t, appended[1].Hash, appended[2].PrevHash)
+
+	page, err := s.GetAuditRecords(ctx, audit.Filter{RequestID: requestID, Principal: "bob", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, page.Records, 1) {
+		assert.Equal(t, appended[0].ID, page.Records[0].ID)
+		// The input is stored as is, so the hash still matches.
+		assert.Equal(t, appended[0].Hash, page.Records[0].ComputeHash())
+	}
+	assert.Equal(t, appended[0].ID, page.NextCursor)
+
+	_, err = audit.VerifyStore(ctx, s, 2)
+	assert.NoError(t, err)
+
+	conn, err := s.getConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = conn.ExecContext(ctx, `update audit_log set outcome = 'failure' where id = $1`, appended[0].ID)
+	assert.Error(t, err)
+	_, err = conn.ExecContext(ctx, `delete from audit_log where id = $1`, appended[0].ID)
+	assert.Error(t, err)
 }
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/donmikel/coins/pkg/payment"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// paymentsChannel is the notification channel of committed payments, the payload is the payment JSON.
+const paymentsChannel = "payments"
+
+// Reconnect intervals and the ping interval of the payments listener connection.
+const (
+	listenerMinReconnect = time.Second
+	listenerMaxReconnect = time.Minute
+	listenerPingInterval = time.Minute
+)
+
+// notifyPayment notifies listeners of the payment. Postgres delivers the notification
+// when the transaction commits and drops it if the transaction or savepoint is rolled back.
+func notifyPayment(ctx context.Context, tx *sqlx.Tx, p payment.Payment) error {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to encode payment notification: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, `select pg_notify($1, $2)`, paymentsChannel, string(payload)); err != nil {
+		return fmt.Errorf("failed to notify payment: %w", err)
+	}
+
+	return nil
+}
+
+// ListenPayments calls fn for every payment committed by any service instance until the context is canceled.
+// fn is called with nil after the listener reconnects, since payments could be missed while it was disconnected.
+func (s *Storage) ListenPayments(ctx context.Context, fn func(p *payment.Payment)) error {
+	listener := pq.NewListener(s.connString, listenerMinReconnect, listenerMaxReconnect, nil)
+	defer listener.Close()
+
+	if err := listener.Listen(paymentsChannel); err != nil {
+		return fmt.Errorf("failed to listen for payments: %w", err)
+	}
+
+	ticker := time.NewTicker(listenerPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case n := <-listener.Notify:
+			if n == nil {
+				fn(nil)
+				continue
+			}
+			var p payment.Payment
+			if err := json.Unmarshal([]byte(n.Extra), &p); err != nil {
+				return fmt.Errorf("failed to decode payment notification: %w", err)
+			}
+			fn(&p)
+
+		case <-ticker.C:
+			// A failed ping makes the listener reconnect.
+			listener.Ping()
+		}
+	}
+}
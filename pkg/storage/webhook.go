@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/donmikel/coins/pkg/coins"
+	"github.com/donmikel/coins/pkg/event"
+	"github.com/donmikel/coins/pkg/webhook"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// subscriptionColumns is a list of webhook_subscriptions table columns scanned into webhook.Subscription.
+const subscriptionColumns = `id, account_id, url, secret, created_at`
+
+// deliveryColumns is a list of webhook_deliveries d joined with outbox o columns scanned into webhook.Delivery.
+const deliveryColumns = `d.id, d.subscription_id, d.event_id, o.type as event_type, d.status, d.attempts,
+	d.next_attempt, d.last_attempt, d.response_status, d.last_error, d.created_at`
+
+// CreateSubscription function stores a webhook subscription of an open account.
+func (s *Storage) CreateSubscription(ctx context.Context, sub webhook.Subscription) (created webhook.Subscription, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return created, err
+	}
+
+	err = conn.GetContext(ctx, &created, `insert into webhook_subscriptions (account_id, url, secret)
+		select id, $2, $3 from accounts where id = $1 and status <> 'closed'
+		returning `+subscriptionColumns, sub.AccountID, sub.URL, sub.Secret)
+	if errors.Is(err, sql.ErrNoRows) {
+		return created, fmt.Errorf("account %s: %w", sub.AccountID, coins.ErrUnknownAccount)
+	}
+	if err != nil {
+		return created, fmt.Errorf("failed to create subscription: %w", err)
+	}
+
+	return created, nil
+}
+
+// GetSubscription function returns the webhook subscription with the given ID
+func (s *Storage) GetSubscription(ctx context.Context, id uint64) (sub webhook.Subscription, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return sub, err
+	}
+
+	err = conn.GetContext(ctx, &sub, `select `+subscriptionColumns+` from webhook_subscriptions where id = $1`, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return sub, fmt.Errorf("subscription %d: %w", id, coins.ErrNotFoundInStorage)
+	}
+	if err != nil {
+		return sub, fmt.Errorf("failed to get subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+// GetSubscriptions function returns webhook subscriptions of the account
+func (s *Storage) GetSubscriptions(ctx context.Context, accountID string) (subs []webhook.Subscription, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.SelectContext(ctx, &subs, `select `+subscriptionColumns+` from webhook_subscriptions
+		where account_id = $1 order by id`, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get subscriptions: %w", err)
+	}
+
+	return subs, nil
+}
+
+// DeleteSubscription function deletes the webhook subscription with its deliveries
+func (s *Storage) DeleteSubscription(ctx context.Context, id uint64) (err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return err
+	}
+
+	res, err := conn.ExecContext(ctx, `delete from webhook_subscriptions where id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+	if n == 0 {
+		return fmt.Errorf("subscription %d: %w", id, coins.ErrNotFoundInStorage)
+	}
+
+	return nil
+}
+
+// EnqueueDeliveries function adds a pending delivery of the event to every subscription of the accounts
+func (s *Storage) EnqueueDeliveries(ctx context.Context, e event.Event, accounts []string) (n int64, err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := conn.ExecContext(ctx, `insert into webhook_deliveries (subscription_id, event_id, status, next_attempt)
+		select id, $1, $2, now() from webhook_subscriptions where account_id = any($3)
+		on conflict (subscription_id, event_id) do nothing`, e.ID, webhook.Pending, pq.Array(accounts))
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue deliveries: %w", err)
+	}
+	n, err = res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue deliveries: %w", err)
+	}
+
+	return n, nil
+}
+
+// ClaimDelivery function claims the earliest pending delivery due at now by moving its next attempt
+// to now + lease, the delivery is attempted again after the lease unless completed.
+func (s *Storage) ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (t webhook.Task, ok bool, err error) {
+	err = s.inTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, &t.Delivery, `select `+deliveryColumns+`
+			from webhook_deliveries d join outbox o on o.id = d.event_id
+			where d.status = $1 and d.next_attempt <= $2
+			order by d.next_attempt, d.id limit 1
+			for update of d skip locked`, webhook.Pending, now)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get due delivery: %w", err)
+		}
+		ok = true
+
+		_, err = tx.ExecContext(ctx, `update webhook_deliveries set next_attempt = $2 where id = $1`,
+			t.Delivery.ID, now.Add(lease))
+		if err != nil {
+			return fmt.Errorf("failed to claim delivery: %w", err)
+		}
+		err = tx.GetContext(ctx, &t.Subscription, `select `+subscriptionColumns+` from webhook_subscriptions where id = $1`,
+			t.Delivery.SubscriptionID)
+		if err != nil {
+			return fmt.Errorf("failed to get subscription: %w", err)
+		}
+		err = tx.GetContext(ctx, &t.Event, `select id, type, payload, created_at, published_at from outbox where id = $1`,
+			t.Delivery.EventID)
+		if err != nil {
+			return fmt.Errorf("failed to get event: %w", err)
+		}
+
+		return nil
+	})
+
+	return t, ok, err
+}
+
+// CompleteDelivery function stores the result of a delivery attempt
+func (s *Storage) CompleteDelivery(ctx context.Context, d webhook.Delivery) (err error) {
+	conn, err := s.getConn()
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, `update webhook_deliveries set status = $2, attempts = $3, next_attempt = $4,
+		last_attempt = $5, response_status = $6, last_error = $7 where id = $1`,
+		d.ID, d.Status, d.Attempts, d.NextAttempt, d.LastAttempt, d.ResponseStatus, d.LastError)
+	if err != nil {
+		return fmt.Errorf("failed to complete delivery: %w", err)
+	}
+
+	return nil
+}
+
+// GetDeliveries function returns up to limit latest deliveries of the webhook subscription
+func (s *Storage) GetDeliveries(ctx context.Context, subscriptionID uint64, limit int) (deliveries []webhook.Delivery, err error) {
+	if _, err = s.GetSubscription(ctx, subscriptionID); err != nil {
+		return nil, err
+	}
+	conn, err := s.getConn()
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.SelectContext(ctx, &deliveries, `select `+deliveryColumns+`
+		from webhook_deliveries d join outbox o on o.id = d.event_id
+		where d.subscription_id = $1 order by d.id desc limit $2`, subscriptionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,157 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/donmikel/coins/pkg/event"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// Enqueuer stores deliveries of events.
+type Enqueuer interface {
+	// EnqueueDeliveries adds a pending delivery of the event to every subscription of the accounts.
+	// An event enqueued again adds no deliveries.
+	EnqueueDeliveries(ctx context.Context, e event.Event, accounts []string) (n int64, err error)
+}
+
+// Fanout is an event publisher enqueueing deliveries of every event to the subscriptions
+// of the source and destination accounts of the event payload.
+type Fanout struct {
+	Enqueuer Enqueuer
+}
+
+var _ event.Publisher = (*Fanout)(nil)
+
+// Publish enqueues deliveries of the event.
+func (f *Fanout) Publish(ctx context.Context, e event.Event) error {
+	var payload struct {
+		FromAccount string `json:"from_account"`
+		ToAccount   string `json:"to_account"`
+	}
+	if err := json.Unmarshal(e.Payload, &payload); err != nil {
+		return fmt.Errorf("failed to decode payload of event %d: %w", e.ID, err)
+	}
+	accounts := make([]string, 0, 2)
+	for _, id := range []string{payload.FromAccount, payload.ToAccount} {
+		if id != "" {
+			accounts = append(accounts, id)
+		}
+	}
+	if len(accounts) == 0 {
+		return nil
+	}
+
+	_, err := f.Enqueuer.EnqueueDeliveries(ctx, e, accounts)
+	return err
+}
+
+// Task is a claimed delivery with its subscription and event.
+type Task struct {
+	Delivery     Delivery
+	Subscription Subscription
+	Event        event.Event
+}
+
+// Store claims and completes deliveries.
+type Store interface {
+	// ClaimDelivery claims the earliest pending delivery due at now until now + lease,
+	// so concurrent workers send different deliveries. It returns false if no delivery is due.
+	ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (t Task, ok bool, err error)
+	// CompleteDelivery stores the result of a delivery attempt.
+	CompleteDelivery(ctx context.Context, d Delivery) (err error)
+}
+
+// Worker periodically sends due deliveries and retries failed ones.
+type Worker struct {
+	Store    Store
+	Client   *http.Client
+	Retry    Retry
+	Interval time.Duration
+	Lease    time.Duration
+	Logger   log.Logger
+}
+
+// Run sends due deliveries every Interval until the context is canceled.
+func (w *Worker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		w.sendDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendDue sends all deliveries due now.
+func (w *Worker) sendDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		t, ok, err := w.Store.ClaimDelivery(ctx, time.Now(), w.Lease)
+		if err != nil {
+			level.Error(w.Logger).Log("msg", "failed to claim delivery", "err", err)
+			return
+		}
+		if !ok {
+			return
+		}
+
+		status, sendErr := w.send(ctx, t.Subscription, t.Event, time.Now())
+		d := t.Delivery.Complete(time.Now(), status, sendErr, w.Retry)
+		if err := w.Store.CompleteDelivery(ctx, d); err != nil {
+			level.Error(w.Logger).Log("msg", "failed to complete delivery", "delivery", d.ID, "err", err)
+			return
+		}
+		switch d.Status {
+		case Dead:
+			level.Warn(w.Logger).Log("msg", "webhook delivery is dead", "delivery", d.ID,
+				"subscription", d.SubscriptionID, "attempts", d.Attempts, "err", d.LastError)
+		case Pending:
+			level.Info(w.Logger).Log("msg", "webhook delivery failed", "delivery", d.ID,
+				"subscription", d.SubscriptionID, "attempts", d.Attempts, "err", d.LastError)
+		}
+	}
+}
+
+// send posts the signed event to the subscription URL and returns the response status.
+func (w *Worker) send(ctx context.Context, sub Subscription, e event.Event, now time.Time) (int, error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode event: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create delivery request: %w", err)
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(event.EventIDHeader, strconv.FormatUint(e.ID, 10))
+	req.Header.Set(event.EventTypeHeader, string(e.Type))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, timestamp, body))
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,119 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/donmikel/coins/pkg/event"
+)
+
+// MinSecretLen is the minimum length of a subscription secret.
+const MinSecretLen = 16
+
+// DeliveryLogSize is the number of the latest deliveries returned in the delivery log.
+const DeliveryLogSize = 100
+
+// Subscription delivers events of the account payments and holds to the URL.
+// Deliveries are signed with the secret, which is never returned by the API.
+type Subscription struct {
+	ID        uint64    `json:"id" db:"id"`
+	AccountID string    `json:"account_id" db:"account_id"`
+	URL       string    `json:"url" db:"url"`
+	Secret    string    `json:"-" db:"secret"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// SubscriptionInput is an input structure used to register a webhook subscription.
+type SubscriptionInput struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+}
+
+// Validate validates the given SubscriptionInput structure
+func (s SubscriptionInput) Validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("URL must be an absolute http or https URL")
+	}
+	if len(s.Secret) < MinSecretLen {
+		return fmt.Errorf("Secret is shorter than %d characters", MinSecretLen)
+	}
+
+	return nil
+}
+
+// DeliveryStatus is a delivery status.
+type DeliveryStatus string
+
+// Delivery statuses. A pending delivery is attempted until it is delivered
+// or runs out of attempts and becomes dead.
+const (
+	Pending   DeliveryStatus = "pending"
+	Delivered DeliveryStatus = "delivered"
+	Dead      DeliveryStatus = "dead"
+)
+
+// Delivery is a delivery of an event to a subscription.
+type Delivery struct {
+	ID             uint64         `json:"id" db:"id"`
+	SubscriptionID uint64         `json:"subscription_id" db:"subscription_id"`
+	EventID        uint64         `json:"event_id" db:"event_id"`
+	EventType      event.Type     `json:"event_type" db:"event_type"`
+	Status         DeliveryStatus `json:"status" db:"status"`
+	Attempts       int            `json:"attempts" db:"attempts"`
+	NextAttempt    *time.Time     `json:"next_attempt,omitempty" db:"next_attempt"`
+	LastAttempt    *time.Time     `json:"last_attempt,omitempty" db:"last_attempt"`
+	ResponseStatus int            `json:"response_status,omitempty" db:"response_status"`
+	LastError      string         `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt      time.Time      `json:"created_at" db:"created_at"`
+}
+
+// Retry is a retry policy of failed deliveries, the delay doubles after every
+// failed attempt up to MaxDelay.
+type Retry struct {
+	MaxAttempts int
+	Delay       time.Duration
+	MaxDelay    time.Duration
+}
+
+// Backoff returns the delay after the given number of failed attempts.
+func (r Retry) Backoff(attempts int) time.Duration {
+	delay := r.Delay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if r.MaxDelay > 0 && delay >= r.MaxDelay {
+			return r.MaxDelay
+		}
+	}
+
+	return delay
+}
+
+// Complete returns the delivery updated with the result of the attempt at now,
+// status is the HTTP status of the response or zero if there was no response.
+func (d Delivery) Complete(now time.Time, status int, sendErr error, retry Retry) Delivery {
+	now = now.UTC()
+	d.Attempts++
+	d.LastAttempt = &now
+	d.ResponseStatus = status
+	d.NextAttempt = nil
+	if sendErr == nil {
+		d.Status = Delivered
+		d.LastError = ""
+		return d
+	}
+
+	d.LastError = sendErr.Error()
+	if d.Attempts >= retry.MaxAttempts {
+		d.Status = Dead
+		return d
+	}
+	next := now.Add(retry.Backoff(d.Attempts))
+	d.NextAttempt = &next
+	return d
+}
@@ -0,0 +1,146 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/donmikel/coins/pkg/event"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionInputValidate(t *testing.T) {
+	secret := "0123456789abcdef"
+	assert.NoError(t, SubscriptionInput{URL: "https://example.com/hooks", Secret: secret}.Validate())
+	assert.Error(t, SubscriptionInput{URL: "/hooks", Secret: secret}.Validate())
+	assert.Error(t, SubscriptionInput{URL: "ftp://example.com", Secret: secret}.Validate())
+	assert.Error(t, SubscriptionInput{URL: "https://example.com/hooks", Secret: "short"}.Validate())
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":1}`)
+	signature := Sign("secret", 1608890400, body)
+
+	// echo -n '1608890400.{"id":1}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=ee1090043627dee6dc18b3e5b1bc64f33afac402ba638a142f5bc161dce0db1a", signature)
+	assert.True(t, Verify("secret", 1608890400, body, signature))
+	assert.False(t, Verify("secret", 1608890401, body, signature))
+	assert.False(t, Verify("other", 1608890400, body, signature))
+}
+
+func TestRetryBackoff(t *testing.T) {
+	r := Retry{MaxAttempts: 10, Delay: time.Second, MaxDelay: 5 * time.Second}
+	assert.Equal(t, time.Second, r.Backoff(1))
+	assert.Equal(t, 2*time.Second, r.Backoff(2))
+	assert.Equal(t, 4*time.Second, r.Backoff(3))
+	assert.Equal(t, 5*time.Second, r.Backoff(4))
+	assert.Equal(t, 5*time.Second, r.Backoff(40))
+}
+
+func TestComplete(t *testing.T) {
+	now := time.Date(2020, 12, 25, 10, 0, 0, 0, time.UTC)
+	retry := Retry{MaxAttempts: 2, Delay: time.Minute}
+	d := Delivery{ID: 1, Status: Pending}
+
+	d = d.Complete(now, http.StatusBadGateway, errors.New("webhook returned status 502"), retry)
+	assert.Equal(t, Pending, d.Status)
+	assert.Equal(t, 1, d.Attempts)
+	if assert.NotNil(t, d.NextAttempt) {
+		assert.Equal(t, now.Add(time.Minute), *d.NextAttempt)
+	}
+
+	dead := d.Complete(now, 0, errors.New("connection refused"), retry)
+	assert.Equal(t, Dead, dead.Status)
+	assert.Nil(t, dead.NextAttempt)
+
+	delivered := d.Complete(now, http.StatusOK, nil, retry)
+	assert.Equal(t, Delivered, delivered.Status)
+	assert.Empty(t, delivered.LastError)
+	assert.Nil(t, delivered.NextAttempt)
+}
+
+type mockEnqueuer struct {
+	accounts []string
+}
+
+func (m *mockEnqueuer) EnqueueDeliveries(ctx context.Context, e event.Event, accounts []string) (n int64, err error) {
+	m.accounts = accounts
+	return int64(len(accounts)), nil
+}
+
+func TestFanout(t *testing.T) {
+	enqueuer := &mockEnqueuer{}
+	f := &Fanout{Enqueuer: enqueuer}
+
+	e, err := event.New(event.PaymentCreated, map[string]string{"from_account": "bob123", "to_account": "alice456"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, f.Publish(context.Background(), e))
+	assert.Equal(t, []string{"bob123", "alice456"}, enqueuer.accounts)
+}
+
+type mockStore struct {
+	tasks     []Task
+	completed []Delivery
+}
+
+func (m *mockStore) ClaimDelivery(ctx context.Context, now time.Time, lease time.Duration) (t Task, ok bool, err error) {
+	if len(m.tasks) == 0 {
+		return t, false, nil
+	}
+	t, m.tasks = m.tasks[0], m.tasks[1:]
+	return t, true, nil
+}
+
+func (m *mockStore) CompleteDelivery(ctx context.Context, d Delivery) (err error) {
+	m.completed = append(m.completed, d)
+	return nil
+}
+
+func TestWorker(t *testing.T) {
+	secret := "0123456789abcdef"
+	var verified bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+		verified = Verify(secret, timestamp, body, r.Header.Get(SignatureHeader))
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	e := event.Event{ID: 7, Type: event.PaymentCreated, Payload: []byte(`{"id":1}`)}
+	store := &mockStore{tasks: []Task{
+		{Delivery: Delivery{ID: 1, Status: Pending}, Subscription: Subscription{URL: server.URL + "/up", Secret: secret}, Event: e},
+		{Delivery: Delivery{ID: 2, Status: Pending}, Subscription: Subscription{URL: server.URL + "/down", Secret: secret}, Event: e},
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Worker{
+		Store:    store,
+		Retry:    Retry{MaxAttempts: 3, Delay: time.Minute},
+		Interval: time.Hour,
+		Lease:    time.Minute,
+		Logger:   log.NewNopLogger(),
+	}
+	cancel()
+
+	assert.NoError(t, w.Run(ctx))
+	// The canceled worker sends nothing.
+	assert.Empty(t, store.completed)
+
+	w.sendDue(context.Background())
+	assert.True(t, verified)
+	if assert.Len(t, store.completed, 2) {
+		assert.Equal(t, Delivered, store.completed[0].Status)
+		assert.Equal(t, Pending, store.completed[1].Status)
+		assert.Equal(t, http.StatusServiceUnavailable, store.completed[1].ResponseStatus)
+	}
+}